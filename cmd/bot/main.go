@@ -41,17 +41,26 @@ func main() {
 	defer cancel()
 
 	// Запускаем бота в горутине
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		if err := bot.Start(ctx); err != nil {
 			logger.Errorf("Bot error: %v", err)
 		}
 	}()
 
-	// Ждем сигнала для graceful shutdown
+	// Ждем сигнала для graceful shutdown или остановки самого бота
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
-
-	logger.Info("Shutting down...")
+	select {
+	case sig := <-sigChan:
+		logger.Infof("Received %v, shutting down...", sig)
+	case <-stopped:
+		logger.Info("Bot stopped on its own, shutting down...")
+	}
 	cancel()
+
+	// Ждем, пока бот доделает обработчики, таймеры и отправку сообщений, и только потом закрываем базу
+	<-stopped
+	logger.Info("Closing database")
 } 
\ No newline at end of file
@@ -0,0 +1,218 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"leo-bot/internal/database"
+	"leo-bot/internal/models"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	adjustUsage    = "❌ Использование: /adjust @username calories|cups|streak <+N|-N> <причина>\n\nНапример: /adjust @leo cups +1 бот пропустил отчет за 17.10\nСерия для калорий сдвигается вместе с серией\nВместо @username можно указать id:<ID> или ответить командой на сообщение участника"
+	setStreakUsage = "❌ Использование: /set_streak @username <N> <YYYY-MM-DD> [причина]\n\nДата — день последней тренировки, от нее продолжится серия\nСерия для калорий сдвигается на ту же разницу\nВместо @username можно указать id:<ID> или ответить командой на сообщение участника"
+)
+
+// maxAdjustDelta — максимальное изменение за одну ручную корректировку
+const maxAdjustDelta = 100000
+
+// adjustCurrencyTitles — названия того, что можно скорректировать через /adjust
+var adjustCurrencyTitles = map[string]string{
+	models.CurrencyCalories: "калории",
+	models.CurrencyCups:     "кубки",
+	models.CurrencyStreak:   "серия",
+}
+
+// adjustment — разобранные аргументы /adjust
+type adjustment struct {
+	Currency string
+	Delta    int
+	Reason   string
+}
+
+// parseAdjustArgs разбирает аргументы /adjust после участника: что меняем, изменение со знаком и причина
+func parseAdjustArgs(args []string) (adjustment, error) {
+	if len(args) < 3 {
+		return adjustment{}, fmt.Errorf("expected currency, delta and reason")
+	}
+
+	currency := strings.ToLower(args[0])
+	if _, ok := adjustCurrencyTitles[currency]; !ok {
+		return adjustment{}, fmt.Errorf("unknown currency: %s", args[0])
+	}
+
+	// Знак обязателен, чтобы "/adjust @leo cups 5" не путали с установкой значения
+	if !strings.HasPrefix(args[1], "+") && !strings.HasPrefix(args[1], "-") {
+		return adjustment{}, fmt.Errorf("delta must be signed: %s", args[1])
+	}
+	delta, err := strconv.Atoi(args[1])
+	if err != nil || delta == 0 || delta > maxAdjustDelta || delta < -maxAdjustDelta {
+		return adjustment{}, fmt.Errorf("invalid delta: %s", args[1])
+	}
+
+	return adjustment{
+		Currency: currency,
+		Delta:    delta,
+		Reason:   strings.Join(args[2:], " "),
+	}, nil
+}
+
+// streakChange — разобранные аргументы /set_streak
+type streakChange struct {
+	StreakDays       int
+	LastTrainingDate string
+	Reason           string
+}
+
+// parseSetStreakArgs разбирает аргументы /set_streak после участника: серия, дата последней тренировки и причина.
+// Дата не может быть позже сегодняшней
+func parseSetStreakArgs(args []string, now time.Time) (streakChange, error) {
+	if len(args) < 2 {
+		return streakChange{}, fmt.Errorf("expected streak and last training date")
+	}
+
+	streakDays, err := strconv.Atoi(args[0])
+	if err != nil || streakDays < 0 || streakDays > maxAdjustDelta {
+		return streakChange{}, fmt.Errorf("invalid streak: %s", args[0])
+	}
+
+	lastDay, err := utils.ParseMoscowDate(args[1])
+	if err != nil {
+		return streakChange{}, fmt.Errorf("invalid date: %s", args[1])
+	}
+	if lastDay.After(now) {
+		return streakChange{}, fmt.Errorf("last training date is in the future: %s", args[1])
+	}
+
+	return streakChange{
+		StreakDays:       streakDays,
+		LastTrainingDate: utils.GetMoscowDateFromTime(lastDay),
+		Reason:           strings.Join(args[2:], " "),
+	}, nil
+}
+
+// handleAdjust вручную меняет калории, кубки или серию участника через журнал начислений
+func (b *Bot) handleAdjust(msg *tgbotapi.Message) {
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	target, args, ok := b.resolveTarget(msg, strings.Fields(msg.CommandArguments()), adjustUsage)
+	if !ok {
+		return
+	}
+	userID := target.UserID
+
+	adj, err := parseAdjustArgs(args)
+	if err != nil {
+		reply := b.newReply(msg, adjustUsage)
+		b.post(reply)
+		return
+	}
+
+	messageLog, err := b.db.GetMessageLog(userID, msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get message log: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных пользователя")
+		b.post(reply)
+		return
+	}
+
+	title := adjustCurrencyTitles[adj.Currency]
+	value, err := b.db.AdjustBalance(userID, msg.Chat.ID, adj.Currency, adj.Delta, models.LedgerReasonAdminAdjust)
+	if errors.Is(err, database.ErrNegativeBalance) {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Нельзя уйти в минус: у %s сейчас %s %d", messageLog.Username, title, value))
+		b.post(reply)
+		return
+	}
+	if err != nil {
+		b.logger.Errorf("Failed to adjust %s of user %d by %d: %v", adj.Currency, userID, adj.Delta, err)
+		reply := b.newReply(msg, "❌ Ошибка при сохранении данных")
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("User %d adjusted %s of user %d in chat %d by %d: %s", msg.From.ID, adj.Currency, userID, msg.Chat.ID, adj.Delta, adj.Reason)
+	b.auditAdmin(msg, models.AuditAdjust, userID, messageLog.Username,
+		fmt.Sprintf("%s %+d (%d → %d): %s", title, adj.Delta, value-adj.Delta, value, adj.Reason))
+
+	calorieStreak := ""
+	if adj.Currency == models.CurrencyStreak {
+		calorieStreak = b.calorieStreakChange(userID, msg.Chat.ID, messageLog.CalorieStreakDays)
+	}
+	reply := b.newReply(msg, fmt.Sprintf("✅ %s: %s %+d → %d%s\n📝 Причина: %s", messageLog.Username, title, adj.Delta, value, calorieStreak, adj.Reason))
+	b.post(reply)
+}
+
+// handleSetStreak устанавливает серию тренировок участника и дату последней тренировки
+func (b *Bot) handleSetStreak(msg *tgbotapi.Message) {
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	target, args, ok := b.resolveTarget(msg, strings.Fields(msg.CommandArguments()), setStreakUsage)
+	if !ok {
+		return
+	}
+	userID := target.UserID
+
+	change, err := parseSetStreakArgs(args, utils.GetMoscowTime())
+	if err != nil {
+		reply := b.newReply(msg, setStreakUsage)
+		b.post(reply)
+		return
+	}
+
+	messageLog, err := b.db.GetMessageLog(userID, msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get message log: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных пользователя")
+		b.post(reply)
+		return
+	}
+
+	previous, err := b.db.SetStreak(userID, msg.Chat.ID, change.StreakDays, change.LastTrainingDate, models.LedgerReasonSetStreak)
+	if err != nil {
+		b.logger.Errorf("Failed to set streak of user %d: %v", userID, err)
+		reply := b.newReply(msg, "❌ Ошибка при сохранении данных")
+		b.post(reply)
+		return
+	}
+
+	reason := change.Reason
+	if reason == "" {
+		reason = "без комментария"
+	}
+
+	b.logger.Infof("User %d set streak of user %d in chat %d: %d -> %d (last training %s)", msg.From.ID, userID, msg.Chat.ID, previous, change.StreakDays, change.LastTrainingDate)
+	b.auditAdmin(msg, models.AuditSetStreak, userID, messageLog.Username,
+		fmt.Sprintf("серия %d → %d, последняя тренировка %s: %s", previous, change.StreakDays, change.LastTrainingDate, reason))
+
+	reply := b.newReply(msg, fmt.Sprintf("✅ %s: серия %d → %d дней, последняя тренировка %s%s\n📝 Причина: %s",
+		messageLog.Username, previous, change.StreakDays, change.LastTrainingDate,
+		b.calorieStreakChange(userID, msg.Chat.ID, messageLog.CalorieStreakDays), reason))
+	b.post(reply)
+}
+
+// calorieStreakChange описывает, как сдвинулась серия для калорий вместе с серией тренировок.
+// Серии различаются: после обмена калорий на кубок серия для калорий начинается заново
+func (b *Bot) calorieStreakChange(userID, chatID int64, before int) string {
+	messageLog, err := b.db.GetMessageLog(userID, chatID)
+	if err != nil {
+		b.logger.Errorf("Failed to get calorie streak of user %d: %v", userID, err)
+		return ""
+	}
+	return fmt.Sprintf("\n🔥 Серия для калорий: %d → %d", before, messageLog.CalorieStreakDays)
+}
@@ -0,0 +1,227 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const auditUsage = "❌ Использование: /audit [@участник|id:<ID>] [by @админ] [действие] [Nd]\n\n" +
+	"Например: /audit @leo 30d или /audit removal\n\n" +
+	"Действия: "
+
+// auditDaysPattern — фильтр по давности записей, например 7d
+var auditDaysPattern = regexp.MustCompile(`^(\d+)d$`)
+
+// auditQuery — разобранные аргументы /audit
+type auditQuery struct {
+	Target string
+	Actor  string
+	Action string
+	Days   int
+}
+
+// parseAuditArgs разбирает аргументы /audit: @участник или id:<ID>, by @админ, действие и давность в днях.
+// Каждый фильтр можно указать не больше одного раза
+func parseAuditArgs(args []string) (auditQuery, error) {
+	var query auditQuery
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case strings.EqualFold(arg, "by"):
+			if i+1 >= len(args) || query.Actor != "" {
+				return auditQuery{}, fmt.Errorf("by requires a single username")
+			}
+			i++
+			query.Actor = args[i]
+		case strings.HasPrefix(arg, "@") || strings.HasPrefix(strings.ToLower(arg), targetIDPrefix):
+			if query.Target != "" {
+				return auditQuery{}, fmt.Errorf("duplicate target: %s", arg)
+			}
+			query.Target = arg
+		case auditDaysPattern.MatchString(arg):
+			days, _ := strconv.Atoi(auditDaysPattern.FindStringSubmatch(arg)[1])
+			if days <= 0 || query.Days != 0 {
+				return auditQuery{}, fmt.Errorf("invalid period: %s", arg)
+			}
+			query.Days = days
+		case isAuditAction(arg):
+			if query.Action != "" {
+				return auditQuery{}, fmt.Errorf("duplicate action: %s", arg)
+			}
+			query.Action = strings.ToLower(arg)
+		default:
+			return auditQuery{}, fmt.Errorf("unknown filter: %s", arg)
+		}
+	}
+
+	if query.Actor != "" && !strings.HasPrefix(query.Actor, "@") {
+		query.Actor = "@" + query.Actor
+	}
+	return query, nil
+}
+
+// isAuditAction проверяет, что действие есть в журнале аудита
+func isAuditAction(action string) bool {
+	for _, known := range models.AuditActions {
+		if strings.EqualFold(action, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordAudit сохраняет запись журнала аудита. Ошибка записи не прерывает само действие
+func (b *Bot) recordAudit(entry *models.AuditEntry) {
+	if err := b.db.AddAuditEntry(entry); err != nil {
+		b.logger.Errorf("Failed to record audit entry %s in chat %d: %v", entry.Action, entry.ChatID, err)
+	}
+}
+
+// auditAdmin записывает действие администратора вместе с аргументами команды
+func (b *Bot) auditAdmin(msg *tgbotapi.Message, action string, targetID int64, targetName, reason string) {
+	b.recordAudit(&models.AuditEntry{
+		ChatID:       msg.Chat.ID,
+		ActorID:      msg.From.ID,
+		ActorName:    getUserDisplayName(msg.From),
+		Action:       action,
+		TargetUserID: targetID,
+		TargetName:   targetName,
+		Arguments:    msg.CommandArguments(),
+		Reason:       reason,
+	})
+}
+
+// auditSystem записывает автоматическое действие бота с рассчитанной причиной
+func (b *Bot) auditSystem(chatID int64, action string, targetID int64, targetName, reason string) {
+	b.recordAudit(&models.AuditEntry{
+		ChatID:       chatID,
+		Action:       action,
+		TargetUserID: targetID,
+		TargetName:   targetName,
+		Reason:       reason,
+	})
+}
+
+// formatAuditDuration описывает длительность в днях и часах
+func formatAuditDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	hours := int(d.Hours())
+	return fmt.Sprintf("%dд %dч", hours/24, hours%24)
+}
+
+// inactivityReason объясняет, почему участник получил предупреждение или был удален:
+// когда запущен таймер, когда был последний отчет и сколько времени таймер шел без учета пауз
+func (b *Bot) inactivityReason(userID, chatID int64) string {
+	messageLog, err := b.db.GetMessageLog(userID, chatID)
+	if err != nil {
+		return "нет данных об участнике"
+	}
+
+	lastReport := "отчетов не было"
+	if messageLog.LastTrainingDate != nil {
+		lastReport = "последний отчет " + *messageLog.LastTrainingDate
+	}
+
+	if messageLog.TimerStartTime == nil {
+		return lastReport + ", время старта таймера не записано"
+	}
+	timerStart, err := utils.ParseMoscowTime(*messageLog.TimerStartTime)
+	if err != nil {
+		return lastReport + ", время старта таймера не читается: " + *messageLog.TimerStartTime
+	}
+
+	now := utils.GetMoscowTime()
+	pauses := b.storedPauses(userID, chatID, timerStart, now)
+	active := activeTimeSince(timerStart, now, pauses)
+	return fmt.Sprintf("%s, таймер запущен %s, без отчета %s (паузы: %s)",
+		lastReport, utils.FormatMoscowDateTime(timerStart), formatAuditDuration(active), formatAuditDuration(now.Sub(timerStart)-active))
+}
+
+// formatAuditEntry описывает запись журнала для /audit
+func formatAuditEntry(e *models.AuditEntry) string {
+	actor := "🤖 бот"
+	if e.ActorID != 0 {
+		actor = "👮 " + e.ActorName
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("#%d %s · %s · %s", e.ID, utils.FormatMoscowDateTime(e.CreatedAt), actor, e.Action))
+	if e.TargetName != "" {
+		sb.WriteString(" → " + e.TargetName)
+	}
+	if e.Arguments != "" {
+		sb.WriteString("\n   аргументы: " + e.Arguments)
+	}
+	if e.Reason != "" {
+		sb.WriteString("\n   причина: " + e.Reason)
+	}
+	return sb.String()
+}
+
+// handleAudit показывает журнал аудита чата с фильтрами
+func (b *Bot) handleAudit(msg *tgbotapi.Message) {
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	query, err := parseAuditArgs(strings.Fields(msg.CommandArguments()))
+	if err != nil {
+		reply := b.newReply(msg, auditUsage+strings.Join(models.AuditActions, ", "))
+		b.post(reply)
+		return
+	}
+
+	filter := models.AuditFilter{
+		ChatID:    msg.Chat.ID,
+		ActorName: query.Actor,
+	}
+	if query.Action != "" {
+		filter.Actions = []string{query.Action}
+	}
+	if query.Days > 0 {
+		filter.Since = utils.GetMoscowTime().AddDate(0, 0, -query.Days)
+	}
+	if query.Target != "" {
+		target, ok := b.resolveTargetArg(msg, query.Target)
+		if !ok {
+			return
+		}
+		filter.TargetUserID = target.UserID
+	}
+
+	entries, err := b.db.GetAuditEntries(filter)
+	if err != nil {
+		b.logger.Errorf("Failed to get audit entries for chat %d: %v", msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении журнала")
+		b.post(reply)
+		return
+	}
+
+	if len(entries) == 0 {
+		reply := b.newReply(msg, "📜 В журнале нет подходящих записей")
+		b.post(reply)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📜 Журнал действий (последние %d):\n", len(entries)))
+	for _, entry := range entries {
+		sb.WriteString("\n" + formatAuditEntry(entry) + "\n")
+	}
+
+	reply := b.newReply(msg, sb.String())
+	b.post(reply)
+}
@@ -2,26 +2,78 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"leo-bot/internal/config"
 	"leo-bot/internal/database"
+	"leo-bot/internal/dispatch"
+	"leo-bot/internal/hashtags"
 	"leo-bot/internal/logger"
 	"leo-bot/internal/models"
+	"leo-bot/internal/outbox"
+	"leo-bot/internal/state"
 	"leo-bot/internal/utils"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 type Bot struct {
-	api    *tgbotapi.BotAPI
+	api    *telegramAPI
 	db     *database.Database
 	logger logger.Logger
 	config *config.Config
-	timers map[int64]*models.TimerInfo
+
+	// dispatcher обрабатывает обновления: одного участника в чате — по очереди, разных — параллельно
+	dispatcher *dispatch.Dispatcher
+
+	// timers — таймеры неактивности. Обновления обрабатываются параллельно, поэтому доступ только под timersMu
+	timersMu sync.Mutex
+	timers   map[timerKey]*models.TimerInfo
+
+	// messageThreads — темы форума сообщений, которые сейчас обрабатываются (*tgbotapi.Message -> int)
+	messageThreads sync.Map
+
+	// privateReports — отчеты из лички, для которых участник выбирает группу (ID участника -> *tgbotapi.Message)
+	privateReports sync.Map
+
+	// timerActions — выполняющиеся предупреждения и удаления по таймерам. После timersStopped новые не начинаются:
+	// таймеры восстановятся из БД при следующем запуске
+	timerActions   sync.WaitGroup
+	timerActionsMu sync.Mutex
+	timersStopped  bool
+
+	// ctx — контекст работы бота из Start, отменяется в начале остановки
+	ctx context.Context
+	// handoffs — горутины, которые ставят в очередь диспетчера отчеты из лички. Остановка дожидается их
+	// после закрытия диспетчера: новые они запускают только из его задач
+	handoffs sync.WaitGroup
+
+	// shutdownTimeout — сколько Start ждет завершения начатой работы после отмены контекста
+	shutdownTimeout time.Duration
+
+	// chatMigrationMu — о миграции в супергруппу Telegram сообщает и в старый, и в новый чат
+	chatMigrationMu sync.Mutex
+
+	// clock возвращает текущее московское время для расчета серий и таймеров; nil — utils.GetMoscowTime
+	clock func() time.Time
+}
+
+// dispatchWorkers и dispatchQueueSize — сколько обновлений обрабатывается одновременно и сколько может ждать.
+// Когда очередь заполнена, бот перестает забирать обновления у Telegram
+const (
+	dispatchWorkers   = 16
+	dispatchQueueSize = 1000
+)
+
+// timerKey — таймер идет у участника в конкретном чате: один человек может состоять в нескольких чатах
+type timerKey struct {
+	ChatID int64
+	UserID int64
 }
 
 func New(cfg *config.Config, db *database.Database, log logger.Logger) (*Bot, error) {
@@ -35,41 +87,162 @@ func New(cfg *config.Config, db *database.Database, log logger.Logger) (*Bot, er
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
-	return &Bot{
-		api:    api,
+	b := &Bot{
+		api:    &telegramAPI{BotAPI: api, outbox: outbox.New(outbox.DefaultConfig(), log)},
 		db:     db,
 		logger: log,
 		config: cfg,
-		timers: make(map[int64]*models.TimerInfo),
-	}, nil
+		timers: make(map[timerKey]*models.TimerInfo),
+
+		dispatcher: dispatch.New(dispatchWorkers, dispatchQueueSize, log),
+
+		shutdownTimeout: defaultShutdownTimeout,
+	}
+	b.api.announceTopic = b.announceTopic
+
+	return b, nil
 }
 
+// Start получает и обрабатывает обновления, пока не будет отменен контекст. Возвращается только после того,
+// как обработчики, планировщик, таймеры и очередь отправки закончат начатое или выйдет shutdownTimeout
 func (b *Bot) Start(ctx context.Context) error {
 	b.logger.Info("Starting bot...")
 
+	// Свой контекст, чтобы остановить планировщик и прием обновлений, если Start завершится сам
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	b.ctx = ctx
+
 	// Восстанавливаем таймеры из базы данных
 	if err := b.recoverTimersFromDatabase(); err != nil {
 		b.logger.Errorf("Failed to recover timers from database: %v", err)
 		// Не останавливаем бота, просто логируем ошибку
 	}
 
+	// Публикуем меню команд для участников, администраторов и владельца
+	b.registerCommands()
+
+	// Запускаем планировщик периодических задач (сезоны и т.п.)
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		b.runScheduler(ctx)
+	}()
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
-
-	updates := b.api.GetUpdatesChan(u)
+	u.AllowedUpdates = allowedUpdates
+
+	var updates <-chan incomingUpdate
+	if b.config.WebhookURL != "" {
+		var err error
+		if updates, err = b.webhookUpdates(ctx, u.AllowedUpdates); err != nil {
+			cancel()
+			b.shutdown(schedulerDone)
+			return fmt.Errorf("failed to start webhook: %w", err)
+		}
+	} else {
+		// Пока у бота задан webhook, Telegram не отдает обновления через getUpdates
+		if err := b.api.deleteWebhook(); err != nil {
+			b.logger.Errorf("Failed to delete webhook: %v", err)
+		}
+		updates = b.pollUpdates(ctx, u)
+	}
 
 	for {
 		select {
-		case update := <-updates:
-			go b.handleUpdate(update)
+		case update, ok := <-updates:
+			if !ok {
+				if ctx.Err() != nil {
+					return b.shutdown(schedulerDone)
+				}
+				cancel()
+				if err := b.shutdown(schedulerDone); err != nil {
+					b.logger.Errorf("%v", err)
+				}
+				return errors.New("updates channel closed")
+			}
+			// Полученное обновление уже подтверждено Telegram, поэтому ставим его в очередь и во время остановки:
+			// shutdown закроет диспетчер только после этого и дождется его обработки
+			if err := b.dispatcher.Submit(context.WithoutCancel(ctx), updateKey(update.Update), func() { b.handleIncoming(update) }); err != nil {
+				b.logger.Infof("Update %d not handled: %v", update.Update.UpdateID, err)
+			}
 		case <-ctx.Done():
-			b.logger.Info("Bot stopped")
-			return nil
+			return b.shutdown(schedulerDone)
+		}
+	}
+}
+
+// updateKey возвращает ключ, по которому обновления обрабатываются по очереди: изменения одного участника
+// в одном чате (отчет, больничный, выход) читают и пишут одну строку message_log
+func updateKey(update tgbotapi.Update) dispatch.Key {
+	switch {
+	case update.Message != nil:
+		key := dispatch.Key{ChatID: update.Message.Chat.ID}
+		if update.Message.From != nil {
+			key.UserID = update.Message.From.ID
+		}
+		// Вход и выход касаются участника, а не того, кто его добавил или удалил
+		if update.Message.LeftChatMember != nil {
+			key.UserID = update.Message.LeftChatMember.ID
+		}
+		if len(update.Message.NewChatMembers) == 1 {
+			key.UserID = update.Message.NewChatMembers[0].ID
+		}
+		return key
+	case update.CallbackQuery != nil:
+		// Кнопка делает то же, что сообщение участника, и должна идти в одной очереди с его сообщениями
+		key := dispatch.Key{UserID: update.CallbackQuery.From.ID}
+		if update.CallbackQuery.Message != nil && update.CallbackQuery.Message.Chat != nil {
+			key.ChatID = update.CallbackQuery.Message.Chat.ID
 		}
+		return key
+	case update.ChatMember != nil:
+		key := dispatch.Key{ChatID: update.ChatMember.Chat.ID}
+		if update.ChatMember.NewChatMember.User != nil {
+			key.UserID = update.ChatMember.NewChatMember.User.ID
+		}
+		return key
+	case update.MyChatMember != nil:
+		// Права бота касаются всего чата
+		return dispatch.Key{ChatID: update.MyChatMember.Chat.ID}
 	}
+	return dispatch.Key{}
 }
 
+// allowedUpdates — типы обновлений, на которые подписывается бот. chat_member Telegram присылает
+// только по явной подписке, а без него бот не видит молчащих участников
+var allowedUpdates = []string{"message", "callback_query", "chat_member", "my_chat_member"}
+
 func (b *Bot) handleUpdate(update tgbotapi.Update) {
+	// Бота добавили в чат, удалили или изменили его права
+	if update.MyChatMember != nil {
+		b.handleMyChatMemberUpdate(update.MyChatMember)
+		return
+	}
+
+	// Вступления и выходы участников, включая молчащих
+	if update.ChatMember != nil {
+		b.handleChatMemberUpdate(update.ChatMember)
+		return
+	}
+
+	// Нажатия кнопок участника
+	if update.CallbackQuery != nil {
+		b.handleCallbackQuery(update.CallbackQuery)
+		return
+	}
+
+	// Группа стала супергруппой и сменила ID
+	if update.Message != nil && update.Message.MigrateToChatID != 0 {
+		b.handleChatMigration(update.Message.Chat.ID, update.Message.MigrateToChatID)
+		return
+	}
+	if update.Message != nil && update.Message.MigrateFromChatID != 0 {
+		b.handleChatMigration(update.Message.MigrateFromChatID, update.Message.Chat.ID)
+		return
+	}
+
 	// Обрабатываем добавление новых участников
 	if update.Message != nil && len(update.Message.NewChatMembers) > 0 {
 		b.handleNewChatMembers(update.Message)
@@ -80,9 +253,21 @@ func (b *Bot) handleUpdate(update tgbotapi.Update) {
 		return
 	}
 
+	// Участник вышел сам (или его удалили — тогда состояние уже removed)
+	if update.Message.LeftChatMember != nil {
+		b.handleLeftChatMember(update.Message)
+		return
+	}
+
 	msg := update.Message
 	b.logger.Infof("Received message from %d: %s", msg.From.ID, msg.Text)
 
+	// Личка с ботом: статус по всем группам и отчеты для них
+	if msg.Chat.IsPrivate() {
+		b.handlePrivateMessage(msg)
+		return
+	}
+
 	// Обрабатываем команды
 	if msg.IsCommand() {
 		b.handleCommand(msg)
@@ -93,38 +278,6 @@ func (b *Bot) handleUpdate(update tgbotapi.Update) {
 	b.handleMessage(msg)
 }
 
-func (b *Bot) handleCommand(msg *tgbotapi.Message) {
-	command := msg.Command()
-	_ = msg.CommandArguments() // Игнорируем аргументы пока
-
-	switch command {
-	case "start":
-		b.handleStart(msg)
-	case "start_timer":
-		b.handleStartTimer(msg)
-	case "help":
-		b.handleHelp(msg)
-	case "db":
-		b.handleDB(msg)
-	case "top":
-		b.handleTop(msg)
-	case "points":
-		b.handlePoints(msg)
-	case "cups":
-		b.handleCups(msg)
-	case "set_exempt":
-		b.handleSetExempt(msg)
-	case "remove_exempt":
-		b.handleRemoveExempt(msg)
-	case "list_users":
-		b.handleListUsers(msg)
-	case "send_to_chat":
-		b.handleSendToChat(msg)
-	default:
-		b.logger.Warnf("Unknown command: %s", command)
-	}
-}
-
 func (b *Bot) handleNewChatMembers(msg *tgbotapi.Message) {
 	// Отправляем приветственное сообщение для каждого нового участника
 	for _, newMember := range msg.NewChatMembers {
@@ -146,6 +299,8 @@ func (b *Bot) handleNewChatMembers(msg *tgbotapi.Message) {
 			username = fmt.Sprintf("User%d", newMember.ID)
 		}
 
+		b.recordMemberEvent(msg.Chat.ID, &newMember, models.MemberEventJoin, models.MemberEventSourceMessage, msg.From.ID)
+
 		// Отправляем приветственное сообщение
 		b.sendWelcomeMessage(msg.Chat.ID, username, newMember.ID)
 	}
@@ -155,18 +310,27 @@ func (b *Bot) sendWelcomeMessage(chatID int64, username string, userID int64) {
 	// Создаем запись пользователя в БД с запущенным таймером
 	timerStartTime := utils.FormatMoscowTime(utils.GetMoscowTime())
 	messageLog := &models.MessageLog{
-		UserID:          userID,
-		ChatID:          chatID,
-		Username:        username,
-		Calories:        0,
-		StreakDays:      0,
-		CupsEarned:      0,
-		LastMessage:     timerStartTime,
-		HasTrainingDone: false,
-		HasSickLeave:    false,
-		HasHealthy:      false,
-		IsDeleted:       false,
-		TimerStartTime:  &timerStartTime, // Сразу устанавливаем время начала таймера
+		UserID:         userID,
+		ChatID:         chatID,
+		Username:       username,
+		Calories:       0,
+		StreakDays:     0,
+		CupsEarned:     0,
+		LastMessage:    timerStartTime,
+		State:          state.Active,
+		TimerStartTime: &timerStartTime, // Сразу устанавливаем время начала таймера
+	}
+
+	// Вернувшийся участник (например, помилованный через /pardon) сохраняет калории, кубки и серию —
+	// обнулить их может только администратор через /pardon @user reset. Отметки старого таймера сбрасываем
+	if existing, err := b.db.GetMessageLog(userID, chatID); err == nil {
+		existing.Username = username
+		existing.LastMessage = timerStartTime
+		existing.TimerStartTime = &timerStartTime
+		existing.SickLeaveStartTime = nil
+		existing.SickLeaveEndTime = nil
+		existing.RestTimeTillDel = nil
+		messageLog = existing
 	}
 
 	if err := b.db.SaveMessageLog(messageLog); err != nil {
@@ -175,6 +339,9 @@ func (b *Bot) sendWelcomeMessage(chatID int64, username string, userID int64) {
 		b.logger.Infof("Successfully saved new user %s (ID: %d) to database with timer start time", username, userID)
 	}
 
+	// Вернувшийся участник (удаленный или вышедший) снова в строю
+	b.setMemberState(userID, chatID, state.Active, state.ReasonJoined)
+
 	// Создаем приветственное сообщение с упоминанием пользователя
 	welcomeText := fmt.Sprintf(`%s, добро пожаловать в стаю! 🦁
 
@@ -182,11 +349,20 @@ func (b *Bot) sendWelcomeMessage(chatID int64, username string, userID int64) {
 
 💪 Отчеты о тренировке:
 • #training_done — Отправить отчет о тренировке
+• Добавляйте теги вида #run или #yoga — они засчитываются в челленджи с таким тегом
 
 🏥 Больничный:
-• #sick_leave — Взять больничный (приостанавливает таймер)
+• #sick_leave [причина] — Взять больничный (приостанавливает таймер, есть годовой лимит дней)
 • #healthy — Выздороветь (возобновляет таймер)
 
+🏖 Отпуск:
+• #vacation <с YYYY-MM-DD> <по YYYY-MM-DD> — Запланировать отпуск (таймер сам остановится и продолжится)
+• /vacation — Ваши отпуска и остаток дней
+• /vacation cancel — Отменить ближайший отпуск или выйти из текущего
+
+👏 Кудосы:
+• Ответьте #kudos на чужой отчет #training_done — автор получит +1 кубок (до 3 кудосов в день, себе нельзя)
+
 🔄 Обмен:
 • #change — Обменять калории на кубки (100 калорий = 42 кубка)
 
@@ -206,8 +382,9 @@ func (b *Bot) sendWelcomeMessage(chatID int64, username string, userID int64) {
 
 🎯 Начни прямо сейчас — отправь #training_done!`, username)
 
-	// Отправляем сообщение
+	// Отправляем сообщение с кнопками частых действий
 	reply := tgbotapi.NewMessage(chatID, welcomeText)
+	reply.ReplyMarkup = memberKeyboard(userID)
 
 	b.logger.Infof("Sending welcome message to chat %d for new user %s (ID: %d)", chatID, username, userID)
 	_, err := b.api.Send(reply)
@@ -222,16 +399,21 @@ func (b *Bot) sendWelcomeMessage(chatID int64, username string, userID int64) {
 }
 
 func (b *Bot) handleMessage(msg *tgbotapi.Message) {
-	// Проверяем наличие хештегов в тексте или подписи
-	text := msg.Text
-	if text == "" && msg.Caption != "" {
-		text = msg.Caption
-	}
+	// Проверяем хештеги в тексте или подписи с учетом псевдонимов чата
+	resolver := b.hashtagResolver(msg.Chat.ID)
+	commands, unknownTags := messageCommands(msg, resolver)
 
-	hasTrainingDone := strings.Contains(strings.ToLower(text), "#training_done")
-	hasSickLeave := strings.Contains(strings.ToLower(text), "#sick_leave")
-	hasHealthy := strings.Contains(strings.ToLower(text), "#healthy")
-	hasChange := strings.Contains(strings.ToLower(text), "#change")
+	hasTrainingDone := commands[hashtags.TrainingDone]
+	hasSickLeave := commands[hashtags.SickLeave]
+	hasHealthy := commands[hashtags.Healthy]
+	hasChange := commands[hashtags.Change]
+	hasKudos := commands[hashtags.Kudos]
+	hasVacation := commands[hashtags.Vacation]
+
+	// Если у чата есть тема для отчетов, отчеты из других тем не засчитываются
+	if hasTrainingDone && b.isOffTopicReport(msg) {
+		hasTrainingDone = false
+	}
 
 	// Получаем никнейм пользователя
 	username := ""
@@ -250,17 +432,16 @@ func (b *Bot) handleMessage(msg *tgbotapi.Message) {
 	existingLog, err := b.db.GetMessageLog(msg.From.ID, msg.Chat.ID)
 	if err != nil {
 		// Если пользователя нет в БД, создаем новую запись
+		now := utils.GetMoscowTime()
 		messageLog := &models.MessageLog{
-			UserID:          msg.From.ID,
-			ChatID:          msg.Chat.ID,
-			Username:        username,
-			Calories:        0,
-			StreakDays:      0,
-			LastMessage:     utils.FormatMoscowTime(utils.GetMoscowTime()),
-			HasTrainingDone: hasTrainingDone,
-			HasSickLeave:    hasSickLeave,
-			HasHealthy:      hasHealthy,
-			IsDeleted:       false,
+			UserID:      msg.From.ID,
+			ChatID:      msg.Chat.ID,
+			Username:    username,
+			Calories:    0,
+			StreakDays:  0,
+			LastMessage: utils.FormatMoscowTime(now),
+			State:       state.Active,
+			LastSpokeAt: &now,
 		}
 
 		if err := b.db.SaveMessageLog(messageLog); err != nil {
@@ -268,31 +449,42 @@ func (b *Bot) handleMessage(msg *tgbotapi.Message) {
 		}
 	} else {
 		// Обновляем только необходимые поля, сохраняя streak данные
+		now := utils.GetMoscowTime()
 		existingLog.Username = username
-		existingLog.LastMessage = utils.FormatMoscowTime(utils.GetMoscowTime())
-		existingLog.HasTrainingDone = hasTrainingDone
-		existingLog.HasSickLeave = hasSickLeave
-		existingLog.HasHealthy = hasHealthy
-		existingLog.IsDeleted = false
+		existingLog.LastMessage = utils.FormatMoscowTime(now)
+		existingLog.LastSpokeAt = &now
 
 		if err := b.db.SaveMessageLog(existingLog); err != nil {
 			b.logger.Errorf("Failed to update message log: %v", err)
 		}
+
+		// Пишет в чат — значит, снова в нем
+		if !existingLog.State.InChat() {
+			b.setMemberState(msg.From.ID, msg.Chat.ID, state.Active, state.ReasonMessage)
+		}
 	}
 
 	// Обрабатываем хештеги
 	if hasTrainingDone {
-		b.handleTrainingDone(msg)
+		b.handleTrainingDone(msg, unknownTags)
 	} else if hasSickLeave {
 		b.handleSickLeave(msg)
 	} else if hasHealthy {
 		b.handleHealthy(msg)
 	} else if hasChange {
 		b.handleChange(msg)
+	} else if hasKudos {
+		b.handleKudos(msg)
+	} else if hasVacation {
+		b.handleVacationTag(msg)
+	} else if len(commands) == 0 {
+		b.suggestHashtag(msg, unknownTags, resolver)
 	}
 }
 
-func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
+// handleTrainingDone засчитывает тренировку. tags — хештеги отчета (#run, #йога), которые не служебные
+// для этого чата: псевдонимы вроде #тренировка и написание #training-done в них уже не попадают
+func (b *Bot) handleTrainingDone(msg *tgbotapi.Message, tags []string) {
 	// Получаем никнейм пользователя
 	username := ""
 	if msg.From.UserName != "" {
@@ -332,7 +524,7 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 		caloriesToAdd, newStreakDays, newCalorieStreakDays, weeklyAchievement, twoWeekAchievement, threeWeekAchievement, monthlyAchievement, quarterlyAchievement)
 
 	// Начисляем калории
-	if err := b.db.AddCalories(msg.From.ID, msg.Chat.ID, caloriesToAdd); err != nil {
+	if err := b.db.AddCalories(msg.From.ID, msg.Chat.ID, caloriesToAdd, models.LedgerReasonTraining); err != nil {
 		b.logger.Errorf("Failed to add calories: %v", err)
 	} else {
 		b.logger.Infof("DEBUG: Successfully added %d calories", caloriesToAdd)
@@ -346,7 +538,7 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 			b.logger.Errorf("Failed to get updated calories: %v", err)
 		} else if updatedCalories >= 100 && updatedCalories-caloriesToAdd < 100 {
 			// Пользователь только что достиг 100 калорий
-			exchangeMessage := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🎉 Поздравляю! 🎉\n\n%s, достигнуто %d калорий!\n\n🔄 Теперь можешь совершить обмен!\n💡 Напиши #change для обмена 100 калорий на 42 кубка!", username, updatedCalories))
+			exchangeMessage := b.newReply(msg, fmt.Sprintf("🎉 Поздравляю! 🎉\n\n%s, достигнуто %d калорий!\n\n🔄 Теперь можешь совершить обмен!\n💡 Напиши #change для обмена 100 калорий на 42 кубка!", username, updatedCalories))
 
 			b.logger.Infof("Sending 100 calories achievement message to chat %d", msg.Chat.ID)
 			_, err = b.api.Send(exchangeMessage)
@@ -381,13 +573,25 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 		b.logger.Infof("DEBUG: Skipping streak update (caloriesToAdd = 0)")
 	}
 
+	// Записываем отчет в историю тренировок (для лидербордов)
+	report := &models.TrainingReport{
+		UserID:     msg.From.ID,
+		ChatID:     msg.Chat.ID,
+		ReportDate: utils.GetMoscowDate(),
+		StreakDays: newStreakDays,
+		Tags:       tags,
+	}
+	if err := b.db.SaveTrainingReport(report); err != nil {
+		b.logger.Errorf("Failed to save training report: %v", err)
+	}
+
 	// Проверяем, был ли пользователь на больничном
-	wasOnSickLeave := messageLog.HasSickLeave && !messageLog.HasHealthy
+	wasOnSickLeave := messageLog.State == state.Sick
 
 	// Начисляем кубки только если была добавлена новая тренировка
 	if caloriesToAdd > 0 {
 		// Начисляем 1 кубок за каждую тренировку
-		if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 1); err != nil {
+		if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 1, models.LedgerReasonTraining); err != nil {
 			b.logger.Errorf("Failed to add daily cup: %v", err)
 		} else {
 			b.logger.Infof("Successfully added 1 cup for daily training")
@@ -395,7 +599,7 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 
 		// Начисляем дополнительные кубки за achievements (но НЕ отправляем сообщения пока)
 		if weeklyAchievement {
-			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 42); err != nil {
+			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 42, models.LedgerReasonWeeklyStreak); err != nil {
 				b.logger.Errorf("Failed to add weekly cups: %v", err)
 			} else {
 				b.logger.Infof("Successfully added 42 cups for weekly achievement")
@@ -403,7 +607,7 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 		}
 
 		if twoWeekAchievement {
-			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 42); err != nil {
+			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 42, models.LedgerReasonTwoWeekStreak); err != nil {
 				b.logger.Errorf("Failed to add two-week cups: %v", err)
 			} else {
 				b.logger.Infof("Successfully added 42 cups for two-week achievement")
@@ -411,7 +615,7 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 		}
 
 		if threeWeekAchievement {
-			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 42); err != nil {
+			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 42, models.LedgerReasonThreeWeekStreak); err != nil {
 				b.logger.Errorf("Failed to add three-week cups: %v", err)
 			} else {
 				b.logger.Infof("Successfully added 42 cups for three-week achievement")
@@ -419,7 +623,7 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 		}
 
 		if monthlyAchievement {
-			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 420); err != nil {
+			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 420, models.LedgerReasonMonthlyStreak); err != nil {
 				b.logger.Errorf("Failed to add monthly cups: %v", err)
 			} else {
 				b.logger.Infof("Successfully added 420 cups for monthly achievement")
@@ -427,7 +631,7 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 		}
 
 		if quarterlyAchievement {
-			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 4200); err != nil {
+			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 4200, models.LedgerReasonQuarterlyStreak); err != nil {
 				b.logger.Errorf("Failed to add quarterly cups: %v", err)
 			} else {
 				b.logger.Infof("Successfully added 4200 cups for quarterly achievement")
@@ -458,7 +662,7 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 			}
 
 			// Новая тренировка БЕЗ achievement - отправляем обычное подтверждение
-			reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ Отчёт принят! 💪\n\n🦁 Ты тренируешься дней подряд: %d\n🔥 +%d калорий\n🔥 Всего калорий: %d\n🏆 +1 кубок за тренировку!\n🏆 Всего кубков: %d\n\n⏰ Таймер перезапускается на 7 дней\n\n🎯 Продолжай тренироваться и не забывай отправлять #training_done!", newStreakDays, caloriesToAdd, totalCalories, currentCups))
+			reply := b.newReply(msg, fmt.Sprintf("✅ Отчёт принят! 💪\n\n🦁 Ты тренируешься дней подряд: %d\n🔥 +%d калорий\n🔥 Всего калорий: %d\n🏆 +1 кубок за тренировку!\n🏆 Всего кубков: %d\n\n⏰ Таймер перезапускается на 7 дней\n\n🎯 Продолжай тренироваться и не забывай отправлять #training_done!", newStreakDays, caloriesToAdd, totalCalories, currentCups))
 
 			b.logger.Infof("Sending training done message to chat %d", msg.Chat.ID)
 			_, err = b.api.Send(reply)
@@ -470,7 +674,7 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 		} else {
 			// Дополнительная тренировка в тот же день
 			// Начисляем 1 кубок за дополнительную тренировку
-			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 1); err != nil {
+			if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, 1, models.LedgerReasonDoubleTraining); err != nil {
 				b.logger.Errorf("Failed to add cup for double training: %v", err)
 			} else {
 				b.logger.Infof("Successfully added 1 cup for double training")
@@ -483,7 +687,7 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 				currentCups = 0
 			}
 
-			reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🦁 Какой мотивированный леопард! Еще одна тренировка сегодня! 💪\n\n🔥 Твоя мотивация впечатляет\n🏆 +1 кубок за дополнительную тренировку!\n🏆 Всего кубков: %d\n\n⏰ Таймер уже перезапущен на 7 дней\n\n🎯 Завтра снова отправляй #training_done для продолжения серии!", currentCups))
+			reply := b.newReply(msg, fmt.Sprintf("🦁 Какой мотивированный леопард! Еще одна тренировка сегодня! 💪\n\n🔥 Твоя мотивация впечатляет\n🏆 +1 кубок за дополнительную тренировку!\n🏆 Всего кубков: %d\n\n⏰ Таймер уже перезапущен на 7 дней\n\n🎯 Завтра снова отправляй #training_done для продолжения серии!", currentCups))
 
 			b.logger.Infof("Sending already trained today message to chat %d", msg.Chat.ID)
 			_, err = b.api.Send(reply)
@@ -527,15 +731,27 @@ func (b *Bot) handleTrainingDone(msg *tgbotapi.Message) {
 
 	// Если пользователь был на больничном, сбрасываем флаги больничного и помечаем как здорового
 	if wasOnSickLeave {
-		messageLog.HasSickLeave = false
-		messageLog.HasHealthy = true
-		messageLog.SickLeaveStartTime = nil
-		if err := b.db.SaveMessageLog(messageLog); err != nil {
-			b.logger.Errorf("Failed to reset sick leave flags: %v", err)
+		// Точечный UPDATE: messageLog прочитан до начисления, и его сохранение затерло бы калории, кубки и серию
+		if err := b.db.ClearSickLeaveMarks(msg.From.ID, msg.Chat.ID); err != nil {
+			b.logger.Errorf("Failed to reset sick leave marks: %v", err)
+		}
+		b.logger.Infof("Reset sick leave marks for user %d (%s) after training during sick leave", msg.From.ID, username)
+
+		// Тренировка завершает больничный и в истории
+		if _, err := b.db.EndSickLeave(msg.From.ID, msg.Chat.ID, utils.GetMoscowTime()); err != nil {
+			b.logger.Errorf("Failed to close sick leave episode: %v", err)
+		}
+		b.setMemberState(msg.From.ID, msg.Chat.ID, b.stateAfterPause(msg.From.ID, msg.Chat.ID), state.ReasonTrainingDone)
+	} else if messageLog.SickLeaveStartTime != nil {
+		// Тренировка начинает новый отсчет таймера: прошлый больничный (и бонус за возвращение) в нем уже учтен
+		if err := b.db.ClearSickLeaveMarks(msg.From.ID, msg.Chat.ID); err != nil {
+			b.logger.Errorf("Failed to clear sick leave marks: %v", err)
 		}
-		b.logger.Infof("Reset sick leave flags and marked as healthy for user %d (%s) after training during sick leave", msg.From.ID, username)
 	}
 
+	// Проверяем, не выполнил ли отчет цель челленджей
+	b.checkChallengeProgress(msg.Chat.ID, msg.From.ID)
+
 	// Запускаем новый таймер
 	b.startTimer(msg.From.ID, msg.Chat.ID, msg.From.UserName)
 }
@@ -548,8 +764,36 @@ func (b *Bot) handleSickLeave(msg *tgbotapi.Message) {
 		return
 	}
 
+	// Повторный #sick_leave не должен перезаписывать начало текущего больничного
+	if messageLog.State == state.Sick {
+		reply := b.newReply(msg, "🏥 Ты уже на больничном! Когда поправишься, отправь #healthy")
+		b.post(reply)
+		return
+	}
+	if !state.CanTransition(messageLog.State, state.Sick) {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Сейчас больничный взять нельзя: ты %s", messageLog.State.Title()))
+		b.post(reply)
+		return
+	}
+
+	// Проверяем годовой лимит больничных дней
+	now := utils.GetMoscowTime()
+	usedSickDays, sickDaysQuota, err := b.sickDaysUsage(msg.From.ID, msg.Chat.ID, now)
+	if err != nil {
+		b.logger.Errorf("Failed to get sick days usage: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+	if usedSickDays >= sickDaysQuota {
+		b.logger.Infof("User %d exhausted sick days quota in chat %d: %d/%d", msg.From.ID, msg.Chat.ID, usedSickDays, sickDaysQuota)
+		reply := b.newReply(msg, fmt.Sprintf("❌ Лимит больничных на этот год исчерпан: использовано %d из %d дней.\n\n⏰ Таймер продолжает идти — отправь #training_done, как только сможешь!", usedSickDays, sickDaysQuota))
+		b.post(reply)
+		return
+	}
+
 	// Записываем время начала больничного
-	sickLeaveStartTime := utils.FormatMoscowTime(utils.GetMoscowTime())
+	sickLeaveStartTime := utils.FormatMoscowTime(now)
 	messageLog.SickLeaveStartTime = &sickLeaveStartTime
 	b.logger.Infof("Set sick leave start time: %s", sickLeaveStartTime)
 
@@ -586,16 +830,10 @@ func (b *Bot) handleSickLeave(msg *tgbotapi.Message) {
 	// Логируем рассчитанное время
 	b.logger.Infof("Calculated remaining time at sick leave start: %v", remainingTime)
 
-	// Обновляем флаги больничного
-	messageLog.HasSickLeave = true
-	messageLog.HasHealthy = false
-
 	// Добавляем подробное логирование перед сохранением
 	b.logger.Infof("Saving message log with fields:")
 	b.logger.Infof("  UserID: %d", messageLog.UserID)
 	b.logger.Infof("  ChatID: %d", messageLog.ChatID)
-	b.logger.Infof("  HasSickLeave: %t", messageLog.HasSickLeave)
-	b.logger.Infof("  HasHealthy: %t", messageLog.HasHealthy)
 	b.logger.Infof("  SickLeaveStartTime: %s", func() string {
 		if messageLog.SickLeaveStartTime != nil {
 			return *messageLog.SickLeaveStartTime
@@ -615,14 +853,26 @@ func (b *Bot) handleSickLeave(msg *tgbotapi.Message) {
 		b.logger.Infof("Successfully saved sick leave start time")
 	}
 
+	// Записываем эпизод в историю больничных
+	sickLeave := &models.SickLeave{
+		UserID:    msg.From.ID,
+		ChatID:    msg.Chat.ID,
+		StartedAt: now,
+		Reason:    parseSickLeaveReason(messageText(msg)),
+	}
+	if err := b.db.StartSickLeave(sickLeave); err != nil {
+		b.logger.Errorf("Failed to save sick leave episode: %v", err)
+	}
+	b.setMemberState(msg.From.ID, msg.Chat.ID, state.Sick, state.ReasonSickLeave)
+
 	// Отменяем существующие таймеры
-	b.cancelTimer(msg.From.ID)
+	b.cancelTimer(msg.Chat.ID, msg.From.ID)
 
 	// Форматируем оставшееся время
 	remainingTimeFormatted := b.formatDurationToDays(remainingTime)
 
 	// Отправляем подтверждение с информацией о времени после разморозки
-	reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🏥 Больничный принят! 🤒\n\n⏸️ Таймер приостановлен на время болезни\n\n❄️ После выздоровления останется: %s до удаления\n\n💪 Выздоравливай и возвращайся к тренировкам!\n\n📝 Когда поправишься, отправь #healthy для возобновления таймера", remainingTimeFormatted))
+	reply := b.newReply(msg, fmt.Sprintf("🏥 Больничный принят! 🤒\n\n⏸️ Таймер приостановлен на время болезни\n\n❄️ После выздоровления останется: %s до удаления\n\n📅 Больничных дней в этом году осталось: %d из %d\n\n💪 Выздоравливай и возвращайся к тренировкам!\n\n📝 Когда поправишься, отправь #healthy для возобновления таймера", remainingTimeFormatted, sickDaysQuota-usedSickDays, sickDaysQuota))
 
 	b.logger.Infof("Sending sick leave message to chat %d", msg.Chat.ID)
 	_, err = b.api.Send(reply)
@@ -634,15 +884,28 @@ func (b *Bot) handleSickLeave(msg *tgbotapi.Message) {
 }
 
 func (b *Bot) handleHealthy(msg *tgbotapi.Message) {
+	b.resumeAfterSickLeave(msg.From.ID, msg.Chat.ID, getUserDisplayName(msg.From), msg.From.UserName, utils.GetMoscowTime(), false)
+}
+
+// resumeAfterSickLeave завершает больничный на момент endedAt и возобновляет таймер с места остановки.
+// displayName используется в сообщениях, timerUsername — для таймера (как при обычном старте).
+// automatic — больничный закрыт ботом по максимальному сроку или годовому лимиту, а не по #healthy
+func (b *Bot) resumeAfterSickLeave(userID, chatID int64, displayName, timerUsername string, endedAt time.Time, automatic bool) {
 	// Получаем данные о времени таймера и больничного
-	messageLog, err := b.db.GetMessageLog(msg.From.ID, msg.Chat.ID)
+	messageLog, err := b.db.GetMessageLog(userID, chatID)
 	if err != nil {
 		b.logger.Errorf("Failed to get message log: %v", err)
 		return
 	}
 
+	if messageLog.State != state.Sick {
+		reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("🤔 %s, ты не на больничном — сейчас ты %s", displayName, messageLog.State.Title()))
+		b.post(reply)
+		return
+	}
+
 	// Записываем время окончания больничного
-	sickLeaveEndTime := utils.FormatMoscowTime(utils.GetMoscowTime())
+	sickLeaveEndTime := utils.FormatMoscowTime(endedAt)
 	messageLog.SickLeaveEndTime = &sickLeaveEndTime
 	b.logger.Infof("Set sick leave end time: %s", sickLeaveEndTime)
 
@@ -667,15 +930,10 @@ func (b *Bot) handleHealthy(msg *tgbotapi.Message) {
 		b.logger.Warnf("Sick leave start time is nil")
 	}
 
-	// Обновляем флаг выздоровления
-	messageLog.HasHealthy = true
-
 	// Добавляем подробное логирование перед сохранением
 	b.logger.Infof("Saving message log with fields:")
 	b.logger.Infof("  UserID: %d", messageLog.UserID)
 	b.logger.Infof("  ChatID: %d", messageLog.ChatID)
-	b.logger.Infof("  HasSickLeave: %t", messageLog.HasSickLeave)
-	b.logger.Infof("  HasHealthy: %t", messageLog.HasHealthy)
 	b.logger.Infof("  SickLeaveStartTime: %s", func() string {
 		if messageLog.SickLeaveStartTime != nil {
 			return *messageLog.SickLeaveStartTime
@@ -701,49 +959,73 @@ func (b *Bot) handleHealthy(msg *tgbotapi.Message) {
 		b.logger.Infof("Successfully saved message log with sick leave data")
 	}
 
-	// Рассчитываем оставшееся время используя исправленную функцию
-	remainingTime := b.calculateRemainingTime(messageLog)
+	// Закрываем эпизод в истории больничных
+	if _, err := b.db.EndSickLeave(userID, chatID, endedAt); err != nil {
+		b.logger.Errorf("Failed to close sick leave episode: %v", err)
+	}
+
+	reason := state.ReasonHealthy
+	if automatic {
+		reason = state.ReasonSickExpired
+	}
+	nextState := b.stateAfterPause(userID, chatID)
+	b.setMemberState(userID, chatID, nextState, reason)
+
+	// Рассчитываем оставшееся время: больничный и отпуска не засчитываются
+	remainingTime := b.remainingTimeWithPauses(messageLog)
 	b.logger.Infof("Calculated remaining time after recovery: %v", remainingTime)
 
 	// Проверяем, не истекло ли время
 	if remainingTime <= 0 {
 		// Время истекло - удаляем пользователя
-		username := ""
-		if msg.From.UserName != "" {
-			username = "@" + msg.From.UserName
-		} else if msg.From.FirstName != "" {
-			username = msg.From.FirstName
-			if msg.From.LastName != "" {
-				username += " " + msg.From.LastName
-			}
-		} else {
-			username = fmt.Sprintf("User%d", msg.From.ID)
-		}
-
 		// Отправляем сообщение об истечении времени
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "⏰ Время истекло! 🚫\n\n💪 Выздоровление принято, но время таймера уже истекло.\n\n🦁 Я питаюсь ленивыми леопардами и становлюсь жирнее!\n\n💪 Ты ведь не хочешь стать как я?\n\nТогда тренируйтесь и отправляйте отчеты!")
-		b.api.Send(reply)
-
+		reply := tgbotapi.NewMessage(chatID, "⏰ Время истекло! 🚫\n\n💪 Выздоровление принято, но время таймера уже истекло.\n\n🦁 Я питаюсь ленивыми леопардами и становлюсь жирнее!\n\n💪 Ты ведь не хочешь стать как я?\n\nТогда тренируйтесь и отправляйте отчеты!")
+		b.post(reply)
 		// Удаляем пользователя
-		b.removeUser(msg.From.ID, msg.Chat.ID, username)
+		b.removeUser(userID, chatID, displayName)
 		return
 	}
 
-	// Запускаем таймер с оставшимся временем
-	b.startTimerWithDuration(msg.From.ID, msg.Chat.ID, msg.From.UserName, remainingTime)
+	// Возобновляем таймер, сохраняя исходный старт: больничный уже учтен как пауза,
+	// поэтому и после перезапуска бота оставшееся время посчитается верно
+	vacationText := ""
+	if nextState == state.Vacation {
+		b.logger.Infof("User %d is on vacation, timer will resume after it", userID)
+		vacationText = "\n\n🏖 Сейчас идет твой отпуск — таймер продолжится после него."
+	} else if messageLog.TimerStartTime != nil {
+		b.restoreTimerWithDuration(userID, chatID, timerUsername, remainingTime, *messageLog.TimerStartTime)
+	} else {
+		b.startTimerWithDuration(userID, chatID, timerUsername, remainingTime)
+	}
 
 	// Форматируем оставшееся время
 	remainingTimeFormatted := b.formatDurationToDays(remainingTime)
 
+	// Сообщаем, сколько больничных дней осталось на год
+	sickDaysText := ""
+	if usedSickDays, sickDaysQuota, err := b.sickDaysUsage(userID, chatID, utils.GetMoscowTime()); err != nil {
+		b.logger.Errorf("Failed to get sick days usage: %v", err)
+	} else {
+		remainingSickDays := sickDaysQuota - usedSickDays
+		if remainingSickDays < 0 {
+			remainingSickDays = 0
+		}
+		sickDaysText = fmt.Sprintf("\n\n📅 Больничных дней в этом году осталось: %d из %d", remainingSickDays, sickDaysQuota)
+	}
+
 	// Отправляем подтверждение с информацией о времени до удаления
-	reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("💪 Выздоровление принято! 🎉\n\n⏰ Таймер возобновлён с места остановки!\n\n⏳ До удаления осталось: %s\n\n🦁 Не дай мне стать жирным леопардом!", remainingTimeFormatted))
+	header := "💪 Выздоровление принято! 🎉"
+	if automatic {
+		header = fmt.Sprintf("🏥 %s, больничный достиг допустимого срока и закрыт автоматически!", displayName)
+	}
+	reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("%s\n\n⏰ Таймер возобновлён с места остановки!\n\n⏳ До удаления осталось: %s%s%s\n\n🦁 Не дай мне стать жирным леопардом!", header, remainingTimeFormatted, sickDaysText, vacationText))
 
-	b.logger.Infof("Sending healthy message to chat %d", msg.Chat.ID)
+	b.logger.Infof("Sending healthy message to chat %d", chatID)
 	_, err = b.api.Send(reply)
 	if err != nil {
 		b.logger.Errorf("Failed to send healthy message: %v", err)
 	} else {
-		b.logger.Infof("Successfully sent healthy message to chat %d", msg.Chat.ID)
+		b.logger.Infof("Successfully sent healthy message to chat %d", chatID)
 	}
 }
 
@@ -765,8 +1047,8 @@ func (b *Bot) handleChange(msg *tgbotapi.Message) {
 	messageLog, err := b.db.GetMessageLog(msg.From.ID, msg.Chat.ID)
 	if err != nil {
 		b.logger.Errorf("Failed to get message log: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка получения данных пользователя")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Ошибка получения данных пользователя")
+		b.post(reply)
 		return
 	}
 
@@ -785,7 +1067,7 @@ func (b *Bot) handleChange(msg *tgbotapi.Message) {
 
 	if exchangesCanMake == 0 {
 		// Недостаточно калорий для обмена
-		reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("💪 %s, у тебя %d калорий\n\n🔄 Для обмена нужно минимум %d калорий\n🏆 За %d калорий можно получить %d кубков\n\n⏰ Пока рано! Еще потренируйся!\n\n🎯 Продолжай тренироваться и накапливай калории!", username, currentCalories, exchangeRate, exchangeRate, cupsPerExchange))
+		reply := b.newReply(msg, fmt.Sprintf("💪 %s, у тебя %d калорий\n\n🔄 Для обмена нужно минимум %d калорий\n🏆 За %d калорий можно получить %d кубков\n\n⏰ Пока рано! Еще потренируйся!\n\n🎯 Продолжай тренироваться и накапливай калории!", username, currentCalories, exchangeRate, exchangeRate, cupsPerExchange))
 		b.logger.Infof("Sending insufficient calories message to chat %d", msg.Chat.ID)
 		_, err = b.api.Send(reply)
 		if err != nil {
@@ -801,18 +1083,18 @@ func (b *Bot) handleChange(msg *tgbotapi.Message) {
 	cupsToAdd := exchangesCanMake * cupsPerExchange
 
 	// Списываем калории
-	if err := b.db.AddCalories(msg.From.ID, msg.Chat.ID, -caloriesToSpend); err != nil {
+	if err := b.db.AddCalories(msg.From.ID, msg.Chat.ID, -caloriesToSpend, models.LedgerReasonExchange); err != nil {
 		b.logger.Errorf("Failed to spend calories: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при списании калорий")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Ошибка при списании калорий")
+		b.post(reply)
 		return
 	}
 
 	// Добавляем кубки
-	if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, cupsToAdd); err != nil {
+	if err := b.db.AddCups(msg.From.ID, msg.Chat.ID, cupsToAdd, models.LedgerReasonExchange); err != nil {
 		b.logger.Errorf("Failed to add cups: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при добавлении кубков")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Ошибка при добавлении кубков")
+		b.post(reply)
 		return
 	}
 
@@ -832,7 +1114,7 @@ func (b *Bot) handleChange(msg *tgbotapi.Message) {
 	newCups := currentCups + cupsToAdd
 
 	// Отправляем сообщение об успешном обмене
-	reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🔄 Обмен выполнен! 💪\n\n%s сожжено 🔥 %d калорий → 🏆 %d кубка\n\n📊 Твой баланс:\n🔥 Калории: %d\n🏆 Кубки: %d\n\n💡 Курс: %d калорий = %d кубка", username, caloriesToSpend, cupsToAdd, newCalories, newCups, exchangeRate, cupsPerExchange))
+	reply := b.newReply(msg, fmt.Sprintf("🔄 Обмен выполнен! 💪\n\n%s сожжено 🔥 %d калорий → 🏆 %d кубка\n\n📊 Твой баланс:\n🔥 Калории: %d\n🏆 Кубки: %d\n\n💡 Курс: %d калорий = %d кубка", username, caloriesToSpend, cupsToAdd, newCalories, newCups, exchangeRate, cupsPerExchange))
 
 	b.logger.Infof("Sending exchange success message to chat %d", msg.Chat.ID)
 	_, err = b.api.Send(reply)
@@ -846,8 +1128,8 @@ func (b *Bot) handleChange(msg *tgbotapi.Message) {
 func (b *Bot) handleStartTimer(msg *tgbotapi.Message) {
 	// Проверяем права администратора
 	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Только администраторы или владелец могут использовать эту команду!")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
 		return
 	}
 
@@ -855,22 +1137,28 @@ func (b *Bot) handleStartTimer(msg *tgbotapi.Message) {
 	users, err := b.db.GetUsersByChatID(msg.Chat.ID)
 	if err != nil {
 		b.logger.Errorf("Failed to get users: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при получении пользователей")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Ошибка при получении пользователей")
+		b.post(reply)
 		return
 	}
 
 	// Запускаем таймеры для всех пользователей
 	startedCount := 0
 	for _, user := range users {
+		// Больничный, отпуск и исключение из удаления таймер не перезапускает
+		if !user.State.TimerRuns() {
+			continue
+		}
 		if b.isUserInChat(msg.Chat.ID, user.UserID) {
 			b.startTimer(user.UserID, msg.Chat.ID, "")
 			startedCount++
 		}
 	}
 
+	b.auditAdmin(msg, models.AuditStartTimer, 0, "", fmt.Sprintf("запущено таймеров: %d", startedCount))
+
 	// Отправляем отчет
-	reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🐆 Fat Leopard активирован!\n\n⏱️ Запущено таймеров: %d\n⏰ Время: 7 дней\n💪 Действие: Отправь #training_done", startedCount))
+	reply := b.newReply(msg, fmt.Sprintf("🐆 Fat Leopard активирован!\n\n⏱️ Запущено таймеров: %d\n⏰ Время: 7 дней\n💪 Действие: Отправь #training_done", startedCount))
 
 	b.logger.Infof("Sending start timer message to chat %d", msg.Chat.ID)
 	_, err = b.api.Send(reply)
@@ -882,23 +1170,24 @@ func (b *Bot) handleStartTimer(msg *tgbotapi.Message) {
 }
 
 func (b *Bot) handleHelp(msg *tgbotapi.Message) {
+	admin, member, private := groupHelpCommands()
 	helpText := `🤖 LeoPoacherBot - Команды:
 
 📝 Команды администратора:
-• /start_timer — Запустить таймеры для всех пользователей
-• /db — Показать статистику БД
-• /help — Показать это сообщение
+` + admin + `
 
 🏆 Команды пользователей:
-• /top — Показать топ пользователей по калориям
-• /points — Показать ваши калории
-• /cups — Показать ваши заработанные кубки
+` + member + `
+
+🔔 В личке с ботом:
+` + private + `
+• #training_done — Отправить отчет в чат прямо из лички
 
 💪 Отчеты о тренировке:
 • #training_done — Отправить отчет о тренировке
 
 🏥 Больничный:
-• #sick_leave — Взять больничный (приостанавливает таймер)
+• #sick_leave [причина] — Взять больничный (приостанавливает таймер, есть годовой лимит дней)
 • #healthy — Выздороветь (возобновляет таймер)
 
 🔄 Обмен:
@@ -925,7 +1214,8 @@ func (b *Bot) handleHelp(msg *tgbotapi.Message) {
 
 Оставайся активным и не становись жирным леопардом! 🦁`
 
-	reply := tgbotapi.NewMessage(msg.Chat.ID, helpText)
+	reply := b.newReply(msg, helpText)
+	reply.ReplyMarkup = memberKeyboard(msg.From.ID)
 
 	b.logger.Infof("Sending help message to chat %d", msg.Chat.ID)
 	_, err := b.api.Send(reply)
@@ -950,7 +1240,7 @@ func (b *Bot) handleStart(msg *tgbotapi.Message) {
 • #training_done — Отправить отчет о тренировке
 
 🏥 **Больничный:**
-• #sick_leave — Взять больничный (приостанавливает таймер)
+• #sick_leave [причина] — Взять больничный (приостанавливает таймер, есть годовой лимит дней)
 • #healthy — Выздороветь (возобновляет таймер)
 
 🔄 **Обмен:**
@@ -970,7 +1260,7 @@ func (b *Bot) handleStart(msg *tgbotapi.Message) {
 
 🎯 **Начни прямо сейчас — отправь #training_done!**`
 
-	reply := tgbotapi.NewMessage(msg.Chat.ID, welcomeText)
+	reply := b.newReply(msg, welcomeText)
 
 	b.logger.Infof("Sending start message to chat %d", msg.Chat.ID)
 	_, err := b.api.Send(reply)
@@ -984,8 +1274,8 @@ func (b *Bot) handleStart(msg *tgbotapi.Message) {
 func (b *Bot) handleDB(msg *tgbotapi.Message) {
 	// Проверяем права администратора
 	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Только администраторы или владелец могут использовать эту команду!")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
 		return
 	}
 
@@ -993,16 +1283,21 @@ func (b *Bot) handleDB(msg *tgbotapi.Message) {
 	stats, err := b.db.GetDatabaseStats()
 	if err != nil {
 		b.logger.Errorf("Failed to get database stats: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при получении данных")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
 		return
 	}
 
 	// Формируем отчет
-	report := fmt.Sprintf("📊 Статистика БД:\n\n👥 Всего пользователей: %v\n✅ С training_done: %v\n🏥 На больничном: %v\n💪 Выздоровели: %v",
+	report := fmt.Sprintf("📊 Статистика БД:\n\n👥 Всего пользователей: %v\n✅ Тренировались сегодня: %v\n🏥 На больничном: %v\n💪 Выздоровели: %v",
 		stats["total_users"], stats["training_done"], stats["sick_leave"], stats["healthy"])
+	if b.api.outbox != nil {
+		metrics := b.api.outbox.Metrics()
+		report += fmt.Sprintf("\n\n📤 Очередь отправки:\n✉️ Отправлено: %d\n⏳ Ждут отправки: %d\n🔁 Повторов: %d (из них 429: %d)\n❌ Не доставлено: %d",
+			metrics.Sent, metrics.Queued, metrics.Retried, metrics.RateLimited, metrics.Failed+metrics.Rejected)
+	}
 
-	reply := tgbotapi.NewMessage(msg.Chat.ID, report)
+	reply := b.newReply(msg, report)
 
 	b.logger.Infof("Sending DB stats message to chat %d", msg.Chat.ID)
 	_, err = b.api.Send(reply)
@@ -1013,55 +1308,13 @@ func (b *Bot) handleDB(msg *tgbotapi.Message) {
 	}
 }
 
-func (b *Bot) handleTop(msg *tgbotapi.Message) {
-	// Получаем топ пользователей
-	topUsers, err := b.db.GetTopUsers(msg.Chat.ID, 10)
-	if err != nil {
-		b.logger.Errorf("Failed to get top users: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при получении данных")
-		b.api.Send(reply)
-		return
-	}
-
-	if len(topUsers) == 0 {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "🏆 **Топ пользователей:**\n\n📊 Пока нет данных о тренировках")
-		reply.ParseMode = "Markdown"
-		b.api.Send(reply)
-		return
-	}
-
-	// Формируем топ
-	topText := "🏆 Топ пользователей по очкам:\n\n"
-	for i, user := range topUsers {
-		emoji := "🥇"
-		if i == 1 {
-			emoji = "🥈"
-		} else if i == 2 {
-			emoji = "🥉"
-		} else {
-			emoji = fmt.Sprintf("%d️⃣", i+1)
-		}
-		topText += fmt.Sprintf("%s %s - %d калорий\n", emoji, user.Username, user.Calories)
-	}
-
-	reply := tgbotapi.NewMessage(msg.Chat.ID, topText)
-
-	b.logger.Infof("Sending top users message to chat %d", msg.Chat.ID)
-	_, err = b.api.Send(reply)
-	if err != nil {
-		b.logger.Errorf("Failed to send top users message: %v", err)
-	} else {
-		b.logger.Infof("Successfully sent top users message to chat %d", msg.Chat.ID)
-	}
-}
-
 func (b *Bot) handlePoints(msg *tgbotapi.Message) {
 	// Получаем калории пользователя
 	calories, err := b.db.GetUserCalories(msg.From.ID, msg.Chat.ID)
 	if err != nil {
 		b.logger.Errorf("Failed to get user calories: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при получении данных")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
 		return
 	}
 
@@ -1081,7 +1334,7 @@ func (b *Bot) handlePoints(msg *tgbotapi.Message) {
 	// Формируем сообщение
 	caloriesText := fmt.Sprintf("🔥 Ваши калории:\n\n👤 %s\n🎯 Всего сожжено калорий: %d\n\n💡 Отправляйте #training_done для сжигания калорий!", username, calories)
 
-	reply := tgbotapi.NewMessage(msg.Chat.ID, caloriesText)
+	reply := b.newReply(msg, caloriesText)
 
 	b.logger.Infof("Sending calories message to chat %d", msg.Chat.ID)
 	_, err = b.api.Send(reply)
@@ -1097,8 +1350,8 @@ func (b *Bot) handleCups(msg *tgbotapi.Message) {
 	cups, err := b.db.GetUserCups(msg.From.ID, msg.Chat.ID)
 	if err != nil {
 		b.logger.Errorf("Failed to get user cups: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при получении данных")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
 		return
 	}
 
@@ -1125,7 +1378,7 @@ func (b *Bot) handleCups(msg *tgbotapi.Message) {
 		cupsText = fmt.Sprintf("🏆 Ваши кубки:\n\n👤 %s\n🎯 Всего заработано кубков: %d\n\n💡 Отправляйте #training_done для получения кубков!\n\n🎊 Розыгрыш футболки Fat Leopard при достижении 420 кубков!", username, cups)
 	}
 
-	reply := tgbotapi.NewMessage(msg.Chat.ID, cupsText)
+	reply := b.newReply(msg, cupsText)
 
 	b.logger.Infof("Sending cups message to chat %d", msg.Chat.ID)
 	_, err = b.api.Send(reply)
@@ -1139,122 +1392,107 @@ func (b *Bot) handleCups(msg *tgbotapi.Message) {
 func (b *Bot) handleSetExempt(msg *tgbotapi.Message) {
 	// Проверяем права администратора
 	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Только администраторы или владелец могут использовать эту команду!")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
 		return
 	}
 
-	// Парсим аргументы команды
-	args := strings.Fields(msg.Text)
-	if len(args) < 2 {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Использование: /set_exempt @username")
-		b.api.Send(reply)
+	// Находим участника по аргументу или по ответу на его сообщение
+	target, _, ok := b.resolveTarget(msg, strings.Fields(msg.CommandArguments()), "❌ Использование: /set_exempt @username, /set_exempt id:<ID> или ответом на сообщение участника")
+	if !ok {
 		return
 	}
+	userID := target.UserID
 
-	// Извлекаем username из аргумента
-	searchUsername := args[1]
-
-	// Логируем поиск для отладки
-	b.logger.Infof("Searching for user: '%s' in chat %d", searchUsername, msg.Chat.ID)
-
-	// Находим пользователя по username (функция сама обработает разные форматы)
-	userID, err := b.db.GetUserIDByUsername(searchUsername, msg.Chat.ID)
-	if err != nil {
-		b.logger.Errorf("Failed to get user ID by username '%s': %v", searchUsername, err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("❌ Пользователь %s не найден в базе данных", searchUsername))
-		b.api.Send(reply)
-		return
-	}
-
-	b.logger.Infof("Found user ID %d for username '%s'", userID, searchUsername)
+	b.logger.Infof("Found user ID %d for set_exempt", userID)
 
 	// Устанавливаем исключение
 	messageLog, err := b.db.GetMessageLog(userID, msg.Chat.ID)
 	if err != nil {
 		b.logger.Errorf("Failed to get message log: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при получении данных пользователя")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных пользователя")
+		b.post(reply)
 		return
 	}
 
-	messageLog.IsExemptFromDeletion = true
-	if err := b.db.SaveMessageLog(messageLog); err != nil {
-		b.logger.Errorf("Failed to save message log: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при сохранении данных")
-		b.api.Send(reply)
+	if err := b.setMemberState(userID, msg.Chat.ID, state.Exempt, state.ReasonSetExempt); err != nil {
+		text := "❌ Ошибка при сохранении данных"
+		if errors.Is(err, state.ErrInvalidTransition) {
+			text = fmt.Sprintf("❌ Пользователя %s нельзя исключить: он %s", messageLog.Username, messageLog.State.Title())
+		}
+		reply := b.newReply(msg, text)
+		b.post(reply)
 		return
 	}
 
+	// Исключенному больничный не нужен — закрываем открытый эпизод
+	auditReason := "было: " + messageLog.State.Title()
+	if messageLog.State == state.Sick {
+		if _, err := b.db.EndSickLeave(userID, msg.Chat.ID, utils.GetMoscowTime()); err != nil {
+			b.logger.Errorf("Failed to close sick leave episode: %v", err)
+		}
+		auditReason += ", больничный закрыт"
+	}
+	b.auditAdmin(msg, models.AuditSetExempt, userID, messageLog.Username, auditReason)
+
 	// Отменяем таймер если он активен
-	b.cancelTimer(userID)
+	b.cancelTimer(msg.Chat.ID, userID)
 
-	reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ Пользователь %s исключен из правила удаления за неактивность", messageLog.Username))
-	b.api.Send(reply)
+	reply := b.newReply(msg, fmt.Sprintf("✅ Пользователь %s исключен из правила удаления за неактивность", messageLog.Username))
+	b.post(reply)
 }
 
 func (b *Bot) handleRemoveExempt(msg *tgbotapi.Message) {
 	// Проверяем права администратора
 	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Только администраторы или владелец могут использовать эту команду!")
-		b.api.Send(reply)
-		return
-	}
-
-	// Парсим аргументы команды
-	args := strings.Fields(msg.Text)
-	if len(args) < 2 {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Использование: /remove_exempt @username")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
 		return
 	}
 
-	// Извлекаем username из аргумента
-	searchUsername := args[1]
-
-	// Логируем поиск для отладки
-	b.logger.Infof("Searching for user: '%s' in chat %d", searchUsername, msg.Chat.ID)
-
-	// Находим пользователя по username (функция сама обработает разные форматы)
-	userID, err := b.db.GetUserIDByUsername(searchUsername, msg.Chat.ID)
-	if err != nil {
-		b.logger.Errorf("Failed to get user ID by username '%s': %v", searchUsername, err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("❌ Пользователь %s не найден в базе данных", searchUsername))
-		b.api.Send(reply)
+	// Находим участника по аргументу или по ответу на его сообщение
+	target, _, ok := b.resolveTarget(msg, strings.Fields(msg.CommandArguments()), "❌ Использование: /remove_exempt @username, /remove_exempt id:<ID> или ответом на сообщение участника")
+	if !ok {
 		return
 	}
+	userID := target.UserID
 
-	b.logger.Infof("Found user ID %d for username '%s'", userID, searchUsername)
+	b.logger.Infof("Found user ID %d for remove_exempt", userID)
 
 	// Убираем исключение
 	messageLog, err := b.db.GetMessageLog(userID, msg.Chat.ID)
 	if err != nil {
 		b.logger.Errorf("Failed to get message log: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при получении данных пользователя")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных пользователя")
+		b.post(reply)
 		return
 	}
 
-	messageLog.IsExemptFromDeletion = false
-	if err := b.db.SaveMessageLog(messageLog); err != nil {
-		b.logger.Errorf("Failed to save message log: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при сохранении данных")
-		b.api.Send(reply)
+	if messageLog.State != state.Exempt {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Пользователь %s не исключен из удаления: он %s", messageLog.Username, messageLog.State.Title()))
+		b.post(reply)
+		return
+	}
+
+	if err := b.setMemberState(userID, msg.Chat.ID, b.stateAfterPause(userID, msg.Chat.ID), state.ReasonRemoveExempt); err != nil {
+		reply := b.newReply(msg, "❌ Ошибка при сохранении данных")
+		b.post(reply)
 		return
 	}
 
 	// Запускаем таймер для пользователя
 	b.startTimer(userID, msg.Chat.ID, messageLog.Username)
+	b.auditAdmin(msg, models.AuditRemoveExempt, userID, messageLog.Username, "")
 
-	reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ Пользователь %s больше не исключен из правила удаления. Таймер запущен.", messageLog.Username))
-	b.api.Send(reply)
+	reply := b.newReply(msg, fmt.Sprintf("✅ Пользователь %s больше не исключен из правила удаления. Таймер запущен.", messageLog.Username))
+	b.post(reply)
 }
 
 func (b *Bot) handleListUsers(msg *tgbotapi.Message) {
 	// Проверяем права администратора
 	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Только администраторы или владелец могут использовать эту команду!")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
 		return
 	}
 
@@ -1262,14 +1500,14 @@ func (b *Bot) handleListUsers(msg *tgbotapi.Message) {
 	users, err := b.db.GetUsersByChatID(msg.Chat.ID)
 	if err != nil {
 		b.logger.Errorf("Failed to get users: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Ошибка при получении списка пользователей")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Ошибка при получении списка пользователей")
+		b.post(reply)
 		return
 	}
 
 	if len(users) == 0 {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "📝 В чате нет пользователей в базе данных")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "📝 В чате нет пользователей в базе данных")
+		b.post(reply)
 		return
 	}
 
@@ -1279,49 +1517,49 @@ func (b *Bot) handleListUsers(msg *tgbotapi.Message) {
 
 	for i, user := range users {
 		exemptStatus := "❌"
-		if user.IsExemptFromDeletion {
+		if user.State == state.Exempt {
 			exemptStatus = "✅"
 		}
 
-		userList.WriteString(fmt.Sprintf("%d. %s (ID: %d) %s\n",
-			i+1, user.Username, user.UserID, exemptStatus))
+		userList.WriteString(fmt.Sprintf("%d. %s (ID: %d) %s %s\n",
+			i+1, user.Username, user.UserID, exemptStatus, user.State.Title()))
 	}
 
 	userList.WriteString("\n✅ = исключен из удаления\n❌ = подпадает под правило удаления")
 
-	reply := tgbotapi.NewMessage(msg.Chat.ID, userList.String())
-	b.api.Send(reply)
+	reply := b.newReply(msg, userList.String())
+	b.post(reply)
 }
 
 func (b *Bot) handleSendToChat(msg *tgbotapi.Message) {
 	// Проверяем права доступа - только владелец бота может отправлять сообщения в другие чаты
 	if msg.From.ID != b.config.OwnerID {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ У вас нет прав для использования этой команды")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ У вас нет прав для использования этой команды")
+		b.post(reply)
 		return
 	}
 
 	// Получаем аргументы команды
 	args := msg.CommandArguments()
 	if args == "" {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Использование: /send_to_chat <chat_id> <текст_сообщения>")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Использование: /send_to_chat <chat_id> <текст_сообщения>")
+		b.post(reply)
 		return
 	}
 
 	// Разбираем аргументы
 	parts := strings.SplitN(args, " ", 2)
 	if len(parts) != 2 {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Использование: /send_to_chat <chat_id> <текст_сообщения>")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Использование: /send_to_chat <chat_id> <текст_сообщения>")
+		b.post(reply)
 		return
 	}
 
 	// Парсим chat_id
 	chatID, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Неверный формат chat_id")
-		b.api.Send(reply)
+		reply := b.newReply(msg, "❌ Неверный формат chat_id")
+		b.post(reply)
 		return
 	}
 
@@ -1336,13 +1574,15 @@ func (b *Bot) handleSendToChat(msg *tgbotapi.Message) {
 	_, err = b.api.Send(chatMessage)
 	if err != nil {
 		errorMsg := fmt.Sprintf("❌ Ошибка при отправке сообщения в чат %d: %v", chatID, err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, errorMsg)
-		b.api.Send(reply)
+		reply := b.newReply(msg, errorMsg)
+		b.post(reply)
 		b.logger.Errorf("Failed to send message to chat %d: %v", chatID, err)
+		b.auditAdmin(msg, models.AuditSendToChat, 0, "", fmt.Sprintf("не отправлено: %v", err))
 	} else {
+		b.auditAdmin(msg, models.AuditSendToChat, 0, "", "отправлено")
 		successMsg := fmt.Sprintf("✅ Сообщение успешно отправлено в чат %d", chatID)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, successMsg)
-		b.api.Send(reply)
+		reply := b.newReply(msg, successMsg)
+		b.post(reply)
 		b.logger.Infof("Successfully sent message to chat %d", chatID)
 	}
 }
@@ -1355,13 +1595,13 @@ func (b *Bot) startTimer(userID, chatID int64, username string) {
 func (b *Bot) startTimerWithDuration(userID, chatID int64, username string, duration time.Duration) {
 	// Проверяем, не исключен ли пользователь из удаления
 	messageLog, err := b.db.GetMessageLog(userID, chatID)
-	if err == nil && messageLog.IsExemptFromDeletion {
+	if err == nil && messageLog.State == state.Exempt {
 		b.logger.Infof("User %d (%s) is exempt from deletion, skipping timer", userID, username)
 		return
 	}
 
 	// Отменяем существующие таймеры
-	b.cancelTimer(userID)
+	b.cancelTimer(chatID, userID)
 
 	// Создаем новые таймеры
 	warningTask := make(chan bool)
@@ -1377,20 +1617,27 @@ func (b *Bot) startTimerWithDuration(userID, chatID int64, username string, dura
 		TimerStartTime: timerStartTime,
 	}
 
-	b.timers[userID] = timerInfo
+	b.setTimer(timerInfo)
 
 	// Сохраняем время начала таймера в базу данных
-	messageLog, err = b.db.GetMessageLog(userID, chatID)
-	if err != nil {
-		b.logger.Errorf("Failed to get message log for timer start: %v", err)
+	if err := b.db.SetTimerStartTime(userID, chatID, timerStartTime); err != nil {
+		b.logger.Errorf("Failed to save timer start time: %v", err)
 	} else {
-		// Обновляем время начала таймера
-		messageLog.TimerStartTime = &timerStartTime
-		if err := b.db.SaveMessageLog(messageLog); err != nil {
-			b.logger.Errorf("Failed to save timer start time: %v", err)
-		} else {
-			b.logger.Infof("Saved timer start time: %s", timerStartTime)
-		}
+		b.logger.Infof("Saved timer start time: %s", timerStartTime)
+	}
+
+	// В отпуске таймер не идет: старт сохранен, отсчет продолжится после отпуска
+	if b.isOnVacation(userID, chatID, utils.GetMoscowTime()) {
+		b.cancelTimer(chatID, userID)
+		b.logger.Infof("User %d (%s) is on vacation, timer will resume after it", userID, username)
+		return
+	}
+
+	// Без права банить таймеры чата стоят: отсчет продолжится, когда бот снова станет администратором
+	if b.isChatPaused(chatID) {
+		b.cancelTimer(chatID, userID)
+		b.logger.Infof("Chat %d is paused, timer of user %d (%s) will resume with the chat", chatID, userID, username)
+		return
 	}
 
 	// Рассчитываем время предупреждения (6 дней до удаления)
@@ -1406,10 +1653,13 @@ func (b *Bot) startTimerWithDuration(userID, chatID int64, username string, dura
 		case <-warningTask:
 			return // Таймер отменен
 		default:
-			b.sendWarning(userID, chatID, username)
+			b.runTimerAction(func() { b.sendWarning(userID, chatID, username) })
 		}
 	}()
 
+	// Напоминание в личку за день до предупреждения в чате
+	b.schedulePrivateReminder(userID, chatID, timerStartTime, warningTime, duration, warningTask)
+
 	// Запускаем удаление через указанное время
 	go func() {
 		time.Sleep(duration)
@@ -1417,7 +1667,7 @@ func (b *Bot) startTimerWithDuration(userID, chatID int64, username string, dura
 		case <-removalTask:
 			return // Таймер отменен
 		default:
-			b.removeUser(userID, chatID, username)
+			b.runTimerAction(func() { b.removeUser(userID, chatID, username) })
 		}
 	}()
 
@@ -1427,7 +1677,13 @@ func (b *Bot) startTimerWithDuration(userID, chatID int64, username string, dura
 // restoreTimerWithDuration восстанавливает таймер без обновления timer_start_time в БД
 func (b *Bot) restoreTimerWithDuration(userID, chatID int64, username string, duration time.Duration, existingTimerStartTime string) {
 	// Отменяем существующие таймеры
-	b.cancelTimer(userID)
+	b.cancelTimer(chatID, userID)
+
+	// Таймеры чата на паузе — их возобновит resumeChatTimers
+	if b.isChatPaused(chatID) {
+		b.logger.Infof("Chat %d is paused, not restoring timer of user %d (%s)", chatID, userID, username)
+		return
+	}
 
 	// Создаем новые таймеры
 	warningTask := make(chan bool)
@@ -1442,7 +1698,7 @@ func (b *Bot) restoreTimerWithDuration(userID, chatID int64, username string, du
 		TimerStartTime: existingTimerStartTime, // Используем существующее время из БД
 	}
 
-	b.timers[userID] = timerInfo
+	b.setTimer(timerInfo)
 
 	// НЕ обновляем timer_start_time в БД - используем существующее значение
 
@@ -1459,10 +1715,13 @@ func (b *Bot) restoreTimerWithDuration(userID, chatID int64, username string, du
 		case <-warningTask:
 			return // Таймер отменен
 		default:
-			b.sendWarning(userID, chatID, username)
+			b.runTimerAction(func() { b.sendWarning(userID, chatID, username) })
 		}
 	}()
 
+	// Напоминание в личку за день до предупреждения в чате
+	b.schedulePrivateReminder(userID, chatID, existingTimerStartTime, warningTime, duration, warningTask)
+
 	// Запускаем удаление через указанное время
 	go func() {
 		time.Sleep(duration)
@@ -1470,20 +1729,63 @@ func (b *Bot) restoreTimerWithDuration(userID, chatID int64, username string, du
 		case <-removalTask:
 			return // Таймер отменен
 		default:
-			b.removeUser(userID, chatID, username)
+			b.runTimerAction(func() { b.removeUser(userID, chatID, username) })
 		}
 	}()
 
 	b.logger.Infof("Restored timer for user %d (%s) - warning in %v, removal in %v (timer start time: %s)", userID, username, warningTime, duration, existingTimerStartTime)
 }
 
-func (b *Bot) cancelTimer(userID int64) {
-	if timer, exists := b.timers[userID]; exists {
+// setTimer запоминает запущенный таймер участника, отменяя предыдущий, если он еще идет
+func (b *Bot) setTimer(timer *models.TimerInfo) {
+	b.timersMu.Lock()
+	defer b.timersMu.Unlock()
+
+	key := timerKey{ChatID: timer.ChatID, UserID: timer.UserID}
+	if previous, exists := b.timers[key]; exists {
+		close(previous.WarningTask)
+		close(previous.RemovalTask)
+	}
+	b.timers[key] = timer
+}
+
+func (b *Bot) cancelTimer(chatID, userID int64) {
+	b.timersMu.Lock()
+	defer b.timersMu.Unlock()
+
+	key := timerKey{ChatID: chatID, UserID: userID}
+	if timer, exists := b.timers[key]; exists {
+		close(timer.WarningTask)
+		close(timer.RemovalTask)
+		delete(b.timers, key)
+		b.logger.Infof("Cancelled timer for user %d in chat %d", userID, chatID)
+	}
+}
+
+// cancelChatTimers отменяет таймеры всех участников чата и возвращает, сколько их было
+func (b *Bot) cancelChatTimers(chatID int64) int {
+	b.timersMu.Lock()
+	defer b.timersMu.Unlock()
+
+	cancelled := 0
+	for key, timer := range b.timers {
+		if key.ChatID != chatID {
+			continue
+		}
 		close(timer.WarningTask)
 		close(timer.RemovalTask)
-		delete(b.timers, userID)
-		b.logger.Infof("Cancelled timer for user %d", userID)
+		delete(b.timers, key)
+		cancelled++
 	}
+	return cancelled
+}
+
+// forgetTimer убирает сработавший таймер из списка, не закрывая его каналы
+func (b *Bot) forgetTimer(chatID, userID int64) {
+	b.timersMu.Lock()
+	defer b.timersMu.Unlock()
+
+	delete(b.timers, timerKey{ChatID: chatID, UserID: userID})
 }
 
 func (b *Bot) sendWarning(userID, chatID int64, username string) {
@@ -1497,11 +1799,16 @@ func (b *Bot) sendWarning(userID, chatID int64, username string) {
 	} else {
 		b.logger.Infof("Successfully sent warning to user %d (%s)", userID, username)
 	}
+
+	b.auditSystem(chatID, models.AuditWarning, userID, username, b.inactivityReason(userID, chatID))
 }
 
 func (b *Bot) removeUser(userID, chatID int64, username string) {
 	b.logger.Infof("Attempting to remove user %d (%s) from chat %d", userID, username, chatID)
 
+	// Причину считаем до смены состояния, пока данные таймера не изменились
+	reason := b.inactivityReason(userID, chatID)
+
 	// Пытаемся удалить пользователя из чата
 	_, err := b.api.Request(tgbotapi.BanChatMemberConfig{
 		ChatMemberConfig: tgbotapi.ChatMemberConfig{
@@ -1513,9 +1820,10 @@ func (b *Bot) removeUser(userID, chatID int64, username string) {
 
 	if err != nil {
 		b.logger.Errorf("Failed to remove user %d: %v", userID, err)
+		b.auditSystem(chatID, models.AuditRemovalFailed, userID, username, fmt.Sprintf("%s; ошибка бана: %v", reason, err))
 		// Отправляем сообщение об ошибке
 		errorMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ Не удалось удалить пользователя %s из чата", username))
-		b.api.Send(errorMsg)
+		b.post(errorMsg)
 	} else {
 		// Отправляем сообщение об удалении
 		message := fmt.Sprintf("🚫 Пользователь удален!\n\n@%s был удален из чата за неактивность.\n\n🦁 Я питаюсь ленивыми леопардами и становлюсь жирнее!\n\n💪 Ты ведь не хочешь стать как я?\n\nТогда тренируйтесь и отправляйте отчеты!", username)
@@ -1529,18 +1837,32 @@ func (b *Bot) removeUser(userID, chatID int64, username string) {
 		}
 
 		b.logger.Infof("Removed user %d (%s) from chat", userID, username)
+		b.auditSystem(chatID, models.AuditRemoval, userID, username, reason)
 	}
 
 	// Помечаем пользователя как удаленного в базе данных
-	if err := b.db.MarkUserAsDeleted(userID, chatID); err != nil {
-		b.logger.Errorf("Failed to mark user as deleted: %v", err)
-	}
+	b.setMemberState(userID, chatID, state.Removed, state.ReasonTimerExpired)
 
 	// Удаляем таймер
-	delete(b.timers, userID)
+	b.forgetTimer(chatID, userID)
 	b.logger.Infof("Timer removed for user %d", userID)
 }
 
+// getUserDisplayName возвращает имя пользователя в том же виде, в каком оно хранится в message_log
+func getUserDisplayName(user *tgbotapi.User) string {
+	if user.UserName != "" {
+		return "@" + user.UserName
+	}
+	if user.FirstName != "" {
+		username := user.FirstName
+		if user.LastName != "" {
+			username += " " + user.LastName
+		}
+		return username
+	}
+	return fmt.Sprintf("User%d", user.ID)
+}
+
 func (b *Bot) isAdmin(chatID, userID int64) bool {
 	// Проверяем, является ли пользователь владельцем
 	if userID == b.config.OwnerID {
@@ -1562,18 +1884,29 @@ func (b *Bot) isAdmin(chatID, userID int64) bool {
 	return member.Status == "administrator" || member.Status == "creator"
 }
 
+// isUserInChat проверяет, состоит ли пользователь в чате. GetChatMember отвечает и для вышедших
+// и забаненных, поэтому смотрим на статус
 func (b *Bot) isUserInChat(chatID, userID int64) bool {
-	_, err := b.api.GetChatMember(tgbotapi.GetChatMemberConfig{
+	member, err := b.api.GetChatMember(tgbotapi.GetChatMemberConfig{
 		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
 			ChatID: chatID,
 			UserID: userID,
 		},
 	})
-	return err == nil
+	return err == nil && isPresentInChat(member)
+}
+
+// now возвращает текущее московское время
+func (b *Bot) now() time.Time {
+	if b.clock != nil {
+		return b.clock()
+	}
+	return utils.GetMoscowTime()
 }
 
 func (b *Bot) calculateCalories(messageLog *models.MessageLog) (int, int, int, bool, bool, bool, bool, bool) {
-	today := utils.GetMoscowDate()
+	now := b.now()
+	today := utils.GetMoscowDateFromTime(now)
 
 	// ДЕБАГ: Логируем входные данные
 	b.logger.Infof("DEBUG calculateCalories: today=%s, LastTrainingDate=%v, StreakDays=%d, CalorieStreakDays=%d",
@@ -1589,7 +1922,7 @@ func (b *Bot) calculateCalories(messageLog *models.MessageLog) (int, int, int, b
 	newStreakDays := 1
 
 	if messageLog.LastTrainingDate != nil {
-		yesterday := utils.GetMoscowTime().AddDate(0, 0, -1)
+		yesterday := now.AddDate(0, 0, -1)
 		yesterdayStr := utils.GetMoscowDateFromTime(yesterday)
 		b.logger.Infof("DEBUG: Сравниваем LastTrainingDate=%s с yesterday=%s", *messageLog.LastTrainingDate, yesterdayStr)
 
@@ -1614,7 +1947,7 @@ func (b *Bot) calculateCalories(messageLog *models.MessageLog) (int, int, int, b
 	newCalorieStreakDays := 1
 
 	if messageLog.LastTrainingDate != nil {
-		yesterday := utils.GetMoscowTime().AddDate(0, 0, -1)
+		yesterday := now.AddDate(0, 0, -1)
 		yesterdayStr := utils.GetMoscowDateFromTime(yesterday)
 		b.logger.Infof("DEBUG: Сравниваем LastTrainingDate=%s с yesterday=%s для калорий", *messageLog.LastTrainingDate, yesterdayStr)
 
@@ -1641,7 +1974,7 @@ func (b *Bot) calculateCalories(messageLog *models.MessageLog) (int, int, int, b
 	b.logger.Infof("DEBUG: Калории равны количеству дней в серии: %d калорий", caloriesToAdd)
 
 	// Бонус за возвращение после больничного
-	if messageLog.HasSickLeave && messageLog.HasHealthy {
+	if recoveredFromSickLeave(messageLog) {
 		caloriesToAdd += 2
 	}
 
@@ -1689,83 +2022,42 @@ func (b *Bot) formatDurationToDays(duration time.Duration) string {
 }
 
 func (b *Bot) calculateRemainingTime(messageLog *models.MessageLog) time.Duration {
-	b.logger.Infof("DEBUG calculateRemainingTime: HasSickLeave=%t, HasHealthy=%t, SickLeaveStartTime=%v, SickLeaveEndTime=%v",
-		messageLog.HasSickLeave, messageLog.HasHealthy,
-		messageLog.SickLeaveStartTime != nil, messageLog.SickLeaveEndTime != nil)
+	return b.calculateRemainingTimeWithPauses(messageLog, nil)
+}
+
+// calculateRemainingTimeWithPauses рассчитывает оставшееся до удаления время: 7 дней минус время,
+// которое таймер шел с timer_start_time. Больничный из message_log и переданные паузы (отпуска) не засчитываются
+func (b *Bot) calculateRemainingTimeWithPauses(messageLog *models.MessageLog, pauses []pauseWindow) time.Duration {
+	b.logger.Infof("DEBUG calculateRemainingTime: State=%s, SickLeaveStartTime=%v, SickLeaveEndTime=%v, pauses=%d",
+		messageLog.State, messageLog.SickLeaveStartTime != nil, messageLog.SickLeaveEndTime != nil, len(pauses))
+
+	// Полное время таймера (7 дней)
+	fullTimerDuration := 7 * 24 * time.Hour
 
 	// Если нет данных о времени, возвращаем полный таймер
 	if messageLog.TimerStartTime == nil {
 		b.logger.Infof("DEBUG: TimerStartTime is nil, returning full duration")
-		return 7 * 24 * time.Hour
+		return fullTimerDuration
 	}
 
 	// Парсим время начала таймера
 	timerStart, err := utils.ParseMoscowTime(*messageLog.TimerStartTime)
 	if err != nil {
 		b.logger.Errorf("Failed to parse timer start time: %v", err)
-		return 7 * 24 * time.Hour
-	}
-
-	// Полное время таймера (7 дней)
-	fullTimerDuration := 7 * 24 * time.Hour
-
-	// Если был больничный, учитываем его
-	if messageLog.SickLeaveStartTime != nil && messageLog.HasSickLeave && !messageLog.HasHealthy {
-		// Пользователь на больничном - таймер приостановлен
-		// Возвращаем оставшееся время на момент больничного
-		sickLeaveStart, err := utils.ParseMoscowTime(*messageLog.SickLeaveStartTime)
-		if err != nil {
-			b.logger.Errorf("Failed to parse sick leave start time: %v", err)
-			return fullTimerDuration
-		}
-
-		// Рассчитываем время, которое прошло до больничного
-		timeBeforeSickLeave := sickLeaveStart.Sub(timerStart)
-
-		// Оставшееся время на момент больничного
-		remainingTime := fullTimerDuration - timeBeforeSickLeave
-
-		if remainingTime <= 0 {
-			return 0 // Время истекло
-		}
-
-		return remainingTime
+		return fullTimerDuration
 	}
 
-	// Если был больничный и пользователь выздоровел (проверяем по наличию SickLeaveStartTime и SickLeaveEndTime)
-	if messageLog.SickLeaveStartTime != nil && messageLog.SickLeaveEndTime != nil && messageLog.HasHealthy {
-		b.logger.Infof("DEBUG: User recovered from sick leave, calculating remaining time")
-		sickLeaveStart, err := utils.ParseMoscowTime(*messageLog.SickLeaveStartTime)
-		if err != nil {
-			b.logger.Errorf("Failed to parse sick leave start time: %v", err)
-			return fullTimerDuration
-		}
-
-		// Рассчитываем время, которое прошло до больничного
-		timeBeforeSickLeave := sickLeaveStart.Sub(timerStart)
-		b.logger.Infof("DEBUG: Timer start: %v, Sick start: %v, Time before sick: %v", timerStart, sickLeaveStart, timeBeforeSickLeave)
-
-		// Оставшееся время на момент начала больничного
-		remainingTimeAtSickStart := fullTimerDuration - timeBeforeSickLeave
-		b.logger.Infof("DEBUG: Full duration: %v, Remaining at sick start: %v", fullTimerDuration, remainingTimeAtSickStart)
-
-		// Если время истекло до больничного, возвращаем 0
-		if remainingTimeAtSickStart <= 0 {
-			b.logger.Infof("DEBUG: Time expired before sick leave, returning 0")
-			return 0 // Время истекло
-		}
+	// Используем московское время для расчета
+	moscowNow := b.now()
 
-		// После выздоровления возвращаем то же время, что было на момент больничного
-		// Время больничного не засчитывается в общий таймер
-		b.logger.Infof("User recovered from sick leave. Remaining time at sick start: %v", remainingTimeAtSickStart)
-		return remainingTimeAtSickStart
+	// Больничный — такая же пауза, как отпуск: пока он открыт, таймер стоит
+	if sickPause, ok := sickLeavePause(messageLog, moscowNow); ok {
+		pauses = append(pauses, sickPause)
 	}
 
-	// Обычный случай - рассчитываем оставшееся время
-	// Используем московское время для расчета
-	moscowNow := utils.GetMoscowTime()
-	elapsedTime := moscowNow.Sub(timerStart)
+	elapsedTime := activeTimeSince(timerStart, moscowNow, pauses)
 	remainingTime := fullTimerDuration - elapsedTime
+	b.logger.Infof("DEBUG: Timer start: %v, active time: %v, remaining: %v", timerStart, elapsedTime, remainingTime)
 
 	if remainingTime <= 0 {
 		return 0 // Время истекло
@@ -1785,52 +2077,66 @@ func (b *Bot) recoverTimersFromDatabase() error {
 	}
 
 	recoveredCount := 0
+	pausedChats := make(map[int64]bool)
 	for _, user := range users {
 		// Дополнительное логирование для диагностики проблем с короткими ID
-		b.logger.Infof("Processing user: ID=%d, Username='%s', ChatID=%d, HasSickLeave=%t, HasHealthy=%t, IsDeleted=%t, IsExemptFromDeletion=%t",
-			user.UserID, user.Username, user.ChatID, user.HasSickLeave, user.HasHealthy, user.IsDeleted, user.IsExemptFromDeletion)
-
-		// Пропускаем пользователей на больничном
-		if user.HasSickLeave && !user.HasHealthy {
-			b.logger.Infof("Skipping user %d (%s) - on sick leave", user.UserID, user.Username)
-			continue
+		b.logger.Infof("Processing user: ID=%d, Username='%s', ChatID=%d, State=%s",
+			user.UserID, user.Username, user.ChatID, user.State)
+
+		// Пропускаем чаты, где у бота нет прав, — таймеры возобновятся вместе с чатом
+		paused, checked := pausedChats[user.ChatID]
+		if !checked {
+			paused = b.isChatPaused(user.ChatID)
+			pausedChats[user.ChatID] = paused
 		}
-
-		// Пропускаем удаленных пользователей
-		if user.IsDeleted {
-			b.logger.Infof("Skipping user %d (%s) - deleted", user.UserID, user.Username)
+		if paused {
+			b.logger.Infof("Skipping user %d (%s) - chat %d is paused", user.UserID, user.Username, user.ChatID)
 			continue
 		}
 
-		// Пропускаем пользователей, исключенных из удаления
-		if user.IsExemptFromDeletion {
-			b.logger.Infof("Skipping user %d (%s) - exempt from deletion", user.UserID, user.Username)
-			continue
+		if b.resumeTimer(user) {
+			recoveredCount++
 		}
+	}
 
-		// Рассчитываем оставшееся время
-		remainingTime := b.calculateRemainingTime(user)
-		if remainingTime <= 0 {
-			// Время истекло - удаляем пользователя
-			b.logger.Infof("Timer expired for user %d (%s), removing from chat", user.UserID, user.Username)
-			b.removeUser(user.UserID, user.ChatID, user.Username)
-			continue
-		}
+	b.logger.Infof("Successfully recovered %d timers from database", recoveredCount)
+	return nil
+}
 
-		// Восстанавливаем таймер без обновления timer_start_time в БД
-		if user.TimerStartTime != nil {
-			b.restoreTimerWithDuration(user.UserID, user.ChatID, user.Username, remainingTime, *user.TimerStartTime)
-		} else {
-			// Fallback - если timer_start_time отсутствует, используем обычный старт
-			b.startTimerWithDuration(user.UserID, user.ChatID, user.Username, remainingTime)
-		}
-		recoveredCount++
+// resumeTimer продолжает таймер участника с учетом всех пауз, а если время вышло — удаляет его.
+// Возвращает true, если таймер запущен
+func (b *Bot) resumeTimer(user *models.MessageLog) bool {
+	// Пропускаем больных, отпускников, исключенных из удаления и тех, кого нет в чате
+	if !user.State.TimerRuns() {
+		b.logger.Infof("Skipping user %d (%s) - %s", user.UserID, user.Username, user.State.Title())
+		return false
+	}
 
-		b.logger.Infof("Recovered timer for user %d (%s) - remaining time: %v", user.UserID, user.Username, remainingTime)
+	// Пропускаем пользователей в отпуске - таймер возобновит планировщик
+	if b.isOnVacation(user.UserID, user.ChatID, utils.GetMoscowTime()) {
+		b.logger.Infof("Skipping user %d (%s) - on vacation", user.UserID, user.Username)
+		return false
 	}
 
-	b.logger.Infof("Successfully recovered %d timers from database", recoveredCount)
-	return nil
+	// Рассчитываем оставшееся время с учетом больничных, отпусков и пауз чата
+	remainingTime := b.remainingTimeWithPauses(user)
+	if remainingTime <= 0 {
+		// Время истекло - удаляем пользователя
+		b.logger.Infof("Timer expired for user %d (%s), removing from chat", user.UserID, user.Username)
+		b.removeUser(user.UserID, user.ChatID, user.Username)
+		return false
+	}
+
+	// Восстанавливаем таймер без обновления timer_start_time в БД
+	if user.TimerStartTime != nil {
+		b.restoreTimerWithDuration(user.UserID, user.ChatID, user.Username, remainingTime, *user.TimerStartTime)
+	} else {
+		// Fallback - если timer_start_time отсутствует, используем обычный старт
+		b.startTimerWithDuration(user.UserID, user.ChatID, user.Username, remainingTime)
+	}
+
+	b.logger.Infof("Recovered timer for user %d (%s) - remaining time: %v", user.UserID, user.Username, remainingTime)
+	return true
 }
 
 func (b *Bot) sendWeeklyCupsReward(msg *tgbotapi.Message, username string, streakDays int, caloriesAdded int) {
@@ -1874,7 +2180,7 @@ func (b *Bot) sendWeeklyCupsReward(msg *tgbotapi.Message, username string, strea
 #weekly_champion #42_cups #training_streak`, username, streakDays, caloriesAdded, totalCalories, totalCups)
 
 	// Отправляем сообщение с кубками
-	reply := tgbotapi.NewMessage(msg.Chat.ID, cupsMessage)
+	reply := b.newReply(msg, cupsMessage)
 
 	b.logger.Infof("Sending weekly cups reward to chat %d for user %s (streak: %d days)", msg.Chat.ID, username, streakDays)
 	_, err = b.api.Send(reply)
@@ -1932,7 +2238,7 @@ func (b *Bot) sendMonthlyCupsReward(msg *tgbotapi.Message, username string, stre
 #monthly_legend #420_cups #training_legend`, username, streakDays, caloriesAdded, totalCalories, totalCups)
 
 	// Отправляем сообщение с кубками
-	reply := tgbotapi.NewMessage(msg.Chat.ID, cupsMessage)
+	reply := b.newReply(msg, cupsMessage)
 
 	b.logger.Infof("Sending monthly cups reward to chat %d for user %s (streak: %d days)", msg.Chat.ID, username, streakDays)
 	_, err = b.api.Send(reply)
@@ -1981,7 +2287,7 @@ func (b *Bot) sendQuarterlyCupsReward(msg *tgbotapi.Message, username string, st
 #quarterly_god #4200_cups #training_emperor`, username, streakDays, caloriesAdded, totalCalories, totalCups)
 
 	// Отправляем сообщение с кубками
-	reply := tgbotapi.NewMessage(msg.Chat.ID, cupsMessage)
+	reply := b.newReply(msg, cupsMessage)
 
 	b.logger.Infof("Sending quarterly cups reward to chat %d for user %s (streak: %d days)", msg.Chat.ID, username, streakDays)
 	_, err = b.api.Send(reply)
@@ -2032,7 +2338,7 @@ func (b *Bot) sendTwoWeekCupsReward(msg *tgbotapi.Message, username string, stre
 #two_week_champion #42_cups #training_warrior`, username, streakDays, caloriesAdded, totalCalories, totalCups)
 
 	// Отправляем сообщение с кубками
-	reply := tgbotapi.NewMessage(msg.Chat.ID, cupsMessage)
+	reply := b.newReply(msg, cupsMessage)
 
 	b.logger.Infof("Sending two-week cups reward to chat %d for user %s (streak: %d days)", msg.Chat.ID, username, streakDays)
 	_, err = b.api.Send(reply)
@@ -2088,7 +2394,7 @@ func (b *Bot) sendThreeWeekCupsReward(msg *tgbotapi.Message, username string, st
 #three_week_legend #42_cups #training_king`, username, streakDays, caloriesAdded, totalCalories, totalCups)
 
 	// Отправляем сообщение с кубками
-	reply := tgbotapi.NewMessage(msg.Chat.ID, cupsMessage)
+	reply := b.newReply(msg, cupsMessage)
 
 	b.logger.Infof("Sending three-week cups reward to chat %d for user %s (streak: %d days)", msg.Chat.ID, username, streakDays)
 	_, err = b.api.Send(reply)
@@ -2125,7 +2431,7 @@ func (b *Bot) sendSuperLevelMessage(msg *tgbotapi.Message, username string, tota
 #super_level #%d_cups #motivation_king`, username, totalCups, totalCups)
 
 	// Отправляем сообщение о супер-уровне
-	reply := tgbotapi.NewMessage(msg.Chat.ID, superMessage)
+	reply := b.newReply(msg, superMessage)
 
 	b.logger.Infof("Sending super level message to chat %d for user %s (total cups: %d)", msg.Chat.ID, username, totalCups)
 	_, err := b.api.Send(reply)
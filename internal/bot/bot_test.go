@@ -1,26 +1,45 @@
 package bot
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"leo-bot/internal/config"
+	"leo-bot/internal/database"
+	"leo-bot/internal/dispatch"
+	"leo-bot/internal/hashtags"
 	"leo-bot/internal/logger"
 	"leo-bot/internal/models"
+	"leo-bot/internal/outbox"
+	"leo-bot/internal/state"
 	"leo-bot/internal/utils"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// fixedClock возвращает часы, которые всегда показывают now
+func fixedClock(now time.Time) func() time.Time {
+	return func() time.Time { return now }
+}
+
 func TestCalculateRemainingTime(t *testing.T) {
 	// Создаем мок логгер
 	log := logger.New("info")
 
-	// Создаем тестовый бот
+	// Создаем тестовый бот с остановленными часами, чтобы время не шло между расчетом и проверкой
+	now := time.Date(2024, 9, 20, 12, 0, 0, 0, time.UTC)
 	cfg := &config.Config{OwnerID: 123}
 	bot := &Bot{
 		logger: log,
 		config: cfg,
+		clock:  fixedClock(now),
 	}
 
 	// Тест 1: Нет данных о времени
@@ -33,16 +52,17 @@ func TestCalculateRemainingTime(t *testing.T) {
 	}
 
 	// Тест 2: Есть данные о времени
-	timerStart := time.Now().Add(-2 * 24 * time.Hour).Format(time.RFC3339)
-	sickLeaveStart := time.Now().Add(-1 * 24 * time.Hour).Format(time.RFC3339)
+	timerStart := now.Add(-2 * 24 * time.Hour).Format(time.RFC3339)
+	sickLeaveStart := now.Add(-1 * 24 * time.Hour).Format(time.RFC3339)
 
 	messageLogWithTime := &models.MessageLog{
 		TimerStartTime:     &timerStart,
 		SickLeaveStartTime: &sickLeaveStart,
+		State:              state.Sick,
 	}
 
 	remainingTime = bot.calculateRemainingTime(messageLogWithTime)
-	expectedTime = 5 * 24 * time.Hour // 7 - 2 = 5 дней
+	expectedTime = 6 * 24 * time.Hour // таймер шел 1 день до больничного: 7 - 1 = 6 дней
 
 	if remainingTime != expectedTime {
 		t.Errorf("Expected %v, got %v", expectedTime, remainingTime)
@@ -59,8 +79,7 @@ func TestCalculateRemainingTime(t *testing.T) {
 	messageLogSickLeave := &models.MessageLog{
 		TimerStartTime:     &timerStartStr,
 		SickLeaveStartTime: &sickStartStr,
-		HasSickLeave:       true,
-		HasHealthy:         true, // Пользователь выздоровел
+		State:              state.Sick,
 	}
 
 	remainingTime = bot.calculateRemainingTime(messageLogSickLeave)
@@ -130,6 +149,7 @@ func TestSickLeaveRecoveryScenario(t *testing.T) {
 	bot := &Bot{
 		logger: log,
 		config: cfg,
+		clock:  fixedClock(time.Date(2024, 9, 19, 10, 0, 0, 0, time.UTC)),
 	}
 
 	// Тест: Больничный сценарий - тренировка, больничный, выздоровление
@@ -144,8 +164,7 @@ func TestSickLeaveRecoveryScenario(t *testing.T) {
 	messageLogSickLeave := &models.MessageLog{
 		TimerStartTime:     &timerStartStr,
 		SickLeaveStartTime: &sickStartStr,
-		HasSickLeave:       true,
-		HasHealthy:         false, // На больничном
+		State:              state.Sick,
 	}
 
 	// Проверяем время на больничном
@@ -156,8 +175,10 @@ func TestSickLeaveRecoveryScenario(t *testing.T) {
 		t.Errorf("On sick leave: Expected %v, got %v", expectedTimeOnSick, remainingTimeOnSick)
 	}
 
-	// Пользователь выздоровел
-	messageLogSickLeave.HasHealthy = true
+	// Пользователь выздоровел только что — таймер продолжается с места остановки
+	sickEndStr := bot.now().Format(time.RFC3339)
+	messageLogSickLeave.State = state.Active
+	messageLogSickLeave.SickLeaveEndTime = &sickEndStr
 
 	// Проверяем время после выздоровления
 	remainingTimeAfterRecovery := bot.calculateRemainingTime(messageLogSickLeave)
@@ -174,13 +195,59 @@ func TestSickLeaveRecoveryScenario(t *testing.T) {
 	if formattedTime != expectedFormatted {
 		t.Errorf("Formatted time: Expected %s, got %s", expectedFormatted, formattedTime)
 	}
+
+	// Первая тренировка после выздоровления приносит бонус, а на больничном — нет
+	if calories, _, _, _, _, _, _, _ := bot.calculateCalories(messageLogSickLeave); calories != 1+2 {
+		t.Errorf("Expected 3 calories after recovery, got %d", calories)
+	}
+	messageLogSickLeave.State = state.Sick
+	if calories, _, _, _, _, _, _, _ := bot.calculateCalories(messageLogSickLeave); calories != 1 {
+		t.Errorf("Expected 1 calorie during sick leave, got %d", calories)
+	}
+}
+
+// stubTelegram отвечает на запросы Bot API без сети: results — JSON-результат по имени метода
+type stubTelegram struct {
+	results map[string]string
+}
+
+func (s *stubTelegram) Do(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	result, ok := s.results[method]
+	body := fmt.Sprintf(`{"ok":true,"result":%s}`, result)
+	if !ok {
+		body = fmt.Sprintf(`{"ok":false,"error_code":400,"description":"Bad Request: unexpected method %s"}`, method)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     make(http.Header),
+		Request:    req,
+	}, nil
+}
+
+// newStubAPI создает клиент Bot API, который получает ответы от stubTelegram
+func newStubAPI(t *testing.T, results map[string]string) *telegramAPI {
+	t.Helper()
+	if _, ok := results["getMe"]; !ok {
+		results["getMe"] = `{"id":1,"is_bot":true,"first_name":"Leo","username":"leo_bot"}`
+	}
+	api, err := tgbotapi.NewBotAPIWithClient("test-token", tgbotapi.APIEndpoint, &stubTelegram{results: results})
+	if err != nil {
+		t.Fatalf("failed to create stub API: %v", err)
+	}
+	return &telegramAPI{BotAPI: api}
 }
 
 func TestIsAdmin(t *testing.T) {
-	// Создаем тестовый бот
+	// Создаем тестовый бот: Telegram отвечает, что пользователь — обычный участник
 	cfg := &config.Config{OwnerID: 123}
 	bot := &Bot{
 		config: cfg,
+		logger: logger.New("info"),
+		api: newStubAPI(t, map[string]string{
+			"getChatMember": `{"user":{"id":789,"is_bot":false,"first_name":"Member"},"status":"member"}`,
+		}),
 	}
 
 	// Тест: Пользователь является владельцем
@@ -194,6 +261,14 @@ func TestIsAdmin(t *testing.T) {
 	if isAdmin {
 		t.Error("Non-owner should not be admin")
 	}
+
+	// Тест: Пользователь — администратор чата
+	bot.api = newStubAPI(t, map[string]string{
+		"getChatMember": `{"user":{"id":789,"is_bot":false,"first_name":"Admin"},"status":"administrator"}`,
+	})
+	if !bot.isAdmin(456, 789) {
+		t.Error("Chat administrator should be admin")
+	}
 }
 
 func TestHandleSendToChat(t *testing.T) {
@@ -257,7 +332,7 @@ func TestCalculateCaloriesWeeklyAchievement(t *testing.T) {
 
 	// Симулируем 7 дней подряд тренировок
 	for day := 1; day <= 7; day++ {
-		calories, streakDays, weeklyAchievement, twoWeekAchievement, threeWeekAchievement, monthlyAchievement, quarterlyAchievement := bot.calculateCalories(messageLog)
+		calories, streakDays, calorieStreakDays, weeklyAchievement, twoWeekAchievement, threeWeekAchievement, monthlyAchievement, quarterlyAchievement := bot.calculateCalories(messageLog)
 
 		if day == 7 {
 			// На 7-й день должно быть недельное достижение
@@ -267,8 +342,8 @@ func TestCalculateCaloriesWeeklyAchievement(t *testing.T) {
 			if streakDays != 7 {
 				t.Errorf("Day %d: Expected streak days 7, got %d", day, streakDays)
 			}
-			if calories < 6 { // 1 базовая + 5 за 7 дней
-				t.Errorf("Day %d: Expected calories >= 6 for 7-day streak, got %d", day, calories)
+			if calories != 7 { // калорий столько же, сколько дней в серии
+				t.Errorf("Day %d: Expected 7 calories for 7-day streak, got %d", day, calories)
 			}
 			// На 7-й день не должно быть других достижений
 			if twoWeekAchievement {
@@ -304,17 +379,19 @@ func TestCalculateCaloriesWeeklyAchievement(t *testing.T) {
 
 		// Обновляем данные для следующего дня
 		messageLog.StreakDays = streakDays
+		messageLog.CalorieStreakDays = calorieStreakDays
 		// Симулируем, что следующая тренировка будет завтра
 		messageLog.LastTrainingDate = nil
 	}
 
 	// Тест 2: Проверяем, что достижение срабатывает только на 7-й день
 	messageLog2 := &models.MessageLog{
-		LastTrainingDate: nil,
-		StreakDays:       6, // 6 дней подряд
+		LastTrainingDate:  nil,
+		StreakDays:        6, // 6 дней подряд
+		CalorieStreakDays: 6,
 	}
 
-	calories2, streakDays2, weeklyAchievement2, twoWeekAchievement2, threeWeekAchievement2, monthlyAchievement2, quarterlyAchievement2 := bot.calculateCalories(messageLog2)
+	calories2, streakDays2, _, weeklyAchievement2, _, _, monthlyAchievement2, quarterlyAchievement2 := bot.calculateCalories(messageLog2)
 
 	// На 7-й день должно быть недельное достижение
 	if !weeklyAchievement2 {
@@ -323,8 +400,8 @@ func TestCalculateCaloriesWeeklyAchievement(t *testing.T) {
 	if streakDays2 != 7 {
 		t.Errorf("Expected streak days 7, got %d", streakDays2)
 	}
-	if calories2 < 6 {
-		t.Errorf("Expected calories >= 6 for 7-day streak, got %d", calories2)
+	if calories2 != 7 {
+		t.Errorf("Expected 7 calories for 7-day streak, got %d", calories2)
 	}
 	// На 7-й день не должно быть месячного и квартального достижений
 	if monthlyAchievement2 {
@@ -336,11 +413,12 @@ func TestCalculateCaloriesWeeklyAchievement(t *testing.T) {
 
 	// Тест 3: Проверяем, что на 6-й день нет достижения
 	messageLog3 := &models.MessageLog{
-		LastTrainingDate: nil,
-		StreakDays:       5, // 5 дней подряд
+		LastTrainingDate:  nil,
+		StreakDays:        5, // 5 дней подряд
+		CalorieStreakDays: 5,
 	}
 
-	calories3, streakDays3, weeklyAchievement3, twoWeekAchievement3, threeWeekAchievement3, monthlyAchievement3, quarterlyAchievement3 := bot.calculateCalories(messageLog3)
+	calories3, streakDays3, _, weeklyAchievement3, _, _, monthlyAchievement3, quarterlyAchievement3 := bot.calculateCalories(messageLog3)
 
 	// На 6-й день не должно быть достижений
 	if weeklyAchievement3 {
@@ -355,8 +433,8 @@ func TestCalculateCaloriesWeeklyAchievement(t *testing.T) {
 	if streakDays3 != 6 {
 		t.Errorf("Expected streak days 6, got %d", streakDays3)
 	}
-	if calories3 < 3 { // 1 базовая + 2 за 3+ дня
-		t.Errorf("Expected calories >= 3 for 6-day streak, got %d", calories3)
+	if calories3 != 6 {
+		t.Errorf("Expected 6 calories for 6-day streak, got %d", calories3)
 	}
 
 	// Проверяем, что функции не падают с ошибками
@@ -374,11 +452,12 @@ func TestCalculateCaloriesMonthlyAchievement(t *testing.T) {
 
 	// Тест: Пользователь достигает 30-дневной серии
 	messageLog := &models.MessageLog{
-		LastTrainingDate: nil,
-		StreakDays:       29, // 29 дней подряд
+		LastTrainingDate:  nil,
+		StreakDays:        29, // 29 дней подряд
+		CalorieStreakDays: 29,
 	}
 
-	calories, streakDays, weeklyAchievement, twoWeekAchievement, threeWeekAchievement, monthlyAchievement, quarterlyAchievement := bot.calculateCalories(messageLog)
+	calories, streakDays, _, weeklyAchievement, _, _, monthlyAchievement, quarterlyAchievement := bot.calculateCalories(messageLog)
 
 	// На 30-й день должно быть месячное достижение
 	if !monthlyAchievement {
@@ -387,8 +466,8 @@ func TestCalculateCaloriesMonthlyAchievement(t *testing.T) {
 	if streakDays != 30 {
 		t.Errorf("Expected streak days 30, got %d", streakDays)
 	}
-	if calories < 21 { // 1 базовая + 20 за 30 дней
-		t.Errorf("Expected calories >= 21 for 30-day streak, got %d", calories)
+	if calories != 30 {
+		t.Errorf("Expected 30 calories for 30-day streak, got %d", calories)
 	}
 	// На 30-й день не должно быть недельного и квартального достижений
 	if weeklyAchievement {
@@ -400,11 +479,12 @@ func TestCalculateCaloriesMonthlyAchievement(t *testing.T) {
 
 	// Тест: Пользователь не достигает месячной серии
 	messageLog2 := &models.MessageLog{
-		LastTrainingDate: nil,
-		StreakDays:       14, // 14 дней подряд
+		LastTrainingDate:  nil,
+		StreakDays:        14, // 14 дней подряд
+		CalorieStreakDays: 14,
 	}
 
-	calories2, streakDays2, _, _, _, monthlyAchievement2, quarterlyAchievement2 := bot.calculateCalories(messageLog2)
+	calories2, streakDays2, _, _, _, _, monthlyAchievement2, quarterlyAchievement2 := bot.calculateCalories(messageLog2)
 
 	// На 15-й день не должно быть месячного и квартального достижений
 	if monthlyAchievement2 {
@@ -416,8 +496,8 @@ func TestCalculateCaloriesMonthlyAchievement(t *testing.T) {
 	if streakDays2 != 15 {
 		t.Errorf("Expected streak days 15, got %d", streakDays2)
 	}
-	if calories2 < 11 { // 1 базовая + 10 за 14+ дней
-		t.Errorf("Expected calories >= 11 for 15-day streak, got %d", calories2)
+	if calories2 != 15 {
+		t.Errorf("Expected 15 calories for 15-day streak, got %d", calories2)
 	}
 
 	// Проверяем, что функции не падают с ошибками
@@ -435,11 +515,12 @@ func TestCalculateCaloriesQuarterlyAchievement(t *testing.T) {
 
 	// Тест: Пользователь достигает 90-дневной серии
 	messageLog := &models.MessageLog{
-		LastTrainingDate: nil,
-		StreakDays:       89, // 89 дней подряд
+		LastTrainingDate:  nil,
+		StreakDays:        89, // 89 дней подряд
+		CalorieStreakDays: 89,
 	}
 
-	calories, streakDays, weeklyAchievement, twoWeekAchievement, threeWeekAchievement, monthlyAchievement, quarterlyAchievement := bot.calculateCalories(messageLog)
+	calories, streakDays, _, weeklyAchievement, _, _, monthlyAchievement, quarterlyAchievement := bot.calculateCalories(messageLog)
 
 	// На 90-й день должно быть квартальное достижение
 	if !quarterlyAchievement {
@@ -448,8 +529,8 @@ func TestCalculateCaloriesQuarterlyAchievement(t *testing.T) {
 	if streakDays != 90 {
 		t.Errorf("Expected streak days 90, got %d", streakDays)
 	}
-	if calories < 21 { // 1 базовая + 20 за 30+ дней
-		t.Errorf("Expected calories >= 21 for 90-day streak, got %d", calories)
+	if calories != 90 {
+		t.Errorf("Expected 90 calories for 90-day streak, got %d", calories)
 	}
 	// На 90-й день не должно быть недельного и месячного достижений (уже были)
 	if weeklyAchievement {
@@ -461,11 +542,12 @@ func TestCalculateCaloriesQuarterlyAchievement(t *testing.T) {
 
 	// Тест: Пользователь не достигает квартальной серии
 	messageLog2 := &models.MessageLog{
-		LastTrainingDate: nil,
-		StreakDays:       45, // 45 дней подряд
+		LastTrainingDate:  nil,
+		StreakDays:        45, // 45 дней подряд
+		CalorieStreakDays: 45,
 	}
 
-	calories2, streakDays2, _, _, _, _, quarterlyAchievement2 := bot.calculateCalories(messageLog2)
+	calories2, streakDays2, _, _, _, _, _, quarterlyAchievement2 := bot.calculateCalories(messageLog2)
 
 	// На 46-й день не должно быть квартального достижения
 	if quarterlyAchievement2 {
@@ -474,8 +556,8 @@ func TestCalculateCaloriesQuarterlyAchievement(t *testing.T) {
 	if streakDays2 != 46 {
 		t.Errorf("Expected streak days 46, got %d", streakDays2)
 	}
-	if calories2 < 21 { // 1 базовая + 20 за 30+ дней
-		t.Errorf("Expected calories >= 21 for 46-day streak, got %d", calories2)
+	if calories2 != 46 {
+		t.Errorf("Expected 46 calories for 46-day streak, got %d", calories2)
 	}
 
 	// Проверяем, что функции не падают с ошибками
@@ -584,7 +666,7 @@ func TestCalculateCaloriesDoubleTraining(t *testing.T) {
 		StreakDays:       0,
 	}
 
-	calories1, streakDays1, weeklyAchievement1, twoWeekAchievement1, threeWeekAchievement1, monthlyAchievement1, quarterlyAchievement1 := bot.calculateCalories(messageLog1)
+	calories1, streakDays1, _, weeklyAchievement1, _, _, monthlyAchievement1, quarterlyAchievement1 := bot.calculateCalories(messageLog1)
 
 	// Первая тренировка должна дать калории и увеличить streak
 	if calories1 == 0 {
@@ -610,7 +692,7 @@ func TestCalculateCaloriesDoubleTraining(t *testing.T) {
 		StreakDays:       1,
 	}
 
-	calories2, streakDays2, weeklyAchievement2, twoWeekAchievement2, threeWeekAchievement2, monthlyAchievement2, quarterlyAchievement2 := bot.calculateCalories(messageLog2)
+	calories2, streakDays2, _, weeklyAchievement2, _, _, monthlyAchievement2, quarterlyAchievement2 := bot.calculateCalories(messageLog2)
 
 	// Вторая тренировка в тот же день не должна дать калории и не должна изменить streak
 	if calories2 != 0 {
@@ -637,7 +719,7 @@ func TestCalculateCaloriesDoubleTraining(t *testing.T) {
 		StreakDays:       1,
 	}
 
-	calories3, streakDays3, weeklyAchievement3, twoWeekAchievement3, threeWeekAchievement3, monthlyAchievement3, quarterlyAchievement3 := bot.calculateCalories(messageLog3)
+	calories3, streakDays3, _, weeklyAchievement3, _, _, monthlyAchievement3, quarterlyAchievement3 := bot.calculateCalories(messageLog3)
 
 	// Тренировка на следующий день должна продолжить серию
 	if calories3 == 0 {
@@ -658,3 +740,1075 @@ func TestCalculateCaloriesDoubleTraining(t *testing.T) {
 
 	t.Log("Double training logic test passed")
 }
+
+func TestParseTopArgs(t *testing.T) {
+	// Без аргументов — калории за всё время
+	period, metric, err := parseTopArgs("")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if period.Title != periodAll.Title || metric != models.MetricCalories {
+		t.Errorf("Expected all-time calories, got %s %s", period.Title, metric)
+	}
+
+	// Аргументы в любом порядке и на русском
+	period, metric, err = parseTopArgs("серия Week")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if period.Title != periodWeek.Title || metric != models.MetricStreak {
+		t.Errorf("Expected weekly streak, got %s %s", period.Title, metric)
+	}
+
+	// Кудосы за месяц
+	period, metric, err = parseTopArgs("kudos month")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if period.Title != periodMonth.Title || metric != models.MetricKudos {
+		t.Errorf("Expected monthly kudos, got %s %s", period.Title, metric)
+	}
+
+	// Неизвестный аргумент
+	if _, _, err := parseTopArgs("year"); err == nil {
+		t.Error("Expected error for unknown argument")
+	}
+}
+
+func TestQuarterSeasonName(t *testing.T) {
+	quarterStart := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	if name := quarterSeasonName(quarterStart); name != "Q4 2026" {
+		t.Errorf("Expected Q4 2026, got %s", name)
+	}
+
+	quarterStart = time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	if name := quarterSeasonName(quarterStart); name != "Q1 2027" {
+		t.Errorf("Expected Q1 2027, got %s", name)
+	}
+}
+
+func TestNewQuarterSeasonWindow(t *testing.T) {
+	day, _ := utils.ParseMoscowDate("2026-11-18")
+	now := day.Add(12 * time.Hour)
+	quarterStart, _ := utils.ParseMoscowDate("2026-10-01")
+
+	// Первый сезон чата начинается с начала квартала, и начальные остатки в его очки не попадают
+	season := newQuarterSeason(-100, now, nil)
+	if !season.StartsAt.Equal(quarterStart) || !season.EndsAt.Equal(quarterStart.AddDate(0, 3, 0)) {
+		t.Errorf("Unexpected first season window: %s — %s", season.StartsAt, season.EndsAt)
+	}
+	if season.Name != "Q4 2026" {
+		t.Errorf("Expected Q4 2026, got %s", season.Name)
+	}
+	if database.CountsOpeningBalance(season.StartsAt) {
+		t.Error("Opening balances must not count towards the first season")
+	}
+
+	// Сезон, заданный администратором, закончился посреди квартала — следующий начинается с его конца
+	lastEnd := quarterStart.AddDate(0, 1, 0)
+	season = newQuarterSeason(-100, now, &lastEnd)
+	if !season.StartsAt.Equal(lastEnd) {
+		t.Errorf("Expected season to start at %s, got %s", lastEnd, season.StartsAt)
+	}
+
+	// Начальные остатки учитываются только в топе за всё время
+	if !database.CountsOpeningBalance(periodAll.Since(now)) {
+		t.Error("Opening balances must count in the all-time top")
+	}
+	if database.CountsOpeningBalance(periodWeek.Since(now)) || database.CountsOpeningBalance(periodMonth.Since(now)) {
+		t.Error("Opening balances must not count in weekly and monthly tops")
+	}
+}
+
+func TestPreviousTeamWeek(t *testing.T) {
+	monday, _ := utils.ParseMoscowDate("2026-10-12")
+	previousMonday, _ := utils.ParseMoscowDate("2026-10-05")
+
+	// В понедельник сразу после полуночи итоги подводятся за только что закончившуюся неделю
+	for _, now := range []time.Time{monday.Add(time.Minute), monday.Add(6*24*time.Hour + 23*time.Hour)} {
+		weekStart, weekEnd := previousTeamWeek(now)
+		if !weekStart.Equal(previousMonday) || !weekEnd.Equal(monday) {
+			t.Errorf("At %s expected week %s — %s, got %s — %s", now, previousMonday, monday, weekStart, weekEnd)
+		}
+	}
+}
+
+func TestFormatTeamStandings(t *testing.T) {
+	text := formatTeamStandings("Зачет:", []*models.TeamStanding{
+		{Name: "Барсы", Members: 2, Trainings: 5},
+		{Name: "Рыси", Members: 3, Trainings: 1},
+	})
+	if !strings.HasPrefix(text, "Зачет:\n\n") {
+		t.Errorf("Expected title first, got %q", text)
+	}
+	if !strings.Contains(text, "Барсы - 5 тренировок (участников: 2)") || !strings.Contains(text, "Рыси - 1 тренировок (участников: 3)") {
+		t.Errorf("Unexpected standings: %q", text)
+	}
+	if strings.Index(text, "Барсы") > strings.Index(text, "Рыси") {
+		t.Errorf("Expected standings order to be kept: %q", text)
+	}
+}
+
+func TestParseChallengeArgs(t *testing.T) {
+	// Среда, 14 октября 2026, полдень по Москве
+	day, _ := utils.ParseMoscowDate("2026-10-14")
+	now := day.Add(12 * time.Hour)
+	resolver := hashtags.NewResolver(map[string]string{"трен": hashtags.TrainingDone})
+
+	challenge, err := parseChallengeArgs([]string{"5", "week", "#Run", "+100", "Пять", "пробежек"}, now, resolver)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if challenge.Target != 5 || challenge.Tag != "run" || challenge.RewardCups != 100 || challenge.Title != "Пять пробежек" {
+		t.Errorf("Unexpected challenge: %+v", challenge)
+	}
+	if expected, _ := utils.ParseMoscowDate("2026-10-19"); !challenge.EndsAt.Equal(expected) {
+		t.Errorf("Expected challenge to end at %s, got %s", expected, challenge.EndsAt)
+	}
+
+	// Дата включительно, награда и название по умолчанию
+	challenge, err = parseChallengeArgs([]string{"20", "2026-10-31"}, now, resolver)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if challenge.RewardCups != defaultChallengeReward || challenge.Title != "20 тренировок" {
+		t.Errorf("Unexpected defaults: %+v", challenge)
+	}
+	if expected, _ := utils.ParseMoscowDate("2026-11-01"); !challenge.EndsAt.Equal(expected) {
+		t.Errorf("Expected challenge to end at %s, got %s", expected, challenge.EndsAt)
+	}
+
+	// Ошибки: цель, срок в прошлом
+	if _, err := parseChallengeArgs([]string{"0", "week"}, now, resolver); err == nil {
+		t.Error("Expected error for zero target")
+	}
+	if _, err := parseChallengeArgs([]string{"5", "2026-10-01"}, now, resolver); err == nil {
+		t.Error("Expected error for past deadline")
+	}
+
+	// Тег через дефис — один тег, а не обрезанный до дефиса
+	challenge, err = parseChallengeArgs([]string{"5", "week", "#trail-run"}, now, resolver)
+	if err != nil || challenge.Tag != "trail-run" {
+		t.Errorf("Expected tag trail-run, got %+v, %v", challenge, err)
+	}
+
+	// Служебные хештеги и псевдонимы чата в теги отчетов не попадают, поэтому тегом челленджа быть не могут
+	for _, tag := range []string{"#training_done", "#training-done", "#тренировка", "#трен"} {
+		if _, err := parseChallengeArgs([]string{"5", "week", tag}, now, resolver); err == nil {
+			t.Errorf("Expected error for command tag %s", tag)
+		}
+	}
+}
+
+func TestChatSettingApply(t *testing.T) {
+	settings := &models.ChatSettings{RedirectOffTopicReports: true, SickDaysPerYear: 30}
+
+	redirect, _ := findChatSetting("redirect_off_topic_reports")
+	if !redirect.apply(settings, "off") || settings.RedirectOffTopicReports || redirect.value(settings) != "off" {
+		t.Errorf("Expected redirect to be turned off, got %t", settings.RedirectOffTopicReports)
+	}
+	if !redirect.apply(settings, "1") || !settings.RedirectOffTopicReports {
+		t.Error("Expected 1 to turn redirect on")
+	}
+	if redirect.apply(settings, "2") || !settings.RedirectOffTopicReports {
+		t.Error("Expected invalid flag to be rejected without changes")
+	}
+
+	sickDays, _ := findChatSetting("sick_days_per_year")
+	if !sickDays.apply(settings, "10") || settings.SickDaysPerYear != 10 || sickDays.value(settings) != "10" {
+		t.Errorf("Expected sick days to be 10, got %d", settings.SickDaysPerYear)
+	}
+	if sickDays.apply(settings, "400") || sickDays.apply(settings, "on") || settings.SickDaysPerYear != 10 {
+		t.Errorf("Expected out of range values to be rejected, got %d", settings.SickDaysPerYear)
+	}
+}
+
+func TestParseSickLeaveReason(t *testing.T) {
+	if reason := parseSickLeaveReason("#SICK_LEAVE   простуда,  температура"); reason != "простуда, температура" {
+		t.Errorf("Expected reason without hashtag, got %q", reason)
+	}
+	if reason := parseSickLeaveReason("#sick_leave"); reason != "" {
+		t.Errorf("Expected empty reason, got %q", reason)
+	}
+}
+
+func TestSickDaysCeil(t *testing.T) {
+	cases := map[time.Duration]int{
+		0:                        0,
+		time.Hour:                1,
+		24 * time.Hour:           1,
+		24*time.Hour + time.Hour: 2,
+	}
+	for duration, expected := range cases {
+		if days := sickDaysCeil(duration); days != expected {
+			t.Errorf("sickDaysCeil(%v) = %d, expected %d", duration, days, expected)
+		}
+	}
+}
+
+func TestNextSickLeaveAction(t *testing.T) {
+	started := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	settings := &models.ChatSettings{MaxSickLeaveDays: 14, SickReminderIntervalDays: 3}
+	leave := &models.SickLeave{StartedAt: started}
+	closesAt := started.Add(14 * 24 * time.Hour)
+
+	if action := nextSickLeaveAction(leave, settings, closesAt, started.Add(48*time.Hour)); action != sickLeaveWait {
+		t.Errorf("Expected wait after 2 days, got %d", action)
+	}
+	if action := nextSickLeaveAction(leave, settings, closesAt, started.Add(72*time.Hour)); action != sickLeaveRemind {
+		t.Errorf("Expected reminder after 3 days, got %d", action)
+	}
+
+	// После напоминания следующее — только через интервал
+	reminded := started.Add(72 * time.Hour)
+	leave.LastRemindedAt = &reminded
+	if action := nextSickLeaveAction(leave, settings, closesAt, started.Add(96*time.Hour)); action != sickLeaveWait {
+		t.Errorf("Expected wait right after reminder, got %d", action)
+	}
+
+	// Максимальный срок важнее напоминаний, в том числе если бот был выключен дольше срока
+	if action := nextSickLeaveAction(leave, settings, closesAt, started.Add(20*24*time.Hour)); action != sickLeaveExpire {
+		t.Errorf("Expected expiry after max length, got %d", action)
+	}
+
+	// Напоминания можно отключить
+	settings.SickReminderIntervalDays = 0
+	leave.LastRemindedAt = nil
+	if action := nextSickLeaveAction(leave, settings, closesAt, started.Add(10*24*time.Hour)); action != sickLeaveWait {
+		t.Errorf("Expected no reminders when disabled, got %d", action)
+	}
+}
+
+func TestSickLeaveClosesAt(t *testing.T) {
+	day := 24 * time.Hour
+	started := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	settings := &models.ChatSettings{SickDaysPerYear: 30, MaxSickLeaveDays: 14}
+	leave := &models.SickLeave{StartedAt: started}
+
+	// Дней на год хватает — закрываем по максимальному сроку
+	now := started.Add(2 * day)
+	closesAt, byQuota := sickLeaveClosesAt(leave, settings, 2*day, now)
+	if byQuota || !closesAt.Equal(started.Add(14*day)) {
+		t.Errorf("Expected close by max length at %s, got %s (by quota %t)", started.Add(14*day), closesAt, byQuota)
+	}
+
+	// До этого больничного в году набралось 25 дней: лимит кончится через 5 дней от начала
+	closesAt, byQuota = sickLeaveClosesAt(leave, settings, 27*day, now)
+	if !byQuota || !closesAt.Equal(started.Add(5*day)) {
+		t.Errorf("Expected close by quota at %s, got %s (by quota %t)", started.Add(5*day), closesAt, byQuota)
+	}
+	if action := nextSickLeaveAction(leave, settings, closesAt, started.Add(5*day-time.Minute)); action != sickLeaveWait {
+		t.Errorf("Expected wait before quota is used up, got %d", action)
+	}
+	if action := nextSickLeaveAction(leave, settings, closesAt, started.Add(5*day)); action != sickLeaveExpire {
+		t.Errorf("Expected expiry when quota is used up, got %d", action)
+	}
+
+	// Бот был выключен дольше остатка лимита — закрываем моментом, когда он кончился
+	now = started.Add(7 * day)
+	closesAt, byQuota = sickLeaveClosesAt(leave, settings, 32*day, now)
+	if !byQuota || !closesAt.Equal(started.Add(5*day)) {
+		t.Errorf("Expected close in the past at %s, got %s (by quota %t)", started.Add(5*day), closesAt, byQuota)
+	}
+}
+
+func TestActiveTimeSince(t *testing.T) {
+	start := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(7 * 24 * time.Hour)
+	day := 24 * time.Hour
+
+	if active := activeTimeSince(start, now, nil); active != 7*day {
+		t.Errorf("Expected 7 days without pauses, got %v", active)
+	}
+
+	// Пересекающиеся паузы не вычитаются дважды, паузы вне интервала обрезаются
+	pauses := []pauseWindow{
+		{Start: start.Add(4 * day), End: start.Add(6 * day)},
+		{Start: start.Add(-2 * day), End: start.Add(day)},
+		{Start: start.Add(5 * day), End: start.Add(10 * day)},
+	}
+	if active := activeTimeSince(start, now, pauses); active != 3*day {
+		t.Errorf("Expected 3 active days, got %v", active)
+	}
+
+	if active := activeTimeSince(now, start, pauses); active != 0 {
+		t.Errorf("Expected 0 when now is before start, got %v", active)
+	}
+}
+
+func TestParseVacationDates(t *testing.T) {
+	now, _ := utils.ParseMoscowDate("2026-10-20")
+	now = now.Add(15 * time.Hour)
+
+	startsAt, endsAt, err := parseVacationDates("#vacation 2026-11-01 2026-11-10 на море", now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if utils.GetMoscowDateFromTime(startsAt) != "2026-11-01" || endsAt.Sub(startsAt) != 10*24*time.Hour {
+		t.Errorf("Expected 10 days from 2026-11-01, got %v - %v", startsAt, endsAt)
+	}
+
+	// Отпуск с сегодняшнего дня начинается с текущего момента
+	startsAt, _, err = parseVacationDates("2026-10-20 2026-10-21", now)
+	if err != nil || !startsAt.Equal(now) {
+		t.Errorf("Expected vacation to start now, got %v (%v)", startsAt, err)
+	}
+
+	for _, text := range []string{
+		"#vacation",
+		"#vacation 2026-11-01",
+		"#vacation 2026-11-10 2026-11-01",
+		"#vacation 2026-10-01 2026-10-25",
+		"#vacation 2026-13-01 2026-13-05",
+	} {
+		if _, _, err := parseVacationDates(text, now); err == nil {
+			t.Errorf("Expected error for %q", text)
+		}
+	}
+}
+
+func TestParseAuditArgs(t *testing.T) {
+	query, err := parseAuditArgs([]string{"@leo", "by", "admin", "Removal", "30d"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if query.Target != "@leo" || query.Actor != "@admin" || query.Action != models.AuditRemoval || query.Days != 30 {
+		t.Errorf("Unexpected query: %+v", query)
+	}
+
+	if query, err := parseAuditArgs(nil); err != nil || query != (auditQuery{}) {
+		t.Errorf("Expected empty query without filters, got %+v (%v)", query, err)
+	}
+
+	for _, args := range [][]string{
+		{"by"},
+		{"@leo", "@tiger"},
+		{"0d"},
+		{"warning", "removal"},
+		{"unknown"},
+	} {
+		if _, err := parseAuditArgs(args); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
+
+func TestParseAdjustArgs(t *testing.T) {
+	adj, err := parseAdjustArgs([]string{"Cups", "+2", "бот", "пропустил", "отчет"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if adj.Currency != models.CurrencyCups || adj.Delta != 2 || adj.Reason != "бот пропустил отчет" {
+		t.Errorf("Unexpected adjustment: %+v", adj)
+	}
+
+	if adj, err := parseAdjustArgs([]string{"streak", "-3", "ошибка"}); err != nil || adj.Delta != -3 {
+		t.Errorf("Expected negative streak adjustment, got %+v (%v)", adj, err)
+	}
+
+	for _, args := range [][]string{
+		{"cups", "+2"},
+		{"points", "+2", "причина"},
+		{"cups", "2", "без знака"},
+		{"cups", "+0", "ноль"},
+		{"cups", "+abc", "не число"},
+		{"calories", "+1000000", "слишком много"},
+	} {
+		if _, err := parseAdjustArgs(args); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
+
+func TestParseSetStreakArgs(t *testing.T) {
+	now, _ := utils.ParseMoscowDate("2026-10-20")
+	now = now.Add(15 * time.Hour)
+
+	change, err := parseSetStreakArgs([]string{"10", "2026-10-19", "восстановили", "серию"}, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if change.StreakDays != 10 || change.LastTrainingDate != "2026-10-19" || change.Reason != "восстановили серию" {
+		t.Errorf("Unexpected streak change: %+v", change)
+	}
+
+	if change, err := parseSetStreakArgs([]string{"0", "2026-10-20"}, now); err != nil || change.Reason != "" {
+		t.Errorf("Expected today to be allowed without reason, got %+v (%v)", change, err)
+	}
+
+	for _, args := range [][]string{
+		{"10"},
+		{"-1", "2026-10-19"},
+		{"10", "19.10.2026"},
+		{"10", "2026-10-21"},
+	} {
+		if _, err := parseSetStreakArgs(args, now); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
+
+func TestParseTargetID(t *testing.T) {
+	tests := []struct {
+		arg       string
+		allowBare bool
+		id        int64
+		ok        bool
+	}{
+		{"id:123", false, 123, true},
+		{"ID:123", true, 123, true},
+		{"123", true, 123, true},
+		{"123", false, 0, false},
+		{"id:abc", true, 0, false},
+		{"id:-5", true, 0, false},
+		{"@leo", true, 0, false},
+	}
+
+	for _, tt := range tests {
+		id, ok := parseTargetID(tt.arg, tt.allowBare)
+		if id != tt.id || ok != tt.ok {
+			t.Errorf("parseTargetID(%q, %t) = %d, %t; want %d, %t", tt.arg, tt.allowBare, id, ok, tt.id, tt.ok)
+		}
+	}
+}
+
+func TestMentionedUser(t *testing.T) {
+	// Смещения в UTF-16: эмодзи в команде занимает две единицы
+	text := "/adjust 🦁 Анна Петрова cups +1 пропуск"
+	user := &tgbotapi.User{ID: 42, FirstName: "Анна"}
+	msg := &tgbotapi.Message{
+		Text:     text,
+		Entities: []tgbotapi.MessageEntity{{Type: "text_mention", Offset: 11, Length: 12, User: user}},
+	}
+
+	if got := entityText(text, msg.Entities[0]); got != "Анна Петрова" {
+		t.Fatalf("Unexpected entity text: %q", got)
+	}
+
+	found, rest, ok := mentionedUser(msg, []string{"Анна", "Петрова", "cups", "+1", "пропуск"})
+	if !ok || found.ID != 42 || len(rest) != 3 || rest[0] != "cups" {
+		t.Errorf("Expected mention of user 42 followed by 3 args, got %v %v %t", found, rest, ok)
+	}
+
+	if _, _, ok := mentionedUser(msg, []string{"cups", "+1", "Анна", "Петрова"}); ok {
+		t.Error("Mention must be the first argument")
+	}
+}
+
+func TestBuildRoster(t *testing.T) {
+	spoke := time.Now()
+	entries := []*models.RosterEntry{
+		{UserID: 1, State: state.Active, LastSpokeAt: &spoke},
+		{UserID: 2, State: state.Active},
+		{UserID: 3, State: state.Sick, LastSpokeAt: &spoke},
+		{UserID: 4, State: state.Left, LastSpokeAt: &spoke},
+		{UserID: 5, State: state.Removed},
+		{UserID: 6, State: state.Exempt},
+	}
+
+	report := buildRoster(entries)
+	if len(report.Tracked) != 2 || report.Tracked[0].UserID != 1 || report.Tracked[1].UserID != 3 {
+		t.Errorf("Expected users 1 and 3 to be tracked, got %v", report.Tracked)
+	}
+	if len(report.Silent) != 2 || report.Silent[0].UserID != 2 || report.Silent[1].UserID != 6 {
+		t.Errorf("Expected users 2 and 6 to be silent, got %v", report.Silent)
+	}
+	if len(report.Departed) != 2 || report.Departed[0].UserID != 4 || report.Departed[1].UserID != 5 {
+		t.Errorf("Expected users 4 and 5 to be departed, got %v", report.Departed)
+	}
+}
+
+func TestIsPresentInChat(t *testing.T) {
+	tests := []struct {
+		member   tgbotapi.ChatMember
+		expected bool
+	}{
+		{tgbotapi.ChatMember{Status: "creator"}, true},
+		{tgbotapi.ChatMember{Status: "administrator"}, true},
+		{tgbotapi.ChatMember{Status: "member"}, true},
+		{tgbotapi.ChatMember{Status: "restricted", IsMember: true}, true},
+		{tgbotapi.ChatMember{Status: "restricted"}, false},
+		{tgbotapi.ChatMember{Status: "left"}, false},
+		{tgbotapi.ChatMember{Status: "kicked"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isPresentInChat(tt.member); got != tt.expected {
+			t.Errorf("isPresentInChat(%s, member=%t) = %t, expected %t", tt.member.Status, tt.member.IsMember, got, tt.expected)
+		}
+	}
+}
+
+func TestBotStatus(t *testing.T) {
+	tests := []struct {
+		member   tgbotapi.ChatMember
+		expected string
+	}{
+		{tgbotapi.ChatMember{Status: "administrator", CanRestrictMembers: true}, models.BotStatusActive},
+		{tgbotapi.ChatMember{Status: "administrator"}, models.BotStatusLimited},
+		{tgbotapi.ChatMember{Status: "member"}, models.BotStatusLimited},
+		{tgbotapi.ChatMember{Status: "restricted", IsMember: true}, models.BotStatusLimited},
+		{tgbotapi.ChatMember{Status: "left"}, models.BotStatusRemoved},
+		{tgbotapi.ChatMember{Status: "kicked"}, models.BotStatusRemoved},
+	}
+
+	for _, tt := range tests {
+		if got := botStatus(tt.member); got != tt.expected {
+			t.Errorf("botStatus(%s, can restrict=%t) = %s, expected %s", tt.member.Status, tt.member.CanRestrictMembers, got, tt.expected)
+		}
+	}
+}
+
+func TestParseUpdates(t *testing.T) {
+	result := []byte(`[
+		{"update_id": 1, "message": {"message_id": 10, "message_thread_id": 7, "is_topic_message": true, "chat": {"id": -100, "type": "supergroup"}, "text": "#training_done"}},
+		{"update_id": 2, "message": {"message_id": 11, "message_thread_id": 9, "chat": {"id": -100, "type": "supergroup"}, "text": "ответ в ветке"}},
+		{"update_id": 3, "my_chat_member": {"chat": {"id": -100, "type": "supergroup"}, "from": {"id": 1}, "date": 0,
+			"old_chat_member": {"user": {"id": 2}, "status": "left"}, "new_chat_member": {"user": {"id": 2}, "status": "member"}}}
+	]`)
+
+	updates, err := parseUpdates(result)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(updates) != 3 {
+		t.Fatalf("Expected 3 updates, got %d", len(updates))
+	}
+
+	if updates[0].ThreadID != 7 || updates[0].Update.Message == nil || updates[0].Update.Message.Text != "#training_done" {
+		t.Errorf("Expected forum topic 7 with the report, got %+v", updates[0])
+	}
+	// Ветка ответов в обычной супергруппе — не тема форума
+	if updates[1].ThreadID != 0 {
+		t.Errorf("Expected no topic for a reply thread, got %d", updates[1].ThreadID)
+	}
+	if updates[2].ThreadID != 0 || updates[2].Update.MyChatMember == nil {
+		t.Errorf("Expected my_chat_member update without topic, got %+v", updates[2])
+	}
+}
+
+func TestWebhookSecret(t *testing.T) {
+	secret, err := webhookSecret("configured_secret")
+	if err != nil || secret != "configured_secret" {
+		t.Errorf("Expected configured secret, got %q, %v", secret, err)
+	}
+
+	first, err := webhookSecret("")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, _ := webhookSecret("")
+	// Telegram принимает секрет до 256 символов из A-Z, a-z, 0-9, _ и -
+	if len(first) != 64 || strings.Trim(first, "0123456789abcdef") != "" {
+		t.Errorf("Unexpected generated secret %q", first)
+	}
+	if first == second {
+		t.Error("Generated secrets must differ")
+	}
+}
+
+func TestUpdateKey(t *testing.T) {
+	chat := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	admin := &tgbotapi.User{ID: 1}
+	member := tgbotapi.User{ID: 2}
+
+	tests := []struct {
+		name     string
+		update   tgbotapi.Update
+		expected dispatch.Key
+	}{
+		{"report", tgbotapi.Update{Message: &tgbotapi.Message{Chat: chat, From: &member, Text: "#training_done"}}, dispatch.Key{ChatID: -100, UserID: 2}},
+		{"member added by admin", tgbotapi.Update{Message: &tgbotapi.Message{Chat: chat, From: admin, NewChatMembers: []tgbotapi.User{member}}}, dispatch.Key{ChatID: -100, UserID: 2}},
+		{"member removed by admin", tgbotapi.Update{Message: &tgbotapi.Message{Chat: chat, From: admin, LeftChatMember: &member}}, dispatch.Key{ChatID: -100, UserID: 2}},
+		{"chat member", tgbotapi.Update{ChatMember: &tgbotapi.ChatMemberUpdated{Chat: *chat, From: *admin, NewChatMember: tgbotapi.ChatMember{User: &member}}}, dispatch.Key{ChatID: -100, UserID: 2}},
+		{"bot status", tgbotapi.Update{MyChatMember: &tgbotapi.ChatMemberUpdated{Chat: *chat, From: *admin}}, dispatch.Key{ChatID: -100}},
+		{"unknown", tgbotapi.Update{}, dispatch.Key{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := updateKey(tt.update); got != tt.expected {
+				t.Errorf("updateKey() = %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// recordingLogger запоминает сообщения Infof и Errorf, остальное передает обычному логгеру
+type recordingLogger struct {
+	logger.Logger
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) record(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Infof(format string, args ...interface{})  { l.record(format, args...) }
+func (l *recordingLogger) Errorf(format string, args ...interface{}) { l.record(format, args...) }
+
+func (l *recordingLogger) shutdownLines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var lines []string
+	for _, line := range l.lines {
+		if strings.HasPrefix(line, "Shutdown: ") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestChatIDOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		c        tgbotapi.Chattable
+		expected int64
+	}{
+		{"message", tgbotapi.NewMessage(-100, "text"), -100},
+		{"topic message", topicMessage{MessageConfig: tgbotapi.NewMessage(-100, "text"), ThreadID: 7}, -100},
+		{"edit", tgbotapi.NewEditMessageText(42, 1, "text"), 42},
+		{"delete", tgbotapi.NewDeleteMessage(-100, 1), -100},
+		{"callback", tgbotapi.NewCallback("id", "text"), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chatIDOf(tt.c); got != tt.expected {
+				t.Errorf("chatIDOf() = %d, expected %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPostDoesNotWaitForChatLimit(t *testing.T) {
+	log := logger.New("error")
+	cfg := outbox.DefaultConfig()
+	cfg.ChatRate, cfg.ChatBurst = 0.001, 1 // второе сообщение в чат ждало бы лимита очень долго
+	api := newStubAPI(t, map[string]string{
+		"sendMessage": `{"message_id":1,"date":0,"chat":{"id":-100,"type":"group"},"text":"ok"}`,
+	})
+	api.outbox = outbox.New(cfg, log)
+	b := &Bot{api: api, logger: log}
+
+	started := time.Now()
+	b.post(tgbotapi.NewMessage(-100, "первый"))
+	b.post(tgbotapi.NewMessage(-100, "второй"))
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("post blocked for %v", elapsed)
+	}
+
+	// Первое сообщение уходит сразу, второе ждет в очереди чата, не занимая вызывающего
+	deadline := time.Now().Add(2 * time.Second)
+	for api.outbox.Metrics().Sent < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if metrics := api.outbox.Metrics(); metrics.Sent != 1 || metrics.Queued != 1 {
+		t.Errorf("Expected 1 sent and 1 queued message, got %+v", metrics)
+	}
+}
+
+func TestShutdownWaitsForInFlightWork(t *testing.T) {
+	log := &recordingLogger{Logger: logger.New("error")}
+	b := &Bot{
+		api:             &telegramAPI{outbox: outbox.New(outbox.DefaultConfig(), log)},
+		logger:          log,
+		dispatcher:      dispatch.New(2, 10, log),
+		shutdownTimeout: 5 * time.Second,
+	}
+
+	var mu sync.Mutex
+	var events []string
+	event := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, name)
+	}
+
+	// Обработчик обновления, который еще работает и в конце отправляет ответ через очередь
+	handlerStarted := make(chan struct{})
+	b.dispatcher.Submit(context.Background(), dispatch.Key{ChatID: -100, UserID: 1}, func() {
+		close(handlerStarted)
+		time.Sleep(30 * time.Millisecond)
+		event("handler")
+		go b.api.outbox.Do(-100, func() error {
+			event("reply sent")
+			return nil
+		})
+		time.Sleep(10 * time.Millisecond)
+	})
+	<-handlerStarted
+
+	// Отчет из лички, который еще ждет места в очереди диспетчера
+	b.handoffs.Add(1)
+	go func() {
+		defer b.handoffs.Done()
+		time.Sleep(40 * time.Millisecond)
+		event("handoff")
+	}()
+
+	// Удаление по таймеру, начатое до остановки
+	timerStarted := make(chan struct{})
+	go b.runTimerAction(func() {
+		close(timerStarted)
+		time.Sleep(30 * time.Millisecond)
+		event("timer")
+	})
+	<-timerStarted
+
+	schedulerDone := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		event("scheduler")
+		close(schedulerDone)
+	}()
+
+	if err := b.shutdown(schedulerDone); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	got := strings.Join(events, ",")
+	mu.Unlock()
+	for _, name := range []string{"handler", "reply sent", "handoff", "timer", "scheduler"} {
+		if !strings.Contains(got, name) {
+			t.Errorf("Expected %q to finish before shutdown returned, got %s", name, got)
+		}
+	}
+
+	// Таймер, сработавший после остановки, ничего не делает: он восстановится из БД
+	b.runTimerAction(func() { t.Error("Timer action must not run after shutdown") })
+
+	lines := log.shutdownLines()
+	expected := []string{"update handlers", "scheduler", "timer actions", "outbox"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d shutdown steps, got %v", len(expected), lines)
+	}
+	for i, name := range expected {
+		if !strings.HasPrefix(lines[i], "Shutdown: "+name+" stopped") {
+			t.Errorf("Step %d: expected %q, got %q", i, name, lines[i])
+		}
+	}
+}
+
+func TestRunShutdownTimesOut(t *testing.T) {
+	log := &recordingLogger{Logger: logger.New("error")}
+	block := make(chan struct{})
+	defer close(block)
+
+	laterRan := false
+	steps := []shutdownStep{
+		{name: "fast", wait: func() {}},
+		{name: "stuck", wait: func() { <-block }},
+		{name: "later", wait: func() { laterRan = true }},
+	}
+
+	started := time.Now()
+	err := runShutdown(log, steps, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "stuck") {
+		t.Fatalf("Expected timeout on the stuck step, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Shutdown did not respect the timeout: %v", elapsed)
+	}
+	if laterRan {
+		t.Error("Steps after a timeout must not be waited for")
+	}
+
+	lines := log.shutdownLines()
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "Shutdown: fast stopped") || !strings.HasPrefix(lines[1], "Shutdown: gave up waiting for stuck") {
+		t.Errorf("Unexpected shutdown log: %v", lines)
+	}
+}
+
+func TestMemberActionData(t *testing.T) {
+	for _, action := range []string{actionTraining, actionSick, actionHealthy, actionChange, actionProfile} {
+		data := memberActionData(action, 7123456789)
+		gotAction, userID, ok := parseMemberAction(data)
+		if !ok || gotAction != action || userID != 7123456789 {
+			t.Errorf("parseMemberAction(%q) = %q, %d, %v", data, gotAction, userID, ok)
+		}
+	}
+
+	for _, data := range []string{"", "member:training", "member:dance:1", "member:training:abc", "other:training:1", "member:training:1:2"} {
+		if _, _, ok := parseMemberAction(data); ok {
+			t.Errorf("Expected %q to be rejected", data)
+		}
+	}
+}
+
+func TestMemberKeyboard(t *testing.T) {
+	keyboard := memberKeyboard(7123456789)
+
+	buttons := 0
+	for _, row := range keyboard.InlineKeyboard {
+		for _, button := range row {
+			buttons++
+			if button.CallbackData == nil {
+				t.Fatalf("Button %q has no callback data", button.Text)
+			}
+			// Telegram ограничивает callback data 64 байтами
+			if len(*button.CallbackData) > 64 {
+				t.Errorf("Callback data of %q is too long: %d bytes", button.Text, len(*button.CallbackData))
+			}
+			if _, userID, ok := parseMemberAction(*button.CallbackData); !ok || userID != 7123456789 {
+				t.Errorf("Button %q is not bound to the member: %q", button.Text, *button.CallbackData)
+			}
+		}
+	}
+	if buttons != 5 {
+		t.Errorf("Expected 5 buttons, got %d", buttons)
+	}
+}
+
+func TestParseCallbackQueryTopic(t *testing.T) {
+	result := []byte(`[
+		{"update_id": 4, "callback_query": {"id": "42", "from": {"id": 2}, "data": "member:training:2", "chat_instance": "1",
+			"message": {"message_id": 12, "message_thread_id": 5, "is_topic_message": true, "chat": {"id": -100, "type": "supergroup"}}}}
+	]`)
+
+	updates, err := parseUpdates(result)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(updates) != 1 || updates[0].Update.CallbackQuery == nil {
+		t.Fatalf("Expected a callback query, got %+v", updates)
+	}
+	if updates[0].ThreadID != 5 {
+		t.Errorf("Expected topic of the message with the button, got %d", updates[0].ThreadID)
+	}
+	if key := updateKey(updates[0].Update); key != (dispatch.Key{ChatID: -100, UserID: 2}) {
+		t.Errorf("Expected button press to be ordered with the member's messages, got %+v", key)
+	}
+}
+
+func TestMessageCommands(t *testing.T) {
+	resolver := hashtags.NewResolver(map[string]string{"трен": hashtags.TrainingDone})
+	hashtag := func(offset, length int) tgbotapi.MessageEntity {
+		return tgbotapi.MessageEntity{Type: "hashtag", Offset: offset, Length: length}
+	}
+
+	tests := []struct {
+		name     string
+		msg      *tgbotapi.Message
+		commands []string
+		unknown  []string
+	}{
+		{"report", &tgbotapi.Message{Text: "#training_done #run", Entities: []tgbotapi.MessageEntity{hashtag(0, 14), hashtag(15, 4)}}, []string{hashtags.TrainingDone}, []string{"run"}},
+		{"no separator", &tgbotapi.Message{Text: "#trainingdone", Entities: []tgbotapi.MessageEntity{hashtag(0, 13)}}, []string{hashtags.TrainingDone}, nil},
+		{"hyphen", &tgbotapi.Message{Text: "#training-done", Entities: []tgbotapi.MessageEntity{hashtag(0, 9)}}, []string{hashtags.TrainingDone}, nil},
+		{"chat alias", &tgbotapi.Message{Text: "💪 #трен", Entities: []tgbotapi.MessageEntity{hashtag(3, 5)}}, []string{hashtags.TrainingDone}, nil},
+		{"caption", &tgbotapi.Message{Caption: "#sick_leave простуда", CaptionEntities: []tgbotapi.MessageEntity{hashtag(0, 11)}}, []string{hashtags.SickLeave}, nil},
+		{"longer tag", &tgbotapi.Message{Text: "#training_done_not", Entities: []tgbotapi.MessageEntity{hashtag(0, 18)}}, nil, []string{"training_done_not"}},
+		{"no entity", &tgbotapi.Message{Text: "пишу про #training_done в коде"}, nil, nil},
+		{"typo", &tgbotapi.Message{Text: "#traning_done", Entities: []tgbotapi.MessageEntity{hashtag(0, 13)}}, nil, []string{"traning_done"}},
+		// Теги отчета — только несервисные: псевдоним и написание через дефис в них не попадают
+		{"report tags", &tgbotapi.Message{Text: "#тренировка #Run утром, #training-done и #йога #run", Entities: []tgbotapi.MessageEntity{hashtag(0, 11), hashtag(12, 4), hashtag(24, 9), hashtag(41, 5), hashtag(47, 4)}}, []string{hashtags.TrainingDone}, []string{"run", "йога"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands, unknown := messageCommands(tt.msg, resolver)
+			if len(commands) != len(tt.commands) {
+				t.Errorf("Expected commands %v, got %v", tt.commands, commands)
+			}
+			for _, command := range tt.commands {
+				if !commands[command] {
+					t.Errorf("Expected command %s, got %v", command, commands)
+				}
+			}
+			if strings.Join(unknown, ",") != strings.Join(tt.unknown, ",") {
+				t.Errorf("Expected unknown %v, got %v", tt.unknown, unknown)
+			}
+		})
+	}
+
+	report := &tgbotapi.Message{Text: "#тренировка", Entities: []tgbotapi.MessageEntity{hashtag(0, 11)}}
+	if !isReport(report, resolver) {
+		t.Error("Expected default alias to count as a report")
+	}
+}
+
+func TestReportChoiceData(t *testing.T) {
+	data := reportChoiceData(-1001234567890)
+	chatID, ok := parseReportChoice(data)
+	if !ok || chatID != -1001234567890 {
+		t.Errorf("parseReportChoice(%q) = %d, %v", data, chatID, ok)
+	}
+
+	for _, data := range []string{"", "report", "report:abc", "report:42", "member:training:1", "report:-1:2"} {
+		if _, ok := parseReportChoice(data); ok {
+			t.Errorf("Expected %q to be rejected", data)
+		}
+	}
+}
+
+func TestIsBlockedByUser(t *testing.T) {
+	if !isBlockedByUser(fmt.Errorf("send: %w", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"})) {
+		t.Error("Expected 403 to mean the bot is blocked")
+	}
+	if isBlockedByUser(&tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}) {
+		t.Error("Expected 400 not to mean the bot is blocked")
+	}
+	if isBlockedByUser(fmt.Errorf("connection reset")) {
+		t.Error("Expected network error not to mean the bot is blocked")
+	}
+}
+
+func TestFormatPrivateStatus(t *testing.T) {
+	b := &Bot{logger: logger.New("info")}
+
+	if text := b.formatPrivateStatus(nil); !strings.Contains(text, "ни в одном чате") {
+		t.Errorf("Expected no groups message, got %q", text)
+	}
+
+	text := b.formatPrivateStatus([]groupStatus{
+		{Title: "Бегуны", Log: &models.MessageLog{State: state.Active, Calories: 12, CupsEarned: 3, StreakDays: 4}, TimerRuns: true, Remaining: 50 * time.Hour},
+		{Title: "Пловцы", Log: &models.MessageLog{State: state.Sick}},
+		{Title: "Лыжники", Log: &models.MessageLog{State: state.Active}, Paused: true},
+	})
+	for _, want := range []string{"«Бегуны»", "До удаления: 2 дн. 2 ч.", "Калории: 12", "Кубки: 3", "Серия: 4 дн.", "«Пловцы»\n• Состояние: на больничном\n• 🔥", "«Лыжники»", "Таймеры чата на паузе"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in status:\n%s", want, text)
+		}
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		private bool
+		ok      bool
+		found   bool
+	}{
+		{"top", false, true, true},
+		{"teams", false, true, true},
+		{"top", true, false, true},
+		{"status", true, true, true},
+		{"points", true, true, true},
+		{"stop", false, false, true},
+		{"send_to_chat", false, true, true},
+		{"send_to_chat", true, true, true},
+		{"dance", false, false, false},
+	}
+
+	for _, tt := range tests {
+		_, ok, found := findCommand(tt.name, tt.private)
+		if ok != tt.ok || found != tt.found {
+			t.Errorf("findCommand(%q, %v) = %v, %v, expected %v, %v", tt.name, tt.private, ok, found, tt.ok, tt.found)
+		}
+	}
+
+	// В группе и в личке одно имя ведет к разным обработчикам
+	group, _, _ := findCommand("start", false)
+	private, _, _ := findCommand("start", true)
+	if group.Chat != chatGroup || private.Chat != chatPrivate {
+		t.Errorf("Expected separate group and private /start, got %v and %v", group.Chat, private.Chat)
+	}
+}
+
+func TestBotCommandsRegistry(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, c := range botCommands() {
+		if c.Handler == nil {
+			t.Errorf("Command /%s has no handler", c.Name)
+		}
+		if c.Description.RU == "" || c.Description.EN == "" {
+			t.Errorf("Command /%s needs Russian and English descriptions", c.Name)
+		}
+		if len(c.Help) == 0 {
+			t.Errorf("Command /%s is missing from /help", c.Name)
+		}
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			for _, private := range []bool{false, true} {
+				if !c.worksIn(private) {
+					continue
+				}
+				key := fmt.Sprintf("%s/%v", name, private)
+				if seen[key] {
+					t.Errorf("Command /%s is registered twice (private: %v)", name, private)
+				}
+				seen[key] = true
+			}
+		}
+	}
+}
+
+func TestCommandMenus(t *testing.T) {
+	menus := commandMenus(42)
+	if len(menus) != 4 {
+		t.Fatalf("Expected 4 menus, got %d", len(menus))
+	}
+	if menus := commandMenus(0); len(menus) != 3 {
+		t.Errorf("Expected no owner menu without owner, got %d menus", len(menus))
+	}
+
+	names := func(menu commandMenu, lang string) map[string]string {
+		commands := make(map[string]string)
+		for _, c := range menu.commands(lang) {
+			commands[c.Command] = c.Description
+		}
+		return commands
+	}
+
+	members := names(menus[0], "")
+	admins := names(menus[1], "en")
+	private := names(menus[2], "")
+	owner := names(menus[3], "")
+
+	if menus[0].Scope.Type != "default" || menus[1].Scope.Type != "all_chat_administrators" || menus[2].Scope.Type != "all_private_chats" {
+		t.Errorf("Unexpected scopes: %v, %v, %v", menus[0].Scope, menus[1].Scope, menus[2].Scope)
+	}
+	if menus[3].Scope.Type != "chat" || menus[3].Scope.ChatID != 42 {
+		t.Errorf("Expected owner menu in owner's chat, got %+v", menus[3].Scope)
+	}
+	if _, ok := members["top"]; !ok || members["top"] != "Топ участников за период" {
+		t.Errorf("Expected /top in Russian for members, got %v", members)
+	}
+	if _, ok := members["pardon"]; ok {
+		t.Error("Expected /pardon to be hidden from members")
+	}
+	if admins["pardon"] != "Pardon a removed member" || admins["top"] == "" {
+		t.Errorf("Expected member and admin commands in English for admins, got %v", admins)
+	}
+	if _, ok := private["status"]; !ok {
+		t.Errorf("Expected /status in private chats, got %v", private)
+	}
+	if _, ok := private["send_to_chat"]; ok {
+		t.Error("Expected /send_to_chat to be hidden from members")
+	}
+	if _, ok := owner["send_to_chat"]; !ok {
+		t.Errorf("Expected /send_to_chat for the owner, got %v", owner)
+	}
+	if _, ok := owner["top"]; ok {
+		t.Error("Expected group commands to be missing from the owner's private chat")
+	}
+}
+
+func TestGroupHelpCommands(t *testing.T) {
+	admin, member, private := groupHelpCommands()
+
+	for _, want := range []string{"• /pardon @username [reset] — ", "• /season start <YYYY-MM-DD> [название] — Начать новый сезон"} {
+		if !strings.Contains(admin, want) {
+			t.Errorf("Expected %q in admin help:\n%s", want, admin)
+		}
+	}
+	for _, want := range []string{"• /team, /teams — Командный зачет недели и ваша команда", "• /help — Показать это сообщение", "• /vacation cancel — "} {
+		if !strings.Contains(member, want) {
+			t.Errorf("Expected %q in member help:\n%s", want, member)
+		}
+	}
+	if strings.Contains(member, "/pardon") || strings.Contains(member, "/send_to_chat") {
+		t.Errorf("Expected admin and owner commands to be missing from member help:\n%s", member)
+	}
+	if !strings.Contains(private, "• /status, /points, /cups, /profile — ") || strings.Contains(private, "/help") {
+		t.Errorf("Unexpected private help:\n%s", private)
+	}
+
+	if strings.Contains(privateHelpCommands(false), "/send_to_chat") || !strings.Contains(privateHelpCommands(true), "/send_to_chat") {
+		t.Error("Expected /send_to_chat only in the owner's private help")
+	}
+}
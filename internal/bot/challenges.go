@@ -0,0 +1,376 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"leo-bot/internal/hashtags"
+	"leo-bot/internal/models"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// defaultChallengeReward — награда за челлендж, если админ не указал свою
+	defaultChallengeReward = 42
+	// maxChallengeTarget — верхняя граница цели челленджа
+	maxChallengeTarget = 1000
+)
+
+const challengeUsage = "❌ Использование:\n" +
+	"/challenge — идущие челленджи\n" +
+	"/challenge join <id> — участвовать\n" +
+	"/challenge board <id> — прогресс участников\n" +
+	"/challenge create <цель> <week|month|YYYY-MM-DD> [#тег] [+кубки] [название] — новый челлендж (админ)\n\n" +
+	"Например: /challenge create 5 week #run +100 Пять пробежек за неделю"
+
+// parseChallengeArgs разбирает аргументы /challenge create.
+// Срок: week — до конца недели, month — до конца месяца, дата — до конца указанного дня включительно.
+// Служебный хештег чата (с учетом псевдонимов) тегом челленджа быть не может: в теги отчетов он не попадает
+func parseChallengeArgs(args []string, now time.Time, resolver *hashtags.Resolver) (*models.Challenge, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("not enough arguments")
+	}
+
+	target, err := strconv.Atoi(args[0])
+	if err != nil || target < 1 || target > maxChallengeTarget {
+		return nil, fmt.Errorf("invalid target: %s", args[0])
+	}
+
+	var endsAt time.Time
+	switch strings.ToLower(args[1]) {
+	case "week", "неделя":
+		endsAt = utils.StartOfMoscowWeek(now).AddDate(0, 0, 7)
+	case "month", "месяц":
+		endsAt = utils.StartOfMoscowMonth(now).AddDate(0, 1, 0)
+	default:
+		lastDay, err := utils.ParseMoscowDate(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid deadline: %s", args[1])
+		}
+		endsAt = lastDay.AddDate(0, 0, 1)
+	}
+	if !endsAt.After(now) {
+		return nil, fmt.Errorf("deadline is in the past: %s", args[1])
+	}
+
+	challenge := &models.Challenge{
+		Target:     target,
+		RewardCups: defaultChallengeReward,
+		StartsAt:   now,
+		EndsAt:     endsAt,
+	}
+
+	var titleWords []string
+	for _, arg := range args[2:] {
+		switch {
+		case challenge.Tag == "" && len(titleWords) == 0 && strings.HasPrefix(arg, "#"):
+			tag, ok := hashtags.Parse(arg)
+			if !ok {
+				return nil, fmt.Errorf("invalid tag: %s", arg)
+			}
+			if _, isCommand := resolver.Resolve(tag); isCommand {
+				return nil, fmt.Errorf("command tag: %s", arg)
+			}
+			challenge.Tag = tag
+		case len(titleWords) == 0 && strings.HasPrefix(arg, "+"):
+			reward, err := strconv.Atoi(arg[1:])
+			if err != nil || reward < 0 {
+				return nil, fmt.Errorf("invalid reward: %s", arg)
+			}
+			challenge.RewardCups = reward
+		default:
+			titleWords = append(titleWords, arg)
+		}
+	}
+
+	challenge.Title = strings.Join(titleWords, " ")
+	if challenge.Title == "" {
+		challenge.Title = fmt.Sprintf("%d тренировок", target)
+		if challenge.Tag != "" {
+			challenge.Title = fmt.Sprintf("%d × #%s", target, challenge.Tag)
+		}
+	}
+
+	return challenge, nil
+}
+
+// formatChallenge описывает условия челленджа одной-двумя строками
+func formatChallenge(c *models.Challenge) string {
+	condition := fmt.Sprintf("%d тренировок", c.Target)
+	if c.Tag != "" {
+		condition = fmt.Sprintf("%d отчетов с #%s", c.Target, c.Tag)
+	}
+	return fmt.Sprintf("🎯 [%d] «%s»\n📋 Цель: %s до %s\n🏆 Награда: %d кубков",
+		c.ID, c.Title, condition, utils.GetMoscowDateFromTime(c.EndsAt.Add(-time.Second)), c.RewardCups)
+}
+
+// formatChallengeBoard форматирует таблицу прогресса участников
+func formatChallengeBoard(c *models.Challenge, progress []*models.ChallengeProgress) string {
+	var text strings.Builder
+	text.WriteString(formatChallenge(c) + "\n\n")
+
+	if len(progress) == 0 {
+		text.WriteString(fmt.Sprintf("👥 Участников пока нет. Вступай: /challenge join %d", c.ID))
+		return text.String()
+	}
+
+	for i, entry := range progress {
+		mark := ""
+		if entry.CompletedAt != nil || entry.Progress >= c.Target {
+			mark = " ✅"
+		}
+		text.WriteString(fmt.Sprintf("%s %s - %d/%d%s\n", placeEmoji(i), entry.Username, entry.Progress, c.Target, mark))
+	}
+	return text.String()
+}
+
+func (b *Bot) handleChallenge(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		b.sendActiveChallenges(msg)
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "create":
+		b.handleChallengeCreate(msg, args[1:])
+	case "join":
+		b.handleChallengeJoin(msg, args[1:])
+	case "board":
+		b.handleChallengeBoard(msg, args[1:])
+	default:
+		reply := b.newReply(msg, challengeUsage)
+		b.post(reply)
+	}
+}
+
+func (b *Bot) handleChallengeCreate(msg *tgbotapi.Message, args []string) {
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	challenge, err := parseChallengeArgs(args, utils.GetMoscowTime(), b.hashtagResolver(msg.Chat.ID))
+	if err != nil {
+		b.logger.Warnf("Invalid /challenge create arguments %q: %v", strings.Join(args, " "), err)
+		reply := b.newReply(msg, challengeUsage)
+		b.post(reply)
+		return
+	}
+	challenge.ChatID = msg.Chat.ID
+	challenge.CreatedBy = msg.From.ID
+
+	if err := b.db.CreateChallenge(challenge); err != nil {
+		b.logger.Errorf("Failed to create challenge in chat %d: %v", msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при создании челленджа")
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("Created challenge %d %q in chat %d", challenge.ID, challenge.Title, msg.Chat.ID)
+	b.auditAdmin(msg, models.AuditChallengeCreate, 0, "", fmt.Sprintf("челлендж %d «%s»", challenge.ID, challenge.Title))
+	reply := b.newReply(msg, fmt.Sprintf("🔥 Новый челлендж!\n\n%s\n\n🦁 Вступай: /challenge join %d", formatChallenge(challenge), challenge.ID))
+	b.post(reply)
+}
+
+// findChallenge разбирает ID челленджа и ищет его в чате, сообщая об ошибке в чат
+func (b *Bot) findChallenge(msg *tgbotapi.Message, args []string, usage string) (*models.Challenge, bool) {
+	if len(args) < 1 {
+		reply := b.newReply(msg, usage)
+		b.post(reply)
+		return nil, false
+	}
+
+	challengeID, err := strconv.ParseInt(strings.TrimPrefix(args[0], "#"), 10, 64)
+	if err != nil {
+		reply := b.newReply(msg, usage)
+		b.post(reply)
+		return nil, false
+	}
+
+	challenge, err := b.db.GetChallenge(msg.Chat.ID, challengeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Челлендж %d не найден. Список: /challenge", challengeID))
+		b.post(reply)
+		return nil, false
+	}
+	if err != nil {
+		b.logger.Errorf("Failed to get challenge %d: %v", challengeID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return nil, false
+	}
+
+	return challenge, true
+}
+
+func (b *Bot) handleChallengeJoin(msg *tgbotapi.Message, args []string) {
+	challenge, ok := b.findChallenge(msg, args, "❌ Использование: /challenge join <id>")
+	if !ok {
+		return
+	}
+
+	now := utils.GetMoscowTime()
+	if challenge.IsFinished || !challenge.EndsAt.After(now) {
+		reply := b.newReply(msg, "❌ Этот челлендж уже завершен")
+		b.post(reply)
+		return
+	}
+
+	joined, err := b.db.JoinChallenge(challenge.ID, msg.From.ID, now)
+	if err != nil {
+		b.logger.Errorf("Failed to join challenge %d: %v", challenge.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при вступлении в челлендж")
+		b.post(reply)
+		return
+	}
+	if !joined {
+		reply := b.newReply(msg, "ℹ️ Вы уже участвуете в этом челлендже")
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("User %d joined challenge %d", msg.From.ID, challenge.ID)
+	reply := b.newReply(msg, fmt.Sprintf("💪 %s принимает челлендж «%s»! Отчеты с начала челленджа уже засчитаны", getUserDisplayName(msg.From), challenge.Title))
+	b.post(reply)
+	// Если цель уже достигнута отчетами до вступления, сразу выдаем награду
+	b.checkChallengeProgress(msg.Chat.ID, msg.From.ID)
+}
+
+func (b *Bot) handleChallengeBoard(msg *tgbotapi.Message, args []string) {
+	challenge, ok := b.findChallenge(msg, args, "❌ Использование: /challenge board <id>")
+	if !ok {
+		return
+	}
+
+	progress, err := b.db.GetChallengeProgress(challenge)
+	if err != nil {
+		b.logger.Errorf("Failed to get challenge %d progress: %v", challenge.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	reply := b.newReply(msg, formatChallengeBoard(challenge, progress))
+	if _, err := b.api.Send(reply); err != nil {
+		b.logger.Errorf("Failed to send challenge board: %v", err)
+	}
+}
+
+func (b *Bot) sendActiveChallenges(msg *tgbotapi.Message) {
+	challenges, err := b.db.GetActiveChallenges(msg.Chat.ID, utils.GetMoscowTime())
+	if err != nil {
+		b.logger.Errorf("Failed to get active challenges for chat %d: %v", msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	if len(challenges) == 0 {
+		reply := b.newReply(msg, "🎯 Сейчас нет активных челленджей. Администратор может запустить: /challenge create")
+		b.post(reply)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString("🔥 Активные челленджи:\n\n")
+	for _, challenge := range challenges {
+		text.WriteString(formatChallenge(challenge) + "\n\n")
+	}
+	text.WriteString("🦁 Вступить: /challenge join <id>\n📊 Прогресс: /challenge board <id>")
+
+	reply := b.newReply(msg, text.String())
+	if _, err := b.api.Send(reply); err != nil {
+		b.logger.Errorf("Failed to send active challenges: %v", err)
+	}
+}
+
+// checkChallengeProgress выдает награду за челленджи, цель которых участник уже выполнил
+func (b *Bot) checkChallengeProgress(chatID, userID int64) {
+	now := utils.GetMoscowTime()
+	challenges, err := b.db.GetUserPendingChallenges(chatID, userID, now)
+	if err != nil {
+		b.logger.Errorf("Failed to get pending challenges for user %d: %v", userID, err)
+		return
+	}
+
+	for _, challenge := range challenges {
+		progress, err := b.db.GetChallengeProgress(challenge)
+		if err != nil {
+			b.logger.Errorf("Failed to get challenge %d progress: %v", challenge.ID, err)
+			continue
+		}
+
+		for _, entry := range progress {
+			if entry.UserID == userID && entry.Progress >= challenge.Target {
+				b.completeChallenge(challenge, entry, now)
+			}
+		}
+	}
+}
+
+// completeChallenge отмечает выполнение челленджа, начисляет кубки и поздравляет участника
+func (b *Bot) completeChallenge(challenge *models.Challenge, entry *models.ChallengeProgress, now time.Time) {
+	completed, err := b.db.CompleteChallenge(challenge, entry.UserID, now)
+	if err != nil {
+		b.logger.Errorf("Failed to complete challenge %d for user %d: %v", challenge.ID, entry.UserID, err)
+		return
+	}
+	if !completed {
+		return
+	}
+
+	b.logger.Infof("User %d completed challenge %d, granted %d cups", entry.UserID, challenge.ID, challenge.RewardCups)
+	reply := tgbotapi.NewMessage(challenge.ChatID, fmt.Sprintf("🎉 %s выполнил челлендж «%s»! 🎯 %d/%d\n\n🏆 +%d кубков! Настоящий леопард! 🦁",
+		entry.Username, challenge.Title, entry.Progress, challenge.Target, challenge.RewardCups))
+	if _, err := b.api.Send(reply); err != nil {
+		b.logger.Errorf("Failed to send challenge completion message: %v", err)
+	}
+}
+
+// finishChallenges подводит итоги челленджей, срок которых истек
+func (b *Bot) finishChallenges(now time.Time) {
+	challenges, err := b.db.GetChallengesToFinish(now)
+	if err != nil {
+		b.logger.Errorf("Failed to get challenges to finish: %v", err)
+		return
+	}
+
+	for _, challenge := range challenges {
+		progress, err := b.db.GetChallengeProgress(challenge)
+		if err != nil {
+			b.logger.Errorf("Failed to get challenge %d progress: %v", challenge.ID, err)
+			continue
+		}
+
+		// Добираем награды, которые могли не выдаться при отчете (например, из-за ошибки БД)
+		for _, entry := range progress {
+			if entry.CompletedAt == nil && entry.Progress >= challenge.Target {
+				b.completeChallenge(challenge, entry, now)
+			}
+		}
+
+		finished, err := b.db.FinishChallenge(challenge.ID)
+		if err != nil {
+			b.logger.Errorf("Failed to finish challenge %d: %v", challenge.ID, err)
+			continue
+		}
+		if !finished {
+			continue
+		}
+
+		b.logger.Infof("Finished challenge %d in chat %d", challenge.ID, challenge.ChatID)
+		reply := tgbotapi.NewMessage(challenge.ChatID, "🏁 Челлендж завершен!\n\n"+formatChallengeBoard(challenge, progress))
+		if _, err := b.api.Send(reply); err != nil {
+			b.logger.Errorf("Failed to send challenge results to chat %d: %v", challenge.ChatID, err)
+		}
+	}
+}
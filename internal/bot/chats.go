@@ -0,0 +1,195 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// botStatus определяет, может ли бот следить за чатом с такими правами
+func botStatus(member tgbotapi.ChatMember) string {
+	switch {
+	case !isPresentInChat(member):
+		return models.BotStatusRemoved
+	case member.IsCreator(), member.IsAdministrator() && member.CanRestrictMembers:
+		return models.BotStatusActive
+	default:
+		return models.BotStatusLimited
+	}
+}
+
+// handleMyChatMemberUpdate обрабатывает изменение статуса самого бота: добавление в чат, удаление,
+// повышение до администратора и лишение прав. Без права банить таймеры чата стоят
+func (b *Bot) handleMyChatMemberUpdate(update *tgbotapi.ChatMemberUpdated) {
+	if update.Chat.IsPrivate() {
+		b.handlePrivateChatStatus(update)
+		return
+	}
+	if update.Chat.IsChannel() {
+		return
+	}
+	chatID := update.Chat.ID
+
+	previous := models.BotStatusRemoved
+	known, err := b.db.GetChat(chatID)
+	switch {
+	case err == nil:
+		previous = known.BotStatus
+	case !errors.Is(err, sql.ErrNoRows):
+		b.logger.Errorf("Failed to get chat %d: %v", chatID, err)
+	}
+
+	status := botStatus(update.NewChatMember)
+	chat := &models.Chat{
+		ChatID:    chatID,
+		Title:     update.Chat.Title,
+		BotStatus: status,
+		CanBan:    status == models.BotStatusActive,
+	}
+	added := !isPresentInChat(update.OldChatMember) && isPresentInChat(update.NewChatMember)
+	if added {
+		chat.AddedBy = update.From.ID
+	}
+	if err := b.db.SaveChat(chat); err != nil {
+		b.logger.Errorf("Failed to save chat %d: %v", chatID, err)
+	}
+
+	b.logger.Infof("Bot status in chat %d (%s) changed by %d: %s -> %s", chatID, update.Chat.Title, update.From.ID, previous, chat.BotStatus)
+	b.recordAudit(&models.AuditEntry{
+		ChatID:    chatID,
+		ActorID:   update.From.ID,
+		ActorName: getUserDisplayName(&update.From),
+		Action:    models.AuditBotStatus,
+		Reason:    fmt.Sprintf("%s → %s", previous, chat.BotStatus),
+	})
+
+	switch chat.BotStatus {
+	case models.BotStatusActive:
+		resumed := b.resumeChatTimers(chatID)
+		switch {
+		case resumed:
+			reply := tgbotapi.NewMessage(chatID, "▶️ Права вернули — Леопард снова на охоте!\n\n⏱️ Таймеры продолжились с места остановки, время без прав никому не засчитано.")
+			b.post(reply)
+		case added:
+			reply := tgbotapi.NewMessage(chatID, "🦁 Fat Leopard в чате и готов следить за тренировками!\n\n⏱️ Таймер каждого участника стартует, когда он напишет в чат или вступит в него. Отправляйте #training_done, а подробности — в /help")
+			b.post(reply)
+		}
+	case models.BotStatusLimited:
+		b.pauseChatTimers(chatID, chat.BotStatus)
+		b.warnMissingBanRights(update)
+	case models.BotStatusRemoved:
+		b.pauseChatTimers(chatID, chat.BotStatus)
+	}
+}
+
+// warnMissingBanRights просит того, кто добавил или понизил бота, выдать право банить.
+// Сначала пишет в личку, а если бот не может написать первым — в чат
+func (b *Bot) warnMissingBanRights(update *tgbotapi.ChatMemberUpdated) {
+	text := fmt.Sprintf("⚠️ У меня нет права блокировать участников в чате «%s»!\n\n⏸️ Пока его нет, таймеры в чате стоят — никого не удалю и никому не засчитаю простой.\n\n👮 Сделайте меня администратором с правом «Блокировка участников», и таймеры продолжатся с места остановки.", update.Chat.Title)
+	_, err := b.api.Send(tgbotapi.NewMessage(update.From.ID, text))
+	if err == nil {
+		return
+	}
+	b.logger.Infof("Failed to warn user %d about missing ban rights in private: %v", update.From.ID, err)
+
+	reply := tgbotapi.NewMessage(update.Chat.ID, fmt.Sprintf("%s, %s", getUserDisplayName(&update.From), text))
+	if _, err := b.api.Send(reply); err != nil {
+		b.logger.Errorf("Failed to warn about missing ban rights in chat %d: %v", update.Chat.ID, err)
+	}
+}
+
+// isChatPaused проверяет, стоят ли таймеры чата из-за прав бота
+func (b *Bot) isChatPaused(chatID int64) bool {
+	paused, err := b.db.IsChatPaused(chatID)
+	if err != nil {
+		b.logger.Errorf("Failed to check pause of chat %d: %v", chatID, err)
+		return false
+	}
+	return paused
+}
+
+// pauseChatTimers останавливает таймеры всех участников чата. Старт таймеров в БД сохраняется,
+// а время паузы потом не засчитывается
+func (b *Bot) pauseChatTimers(chatID int64, reason string) {
+	paused, err := b.db.PauseChat(chatID, utils.GetMoscowTime(), reason)
+	if err != nil {
+		b.logger.Errorf("Failed to pause chat %d: %v", chatID, err)
+		return
+	}
+	if !paused {
+		return
+	}
+
+	cancelled := b.cancelChatTimers(chatID)
+	b.logger.Infof("Chat %d paused (%s), cancelled %d timers", chatID, reason, cancelled)
+}
+
+// resumeChatTimers снимает паузу с чата и возобновляет таймеры участников с учетом всех пауз.
+// Возвращает false, если чат не был на паузе
+func (b *Bot) resumeChatTimers(chatID int64) bool {
+	resumed, err := b.db.ResumeChat(chatID, utils.GetMoscowTime())
+	if err != nil {
+		b.logger.Errorf("Failed to resume chat %d: %v", chatID, err)
+		return false
+	}
+	if !resumed {
+		return false
+	}
+
+	users, err := b.db.GetUsersByChatID(chatID)
+	if err != nil {
+		b.logger.Errorf("Failed to get users of resumed chat %d: %v", chatID, err)
+		return true
+	}
+
+	restored := 0
+	for _, user := range users {
+		if b.resumeTimer(user) {
+			restored++
+		}
+	}
+	b.logger.Infof("Chat %d resumed, restored %d timers", chatID, restored)
+	return true
+}
+
+// handleChatMigration переносит данные группы, ставшей супергруппой, на новый ID и перезапускает таймеры
+// под ним. Повторное сообщение о той же миграции ничего не делает
+func (b *Bot) handleChatMigration(oldChatID, newChatID int64) {
+	b.chatMigrationMu.Lock()
+	defer b.chatMigrationMu.Unlock()
+
+	members, err := b.db.MigrateChat(oldChatID, newChatID)
+	if err != nil {
+		b.logger.Errorf("Failed to migrate chat %d to %d: %v", oldChatID, newChatID, err)
+		return
+	}
+	if members == 0 {
+		b.logger.Infof("Chat %d migrated to %d, no members to move", oldChatID, newChatID)
+		return
+	}
+
+	// Горутины таймеров помнят старый ID, поэтому таймеры не переносим, а запускаем заново с оставшимся временем
+	cancelled := b.cancelChatTimers(oldChatID)
+	restored := 0
+	users, err := b.db.GetUsersByChatID(newChatID)
+	if err != nil {
+		b.logger.Errorf("Failed to get users of migrated chat %d: %v", newChatID, err)
+	}
+	for _, user := range users {
+		if b.resumeTimer(user) {
+			restored++
+		}
+	}
+
+	b.logger.Infof("Chat %d migrated to %d: moved %d members, cancelled %d timers, restored %d", oldChatID, newChatID, members, cancelled, restored)
+	b.auditSystem(newChatID, models.AuditChatMigrated, 0, "",
+		fmt.Sprintf("ID %d → %d, участников: %d, таймеров: %d", oldChatID, newChatID, members, restored))
+
+	reply := tgbotapi.NewMessage(newChatID, fmt.Sprintf("🔄 Чат стал супергруппой — Леопард перевел всю стаю на новое место!\n\n👥 Участников: %d\n⏱️ Таймеров продолжено: %d\n\n🏆 Калории, кубки, серии и настройки сохранены.", members, restored))
+	b.post(reply)
+}
@@ -0,0 +1,465 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// commandChat — где работает команда
+type commandChat int
+
+const (
+	chatGroup   commandChat = iota // в групповом чате
+	chatPrivate                    // в личке с ботом
+	chatAny                        // и там, и там
+)
+
+// commandAccess — кому команда предназначена. Права проверяет сам обработчик, а доступ определяет,
+// в каком меню Telegram команда показывается
+type commandAccess int
+
+const (
+	accessMember commandAccess = iota // всем участникам
+	accessAdmin                       // администраторам чата и владельцу
+	accessOwner                       // только владельцу бота
+)
+
+// commandDescription — описание команды в меню Telegram
+type commandDescription struct {
+	RU string
+	EN string
+}
+
+// in возвращает описание на языке меню: en — по-английски, остальные — по-русски
+func (d commandDescription) in(lang string) string {
+	if lang == "en" {
+		return d.EN
+	}
+	return d.RU
+}
+
+// commandUsage — строка /help: аргументы команды и что она делает
+type commandUsage struct {
+	Args  string
+	Text  string
+	Admin bool
+}
+
+// botCommand — команда бота. Из реестра строятся маршрутизация команд, /help и меню команд Telegram
+type botCommand struct {
+	Name        string
+	Aliases     []string
+	Chat        commandChat
+	Access      commandAccess
+	Description commandDescription
+	Help        []commandUsage
+	Handler     func(b *Bot, msg *tgbotapi.Message)
+}
+
+// matches сообщает, вызывается ли команда этим именем
+func (c botCommand) matches(name string) bool {
+	if c.Name == name {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+// worksIn сообщает, работает ли команда в личке или в группе
+func (c botCommand) worksIn(private bool) bool {
+	if c.Chat == chatAny {
+		return true
+	}
+	return (c.Chat == chatPrivate) == private
+}
+
+// names возвращает команду со всеми ее именами для /help: /team, /teams
+func (c botCommand) names() string {
+	names := "/" + c.Name
+	for _, alias := range c.Aliases {
+		names += ", /" + alias
+	}
+	return names
+}
+
+// botCommands — реестр команд бота. У команды с одним именем может быть свой вариант для группы и для лички
+func botCommands() []botCommand {
+	return []botCommand{
+		// Команды участников в группе
+		{
+			Name:        "start",
+			Description: commandDescription{RU: "Приветствие и правила", EN: "Welcome and rules"},
+			Help:        []commandUsage{{Text: "Показать приветствие"}},
+			Handler:     (*Bot).handleStart,
+		},
+		{
+			Name:        "help",
+			Description: commandDescription{RU: "Справка по командам и хештегам", EN: "Commands and hashtags help"},
+			Help:        []commandUsage{{Text: "Показать это сообщение"}},
+			Handler:     (*Bot).handleHelp,
+		},
+		{
+			Name:        "top",
+			Description: commandDescription{RU: "Топ участников за период", EN: "Leaderboard for a period"},
+			Help:        []commandUsage{{Args: "[week|month|all] [trainings|calories|cups|streak|kudos]", Text: "Топ за период по выбранной метрике"}},
+			Handler:     (*Bot).handleTop,
+		},
+		{
+			Name:        "points",
+			Description: commandDescription{RU: "Ваши калории", EN: "Your calories"},
+			Help:        []commandUsage{{Text: "Показать ваши калории"}},
+			Handler:     (*Bot).handlePoints,
+		},
+		{
+			Name:        "cups",
+			Description: commandDescription{RU: "Ваши кубки", EN: "Your cups"},
+			Help:        []commandUsage{{Text: "Показать ваши заработанные кубки"}},
+			Handler:     (*Bot).handleCups,
+		},
+		{
+			Name:        "profile",
+			Description: commandDescription{RU: "Ваш профиль", EN: "Your profile"},
+			Help:        []commandUsage{{Text: "Ваш профиль: тренировки, серия, кубки, кудосы, команда"}},
+			Handler:     (*Bot).handleProfile,
+		},
+		{
+			Name:        "vacation",
+			Description: commandDescription{RU: "Ваши отпуска", EN: "Your vacations"},
+			Help: []commandUsage{
+				{Text: "Ваши отпуска и остаток дней отпуска"},
+				{Args: "<с YYYY-MM-DD> <по YYYY-MM-DD>", Text: "Запланировать отпуск"},
+				{Args: "cancel", Text: "Отменить ближайший отпуск или выйти из текущего"},
+			},
+			Handler: (*Bot).handleVacation,
+		},
+		{
+			Name:        "settings",
+			Description: commandDescription{RU: "Настройки чата", EN: "Chat settings"},
+			Help: []commandUsage{
+				{Text: "Настройки чата"},
+				{Args: "<ключ> <значение>", Text: "Изменить настройку чата (например, sick_days_per_year)", Admin: true},
+			},
+			Handler: (*Bot).handleSettings,
+		},
+		{
+			Name:        "alias",
+			Description: commandDescription{RU: "Псевдонимы хештегов", EN: "Hashtag aliases"},
+			Help: []commandUsage{
+				{Text: "Псевдонимы хештегов (например, #тренировка вместо #training_done)"},
+				{Args: "add #алиас #хештег", Text: "Добавить псевдоним хештега (например, #трен для #training_done)", Admin: true},
+				{Args: "remove #алиас", Text: "Удалить псевдоним хештега", Admin: true},
+			},
+			Handler: (*Bot).handleAlias,
+		},
+		{
+			Name:        "season",
+			Description: commandDescription{RU: "Текущий сезон", EN: "Current season"},
+			Help: []commandUsage{
+				{Text: "Текущий сезон: таблица и время до конца"},
+				{Args: "hall", Text: "Зал славы прошлых сезонов"},
+				{Args: "start <YYYY-MM-DD> [название]", Text: "Начать новый сезон", Admin: true},
+				{Args: "end", Text: "Завершить сезон досрочно", Admin: true},
+			},
+			Handler: (*Bot).handleSeason,
+		},
+		{
+			Name:        "team",
+			Aliases:     []string{"teams"},
+			Description: commandDescription{RU: "Командный зачет", EN: "Team standings"},
+			Help: []commandUsage{
+				{Text: "Командный зачет недели и ваша команда"},
+				{Args: "join <название>", Text: "Вступить в команду"},
+				{Args: "leave", Text: "Выйти из команды"},
+				{Args: "create <название>", Text: "Создать команду", Admin: true},
+				{Args: "delete <название>", Text: "Удалить команду", Admin: true},
+				{Args: "assign @username <название>", Text: "Записать участника в команду", Admin: true},
+			},
+			Handler: (*Bot).handleTeam,
+		},
+		{
+			Name:        "challenge",
+			Aliases:     []string{"challenges"},
+			Description: commandDescription{RU: "Челленджи", EN: "Challenges"},
+			Help: []commandUsage{
+				{Text: "Активные челленджи"},
+				{Args: "join <id>", Text: "Участвовать в челлендже"},
+				{Args: "board <id>", Text: "Прогресс участников челленджа"},
+				{Args: "create <цель> <week|month|YYYY-MM-DD> [#тег] [+кубки] [название]", Text: "Запустить челлендж", Admin: true},
+			},
+			Handler: (*Bot).handleChallenge,
+		},
+
+		// Команды администраторов в группе
+		{
+			Name:        "start_timer",
+			Access:      accessAdmin,
+			Description: commandDescription{RU: "Запустить таймеры всем", EN: "Start timers for everyone"},
+			Help:        []commandUsage{{Text: "Запустить таймеры для всех пользователей", Admin: true}},
+			Handler:     (*Bot).handleStartTimer,
+		},
+		{
+			Name:        "db",
+			Access:      accessAdmin,
+			Description: commandDescription{RU: "Статистика базы данных", EN: "Database statistics"},
+			Help:        []commandUsage{{Text: "Показать статистику БД", Admin: true}},
+			Handler:     (*Bot).handleDB,
+		},
+		{
+			Name:        "roster",
+			Access:      accessAdmin,
+			Description: commandDescription{RU: "Кто пишет, кто молчит, кто ушел", EN: "Who is active, silent or gone"},
+			Help:        []commandUsage{{Text: "Кто в чате пишет, кто молчит и кто ушел", Admin: true}},
+			Handler:     (*Bot).handleRoster,
+		},
+		{
+			Name:        "list_users",
+			Access:      accessAdmin,
+			Description: commandDescription{RU: "Участники и их таймеры", EN: "Members and their timers"},
+			Help:        []commandUsage{{Text: "Список участников чата", Admin: true}},
+			Handler:     (*Bot).handleListUsers,
+		},
+		{
+			Name:        "set_exempt",
+			Access:      accessAdmin,
+			Description: commandDescription{RU: "Исключить участника из удаления", EN: "Exempt a member from removal"},
+			Help:        []commandUsage{{Args: "@username", Text: "Исключить участника из удаления", Admin: true}},
+			Handler:     (*Bot).handleSetExempt,
+		},
+		{
+			Name:        "remove_exempt",
+			Access:      accessAdmin,
+			Description: commandDescription{RU: "Вернуть участнику таймер", EN: "Return a member's timer"},
+			Help:        []commandUsage{{Args: "@username", Text: "Снять исключение и вернуть таймер", Admin: true}},
+			Handler:     (*Bot).handleRemoveExempt,
+		},
+		{
+			Name:        "pardon",
+			Access:      accessAdmin,
+			Description: commandDescription{RU: "Помиловать удаленного участника", EN: "Pardon a removed member"},
+			Help:        []commandUsage{{Args: "@username [reset]", Text: "Разбанить удаленного участника и отправить ему приглашение (reset обнуляет калории и кубки)", Admin: true}},
+			Handler:     (*Bot).handlePardon,
+		},
+		{
+			Name:        "adjust",
+			Access:      accessAdmin,
+			Description: commandDescription{RU: "Исправить калории, кубки или серию", EN: "Adjust calories, cups or streak"},
+			Help:        []commandUsage{{Args: "@username calories|cups|streak <+N|-N> <причина>", Text: "Исправить калории, кубки или серию", Admin: true}},
+			Handler:     (*Bot).handleAdjust,
+		},
+		{
+			Name:        "set_streak",
+			Access:      accessAdmin,
+			Description: commandDescription{RU: "Установить серию участника", EN: "Set a member's streak"},
+			Help:        []commandUsage{{Args: "@username <N> <YYYY-MM-DD> [причина]", Text: "Установить серию и дату последней тренировки", Admin: true}},
+			Handler:     (*Bot).handleSetStreak,
+		},
+		{
+			Name:        "audit",
+			Access:      accessAdmin,
+			Description: commandDescription{RU: "Журнал действий", EN: "Audit log"},
+			Help:        []commandUsage{{Args: "[@username] [by @админ] [действие] [Nd]", Text: "Журнал действий администраторов и бота", Admin: true}},
+			Handler:     (*Bot).handleAudit,
+		},
+
+		// Команды владельца
+		{
+			Name:        "send_to_chat",
+			Chat:        chatAny,
+			Access:      accessOwner,
+			Description: commandDescription{RU: "Отправить сообщение в чат", EN: "Send a message to a chat"},
+			Help:        []commandUsage{{Args: "<chat_id> <текст>", Text: "Отправить сообщение в чат от имени бота"}},
+			Handler:     (*Bot).handleSendToChat,
+		},
+
+		// Команды в личке
+		{
+			Name:        "start",
+			Chat:        chatPrivate,
+			Description: commandDescription{RU: "Включить личные напоминания", EN: "Turn on personal reminders"},
+			Help:        []commandUsage{{Text: "Включить личные напоминания за день до предупреждения в чате"}},
+			Handler:     (*Bot).handlePrivateStart,
+		},
+		{
+			Name:        "status",
+			Aliases:     []string{"points", "cups", "profile"},
+			Chat:        chatPrivate,
+			Description: commandDescription{RU: "Статус во всех чатах", EN: "Your status in all chats"},
+			Help:        []commandUsage{{Text: "Калории, кубки, серия и время до удаления во всех чатах"}},
+			Handler:     (*Bot).sendPrivateStatus,
+		},
+		{
+			Name:        "stop",
+			Chat:        chatPrivate,
+			Description: commandDescription{RU: "Выключить личные напоминания", EN: "Turn off personal reminders"},
+			Help:        []commandUsage{{Text: "Выключить личные напоминания"}},
+			Handler:     (*Bot).handlePrivateStop,
+		},
+		{
+			Name:        "help",
+			Chat:        chatPrivate,
+			Description: commandDescription{RU: "Справка", EN: "Help"},
+			Help:        []commandUsage{{Text: "Показать это сообщение"}},
+			Handler:     (*Bot).handlePrivateHelp,
+		},
+	}
+}
+
+// findCommand ищет команду по имени для группы или лички. found — есть ли команда с таким именем вообще
+func findCommand(name string, private bool) (command botCommand, ok bool, found bool) {
+	for _, c := range botCommands() {
+		if !c.matches(name) {
+			continue
+		}
+		found = true
+		if c.worksIn(private) {
+			return c, true, true
+		}
+	}
+	return botCommand{}, false, found
+}
+
+// handleCommand находит команду в реестре и вызывает ее обработчик
+func (b *Bot) handleCommand(msg *tgbotapi.Message) {
+	name := msg.Command()
+	private := msg.Chat.IsPrivate()
+
+	command, ok, found := findCommand(name, private)
+	switch {
+	case ok:
+		command.Handler(b, msg)
+	case found && private:
+		reply := b.newReply(msg, fmt.Sprintf("🐆 /%s работает только в групповом чате.\n\nВ личке: /status, /stop, /help и отчеты с #training_done", name))
+		b.post(reply)
+	case found:
+		reply := b.newReply(msg, fmt.Sprintf("🐆 /%s работает в личке с ботом — напиши мне!", name))
+		b.post(reply)
+	case private:
+		reply := b.newReply(msg, "🤔 Леопард не знает такой команды. Что он умеет в личке — в /help")
+		b.post(reply)
+	default:
+		b.logger.Warnf("Unknown command: %s", name)
+	}
+}
+
+// formatCommandHelp собирает строки /help для команд, подходящих под filter
+func formatCommandHelp(private bool, filter func(c botCommand, usage commandUsage) bool) string {
+	var lines []string
+	for _, c := range botCommands() {
+		if !c.worksIn(private) {
+			continue
+		}
+		for _, usage := range c.Help {
+			if !filter(c, usage) {
+				continue
+			}
+			line := "• " + c.names()
+			if usage.Args != "" {
+				line = "• /" + c.Name + " " + usage.Args
+			}
+			lines = append(lines, line+" — "+usage.Text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// groupHelpCommands — разделы команд в /help группы
+func groupHelpCommands() (admin, member, private string) {
+	admin = formatCommandHelp(false, func(c botCommand, usage commandUsage) bool {
+		return c.Chat == chatGroup && usage.Admin
+	})
+	member = formatCommandHelp(false, func(c botCommand, usage commandUsage) bool {
+		return c.Chat == chatGroup && !usage.Admin
+	})
+	private = formatCommandHelp(true, func(c botCommand, usage commandUsage) bool {
+		return c.Chat == chatPrivate && c.Name != "help"
+	})
+	return admin, member, private
+}
+
+// privateHelpCommands — команды в /help лички. Команды владельца видит только владелец
+func privateHelpCommands(owner bool) string {
+	return formatCommandHelp(true, func(c botCommand, usage commandUsage) bool {
+		return c.Access == accessMember || owner && c.Access == accessOwner
+	})
+}
+
+// commandMenu — меню команд Telegram для одной области видимости
+type commandMenu struct {
+	Name   string
+	Scope  tgbotapi.BotCommandScope
+	filter func(c botCommand) bool
+}
+
+// commandLanguages — языки меню: "" — для всех, у кого нет своего списка (по-русски), en — для английского интерфейса
+var commandLanguages = []string{"", "en"}
+
+// commandMenus — меню команд: участникам групп, администраторам групп, в личке и в личке владельца
+func commandMenus(ownerID int64) []commandMenu {
+	menus := []commandMenu{
+		{
+			Name:  "members",
+			Scope: tgbotapi.NewBotCommandScopeDefault(),
+			filter: func(c botCommand) bool {
+				return c.Chat == chatGroup && c.Access == accessMember
+			},
+		},
+		{
+			Name:  "administrators",
+			Scope: tgbotapi.NewBotCommandScopeAllChatAdministrators(),
+			filter: func(c botCommand) bool {
+				return c.Chat == chatGroup && c.Access <= accessAdmin
+			},
+		},
+		{
+			Name:  "private chats",
+			Scope: tgbotapi.NewBotCommandScopeAllPrivateChats(),
+			filter: func(c botCommand) bool {
+				return c.worksIn(true) && c.Access == accessMember
+			},
+		},
+	}
+	if ownerID != 0 {
+		menus = append(menus, commandMenu{
+			Name:  "owner",
+			Scope: tgbotapi.NewBotCommandScopeChat(ownerID),
+			filter: func(c botCommand) bool {
+				return c.worksIn(true)
+			},
+		})
+	}
+	return menus
+}
+
+// commands возвращает команды меню на языке lang
+func (m commandMenu) commands(lang string) []tgbotapi.BotCommand {
+	var commands []tgbotapi.BotCommand
+	for _, c := range botCommands() {
+		if m.filter(c) {
+			commands = append(commands, tgbotapi.BotCommand{Command: c.Name, Description: c.Description.in(lang)})
+		}
+	}
+	return commands
+}
+
+// registerCommands публикует меню команд в Telegram. Без меню бот работает, поэтому ошибки только логируются
+func (b *Bot) registerCommands() {
+	for _, menu := range commandMenus(b.config.OwnerID) {
+		registered := true
+		for _, lang := range commandLanguages {
+			request := tgbotapi.NewSetMyCommandsWithScopeAndLanguage(menu.Scope, lang, menu.commands(lang)...)
+			if _, err := b.api.Request(request); err != nil {
+				b.logger.Errorf("Failed to set %s commands (language %q): %v", menu.Name, lang, err)
+				registered = false
+			}
+		}
+		if registered {
+			b.logger.Infof("Registered %s commands", menu.Name)
+		}
+	}
+}
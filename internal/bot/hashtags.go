@@ -0,0 +1,214 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"leo-bot/internal/hashtags"
+	"leo-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxHashtagAliases — сколько псевдонимов хештегов может завести чат
+const maxHashtagAliases = 50
+
+// messageText возвращает текст сообщения, а для медиа — подпись
+func messageText(msg *tgbotapi.Message) string {
+	if msg.Text == "" && msg.Caption != "" {
+		return msg.Caption
+	}
+	return msg.Text
+}
+
+// messageEntities возвращает сущности текста сообщения, а для медиа — подписи
+func messageEntities(msg *tgbotapi.Message) []tgbotapi.MessageEntity {
+	if msg.Text == "" && msg.Caption != "" {
+		return msg.CaptionEntities
+	}
+	return msg.Entities
+}
+
+// hashtagResolver возвращает сопоставитель хештегов с псевдонимами чата. Если псевдонимы не загрузились,
+// работают хотя бы команды и псевдонимы по умолчанию
+func (b *Bot) hashtagResolver(chatID int64) *hashtags.Resolver {
+	aliases, err := b.db.GetHashtagAliases(chatID)
+	if err != nil {
+		b.logger.Errorf("Failed to get hashtag aliases of chat %d: %v", chatID, err)
+	}
+	return hashtags.NewResolver(aliases)
+}
+
+// messageCommands возвращает служебные хештеги сообщения и хештеги, которые не распознаны
+func messageCommands(msg *tgbotapi.Message, resolver *hashtags.Resolver) (map[string]bool, []string) {
+	commands := make(map[string]bool)
+	var unknown []string
+	for _, tag := range hashtags.Extract(messageText(msg), messageEntities(msg)) {
+		if command, ok := resolver.Resolve(tag); ok {
+			commands[command] = true
+		} else {
+			unknown = append(unknown, tag)
+		}
+	}
+	return commands, unknown
+}
+
+// suggestHashtag отвечает на первый хештег, похожий на служебный, подсказкой с правильным написанием
+func (b *Bot) suggestHashtag(msg *tgbotapi.Message, unknown []string, resolver *hashtags.Resolver) {
+	for _, tag := range unknown {
+		command, ok := resolver.Suggest(tag)
+		if !ok {
+			continue
+		}
+
+		b.logger.Infof("User %d wrote #%s in chat %d, suggesting #%s", msg.From.ID, tag, msg.Chat.ID, command)
+		reply := b.newReply(msg, fmt.Sprintf("🤔 Может, ты имел в виду #%s?\n\n🦁 #%s Леопард не знает, так что сообщение не засчитано. Отправь его еще раз с #%s!", command, tag, command))
+		reply.ReplyToMessageID = msg.MessageID
+		b.post(reply)
+		return
+	}
+}
+
+// handleAlias показывает и настраивает псевдонимы служебных хештегов чата:
+// /alias, /alias add #алиас #хештег, /alias remove #алиас
+func (b *Bot) handleAlias(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		b.showHashtagAliases(msg)
+		return
+	}
+
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	switch {
+	case strings.ToLower(args[0]) == "add" && len(args) == 3:
+		b.addHashtagAlias(msg, args[1], args[2])
+	case strings.ToLower(args[0]) == "remove" && len(args) == 2:
+		b.removeHashtagAlias(msg, args[1])
+	default:
+		reply := b.newReply(msg, "❌ Использование:\n/alias — псевдонимы хештегов чата\n/alias add #алиас #хештег — добавить псевдоним\n/alias remove #алиас — удалить псевдоним")
+		b.post(reply)
+	}
+}
+
+// showHashtagAliases выводит псевдонимы по умолчанию и псевдонимы чата
+func (b *Bot) showHashtagAliases(msg *tgbotapi.Message) {
+	aliases, err := b.db.GetHashtagAliases(msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get hashtag aliases of chat %d: %v", msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString("🏷 Псевдонимы хештегов:\n\n")
+	text.WriteString("По умолчанию:\n")
+	text.WriteString(formatHashtagAliases(hashtags.DefaultAliases))
+	if len(aliases) > 0 {
+		text.WriteString("\nЭтого чата:\n")
+		text.WriteString(formatHashtagAliases(aliases))
+	}
+	text.WriteString("\n💡 Написание без _ и - тоже засчитывается: #trainingdone, #training-done")
+	text.WriteString("\n✏️ Добавить (админ): /alias add #алиас #хештег")
+
+	reply := b.newReply(msg, text.String())
+	b.post(reply)
+}
+
+// formatHashtagAliases форматирует псевдонимы по алфавиту
+func formatHashtagAliases(aliases map[string]string) string {
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+
+	var text strings.Builder
+	for _, alias := range names {
+		text.WriteString(fmt.Sprintf("• #%s → #%s\n", alias, aliases[alias]))
+	}
+	return text.String()
+}
+
+// addHashtagAlias добавляет псевдоним служебного хештега
+func (b *Bot) addHashtagAlias(msg *tgbotapi.Message, alias, tag string) {
+	alias = hashtags.Normalize(alias)
+	tag = strings.TrimPrefix(strings.ToLower(tag), "#")
+	if !hashtags.IsCommand(tag) {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Псевдоним можно задать только для хештегов бота: #%s", strings.Join(hashtags.Commands, ", #")))
+		b.post(reply)
+		return
+	}
+	if alias == "" || len([]rune(alias)) > 64 || strings.ContainsAny(alias, "#@/") {
+		reply := b.newReply(msg, "❌ Псевдоним должен быть хештегом из букв и цифр, например #тренировка")
+		b.post(reply)
+		return
+	}
+	for _, command := range hashtags.Commands {
+		if hashtags.Normalize(command) == alias {
+			reply := b.newReply(msg, fmt.Sprintf("❌ #%s — сам хештег бота, переназначить его нельзя", command))
+			b.post(reply)
+			return
+		}
+	}
+
+	aliases, err := b.db.GetHashtagAliases(msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get hashtag aliases of chat %d: %v", msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+	if _, exists := aliases[alias]; !exists && len(aliases) >= maxHashtagAliases {
+		reply := b.newReply(msg, fmt.Sprintf("❌ В чате уже %d псевдонимов — удалите лишние через /alias remove", maxHashtagAliases))
+		b.post(reply)
+		return
+	}
+
+	if err := b.db.SaveHashtagAlias(msg.Chat.ID, alias, tag, msg.From.ID); err != nil {
+		b.logger.Errorf("Failed to save hashtag alias #%s of chat %d: %v", alias, msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при сохранении псевдонима")
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("Chat %d hashtag alias #%s -> #%s added by user %d", msg.Chat.ID, alias, tag, msg.From.ID)
+	b.auditAdmin(msg, models.AuditHashtagAlias, 0, "", fmt.Sprintf("#%s -> #%s", alias, tag))
+	reply := b.newReply(msg, fmt.Sprintf("✅ Теперь #%s засчитывается как #%s", alias, tag))
+	b.post(reply)
+}
+
+// removeHashtagAlias удаляет псевдоним хештега чата
+func (b *Bot) removeHashtagAlias(msg *tgbotapi.Message, alias string) {
+	alias = hashtags.Normalize(alias)
+	deleted, err := b.db.DeleteHashtagAlias(msg.Chat.ID, alias)
+	if err != nil {
+		b.logger.Errorf("Failed to delete hashtag alias #%s of chat %d: %v", alias, msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при удалении псевдонима")
+		b.post(reply)
+		return
+	}
+	if !deleted {
+		reply := b.newReply(msg, fmt.Sprintf("❌ У чата нет псевдонима #%s", alias))
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("Chat %d hashtag alias #%s removed by user %d", msg.Chat.ID, alias, msg.From.ID)
+	b.auditAdmin(msg, models.AuditHashtagAlias, 0, "", fmt.Sprintf("#%s удален", alias))
+	reply := b.newReply(msg, fmt.Sprintf("✅ Псевдоним #%s удален", alias))
+	b.post(reply)
+}
+
+// isReport проверяет, что сообщение — отчет о тренировке
+func isReport(msg *tgbotapi.Message, resolver *hashtags.Resolver) bool {
+	commands, _ := messageCommands(msg, resolver)
+	return commands[hashtags.TrainingDone]
+}
@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// memberActionPrefix — начало callback data кнопок участника: member:<действие>:<ID участника>
+const memberActionPrefix = "member"
+
+// Действия кнопок участника
+const (
+	actionTraining = "training"
+	actionSick     = "sick"
+	actionHealthy  = "healthy"
+	actionChange   = "change"
+	actionProfile  = "profile"
+)
+
+// memberActionTags — хештег, который отправляет кнопка. Кнопки проходят тот же путь, что и сообщение с тегом
+var memberActionTags = map[string]string{
+	actionTraining: "#training_done",
+	actionSick:     "#sick_leave",
+	actionHealthy:  "#healthy",
+	actionChange:   "#change",
+}
+
+// memberActionData кодирует действие и участника, для которого предназначена кнопка
+func memberActionData(action string, userID int64) string {
+	return fmt.Sprintf("%s:%s:%d", memberActionPrefix, action, userID)
+}
+
+// parseMemberAction разбирает callback data кнопки участника
+func parseMemberAction(data string) (action string, userID int64, ok bool) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 || parts[0] != memberActionPrefix {
+		return "", 0, false
+	}
+	if _, known := memberActionTags[parts[1]]; !known && parts[1] != actionProfile {
+		return "", 0, false
+	}
+	userID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return parts[1], userID, true
+}
+
+// memberKeyboard — кнопки частых действий участника. Нажать их может только сам участник
+func memberKeyboard(userID int64) tgbotapi.InlineKeyboardMarkup {
+	button := func(text, action string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(text, memberActionData(action, userID))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(button("💪 Отчет о тренировке", actionTraining)),
+		tgbotapi.NewInlineKeyboardRow(button("🤒 Взять больничный", actionSick), button("💚 Я здоров", actionHealthy)),
+		tgbotapi.NewInlineKeyboardRow(button("🔄 Обмен", actionChange), button("🐆 Мой профиль", actionProfile)),
+	)
+}
+
+// handleCallbackQuery обрабатывает нажатие кнопки участника так же, как сообщение с хештегом или /profile,
+// и выбор группы для отчета из лички
+func (b *Bot) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
+	// Выбор группы для отчета из лички
+	if chatID, ok := parseReportChoice(query.Data); ok {
+		b.handleReportChoice(query, chatID)
+		return
+	}
+
+	action, ownerID, ok := parseMemberAction(query.Data)
+	if !ok || query.Message == nil || query.Message.Chat == nil {
+		b.answerCallback(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	if query.From.ID != ownerID {
+		b.logger.Infof("User %d pressed %s button of user %d in chat %d", query.From.ID, action, ownerID, query.Message.Chat.ID)
+		b.answerCallback(tgbotapi.NewCallbackWithAlert(query.ID, "🐆 Эта кнопка не твоя! Отправь /help, и Леопард выдаст тебе твои."))
+		return
+	}
+	b.answerCallback(tgbotapi.NewCallback(query.ID, ""))
+
+	// Сообщение от имени участника, как если бы он сам написал хештег
+	tag := memberActionTags[action]
+	msg := &tgbotapi.Message{
+		From:     query.From,
+		Chat:     query.Message.Chat,
+		Date:     int(time.Now().Unix()),
+		Text:     tag,
+		Entities: []tgbotapi.MessageEntity{{Type: "hashtag", Offset: 0, Length: len(tag)}},
+	}
+	threadID := b.threadOf(query.Message)
+	// Кнопка — не сообщение в теме, поэтому отчет по ней засчитывается и ответ уходит в тему для отчетов
+	if action == actionTraining && !msg.Chat.IsPrivate() {
+		if settings, err := b.db.GetChatSettings(msg.Chat.ID); err == nil && settings.ReportTopicID != 0 {
+			threadID = settings.ReportTopicID
+		}
+	}
+	if threadID != 0 {
+		b.messageThreads.Store(msg, threadID)
+		defer b.messageThreads.Delete(msg)
+	}
+
+	b.logger.Infof("User %d pressed %s button in chat %d", query.From.ID, action, msg.Chat.ID)
+	if action == actionProfile {
+		b.handleProfile(msg)
+		return
+	}
+	b.handleMessage(msg)
+}
+
+// answerCallback убирает часики с нажатой кнопки и при необходимости показывает уведомление
+func (b *Bot) answerCallback(callback tgbotapi.CallbackConfig) {
+	if _, err := b.api.Request(callback); err != nil {
+		b.logger.Errorf("Failed to answer callback query %s: %v", callback.CallbackQueryID, err)
+	}
+}
@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"leo-bot/internal/database"
+	"leo-bot/internal/models"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// kudosDailyLimit — сколько кудосов участник может раздать за день
+	kudosDailyLimit = 3
+	// kudosRewardCups — сколько кубков получает автор отчета за один кудос
+	kudosRewardCups = 1
+)
+
+// handleKudos обрабатывает ответ с #kudos на отчет #training_done.
+// Реакции Telegram (message_reaction) библиотека telegram-bot-api v5.5.1 не поддерживает,
+// поэтому кудос выдается только ответом на сообщение
+func (b *Bot) handleKudos(msg *tgbotapi.Message) {
+	report := msg.ReplyToMessage
+	if report == nil || report.From == nil || !isReport(report, b.hashtagResolver(msg.Chat.ID)) {
+		reply := b.newReply(msg, "👏 Чтобы дать кудос, ответь #kudos на отчет #training_done другого участника")
+		reply.ReplyToMessageID = msg.MessageID
+		b.post(reply)
+		return
+	}
+
+	if report.From.IsBot {
+		return
+	}
+
+	if report.From.ID == msg.From.ID {
+		reply := b.newReply(msg, "🦁 Хвалить себя — не по-леопардовски! Кудос можно дать только другому участнику")
+		reply.ReplyToMessageID = msg.MessageID
+		b.post(reply)
+		return
+	}
+
+	now := utils.GetMoscowTime()
+	kudos := &models.Kudos{
+		ChatID:          msg.Chat.ID,
+		GiverID:         msg.From.ID,
+		ReceiverID:      report.From.ID,
+		ReportMessageID: report.MessageID,
+		CreatedAt:       now,
+	}
+
+	err := b.db.GiveKudos(kudos, kudosRewardCups, kudosDailyLimit, utils.StartOfMoscowDay(now))
+	switch {
+	case errors.Is(err, database.ErrKudosLimit):
+		reply := b.newReply(msg, fmt.Sprintf("⏳ Сегодня вы уже раздали %d кудоса. Возвращайтесь завтра!", kudosDailyLimit))
+		reply.ReplyToMessageID = msg.MessageID
+		b.post(reply)
+		return
+	case errors.Is(err, database.ErrKudosDuplicate):
+		reply := b.newReply(msg, "ℹ️ Вы уже дали кудос за этот отчет")
+		reply.ReplyToMessageID = msg.MessageID
+		b.post(reply)
+		return
+	case err != nil:
+		b.logger.Errorf("Failed to give kudos from %d to %d: %v", msg.From.ID, report.From.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при выдаче кудоса")
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("User %d gave kudos to user %d in chat %d", msg.From.ID, report.From.ID, msg.Chat.ID)
+	reply := b.newReply(msg, fmt.Sprintf("👏 %s дает кудос %s за тренировку!\n🏆 +%d кубок", getUserDisplayName(msg.From), getUserDisplayName(report.From), kudosRewardCups))
+	reply.ReplyToMessageID = report.MessageID
+	b.post(reply)
+}
+
+func (b *Bot) handleProfile(msg *tgbotapi.Message) {
+	messageLog, err := b.db.GetMessageLog(msg.From.ID, msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get message log for profile: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	trainings, err := b.db.GetTrainingCount(msg.From.ID, msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get training count for profile: %v", err)
+	}
+
+	kudos, err := b.db.GetKudosStats(msg.From.ID, msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get kudos stats for profile: %v", err)
+		kudos = &models.KudosStats{}
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🐆 Профиль %s\n\n", getUserDisplayName(msg.From)))
+	text.WriteString(fmt.Sprintf("📍 Статус: %s\n", messageLog.State.Title()))
+	text.WriteString(fmt.Sprintf("💪 Тренировок: %d\n", trainings))
+	text.WriteString(fmt.Sprintf("🦁 Серия: %d дней подряд\n", messageLog.StreakDays))
+	text.WriteString(fmt.Sprintf("🔥 Калории: %d\n", messageLog.Calories))
+	text.WriteString(fmt.Sprintf("🏆 Кубки: %d\n", messageLog.CupsEarned))
+	text.WriteString(fmt.Sprintf("👏 Кудосы: получено %d, отдано %d\n", kudos.Received, kudos.Given))
+
+	if usedSickDays, sickDaysQuota, err := b.sickDaysUsage(msg.From.ID, msg.Chat.ID, utils.GetMoscowTime()); err != nil {
+		b.logger.Errorf("Failed to get sick days usage for profile: %v", err)
+	} else {
+		text.WriteString(fmt.Sprintf("🏥 Больничные в этом году: %d из %d дней\n", usedSickDays, sickDaysQuota))
+	}
+
+	team, err := b.db.GetUserTeam(msg.Chat.ID, msg.From.ID)
+	switch {
+	case err == nil:
+		text.WriteString(fmt.Sprintf("🛡 Команда: «%s»\n", team.Name))
+	case !errors.Is(err, sql.ErrNoRows):
+		b.logger.Errorf("Failed to get team for profile: %v", err)
+	}
+
+	// Ручные корректировки администраторов видны участнику вместе с причиной
+	adjustments, err := b.db.GetAuditEntries(models.AuditFilter{
+		ChatID:       msg.Chat.ID,
+		TargetUserID: msg.From.ID,
+		Actions:      []string{models.AuditAdjust, models.AuditSetStreak},
+		Limit:        3,
+	})
+	if err != nil {
+		b.logger.Errorf("Failed to get adjustments for profile: %v", err)
+	}
+	if len(adjustments) > 0 {
+		text.WriteString("\n🛠 Корректировки администраторов:\n")
+		for _, entry := range adjustments {
+			text.WriteString(fmt.Sprintf("• %s %s (%s)\n", utils.GetMoscowDateFromTime(entry.CreatedAt), entry.Reason, entry.ActorName))
+		}
+	}
+
+	reply := b.newReply(msg, text.String())
+	if _, err := b.api.Send(reply); err != nil {
+		b.logger.Errorf("Failed to send profile message: %v", err)
+	}
+}
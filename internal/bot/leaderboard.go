@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"leo-bot/internal/database"
+	"leo-bot/internal/models"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// leaderboardPeriod описывает период, за который строится топ
+type leaderboardPeriod struct {
+	Title string
+	Since func(now time.Time) time.Time
+}
+
+var (
+	periodWeek  = leaderboardPeriod{Title: "за неделю", Since: utils.StartOfMoscowWeek}
+	periodMonth = leaderboardPeriod{Title: "за месяц", Since: utils.StartOfMoscowMonth}
+	periodAll   = leaderboardPeriod{Title: "за всё время", Since: func(time.Time) time.Time { return database.AllTime }}
+)
+
+// leaderboardPeriods сопоставляет аргументы /top с периодами
+var leaderboardPeriods = map[string]leaderboardPeriod{
+	"week":   periodWeek,
+	"неделя": periodWeek,
+	"month":  periodMonth,
+	"месяц":  periodMonth,
+	"all":    periodAll,
+	"всё":    periodAll,
+	"все":    periodAll,
+}
+
+// leaderboardMetrics сопоставляет аргументы /top с метриками
+var leaderboardMetrics = map[string]models.LeaderboardMetric{
+	"trainings":  models.MetricTrainings,
+	"тренировки": models.MetricTrainings,
+	"calories":   models.MetricCalories,
+	"калории":    models.MetricCalories,
+	"cups":       models.MetricCups,
+	"кубки":      models.MetricCups,
+	"streak":     models.MetricStreak,
+	"серия":      models.MetricStreak,
+	"kudos":      models.MetricKudos,
+	"кудосы":     models.MetricKudos,
+}
+
+// metricTitles — заголовки и единицы измерения метрик для сообщения
+var metricTitles = map[models.LeaderboardMetric][2]string{
+	models.MetricTrainings: {"по тренировкам", "тренировок"},
+	models.MetricCalories:  {"по заработанным калориям", "калорий"},
+	models.MetricCups:      {"по заработанным кубкам", "кубков"},
+	models.MetricStreak:    {"по самой длинной серии", "дней подряд"},
+	models.MetricKudos:     {"по полученным кудосам", "кудосов"},
+}
+
+// parseTopArgs разбирает аргументы /top в любом порядке: /top week cups, /top streak all
+func parseTopArgs(args string) (leaderboardPeriod, models.LeaderboardMetric, error) {
+	period := periodAll
+	metric := models.MetricCalories
+
+	for _, arg := range strings.Fields(strings.ToLower(args)) {
+		if p, ok := leaderboardPeriods[arg]; ok {
+			period = p
+			continue
+		}
+		if m, ok := leaderboardMetrics[arg]; ok {
+			metric = m
+			continue
+		}
+		return period, metric, fmt.Errorf("unknown argument: %s", arg)
+	}
+
+	return period, metric, nil
+}
+
+func (b *Bot) handleTop(msg *tgbotapi.Message) {
+	period, metric, err := parseTopArgs(msg.CommandArguments())
+	if err != nil {
+		reply := b.newReply(msg, "❌ Использование: /top [week|month|all] [trainings|calories|cups|streak|kudos]")
+		b.post(reply)
+		return
+	}
+
+	now := utils.GetMoscowTime()
+	since := period.Since(now)
+	topUsers, err := b.db.GetLeaderboard(msg.Chat.ID, metric, since, now, 10)
+	if err != nil {
+		b.logger.Errorf("Failed to get leaderboard (%s since %s): %v", metric, since, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	titles := metricTitles[metric]
+	if len(topUsers) == 0 {
+		reply := b.newReply(msg, fmt.Sprintf("🏆 Топ %s %s:\n\n📊 Пока нет данных о тренировках", titles[0], period.Title))
+		b.post(reply)
+		return
+	}
+
+	// Формируем топ
+	var topText strings.Builder
+	topText.WriteString(fmt.Sprintf("🏆 Топ %s %s:\n\n", titles[0], period.Title))
+	for i, user := range topUsers {
+		topText.WriteString(fmt.Sprintf("%s %s - %d %s\n", placeEmoji(i), user.Username, user.Value, titles[1]))
+	}
+
+	reply := b.newReply(msg, topText.String())
+
+	b.logger.Infof("Sending top users message to chat %d", msg.Chat.ID)
+	_, err = b.api.Send(reply)
+	if err != nil {
+		b.logger.Errorf("Failed to send top users message: %v", err)
+	} else {
+		b.logger.Infof("Successfully sent top users message to chat %d", msg.Chat.ID)
+	}
+}
+
+// placeEmoji возвращает значок для места в топе (нумерация с нуля)
+func placeEmoji(i int) string {
+	switch i {
+	case 0:
+		return "🥇"
+	case 1:
+		return "🥈"
+	case 2:
+		return "🥉"
+	default:
+		return fmt.Sprintf("%d️⃣", i+1)
+	}
+}
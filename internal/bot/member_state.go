@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/state"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// setMemberState переводит участника в состояние to и логирует переход.
+// Запрещенный переход возвращает state.ErrInvalidTransition, состояние при этом не меняется
+func (b *Bot) setMemberState(userID, chatID int64, to state.State, reason string) error {
+	from, err := b.db.ChangeMemberState(userID, chatID, to, reason)
+	if err != nil {
+		b.logger.Errorf("Failed to change state of user %d in chat %d to %s (%s): %v", userID, chatID, to, reason, err)
+		return err
+	}
+
+	if from != to {
+		b.logger.Infof("User %d in chat %d: %s -> %s (%s)", userID, chatID, from, to, reason)
+	}
+	return nil
+}
+
+// stateAfterPause возвращает состояние участника после окончания больничного: если идет отпуск,
+// таймер остается на паузе
+func (b *Bot) stateAfterPause(userID, chatID int64) state.State {
+	if b.isOnVacation(userID, chatID, utils.GetMoscowTime()) {
+		return state.Vacation
+	}
+	return state.Active
+}
+
+// handleLeftChatMember обрабатывает служебное сообщение о выходе участника.
+// Если сообщение отправил не сам участник, его удалил администратор
+func (b *Bot) handleLeftChatMember(msg *tgbotapi.Message) {
+	member := msg.LeftChatMember
+	if member.IsBot {
+		return
+	}
+
+	b.memberLeft(msg.Chat.ID, member, msg.From.ID, msg.From.ID != member.ID, models.MemberEventSourceMessage)
+}
+
+// handleChatMemberUpdate обрабатывает обновление chat_member: Telegram присылает его при любом вступлении
+// и выходе, даже если участник молчит или служебные сообщения скрыты
+func (b *Bot) handleChatMemberUpdate(update *tgbotapi.ChatMemberUpdated) {
+	user := update.NewChatMember.User
+	if user == nil || user.IsBot || update.Chat.IsPrivate() {
+		return
+	}
+
+	wasPresent := isPresentInChat(update.OldChatMember)
+	isPresent := isPresentInChat(update.NewChatMember)
+	switch {
+	case !wasPresent && isPresent:
+		b.memberJoined(update.Chat.ID, user, update.From.ID, models.MemberEventSourceChatMember)
+	case wasPresent && !isPresent:
+		b.memberLeft(update.Chat.ID, user, update.From.ID, update.NewChatMember.WasKicked(), models.MemberEventSourceChatMember)
+	}
+}
+
+// isPresentInChat сообщает, состоит ли пользователь в чате с таким статусом
+func isPresentInChat(member tgbotapi.ChatMember) bool {
+	switch member.Status {
+	case "creator", "administrator", "member":
+		return true
+	case "restricted":
+		return member.IsMember
+	default:
+		return false
+	}
+}
+
+// recordMemberEvent записывает вступление или выход участника в member_events
+func (b *Bot) recordMemberEvent(chatID int64, user *tgbotapi.User, event, source string, actorID int64) {
+	err := b.db.RecordMemberEvent(&models.MemberEvent{
+		ChatID:   chatID,
+		UserID:   user.ID,
+		Username: getUserDisplayName(user),
+		Event:    event,
+		Source:   source,
+		ActorID:  actorID,
+	})
+	if err != nil {
+		b.logger.Errorf("Failed to record %s of user %d in chat %d: %v", event, user.ID, chatID, err)
+	}
+}
+
+// memberJoined начинает отслеживать вступившего участника: создает запись и запускает таймер,
+// если участник новый или возвращается. Приветствие отправляется только по служебному сообщению
+func (b *Bot) memberJoined(chatID int64, user *tgbotapi.User, actorID int64, source string) {
+	b.recordMemberEvent(chatID, user, models.MemberEventJoin, source, actorID)
+
+	username := getUserDisplayName(user)
+	messageLog, err := b.db.GetMessageLog(user.ID, chatID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		now := utils.FormatMoscowTime(utils.GetMoscowTime())
+		messageLog = &models.MessageLog{
+			UserID:         user.ID,
+			ChatID:         chatID,
+			Username:       username,
+			LastMessage:    now,
+			State:          state.Active,
+			TimerStartTime: &now,
+		}
+		if err := b.db.SaveMessageLog(messageLog); err != nil {
+			b.logger.Errorf("Failed to save joined member %d in chat %d: %v", user.ID, chatID, err)
+			return
+		}
+	case err != nil:
+		b.logger.Errorf("Failed to get message log of joined member %d: %v", user.ID, err)
+		return
+	case messageLog.State.InChat():
+		// Уже отслеживается — например, служебное сообщение пришло раньше обновления chat_member
+		return
+	default:
+		if err := b.setMemberState(user.ID, chatID, state.Active, state.ReasonJoined); err != nil {
+			return
+		}
+	}
+
+	b.logger.Infof("Member %d (%s) joined chat %d (%s)", user.ID, username, chatID, source)
+	b.startTimer(user.ID, chatID, username)
+}
+
+// memberLeft останавливает таймер ушедшего участника и переводит его в состояние left,
+// а удаленного администратором — в removed. Удаления самим ботом обрабатывает removeUser
+func (b *Bot) memberLeft(chatID int64, user *tgbotapi.User, actorID int64, kicked bool, source string) {
+	event := models.MemberEventLeave
+	if kicked {
+		event = models.MemberEventKick
+	}
+	b.recordMemberEvent(chatID, user, event, source, actorID)
+
+	if actorID == b.api.Self.ID {
+		return
+	}
+
+	messageLog, err := b.db.GetMessageLog(user.ID, chatID)
+	if err != nil {
+		b.logger.Infof("Left chat member %d is not tracked in chat %d: %v", user.ID, chatID, err)
+		return
+	}
+	if !messageLog.State.InChat() {
+		return
+	}
+
+	b.cancelTimer(chatID, user.ID)
+	if kicked {
+		b.setMemberState(user.ID, chatID, state.Removed, state.ReasonKicked)
+		return
+	}
+	b.setMemberState(user.ID, chatID, state.Left, state.ReasonLeftChat)
+}
@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/state"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const pardonUsage = "❌ Использование: /pardon @username [keep|reset]\n\nВместо @username можно указать id:<ID> или ответить командой на старое сообщение участника"
+
+// pardonInviteTTL — сколько действует ссылка-приглашение для помилованного участника
+const pardonInviteTTL = 7 * 24 * time.Hour
+
+// handlePardon снимает бан с удаленного за неактивность участника и отправляет ему приглашение.
+// Формат: /pardon @username [keep|reset]. keep (по умолчанию) сохраняет калории и кубки, reset обнуляет их
+func (b *Bot) handlePardon(msg *tgbotapi.Message) {
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	target, args, ok := b.resolveTarget(msg, strings.Fields(msg.CommandArguments()), pardonUsage)
+	if !ok {
+		return
+	}
+	userID := target.UserID
+
+	resetBalances := false
+	if len(args) > 1 {
+		reply := b.newReply(msg, pardonUsage)
+		b.post(reply)
+		return
+	}
+	if len(args) == 1 {
+		switch strings.ToLower(args[0]) {
+		case "keep":
+		case "reset":
+			resetBalances = true
+		default:
+			reply := b.newReply(msg, pardonUsage)
+			b.post(reply)
+			return
+		}
+	}
+
+	messageLog, err := b.db.GetMessageLog(userID, msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get message log: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных пользователя")
+		b.post(reply)
+		return
+	}
+
+	if messageLog.State != state.Removed {
+		reply := b.newReply(msg, fmt.Sprintf("🤔 %s не удален ботом — сейчас он %s", messageLog.Username, messageLog.State.Title()))
+		b.post(reply)
+		return
+	}
+
+	// Снимаем бан. OnlyIfBanned не выкидывает участника, если бан уже снят вручную
+	_, err = b.api.Request(tgbotapi.UnbanChatMemberConfig{
+		ChatMemberConfig: tgbotapi.ChatMemberConfig{
+			ChatID: msg.Chat.ID,
+			UserID: userID,
+		},
+		OnlyIfBanned: true,
+	})
+	if err != nil {
+		b.logger.Errorf("Failed to unban user %d in chat %d: %v", userID, msg.Chat.ID, err)
+		reply := b.newReply(msg, fmt.Sprintf("❌ Не удалось снять бан с %s: %v", messageLog.Username, err))
+		b.post(reply)
+		return
+	}
+
+	// Бан уже снят, поэтому при ошибке обнуления помилование продолжается, а ответ и аудит сообщают, что балансы остались
+	balancesText := "Калории, кубки и серия сохранены."
+	if resetBalances {
+		if err := b.db.ResetBalances(userID, msg.Chat.ID, models.LedgerReasonPardonReset); err != nil {
+			b.logger.Errorf("Failed to reset balances of user %d: %v", userID, err)
+			resetBalances = false
+			balancesText = "❌ Обнулить калории и кубки не удалось — они сохранены."
+		} else {
+			balancesText = "Калории и кубки обнулены."
+		}
+	}
+
+	// Участника еще нет в чате: таймер запустится заново, когда он вернется
+	if err := b.setMemberState(userID, msg.Chat.ID, state.Left, state.ReasonPardon); err != nil {
+		reply := b.newReply(msg, "❌ Ошибка при сохранении данных")
+		b.post(reply)
+		return
+	}
+
+	inviteLink, err := b.createPardonInvite(msg.Chat.ID, messageLog.Username)
+	if err != nil {
+		b.logger.Errorf("Failed to create invite link for user %d in chat %d: %v", userID, msg.Chat.ID, err)
+	}
+
+	text := fmt.Sprintf("🕊 %s помилован! Бан снят. %s\nКогда вернется в чат, таймер стартует заново.", messageLog.Username, balancesText)
+	switch {
+	case inviteLink == "":
+		text += "\n\n⚠️ Создать ссылку-приглашение не удалось — пригласите участника вручную."
+	case b.sendPardonInvite(userID, msg.Chat.Title, inviteLink):
+		text += "\n\n📩 Ссылка-приглашение отправлена в личные сообщения."
+	default:
+		// Бот не может написать первым тому, кто не запускал его в личке, — оставляем ссылку в чате
+		text += fmt.Sprintf("\n\n🔗 Написать в личку не получилось, ссылка для возвращения: %s", inviteLink)
+	}
+
+	b.auditAdmin(msg, models.AuditPardon, userID, messageLog.Username, balancesText)
+
+	reply := b.newReply(msg, text)
+	b.post(reply)
+	b.logger.Infof("User %d (%s) pardoned in chat %d by %d (reset balances: %t)", userID, messageLog.Username, msg.Chat.ID, msg.From.ID, resetBalances)
+}
+
+// createPardonInvite создает одноразовую ссылку-приглашение в чат, действующую pardonInviteTTL
+func (b *Bot) createPardonInvite(chatID int64, username string) (string, error) {
+	resp, err := b.api.Request(tgbotapi.CreateChatInviteLinkConfig{
+		ChatConfig:  tgbotapi.ChatConfig{ChatID: chatID},
+		Name:        fmt.Sprintf("pardon %s", username),
+		ExpireDate:  int(utils.GetMoscowTime().Add(pardonInviteTTL).Unix()),
+		MemberLimit: 1,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var link tgbotapi.ChatInviteLink
+	if err := json.Unmarshal(resp.Result, &link); err != nil {
+		return "", fmt.Errorf("failed to parse invite link: %w", err)
+	}
+	return link.InviteLink, nil
+}
+
+// sendPardonInvite отправляет ссылку-приглашение в личные сообщения. Возвращает false, если написать не удалось
+func (b *Bot) sendPardonInvite(userID int64, chatTitle, inviteLink string) bool {
+	text := fmt.Sprintf("🕊 Леопард тебя помиловал! Бан в чате «%s» снят.\n\nВозвращайся по ссылке (действует 7 дней, один раз): %s\n\n💪 Таймер стартует заново, как только вернешься. Не заставляй меня снова толстеть!", chatTitle, inviteLink)
+	if _, err := b.api.Send(tgbotapi.NewMessage(userID, text)); err != nil {
+		b.logger.Infof("Failed to send pardon invite to user %d: %v", userID, err)
+		return false
+	}
+	return true
+}
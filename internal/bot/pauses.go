@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"sort"
+	"time"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/state"
+	"leo-bot/internal/utils"
+)
+
+// pauseWindow — интервал [Start, End), в котором таймер участника не идет (больничный, отпуск, пауза чата)
+type pauseWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// activeTimeSince считает, сколько времени таймер шел с start до now, не считая пауз.
+// Паузы обрезаются по [start, now], пересекающиеся паузы не вычитаются дважды
+func activeTimeSince(start, now time.Time, pauses []pauseWindow) time.Duration {
+	if !now.After(start) {
+		return 0
+	}
+
+	var clipped []pauseWindow
+	for _, pause := range pauses {
+		if pause.Start.Before(start) {
+			pause.Start = start
+		}
+		if pause.End.After(now) {
+			pause.End = now
+		}
+		if pause.End.After(pause.Start) {
+			clipped = append(clipped, pause)
+		}
+	}
+	sort.Slice(clipped, func(i, j int) bool { return clipped[i].Start.Before(clipped[j].Start) })
+
+	active := now.Sub(start)
+	var current *pauseWindow
+	for i := range clipped {
+		pause := clipped[i]
+		if current != nil && !pause.Start.After(current.End) {
+			if pause.End.After(current.End) {
+				current.End = pause.End
+			}
+			continue
+		}
+		if current != nil {
+			active -= current.End.Sub(current.Start)
+		}
+		current = &pause
+	}
+	if current != nil {
+		active -= current.End.Sub(current.Start)
+	}
+
+	return active
+}
+
+// sickLeavePause возвращает паузу больничного в текущем отсчете таймера. Отметки больничного
+// сбрасываются, когда таймер запускается заново, поэтому их наличие и означает больничный в этом отсчете.
+// Пока участник на больничном (или время окончания не записано), пауза длится до now
+func sickLeavePause(messageLog *models.MessageLog, now time.Time) (pauseWindow, bool) {
+	if messageLog.SickLeaveStartTime == nil {
+		return pauseWindow{}, false
+	}
+
+	start, err := utils.ParseMoscowTime(*messageLog.SickLeaveStartTime)
+	if err != nil {
+		return pauseWindow{}, false
+	}
+
+	end := now
+	if messageLog.State != state.Sick && messageLog.SickLeaveEndTime != nil {
+		if sickEnd, err := utils.ParseMoscowTime(*messageLog.SickLeaveEndTime); err == nil && !sickEnd.Before(start) {
+			end = sickEnd
+		}
+	}
+
+	return pauseWindow{Start: start, End: end}, true
+}
+
+// recoveredFromSickLeave сообщает, что участник выздоровел в текущем отсчете таймера:
+// больничный начался и закончился после последней тренировки
+func recoveredFromSickLeave(messageLog *models.MessageLog) bool {
+	return messageLog.State != state.Sick && messageLog.SickLeaveStartTime != nil && messageLog.SickLeaveEndTime != nil
+}
+
+// storedPauses возвращает больничные из истории и отпуска участника, которые могли прервать таймер,
+// запущенный в since. Открытый больничный длится до now
+func (b *Bot) storedPauses(userID, chatID int64, since, now time.Time) []pauseWindow {
+	var pauses []pauseWindow
+
+	leaves, err := b.db.GetSickLeavesEndingAfter(userID, chatID, since)
+	if err != nil {
+		b.logger.Errorf("Failed to get sick leaves for user %d in chat %d: %v", userID, chatID, err)
+	}
+	for _, leave := range leaves {
+		end := now
+		if leave.EndedAt != nil {
+			end = *leave.EndedAt
+		}
+		pauses = append(pauses, pauseWindow{Start: leave.StartedAt, End: end})
+	}
+
+	vacations, err := b.db.GetVacationsEndingAfter(userID, chatID, since)
+	if err != nil {
+		b.logger.Errorf("Failed to get vacations for user %d in chat %d: %v", userID, chatID, err)
+	}
+	for _, vacation := range vacations {
+		pauses = append(pauses, pauseWindow{Start: vacation.StartsAt, End: vacation.EndsAt})
+	}
+
+	// Пока у бота не было права банить, таймеры всего чата стояли
+	chatPauses, err := b.db.GetChatPausesEndingAfter(chatID, since)
+	if err != nil {
+		b.logger.Errorf("Failed to get pauses of chat %d: %v", chatID, err)
+	}
+	for _, pause := range chatPauses {
+		end := now
+		if pause.EndedAt != nil {
+			end = *pause.EndedAt
+		}
+		pauses = append(pauses, pauseWindow{Start: pause.StartedAt, End: end})
+	}
+
+	return pauses
+}
+
+// remainingTimeWithPauses рассчитывает оставшееся время с учетом всех больничных и отпусков участника
+// с момента старта таймера, а не только последнего больничного из message_log
+func (b *Bot) remainingTimeWithPauses(messageLog *models.MessageLog) time.Duration {
+	if messageLog.TimerStartTime == nil {
+		return b.calculateRemainingTime(messageLog)
+	}
+
+	timerStart, err := utils.ParseMoscowTime(*messageLog.TimerStartTime)
+	if err != nil {
+		return b.calculateRemainingTime(messageLog)
+	}
+
+	pauses := b.storedPauses(messageLog.UserID, messageLog.ChatID, timerStart, utils.GetMoscowTime())
+	return b.calculateRemainingTimeWithPauses(messageLog, pauses)
+}
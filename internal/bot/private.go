@@ -0,0 +1,354 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"leo-bot/internal/dispatch"
+	"leo-bot/internal/hashtags"
+	"leo-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// privateReminderLead — за сколько до предупреждения в чате участник получает напоминание в личку
+const privateReminderLead = 24 * time.Hour
+
+// reportChoicePrefix — начало callback data кнопки отчета из лички: report:<ID чата>
+const reportChoicePrefix = "report"
+
+// reportChoiceData кодирует чат, в который отправляется отчет из лички
+func reportChoiceData(chatID int64) string {
+	return fmt.Sprintf("%s:%d", reportChoicePrefix, chatID)
+}
+
+// parseReportChoice разбирает callback data кнопки отчета из лички
+func parseReportChoice(data string) (int64, bool) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 2 || parts[0] != reportChoicePrefix {
+		return 0, false
+	}
+	chatID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || chatID >= 0 {
+		return 0, false
+	}
+	return chatID, true
+}
+
+// isBlockedByUser сообщает, что участник остановил бота и писать ему в личку нельзя
+func isBlockedByUser(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden
+}
+
+// groupStatus — положение участника в одной из групп для /status в личке
+type groupStatus struct {
+	Title string
+	Log   *models.MessageLog
+	// Remaining — сколько осталось до удаления, если таймер участника идет
+	Remaining time.Duration
+	TimerRuns bool
+	Paused    bool
+}
+
+// handlePrivateMessage обрабатывает сообщения в личке с ботом: свои команды и отчеты для групп
+func (b *Bot) handlePrivateMessage(msg *tgbotapi.Message) {
+	if msg.IsCommand() {
+		b.handleCommand(msg)
+		return
+	}
+
+	commands, _ := messageCommands(msg, hashtags.NewResolver(nil))
+	if !commands[hashtags.TrainingDone] {
+		reply := b.newReply(msg, "🐆 В личке Леопард принимает только отчеты: отправь #training_done, а свой статус смотри в /status\n\n🏥 Больничный, отпуск и обмен калорий — в групповом чате")
+		b.post(reply)
+		return
+	}
+	b.choosePrivateReportGroup(msg)
+}
+
+// handlePrivateStart включает личные напоминания и сразу показывает статус
+func (b *Bot) handlePrivateStart(msg *tgbotapi.Message) {
+	if err := b.db.EnablePrivateChat(msg.From.ID); err != nil {
+		b.logger.Errorf("Failed to enable private chat of user %d: %v", msg.From.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при сохранении данных")
+		b.post(reply)
+		return
+	}
+	b.logger.Infof("User %d started private chat", msg.From.ID)
+
+	reply := b.newReply(msg, "🦁 Fat Leopard теперь следит за тобой и в личке!\n\n🔔 За день до предупреждения в чате я напомню здесь, а не при всех\n💪 Отчет можно отправить прямо сюда: #training_done\n📊 /status — твои калории, кубки и таймеры во всех чатах\n🔕 /stop — выключить личные напоминания")
+	b.post(reply)
+	b.sendPrivateStatus(msg)
+}
+
+// handlePrivateStop выключает личные напоминания до следующего /start
+func (b *Bot) handlePrivateStop(msg *tgbotapi.Message) {
+	if err := b.db.DisablePrivateChat(msg.From.ID); err != nil {
+		b.logger.Errorf("Failed to disable private chat of user %d: %v", msg.From.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при сохранении данных")
+		b.post(reply)
+		return
+	}
+	b.logger.Infof("User %d stopped private reminders", msg.From.ID)
+
+	reply := b.newReply(msg, "🔕 Личные напоминания выключены. Предупреждения в чате остаются!\n\n🔔 Включить снова — /start")
+	b.post(reply)
+}
+
+// handlePrivateHelp — справка для лички
+func (b *Bot) handlePrivateHelp(msg *tgbotapi.Message) {
+	helpText := `🤖 LeoPoacherBot в личке:
+
+` + privateHelpCommands(msg.From.ID == b.config.OwnerID) + `
+• #training_done — Отправить отчет о тренировке в чат (если чатов несколько, Леопард спросит, в какой)
+
+🏆 Остальные команды работают в групповом чате — там же /help с полным списком`
+
+	reply := b.newReply(msg, helpText)
+	b.post(reply)
+}
+
+// sendPrivateStatus показывает положение участника во всех группах, где он состоит
+func (b *Bot) sendPrivateStatus(msg *tgbotapi.Message) {
+	groups, err := b.db.GetUserGroups(msg.From.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get groups of user %d: %v", msg.From.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	statuses := make([]groupStatus, 0, len(groups))
+	for _, group := range groups {
+		status := groupStatus{Title: b.chatTitle(group.ChatID), Log: group}
+		if group.State.TimerRuns() {
+			status.Paused = b.isChatPaused(group.ChatID)
+			status.TimerRuns = !status.Paused && group.TimerStartTime != nil
+			if status.TimerRuns {
+				status.Remaining = b.remainingTimeWithPauses(group)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	reply := b.newReply(msg, b.formatPrivateStatus(statuses))
+	b.post(reply)
+}
+
+// formatPrivateStatus форматирует статус участника по группам
+func (b *Bot) formatPrivateStatus(statuses []groupStatus) string {
+	if len(statuses) == 0 {
+		return "🐆 Леопард не нашел тебя ни в одном чате с тренировками.\n\n💬 Напиши в групповой чат, где живет бот, и загляни сюда снова!"
+	}
+
+	var text strings.Builder
+	text.WriteString("📊 Твой статус:")
+	for _, status := range statuses {
+		fmt.Fprintf(&text, "\n\n🐆 «%s»\n• Состояние: %s", status.Title, status.Log.State.Title())
+		switch {
+		case status.Paused:
+			text.WriteString("\n• ⏸️ Таймеры чата на паузе")
+		case status.TimerRuns:
+			fmt.Fprintf(&text, "\n• ⏰ До удаления: %s", b.formatDurationToDays(status.Remaining))
+		}
+		fmt.Fprintf(&text, "\n• 🔥 Калории: %d\n• 🏆 Кубки: %d\n• 📅 Серия: %d дн.", status.Log.Calories, status.Log.CupsEarned, status.Log.StreakDays)
+	}
+	return text.String()
+}
+
+// chatTitle возвращает название группы для сообщений в личку
+func (b *Bot) chatTitle(chatID int64) string {
+	chat, err := b.db.GetChat(chatID)
+	if err != nil || chat.Title == "" {
+		return fmt.Sprintf("Чат %d", chatID)
+	}
+	return chat.Title
+}
+
+// choosePrivateReportGroup отправляет отчет из лички в группу участника, а если групп несколько — спрашивает, в какую
+func (b *Bot) choosePrivateReportGroup(msg *tgbotapi.Message) {
+	groups, err := b.db.GetUserGroups(msg.From.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get groups of user %d: %v", msg.From.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	switch len(groups) {
+	case 0:
+		reply := b.newReply(msg, "🐆 Леопард не нашел тебя ни в одном чате с тренировками — отчет некуда отправить.\n\n💬 Напиши в групповой чат, где живет бот!")
+		b.post(reply)
+	case 1:
+		b.submitPrivateReport(msg.From, groups[0].ChatID, msg, func(text string) {
+			reply := b.newReply(msg, text)
+			b.post(reply)
+		})
+	default:
+		// Текст отчета нужен после выбора группы: в нем могут быть теги челленджей
+		b.privateReports.Store(msg.From.ID, msg)
+
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, group := range groups {
+			button := tgbotapi.NewInlineKeyboardButtonData("💪 "+b.chatTitle(group.ChatID), reportChoiceData(group.ChatID))
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(button))
+		}
+		reply := b.newReply(msg, "🐆 В какой чат отправить отчет?")
+		reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+		b.post(reply)
+	}
+}
+
+// handleReportChoice отправляет отчет в группу, выбранную кнопкой в личке
+func (b *Bot) handleReportChoice(query *tgbotapi.CallbackQuery, chatID int64) {
+	if query.Message == nil || query.Message.Chat == nil || !query.Message.Chat.IsPrivate() {
+		b.answerCallback(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	member, err := b.db.GetMessageLog(query.From.ID, chatID)
+	if err != nil || !member.State.InChat() {
+		b.logger.Infof("User %d chose chat %d for report but is not a member", query.From.ID, chatID)
+		b.answerCallback(tgbotapi.NewCallbackWithAlert(query.ID, "🐆 Ты больше не состоишь в этом чате!"))
+		return
+	}
+	b.answerCallback(tgbotapi.NewCallback(query.ID, ""))
+
+	// Кнопка под напоминанием приходит без текста отчета — тогда это просто #training_done
+	report := &tgbotapi.Message{
+		Text:     "#" + hashtags.TrainingDone,
+		Entities: []tgbotapi.MessageEntity{{Type: "hashtag", Offset: 0, Length: len(hashtags.TrainingDone) + 1}},
+	}
+	if pending, ok := b.privateReports.LoadAndDelete(query.From.ID); ok {
+		report = pending.(*tgbotapi.Message)
+	}
+
+	choice := query.Message
+	b.submitPrivateReport(query.From, chatID, report, func(text string) {
+		edit := tgbotapi.NewEditMessageText(choice.Chat.ID, choice.MessageID, text)
+		if _, err := b.api.Request(edit); err != nil {
+			b.logger.Errorf("Failed to edit report choice of user %d: %v", query.From.ID, err)
+		}
+	})
+}
+
+// submitPrivateReport обрабатывает отчет из лички как сообщение участника в группе. Отчет ставится в очередь
+// участника в этой группе, чтобы не обогнать его сообщения в самом чате; confirm сообщает результат в личку
+func (b *Bot) submitPrivateReport(from *tgbotapi.User, chatID int64, report *tgbotapi.Message, confirm func(text string)) {
+	title := b.chatTitle(chatID)
+	msg := &tgbotapi.Message{
+		From:            from,
+		Chat:            &tgbotapi.Chat{ID: chatID, Type: "supergroup", Title: title},
+		Date:            int(time.Now().Unix()),
+		Text:            report.Text,
+		Entities:        report.Entities,
+		Caption:         report.Caption,
+		CaptionEntities: report.CaptionEntities,
+	}
+
+	// Отчет из лички — не сообщение в теме, поэтому ответ на него уходит в тему для отчетов
+	threadID := 0
+	if settings, err := b.db.GetChatSettings(chatID); err == nil {
+		threadID = settings.ReportTopicID
+	}
+
+	task := func() {
+		if threadID != 0 {
+			b.messageThreads.Store(msg, threadID)
+			defer b.messageThreads.Delete(msg)
+		}
+		b.handleMessage(msg)
+		confirm(fmt.Sprintf("✅ Отчет отправлен в «%s» — ответ Леопарда ищи там!", title))
+	}
+
+	b.logger.Infof("User %d sent report to chat %d from private chat", from.ID, chatID)
+	// Обработчик лички сам выполняется в диспетчере, поэтому ждать места в очереди нужно в отдельной горутине.
+	// Остановка бота дожидается ее: если диспетчер уже не принимает задачи, участник узнает об этом в личке
+	b.handoffs.Add(1)
+	go func() {
+		defer b.handoffs.Done()
+		if err := b.dispatcher.Submit(b.ctx, dispatch.Key{ChatID: chatID, UserID: from.ID}, task); err != nil {
+			b.logger.Errorf("Failed to submit private report of user %d to chat %d: %v", from.ID, chatID, err)
+			confirm("❌ Не получилось отправить отчет, попробуй еще раз")
+		}
+	}()
+}
+
+// schedulePrivateReminder напоминает участнику в личку за privateReminderLead до предупреждения в чате.
+// Если до предупреждения осталось меньше (таймер восстановлен после перезапуска или срок короткий), напоминает сразу,
+// но не больше одного раза за отсчет таймера timerStartTime. Напоминание отменяется вместе с предупреждением
+func (b *Bot) schedulePrivateReminder(userID, chatID int64, timerStartTime string, warningTime, duration time.Duration, cancelled chan bool) {
+	after := warningTime - privateReminderLead
+	if after < 0 {
+		after = 0
+	}
+
+	go func() {
+		time.Sleep(after)
+		select {
+		case <-cancelled:
+			return // Таймер отменен
+		default:
+			b.runTimerAction(func() { b.sendPrivateReminder(userID, chatID, timerStartTime, duration-after) })
+		}
+	}()
+}
+
+// sendPrivateReminder напоминает участнику об отчете в личку, если он запустил бота
+// и за этот отсчет таймера напоминания еще не было
+func (b *Bot) sendPrivateReminder(userID, chatID int64, timerStartTime string, timeLeft time.Duration) {
+	enabled, err := b.db.IsPrivateChatEnabled(userID)
+	if err != nil {
+		b.logger.Errorf("Failed to check private chat of user %d: %v", userID, err)
+		return
+	}
+	if !enabled {
+		return
+	}
+
+	// Отмечаем напоминание до отправки, чтобы перезапуск во время отправки не привел к повтору
+	first, err := b.db.MarkPrivateReminderSent(userID, chatID, timerStartTime)
+	if err != nil {
+		b.logger.Errorf("Failed to mark private reminder of user %d in chat %d: %v", userID, chatID, err)
+		return
+	}
+	if !first {
+		b.logger.Infof("User %d was already reminded about chat %d for timer started at %s", userID, chatID, timerStartTime)
+		return
+	}
+
+	title := b.chatTitle(chatID)
+	msg := tgbotapi.NewMessage(userID, fmt.Sprintf("⏰ Напоминание из «%s»\n\n🐆 Ты давно не отправлял отчет о тренировке. Скоро Леопард предупредит тебя при всех, а через %s удалит из чата!\n\n💪 Отправь #training_done сюда или нажми кнопку — и таймер начнется заново", title, b.formatDurationToDays(timeLeft)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("💪 Отчет в «"+title+"»", reportChoiceData(chatID))),
+	)
+
+	b.logger.Infof("Sending private reminder to user %d about chat %d", userID, chatID)
+	if _, err := b.api.Send(msg); err != nil {
+		b.logger.Errorf("Failed to send private reminder to user %d: %v", userID, err)
+		if isBlockedByUser(err) {
+			b.disablePrivateChat(userID)
+		}
+	}
+}
+
+// handlePrivateChatStatus выключает личные напоминания, когда участник останавливает бота
+func (b *Bot) handlePrivateChatStatus(update *tgbotapi.ChatMemberUpdated) {
+	if isPresentInChat(update.NewChatMember) {
+		return
+	}
+	b.logger.Infof("User %d blocked the bot", update.Chat.ID)
+	b.disablePrivateChat(update.Chat.ID)
+}
+
+// disablePrivateChat выключает личные напоминания участника
+func (b *Bot) disablePrivateChat(userID int64) {
+	if err := b.db.DisablePrivateChat(userID); err != nil {
+		b.logger.Errorf("Failed to disable private chat of user %d: %v", userID, err)
+	}
+}
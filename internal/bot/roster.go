@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxRosterListed — сколько участников каждой группы показывается в /roster
+const maxRosterListed = 30
+
+// rosterReport — участники чата, разбитые для /roster
+type rosterReport struct {
+	Tracked  []*models.RosterEntry // в чате и хоть раз писали
+	Silent   []*models.RosterEntry // в чате, но ни разу не писали
+	Departed []*models.RosterEntry // вышли или удалены
+}
+
+// buildRoster разбивает известных боту участников на пишущих, молчащих и ушедших
+func buildRoster(entries []*models.RosterEntry) rosterReport {
+	var report rosterReport
+	for _, entry := range entries {
+		switch {
+		case !entry.State.InChat():
+			report.Departed = append(report.Departed, entry)
+		case entry.LastSpokeAt == nil:
+			report.Silent = append(report.Silent, entry)
+		default:
+			report.Tracked = append(report.Tracked, entry)
+		}
+	}
+	return report
+}
+
+// writeRosterList дописывает в отчет не больше maxRosterListed участников
+func writeRosterList(sb *strings.Builder, entries []*models.RosterEntry, describe func(*models.RosterEntry) string) {
+	for i, entry := range entries {
+		if i == maxRosterListed {
+			sb.WriteString(fmt.Sprintf("… и еще %d\n", len(entries)-maxRosterListed))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("• %s — %s%d, %s\n", entry.Username, targetIDPrefix, entry.UserID, describe(entry)))
+	}
+}
+
+// handleRoster сверяет участников чата в Telegram с теми, кого отслеживает бот
+func (b *Bot) handleRoster(msg *tgbotapi.Message) {
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	entries, err := b.db.GetChatRoster(msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get roster of chat %d: %v", msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении участников")
+		b.post(reply)
+		return
+	}
+	report := buildRoster(entries)
+
+	var sb strings.Builder
+	sb.WriteString("📋 Состав стаи:\n\n")
+
+	total, err := b.api.GetChatMembersCount(tgbotapi.ChatMemberCountConfig{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: msg.Chat.ID},
+	})
+	if err != nil {
+		b.logger.Errorf("Failed to get members count of chat %d: %v", msg.Chat.ID, err)
+		sb.WriteString("👥 В чате: не удалось узнать у Telegram\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("👥 В чате: %d\n", total))
+	}
+	sb.WriteString(fmt.Sprintf("💬 Отслеживаются и пишут: %d\n", len(report.Tracked)))
+	sb.WriteString(fmt.Sprintf("🤐 Отслеживаются, но молчат: %d\n", len(report.Silent)))
+	sb.WriteString(fmt.Sprintf("🚪 Ушли или удалены: %d\n", len(report.Departed)))
+	if err == nil {
+		// Сам бот тоже входит в число участников
+		unknown := total - len(report.Tracked) - len(report.Silent) - 1
+		if unknown > 0 {
+			sb.WriteString(fmt.Sprintf("❓ Неизвестны боту: %d — вступили до его подключения и ни разу не писали\n", unknown))
+		}
+	}
+
+	if len(report.Silent) > 0 {
+		sb.WriteString("\n🤐 Молчат:\n")
+		writeRosterList(&sb, report.Silent, func(entry *models.RosterEntry) string {
+			return fmt.Sprintf("с %s", utils.FormatMoscowDateTime(entry.FirstSeenAt))
+		})
+	}
+
+	if len(report.Departed) > 0 {
+		sb.WriteString("\n🚪 Ушли:\n")
+		writeRosterList(&sb, report.Departed, func(entry *models.RosterEntry) string {
+			if entry.LeftAt == nil {
+				return entry.State.Title()
+			}
+			return fmt.Sprintf("%s с %s", entry.State.Title(), utils.FormatMoscowDateTime(*entry.LeftAt))
+		})
+	}
+
+	reply := b.newReply(msg, sb.String())
+	b.post(reply)
+}
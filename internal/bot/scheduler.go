@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"context"
+	"time"
+
+	"leo-bot/internal/dispatch"
+	"leo-bot/internal/utils"
+)
+
+// schedulerInterval — как часто планировщик проверяет периодические задачи
+const schedulerInterval = time.Minute
+
+// runScheduler выполняет периодические задачи бота, пока не будет отменен контекст
+func (b *Bot) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	// Первый прогон сразу после старта, чтобы не ждать минуту после перезапуска
+	b.runScheduledJobs(ctx)
+
+	for {
+		select {
+		case <-ticker.C:
+			b.runScheduledJobs(ctx)
+		case <-ctx.Done():
+			b.logger.Info("Scheduler stopped")
+			return
+		}
+	}
+}
+
+// runScheduledJobs запускает все периодические задачи по очереди
+func (b *Bot) runScheduledJobs(ctx context.Context) {
+	now := utils.GetMoscowTime()
+
+	b.closeFinishedSeasons(now)
+	b.ensureSeasonsForTrackedChats(now)
+	b.postTeamWeeklyResults(now)
+	b.finishChallenges(now)
+	b.processOpenSickLeaves(ctx, now)
+	b.processVacations(ctx, now)
+}
+
+// submitMemberTask выполняет изменение участника в очереди диспетчера, чтобы оно не пересекалось
+// с обработкой его сообщений: обе стороны читают и пишут одну строку message_log.
+// Если бот останавливается, задача пропускается — ее состояние в базе, и следующий прогон выполнит ее снова
+func (b *Bot) submitMemberTask(ctx context.Context, chatID, userID int64, task func()) {
+	if err := b.dispatcher.Submit(ctx, dispatch.Key{ChatID: chatID, UserID: userID}, task); err != nil {
+		b.logger.Infof("Scheduled task for user %d in chat %d postponed: %v", userID, chatID, err)
+	}
+}
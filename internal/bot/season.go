@@ -0,0 +1,328 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// seasonMetric — по какой метрике считаются очки сезона
+	seasonMetric = models.MetricCalories
+	// hallOfFamePlaces — сколько призеров сезона попадает в зал славы
+	hallOfFamePlaces = 3
+)
+
+// quarterSeasonName возвращает название сезона-квартала, например "Q4 2026"
+func quarterSeasonName(quarterStart time.Time) string {
+	return fmt.Sprintf("Q%d %d", (int(quarterStart.Month())-1)/3+1, quarterStart.Year())
+}
+
+// ensureCurrentSeason возвращает текущий сезон чата, при необходимости создавая сезон-квартал.
+// Новый квартальный сезон начинается не раньше окончания предыдущего, чтобы сезоны не пересекались
+func (b *Bot) ensureCurrentSeason(chatID int64, now time.Time) (*models.Season, error) {
+	season, err := b.db.GetCurrentSeason(chatID, now)
+	if err == nil {
+		return season, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	lastEnd, err := b.db.GetLastSeasonEnd(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	season = newQuarterSeason(chatID, now, lastEnd)
+	if err := b.db.CreateSeason(season); err != nil {
+		return nil, err
+	}
+
+	b.logger.Infof("Created season %q for chat %d: %s — %s", season.Name, chatID, season.StartsAt, season.EndsAt)
+	return season, nil
+}
+
+// newQuarterSeason описывает сезон-квартал, идущий в момент now. lastEnd — конец предыдущего сезона чата,
+// nil — сезонов еще не было. Первый сезон начинается с начала квартала, а не с AllTime,
+// поэтому начальные остатки из миграции в его очки не попадают
+func newQuarterSeason(chatID int64, now time.Time, lastEnd *time.Time) *models.Season {
+	quarterStart := utils.StartOfMoscowQuarter(now)
+	startsAt := quarterStart
+	if lastEnd != nil && lastEnd.After(startsAt) {
+		startsAt = *lastEnd
+	}
+
+	return &models.Season{
+		ChatID:   chatID,
+		Name:     quarterSeasonName(quarterStart),
+		StartsAt: startsAt,
+		EndsAt:   quarterStart.AddDate(0, 3, 0),
+	}
+}
+
+// ensureSeasonsForTrackedChats следит, чтобы у каждого чата был идущий сезон
+func (b *Bot) ensureSeasonsForTrackedChats(now time.Time) {
+	chatIDs, err := b.db.GetTrackedChatIDs()
+	if err != nil {
+		b.logger.Errorf("Failed to get tracked chats for seasons: %v", err)
+		return
+	}
+
+	for _, chatID := range chatIDs {
+		if _, err := b.ensureCurrentSeason(chatID, now); err != nil {
+			b.logger.Errorf("Failed to ensure season for chat %d: %v", chatID, err)
+		}
+	}
+}
+
+// closeFinishedSeasons подводит итоги всех закончившихся сезонов
+func (b *Bot) closeFinishedSeasons(now time.Time) {
+	seasons, err := b.db.GetSeasonsToClose(now)
+	if err != nil {
+		b.logger.Errorf("Failed to get seasons to close: %v", err)
+		return
+	}
+
+	for _, season := range seasons {
+		b.closeSeason(season)
+
+		// Сразу открываем следующий сезон, чтобы очки не терялись
+		if _, err := b.ensureCurrentSeason(season.ChatID, now); err != nil {
+			b.logger.Errorf("Failed to open next season for chat %d: %v", season.ChatID, err)
+		}
+	}
+}
+
+// closeSeason переносит призеров сезона в зал славы и объявляет итоги в чате
+func (b *Bot) closeSeason(season *models.Season) {
+	winners, err := b.db.GetLeaderboard(season.ChatID, seasonMetric, season.StartsAt, season.EndsAt, hallOfFamePlaces)
+	if err != nil {
+		b.logger.Errorf("Failed to get standings for season %d: %v", season.ID, err)
+		return
+	}
+
+	if err := b.db.CloseSeason(season, winners); err != nil {
+		b.logger.Errorf("Failed to close season %d: %v", season.ID, err)
+		return
+	}
+	b.logger.Infof("Closed season %d (%s) in chat %d with %d winners", season.ID, season.Name, season.ChatID, len(winners))
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🏁 Сезон «%s» завершен! 🏁\n\n", season.Name))
+	if len(winners) == 0 {
+		text.WriteString("😾 В этом сезоне никто не заработал ни одной калории...\n\n🦁 Fat Leopard разочарован и идет за добавкой!")
+	} else {
+		text.WriteString("🏆 Зал славы пополняют:\n\n")
+		for i, winner := range winners {
+			text.WriteString(fmt.Sprintf("%s %s — %d калорий\n", placeEmoji(i), winner.Username, winner.Value))
+		}
+		text.WriteString("\n🦁 Fat Leopard снимает шляпу перед чемпионами!\n🔄 Очки сезона обнулены — новый сезон уже начался, догоняйте!")
+	}
+
+	reply := tgbotapi.NewMessage(season.ChatID, text.String())
+	b.logger.Infof("Sending season results to chat %d", season.ChatID)
+	if _, err := b.api.Send(reply); err != nil {
+		b.logger.Errorf("Failed to send season results: %v", err)
+	} else {
+		b.logger.Infof("Successfully sent season results to chat %d", season.ChatID)
+	}
+}
+
+func (b *Bot) handleSeason(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		b.sendSeasonStandings(msg)
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "hall", "зал":
+		b.sendHallOfFame(msg)
+	case "start":
+		b.handleSeasonStart(msg, args[1:])
+	case "end":
+		b.handleSeasonEnd(msg)
+	default:
+		reply := b.newReply(msg, "❌ Использование:\n/season — текущий сезон\n/season hall — зал славы\n/season start <YYYY-MM-DD> [название] — начать сезон (админ)\n/season end — завершить сезон досрочно (админ)")
+		b.post(reply)
+	}
+}
+
+func (b *Bot) sendSeasonStandings(msg *tgbotapi.Message) {
+	now := utils.GetMoscowTime()
+	season, err := b.ensureCurrentSeason(msg.Chat.ID, now)
+	if err != nil {
+		b.logger.Errorf("Failed to get current season: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	standings, err := b.db.GetLeaderboard(msg.Chat.ID, seasonMetric, season.StartsAt, now, 10)
+	if err != nil {
+		b.logger.Errorf("Failed to get season standings: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🏟 Сезон «%s»\n📅 %s — %s\n⏳ До конца сезона: %s\n\n",
+		season.Name,
+		utils.GetMoscowDateFromTime(season.StartsAt),
+		utils.GetMoscowDateFromTime(season.EndsAt.Add(-time.Second)),
+		b.formatDurationToDays(season.EndsAt.Sub(now))))
+
+	if len(standings) == 0 {
+		text.WriteString("📊 В этом сезоне пока никто не заработал калорий. Отправь #training_done и стань первым!")
+	} else {
+		text.WriteString("🏆 Таблица сезона (заработанные калории):\n\n")
+		for i, user := range standings {
+			text.WriteString(fmt.Sprintf("%s %s - %d калорий\n", placeEmoji(i), user.Username, user.Value))
+		}
+	}
+
+	reply := b.newReply(msg, text.String())
+	b.logger.Infof("Sending season standings to chat %d", msg.Chat.ID)
+	if _, err := b.api.Send(reply); err != nil {
+		b.logger.Errorf("Failed to send season standings: %v", err)
+	} else {
+		b.logger.Infof("Successfully sent season standings to chat %d", msg.Chat.ID)
+	}
+}
+
+func (b *Bot) sendHallOfFame(msg *tgbotapi.Message) {
+	entries, err := b.db.GetHallOfFame(msg.Chat.ID, 30)
+	if err != nil {
+		b.logger.Errorf("Failed to get hall of fame: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	if len(entries) == 0 {
+		reply := b.newReply(msg, "🏛 Зал славы пока пуст — ни один сезон еще не завершился")
+		b.post(reply)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString("🏛 Зал славы Fat Leopard:\n")
+	var currentSeason int64
+	for _, entry := range entries {
+		if entry.SeasonID != currentSeason {
+			currentSeason = entry.SeasonID
+			text.WriteString(fmt.Sprintf("\n🏁 %s\n", entry.SeasonName))
+		}
+		text.WriteString(fmt.Sprintf("%s %s — %d калорий\n", placeEmoji(entry.Place-1), entry.Username, entry.Points))
+	}
+
+	reply := b.newReply(msg, text.String())
+	b.post(reply)
+}
+
+func (b *Bot) handleSeasonStart(msg *tgbotapi.Message, args []string) {
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	if len(args) < 1 {
+		reply := b.newReply(msg, "❌ Использование: /season start <YYYY-MM-DD> [название]")
+		b.post(reply)
+		return
+	}
+
+	// Дата окончания включительно: сезон длится до конца указанного дня
+	lastDay, err := utils.ParseMoscowDate(args[0])
+	if err != nil {
+		reply := b.newReply(msg, "❌ Неверный формат даты, нужен YYYY-MM-DD")
+		b.post(reply)
+		return
+	}
+	now := utils.GetMoscowTime()
+	endsAt := lastDay.AddDate(0, 0, 1)
+	if !endsAt.After(now) {
+		reply := b.newReply(msg, "❌ Дата окончания сезона должна быть в будущем")
+		b.post(reply)
+		return
+	}
+
+	name := strings.Join(args[1:], " ")
+	if name == "" {
+		name = fmt.Sprintf("Сезон до %s", args[0])
+	}
+
+	// Текущий сезон завершается досрочно и подводятся его итоги
+	if current, err := b.db.GetCurrentSeason(msg.Chat.ID, now); err == nil {
+		if err := b.db.SetSeasonEnd(current.ID, now); err != nil {
+			b.logger.Errorf("Failed to end current season %d: %v", current.ID, err)
+			reply := b.newReply(msg, "❌ Ошибка при завершении текущего сезона")
+			b.post(reply)
+			return
+		}
+		current.EndsAt = now
+		b.closeSeason(current)
+	}
+
+	season := &models.Season{
+		ChatID:   msg.Chat.ID,
+		Name:     name,
+		StartsAt: now,
+		EndsAt:   endsAt,
+	}
+	if err := b.db.CreateSeason(season); err != nil {
+		b.logger.Errorf("Failed to create season: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при создании сезона")
+		b.post(reply)
+		return
+	}
+
+	b.auditAdmin(msg, models.AuditSeasonStart, 0, "", fmt.Sprintf("сезон %d «%s»", season.ID, season.Name))
+
+	reply := b.newReply(msg, fmt.Sprintf("🏟 Новый сезон «%s» начался!\n\n📅 До %s включительно\n🔄 Очки сезона обнулены, общая статистика сохранена\n\n🎯 Отправляй #training_done и попади в зал славы!", season.Name, args[0]))
+	b.post(reply)
+}
+
+func (b *Bot) handleSeasonEnd(msg *tgbotapi.Message) {
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	now := utils.GetMoscowTime()
+	current, err := b.db.GetCurrentSeason(msg.Chat.ID, now)
+	if err != nil {
+		reply := b.newReply(msg, "❌ Сейчас нет идущего сезона")
+		b.post(reply)
+		return
+	}
+
+	if err := b.db.SetSeasonEnd(current.ID, now); err != nil {
+		b.logger.Errorf("Failed to end season %d: %v", current.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при завершении сезона")
+		b.post(reply)
+		return
+	}
+	current.EndsAt = now
+	b.auditAdmin(msg, models.AuditSeasonEnd, 0, "", fmt.Sprintf("сезон %d «%s» завершен досрочно", current.ID, current.Name))
+
+	// Итоги и объявление — тем же путем, что и при плановом окончании
+	b.closeSeason(current)
+
+	if _, err := b.ensureCurrentSeason(msg.Chat.ID, now); err != nil {
+		b.logger.Errorf("Failed to open next season for chat %d: %v", msg.Chat.ID, err)
+	}
+}
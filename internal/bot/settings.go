@@ -0,0 +1,219 @@
+package bot
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"leo-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatSetting описывает одну настройку чата, которую можно менять через /settings.
+// Числовые настройки задают Min, Max, Get и Set, настройки да/нет — GetFlag и SetFlag
+type chatSetting struct {
+	Key     string
+	Title   string
+	Min     int
+	Max     int
+	Get     func(s *models.ChatSettings) int
+	Set     func(s *models.ChatSettings, value int)
+	GetFlag func(s *models.ChatSettings) bool
+	SetFlag func(s *models.ChatSettings, value bool)
+}
+
+// flagValues — как можно написать значение настройки да/нет
+var flagValues = map[string]bool{
+	"on": true, "off": false,
+	"1": true, "0": false,
+	"yes": true, "no": false,
+	"да": true, "нет": false,
+}
+
+// value возвращает текущее значение настройки так, как его показывает /settings
+func (c chatSetting) value(s *models.ChatSettings) string {
+	if c.GetFlag != nil {
+		if c.GetFlag(s) {
+			return "on"
+		}
+		return "off"
+	}
+	return strconv.Itoa(c.Get(s))
+}
+
+// apply разбирает значение из /settings и записывает его в настройки. false — значение не подходит
+func (c chatSetting) apply(s *models.ChatSettings, arg string) bool {
+	if c.SetFlag != nil {
+		flag, ok := flagValues[strings.ToLower(arg)]
+		if ok {
+			c.SetFlag(s, flag)
+		}
+		return ok
+	}
+
+	value, err := strconv.Atoi(arg)
+	if err != nil || value < c.Min || value > c.Max {
+		return false
+	}
+	c.Set(s, value)
+	return true
+}
+
+// hint описывает допустимые значения настройки для сообщения об ошибке
+func (c chatSetting) hint() string {
+	if c.SetFlag != nil {
+		return "on или off"
+	}
+	return fmt.Sprintf("числом от %d до %d", c.Min, c.Max)
+}
+
+// chatSettings — все настройки чата в порядке вывода
+var chatSettings = []chatSetting{
+	{
+		Key:   "sick_days_per_year",
+		Title: "Больничных дней в календарном году",
+		Min:   0,
+		Max:   366,
+		Get:   func(s *models.ChatSettings) int { return s.SickDaysPerYear },
+		Set:   func(s *models.ChatSettings, value int) { s.SickDaysPerYear = value },
+	},
+	{
+		Key:   "max_sick_leave_days",
+		Title: "Через сколько дней больничный закрывается автоматически",
+		Min:   1,
+		Max:   90,
+		Get:   func(s *models.ChatSettings) int { return s.MaxSickLeaveDays },
+		Set:   func(s *models.ChatSettings, value int) { s.MaxSickLeaveDays = value },
+	},
+	{
+		Key:   "sick_reminder_interval_days",
+		Title: "Как часто напоминать о незакрытом больничном, дней (0 — не напоминать)",
+		Min:   0,
+		Max:   30,
+		Get:   func(s *models.ChatSettings) int { return s.SickReminderIntervalDays },
+		Set:   func(s *models.ChatSettings, value int) { s.SickReminderIntervalDays = value },
+	},
+	{
+		Key:   "vacation_days_per_year",
+		Title: "Дней отпуска в календарном году",
+		Min:   0,
+		Max:   366,
+		Get:   func(s *models.ChatSettings) int { return s.VacationDaysPerYear },
+		Set:   func(s *models.ChatSettings, value int) { s.VacationDaysPerYear = value },
+	},
+	{
+		Key:   "max_vacation_days",
+		Title: "Максимальная длина одного отпуска, дней",
+		Min:   1,
+		Max:   90,
+		Get:   func(s *models.ChatSettings) int { return s.MaxVacationDays },
+		Set:   func(s *models.ChatSettings, value int) { s.MaxVacationDays = value },
+	},
+	{
+		Key:   "report_topic_id",
+		Title: "Тема форума для отчетов #training_done (0 — любая тема, here — текущая)",
+		Min:   0,
+		Max:   math.MaxInt32,
+		Get:   func(s *models.ChatSettings) int { return s.ReportTopicID },
+		Set:   func(s *models.ChatSettings, value int) { s.ReportTopicID = value },
+	},
+	{
+		Key:   "announce_topic_id",
+		Title: "Тема форума для объявлений бота (0 — общая тема, here — текущая)",
+		Min:   0,
+		Max:   math.MaxInt32,
+		Get:   func(s *models.ChatSettings) int { return s.AnnounceTopicID },
+		Set:   func(s *models.ChatSettings, value int) { s.AnnounceTopicID = value },
+	},
+	{
+		Key:     "redirect_off_topic_reports",
+		Title:   "Подсказывать, куда отправить отчет из другой темы (on — да, off — молча не засчитывать)",
+		GetFlag: func(s *models.ChatSettings) bool { return s.RedirectOffTopicReports },
+		SetFlag: func(s *models.ChatSettings, value bool) { s.RedirectOffTopicReports = value },
+	},
+}
+
+// findChatSetting ищет настройку по ключу
+func findChatSetting(key string) (chatSetting, bool) {
+	for _, setting := range chatSettings {
+		if setting.Key == key {
+			return setting, true
+		}
+	}
+	return chatSetting{}, false
+}
+
+// formatChatSettings форматирует текущие значения настроек чата
+func formatChatSettings(settings *models.ChatSettings) string {
+	var text strings.Builder
+	text.WriteString("⚙️ Настройки чата:\n\n")
+	for _, setting := range chatSettings {
+		text.WriteString(fmt.Sprintf("• %s = %s — %s\n", setting.Key, setting.value(settings), setting.Title))
+	}
+	text.WriteString("\n✏️ Изменить (админ): /settings <ключ> <значение>")
+	return text.String()
+}
+
+func (b *Bot) handleSettings(msg *tgbotapi.Message) {
+	settings, err := b.db.GetChatSettings(msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get chat settings for chat %d: %v", msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		reply := b.newReply(msg, formatChatSettings(settings))
+		b.post(reply)
+		return
+	}
+
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	if len(args) != 2 {
+		reply := b.newReply(msg, "❌ Использование: /settings <ключ> <значение>")
+		b.post(reply)
+		return
+	}
+
+	setting, ok := findChatSetting(strings.ToLower(args[0]))
+	if !ok {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Неизвестная настройка: %s\n\n%s", args[0], formatChatSettings(settings)))
+		b.post(reply)
+		return
+	}
+
+	arg := args[1]
+	// Тему форума удобнее указать, отправив команду прямо из нее
+	if strings.HasSuffix(setting.Key, "_topic_id") && strings.EqualFold(arg, "here") {
+		arg = strconv.Itoa(b.threadOf(msg))
+	}
+
+	previous := setting.value(settings)
+	if !setting.apply(settings, arg) {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Значение %s должно быть %s", setting.Key, setting.hint()))
+		b.post(reply)
+		return
+	}
+	value := setting.value(settings)
+	if err := b.db.SaveChatSettings(settings); err != nil {
+		b.logger.Errorf("Failed to save chat settings for chat %d: %v", msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при сохранении настроек")
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("Chat %d setting %s set to %s by user %d", msg.Chat.ID, setting.Key, value, msg.From.ID)
+	b.auditAdmin(msg, models.AuditSettings, 0, "", fmt.Sprintf("%s: %s -> %s", setting.Key, previous, value))
+	reply := b.newReply(msg, fmt.Sprintf("✅ %s = %s", setting.Key, value))
+	b.post(reply)
+}
@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"leo-bot/internal/logger"
+)
+
+// defaultShutdownTimeout — сколько ждать завершения начатой работы при остановке. По умолчанию Docker дает
+// 10 секунд между SIGTERM и SIGKILL, поэтому в docker-compose.yml stop_grace_period больше
+const defaultShutdownTimeout = 30 * time.Second
+
+// shutdownStep — этап остановки: что нужно дождаться и как назвать это в логе
+type shutdownStep struct {
+	name string
+	wait func()
+}
+
+// shutdown дожидается, пока бот доделает начатое: сначала обработчики обновлений (они могут запускать таймеры
+// и отправлять ответы), затем планировщик и таймеры, и последней — очередь отправки с их сообщениями
+func (b *Bot) shutdown(schedulerDone <-chan struct{}) error {
+	b.logger.Infof("Shutting down: %d updates in progress", b.dispatcher.Pending())
+
+	steps := []shutdownStep{
+		{name: "update handlers", wait: func() {
+			b.dispatcher.Close()
+			b.handoffs.Wait()
+		}},
+		{name: "scheduler", wait: func() { <-schedulerDone }},
+		{name: "timer actions", wait: b.stopTimerActions},
+	}
+	if b.api.outbox != nil {
+		steps = append(steps, shutdownStep{name: "outbox", wait: b.api.outbox.Close})
+	}
+
+	if err := runShutdown(b.logger, steps, b.shutdownTimeout); err != nil {
+		return err
+	}
+	b.logger.Info("Bot stopped")
+	return nil
+}
+
+// runShutdown выполняет этапы по порядку. Если общее время вышло, оставшиеся этапы не ждет и возвращает ошибку
+func runShutdown(log logger.Logger, steps []shutdownStep, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for _, step := range steps {
+		started := time.Now()
+		done := make(chan struct{})
+		go func(wait func()) {
+			defer close(done)
+			wait()
+		}(step.wait)
+
+		select {
+		case <-done:
+			log.Infof("Shutdown: %s stopped in %v", step.name, time.Since(started).Round(time.Millisecond))
+		case <-deadline.C:
+			log.Errorf("Shutdown: gave up waiting for %s after %v", step.name, timeout)
+			return fmt.Errorf("shutdown timed out waiting for %s", step.name)
+		}
+	}
+	return nil
+}
+
+// runTimerAction выполняет предупреждение или удаление по таймеру, если бот не останавливается
+func (b *Bot) runTimerAction(action func()) {
+	b.timerActionsMu.Lock()
+	if b.timersStopped {
+		b.timerActionsMu.Unlock()
+		return
+	}
+	b.timerActions.Add(1)
+	b.timerActionsMu.Unlock()
+
+	defer b.timerActions.Done()
+	action()
+}
+
+// stopTimerActions запрещает новые действия по таймерам и дожидается уже начатых
+func (b *Bot) stopTimerActions() {
+	b.timerActionsMu.Lock()
+	b.timersStopped = true
+	b.timerActionsMu.Unlock()
+
+	b.timerActions.Wait()
+}
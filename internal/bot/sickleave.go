@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/state"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxSickLeaveReasonLength — сколько символов причины больничного сохраняем
+const maxSickLeaveReasonLength = 200
+
+// sickLeaveTagPattern находит хештег больничного в любом регистре
+var sickLeaveTagPattern = regexp.MustCompile(`(?i)#sick_leave`)
+
+// parseSickLeaveReason возвращает причину больничного — текст сообщения без хештега
+func parseSickLeaveReason(text string) string {
+	reason := strings.Join(strings.Fields(sickLeaveTagPattern.ReplaceAllString(text, " ")), " ")
+	if utf8.RuneCountInString(reason) > maxSickLeaveReasonLength {
+		reason = string([]rune(reason)[:maxSickLeaveReasonLength])
+	}
+	return reason
+}
+
+// sickDaysCeil переводит время на больничном в дни; неполный день считается целым
+func sickDaysCeil(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	day := 24 * time.Hour
+	return int((d + day - 1) / day)
+}
+
+// sickDaysUsage возвращает, сколько больничных дней участник использовал в текущем году, и годовой лимит чата
+func (b *Bot) sickDaysUsage(userID, chatID int64, now time.Time) (used, quota int, err error) {
+	settings, err := b.db.GetChatSettings(chatID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	usage, err := b.db.GetSickLeaveUsage(userID, chatID, utils.StartOfMoscowYear(now), now)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return sickDaysCeil(usage), settings.SickDaysPerYear, nil
+}
+
+// sickLeaveAction — что планировщик должен сделать с открытым больничным
+type sickLeaveAction int
+
+const (
+	sickLeaveWait sickLeaveAction = iota
+	sickLeaveRemind
+	sickLeaveExpire
+)
+
+// sickLeaveClosesAt возвращает момент, когда больничный закроется автоматически: по max_sick_leave_days
+// или раньше, если к этому времени закончатся больничные дни на год. usage — время на больничных
+// с начала года по now, включая текущий. byQuota сообщает, что срок задает годовой лимит
+func sickLeaveClosesAt(leave *models.SickLeave, settings *models.ChatSettings, usage time.Duration, now time.Time) (closesAt time.Time, byQuota bool) {
+	day := 24 * time.Hour
+	closesAt = leave.StartedAt.Add(time.Duration(settings.MaxSickLeaveDays) * day)
+
+	quotaEndsAt := now.Add(time.Duration(settings.SickDaysPerYear)*day - usage)
+	if quotaEndsAt.Before(closesAt) {
+		return quotaEndsAt, true
+	}
+	return closesAt, false
+}
+
+// nextSickLeaveAction решает, пора ли напомнить о больничном или закрыть его в момент closesAt
+func nextSickLeaveAction(leave *models.SickLeave, settings *models.ChatSettings, closesAt, now time.Time) sickLeaveAction {
+	if !now.Before(closesAt) {
+		return sickLeaveExpire
+	}
+
+	if settings.SickReminderIntervalDays <= 0 {
+		return sickLeaveWait
+	}
+	lastReminder := leave.StartedAt
+	if leave.LastRemindedAt != nil {
+		lastReminder = *leave.LastRemindedAt
+	}
+	if now.Sub(lastReminder) >= time.Duration(settings.SickReminderIntervalDays)*24*time.Hour {
+		return sickLeaveRemind
+	}
+
+	return sickLeaveWait
+}
+
+// processOpenSickLeaves напоминает о затянувшихся больничных и закрывает те, что достигли максимального срока
+// или исчерпали годовой лимит. Состояние берется из sick_leaves, поэтому после перезапуска бот продолжает с того же места
+func (b *Bot) processOpenSickLeaves(ctx context.Context, now time.Time) {
+	leaves, err := b.db.GetOpenSickLeaves()
+	if err != nil {
+		b.logger.Errorf("Failed to get open sick leaves: %v", err)
+		return
+	}
+
+	settingsByChat := make(map[int64]*models.ChatSettings)
+	for _, leave := range leaves {
+		settings, ok := settingsByChat[leave.ChatID]
+		if !ok {
+			settings, err = b.db.GetChatSettings(leave.ChatID)
+			if err != nil {
+				b.logger.Errorf("Failed to get chat settings for chat %d: %v", leave.ChatID, err)
+				continue
+			}
+			settingsByChat[leave.ChatID] = settings
+		}
+
+		usage, err := b.db.GetSickLeaveUsage(leave.UserID, leave.ChatID, utils.StartOfMoscowYear(now), now)
+		if err != nil {
+			b.logger.Errorf("Failed to get sick leave usage of user %d in chat %d: %v", leave.UserID, leave.ChatID, err)
+			continue
+		}
+		closesAt, byQuota := sickLeaveClosesAt(leave, settings, usage, now)
+
+		switch nextSickLeaveAction(leave, settings, closesAt, now) {
+		case sickLeaveRemind:
+			b.remindAboutSickLeave(leave, closesAt, now)
+		case sickLeaveExpire:
+			leave, settings := leave, settings
+			b.submitMemberTask(ctx, leave.ChatID, leave.UserID, func() { b.expireSickLeave(leave, settings, closesAt, byQuota) })
+		}
+	}
+}
+
+// remindAboutSickLeave спрашивает участника, не выздоровел ли он
+func (b *Bot) remindAboutSickLeave(leave *models.SickLeave, closesAt, now time.Time) {
+	// Отмечаем напоминание до отправки, чтобы при ошибке сети не спамить каждую минуту
+	if err := b.db.MarkSickLeaveReminded(leave.ID, now); err != nil {
+		b.logger.Errorf("Failed to mark sick leave %d reminded: %v", leave.ID, err)
+		return
+	}
+
+	messageLog, err := b.db.GetMessageLog(leave.UserID, leave.ChatID)
+	if err != nil {
+		b.logger.Errorf("Failed to get message log for sick leave reminder: %v", err)
+		return
+	}
+
+	sickFor := now.Sub(leave.StartedAt)
+	autoCloseIn := closesAt.Sub(now)
+	text := fmt.Sprintf("🏥 %s, ты на больничном уже %s. Как самочувствие?\n\n💪 Если поправился — отправь #healthy, и таймер продолжится с места остановки.\n\n⏳ Через %s больничный закроется автоматически.",
+		messageLog.Username, b.formatDurationToDays(sickFor), b.formatDurationToDays(autoCloseIn))
+
+	reply := tgbotapi.NewMessage(leave.ChatID, text)
+	if _, err := b.api.Send(reply); err != nil {
+		b.logger.Errorf("Failed to send sick leave reminder to user %d: %v", leave.UserID, err)
+	} else {
+		b.logger.Infof("Sent sick leave reminder to user %d in chat %d", leave.UserID, leave.ChatID)
+	}
+}
+
+// expireSickLeave закрывает больничный в момент endedAt так, будто участник отправил #healthy.
+// Если бот был выключен, endedAt — момент достижения лимита, а не момент проверки
+func (b *Bot) expireSickLeave(leave *models.SickLeave, settings *models.ChatSettings, endedAt time.Time, byQuota bool) {
+	messageLog, err := b.db.GetMessageLog(leave.UserID, leave.ChatID)
+	if err != nil {
+		b.logger.Errorf("Failed to get message log for sick leave expiry: %v", err)
+		return
+	}
+
+	// Участник уже не на больничном (например, удален или выздоровел иначе) — просто закрываем запись в истории
+	if messageLog.State != state.Sick {
+		if _, err := b.db.EndSickLeave(leave.UserID, leave.ChatID, endedAt); err != nil {
+			b.logger.Errorf("Failed to close stale sick leave %d: %v", leave.ID, err)
+		}
+		return
+	}
+
+	limit := fmt.Sprintf("max_sick_leave_days = %d", settings.MaxSickLeaveDays)
+	if byQuota {
+		limit = fmt.Sprintf("sick_days_per_year = %d", settings.SickDaysPerYear)
+	}
+	b.logger.Infof("Sick leave %d of user %d reached %s, resuming timer automatically", leave.ID, leave.UserID, limit)
+	b.auditSystem(leave.ChatID, models.AuditSickLeaveExpired, leave.UserID, messageLog.Username,
+		fmt.Sprintf("больничный с %s достиг лимита %s, закрыт на %s",
+			utils.FormatMoscowDateTime(leave.StartedAt), limit, utils.FormatMoscowDateTime(endedAt)))
+	b.resumeAfterSickLeave(leave.UserID, leave.ChatID, messageLog.Username, strings.TrimPrefix(messageLog.Username, "@"), endedAt, true)
+}
@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"leo-bot/internal/state"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// targetIDPrefix — явное указание участника по ID, работает и в ответе на сообщение
+const targetIDPrefix = "id:"
+
+// memberTarget — участник, к которому относится команда администратора
+type memberTarget struct {
+	UserID   int64
+	Username string
+}
+
+// entityText возвращает текст сущности сообщения. Смещения сущностей Telegram считаются в UTF-16
+func entityText(text string, entity tgbotapi.MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	if entity.Offset < 0 || entity.Length <= 0 || entity.Offset+entity.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[entity.Offset : entity.Offset+entity.Length]))
+}
+
+// mentionedUser находит упоминание без username (text_mention), с которого начинаются аргументы команды.
+// Возвращает упомянутого пользователя и аргументы после упоминания
+func mentionedUser(msg *tgbotapi.Message, args []string) (*tgbotapi.User, []string, bool) {
+	joined := strings.Join(args, " ")
+	for _, entity := range msg.Entities {
+		if entity.Type != "text_mention" || entity.User == nil {
+			continue
+		}
+		mention := strings.Fields(entityText(msg.Text, entity))
+		if len(mention) == 0 || !strings.HasPrefix(joined, strings.Join(mention, " ")) || len(mention) > len(args) {
+			continue
+		}
+		return entity.User, args[len(mention):], true
+	}
+	return nil, nil, false
+}
+
+// parseTargetID разбирает ID участника: id:123 всегда, просто 123 — только если allowBare.
+// В ответе на сообщение голое число — это обычный аргумент команды (например, серия в /set_streak)
+func parseTargetID(arg string, allowBare bool) (int64, bool) {
+	digits := strings.TrimPrefix(strings.ToLower(arg), targetIDPrefix)
+	if digits == strings.ToLower(arg) && !allowBare {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// resolveTarget определяет участника, к которому относится команда администратора. Участник берется из первого
+// аргумента (упоминание text_mention, id:123 или 123, @username или точное имя) или из ответа на его сообщение.
+// Возвращает участника и оставшиеся аргументы. Если участника определить нельзя, сам отвечает в чат
+// (usage, «не найден» или список кандидатов) и возвращает ok = false
+func (b *Bot) resolveTarget(msg *tgbotapi.Message, args []string, usage string) (*memberTarget, []string, bool) {
+	reply := msg.ReplyToMessage
+	hasReply := reply != nil && reply.From != nil && !reply.From.IsBot
+
+	if user, rest, ok := mentionedUser(msg, args); ok {
+		target, ok := b.targetByID(msg, user.ID)
+		return target, rest, ok
+	}
+
+	if len(args) > 0 {
+		if id, ok := parseTargetID(args[0], !hasReply); ok {
+			target, ok := b.targetByID(msg, id)
+			return target, args[1:], ok
+		}
+		// Без ответа первый аргумент — всегда участник, в ответе — только явный @username
+		if !hasReply || strings.HasPrefix(args[0], "@") {
+			target, ok := b.targetByName(msg, args[0])
+			return target, args[1:], ok
+		}
+	}
+
+	if hasReply {
+		target, ok := b.targetByID(msg, reply.From.ID)
+		return target, args, ok
+	}
+
+	b.post(b.newReply(msg, usage))
+	return nil, nil, false
+}
+
+// resolveTargetArg определяет участника по одному аргументу: id:123, 123 или имени
+func (b *Bot) resolveTargetArg(msg *tgbotapi.Message, arg string) (*memberTarget, bool) {
+	if id, ok := parseTargetID(arg, true); ok {
+		return b.targetByID(msg, id)
+	}
+	return b.targetByName(msg, arg)
+}
+
+// targetByID проверяет, что участник с таким ID есть в базе этого чата
+func (b *Bot) targetByID(msg *tgbotapi.Message, userID int64) (*memberTarget, bool) {
+	messageLog, err := b.db.GetMessageLog(userID, msg.Chat.ID)
+	if err != nil {
+		text := "❌ Ошибка при получении данных пользователя"
+		if errors.Is(err, sql.ErrNoRows) {
+			text = fmt.Sprintf("❌ Участник с ID %d не найден в базе данных", userID)
+		} else {
+			b.logger.Errorf("Failed to get message log of user %d: %v", userID, err)
+		}
+		b.post(b.newReply(msg, text))
+		return nil, false
+	}
+
+	return &memberTarget{UserID: userID, Username: messageLog.Username}, true
+}
+
+// targetByName ищет участника по точному имени. Если точного совпадения нет или их несколько,
+// показывает кандидатов и просит выбрать, а не угадывает
+func (b *Bot) targetByName(msg *tgbotapi.Message, name string) (*memberTarget, bool) {
+	b.logger.Infof("Searching for user: '%s' in chat %d", name, msg.Chat.ID)
+
+	users, exact, err := b.db.FindUsersByName(name, msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to find users by name '%s': %v", name, err)
+		b.post(b.newReply(msg, "❌ Ошибка при получении данных пользователя"))
+		return nil, false
+	}
+
+	if exact && len(users) == 1 {
+		return &memberTarget{UserID: users[0].UserID, Username: users[0].Username}, true
+	}
+	if len(users) == 0 {
+		b.post(b.newReply(msg, fmt.Sprintf("❌ Пользователь %s не найден в базе данных", name)))
+		return nil, false
+	}
+
+	var text strings.Builder
+	if exact {
+		text.WriteString(fmt.Sprintf("🤔 Имя %s носят несколько участников. Кого вы имели в виду?\n\n", name))
+	} else {
+		text.WriteString(fmt.Sprintf("🤔 Точного совпадения для %s нет. Возможно, вы имели в виду:\n\n", name))
+	}
+	for _, user := range users {
+		text.WriteString(fmt.Sprintf("• %s — %s%d (%s)\n", user.Username, targetIDPrefix, user.UserID, state.State(user.Status).Title()))
+	}
+	text.WriteString(fmt.Sprintf("\nПовторите команду с %sID или @username либо ответьте ею на сообщение участника", targetIDPrefix))
+
+	b.post(b.newReply(msg, text.String()))
+	return nil, false
+}
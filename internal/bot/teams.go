@@ -0,0 +1,332 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"leo-bot/internal/database"
+	"leo-bot/internal/models"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxTeamNameLength — максимальная длина названия команды в символах
+const maxTeamNameLength = 32
+
+const teamUsage = "❌ Использование:\n" +
+	"/team — ваша команда и зачет недели\n" +
+	"/team join <название> — вступить в команду\n" +
+	"/team leave — выйти из команды\n" +
+	"/team create <название> — создать команду (админ)\n" +
+	"/team delete <название> — удалить команду (админ)\n" +
+	"/team assign @username <название> — записать участника в команду (админ)"
+
+// normalizeTeamName приводит название команды к единому виду и проверяет длину
+func normalizeTeamName(args []string) (string, bool) {
+	name := strings.Join(args, " ")
+	if name == "" || utf8.RuneCountInString(name) > maxTeamNameLength {
+		return "", false
+	}
+	return name, true
+}
+
+func (b *Bot) handleTeam(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		b.sendTeamStandings(msg)
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "join":
+		b.handleTeamJoin(msg, args[1:])
+	case "leave":
+		b.handleTeamLeave(msg)
+	case "create":
+		b.handleTeamCreate(msg, args[1:])
+	case "delete":
+		b.handleTeamDelete(msg, args[1:])
+	case "assign":
+		b.handleTeamAssign(msg, args[1:])
+	default:
+		reply := b.newReply(msg, teamUsage)
+		b.post(reply)
+	}
+}
+
+func (b *Bot) handleTeamCreate(msg *tgbotapi.Message, args []string) {
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	name, ok := normalizeTeamName(args)
+	if !ok {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Использование: /team create <название> (до %d символов)", maxTeamNameLength))
+		b.post(reply)
+		return
+	}
+
+	team := &models.Team{
+		ChatID:    msg.Chat.ID,
+		Name:      name,
+		CreatedBy: msg.From.ID,
+		CreatedAt: utils.GetMoscowTime(),
+	}
+	if err := b.db.CreateTeam(team); err != nil {
+		if errors.Is(err, database.ErrTeamExists) {
+			reply := b.newReply(msg, fmt.Sprintf("❌ Команда «%s» уже существует", name))
+			b.post(reply)
+			return
+		}
+		b.logger.Errorf("Failed to create team %q in chat %d: %v", name, msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при создании команды")
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("Created team %q (id %d) in chat %d", team.Name, team.ID, msg.Chat.ID)
+	b.auditAdmin(msg, models.AuditTeamCreate, 0, "", fmt.Sprintf("команда %d «%s»", team.ID, team.Name))
+	reply := b.newReply(msg, fmt.Sprintf("🛡 Команда «%s» создана! Вступайте: /team join %s", team.Name, team.Name))
+	b.post(reply)
+}
+
+func (b *Bot) handleTeamDelete(msg *tgbotapi.Message, args []string) {
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	name, ok := normalizeTeamName(args)
+	if !ok {
+		reply := b.newReply(msg, "❌ Использование: /team delete <название>")
+		b.post(reply)
+		return
+	}
+
+	deleted, err := b.db.DeleteTeam(msg.Chat.ID, name)
+	if err != nil {
+		b.logger.Errorf("Failed to delete team %q in chat %d: %v", name, msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при удалении команды")
+		b.post(reply)
+		return
+	}
+	if !deleted {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Команда «%s» не найдена", name))
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("Deleted team %q in chat %d", name, msg.Chat.ID)
+	b.auditAdmin(msg, models.AuditTeamDelete, 0, "", fmt.Sprintf("команда «%s»", name))
+	reply := b.newReply(msg, fmt.Sprintf("🗑 Команда «%s» распущена", name))
+	b.post(reply)
+}
+
+func (b *Bot) handleTeamAssign(msg *tgbotapi.Message, args []string) {
+	// Проверяем права администратора
+	if !b.isAdmin(msg.Chat.ID, msg.From.ID) {
+		reply := b.newReply(msg, "❌ Только администраторы или владелец могут использовать эту команду!")
+		b.post(reply)
+		return
+	}
+
+	const usage = "❌ Использование: /team assign @username <название> или ответом на сообщение участника: /team assign <название>"
+	target, args, ok := b.resolveTarget(msg, args, usage)
+	if !ok {
+		return
+	}
+	userID := target.UserID
+
+	name, ok := normalizeTeamName(args)
+	if !ok {
+		reply := b.newReply(msg, usage)
+		b.post(reply)
+		return
+	}
+	team, ok := b.findTeam(msg, name)
+	if !ok {
+		return
+	}
+
+	if err := b.db.SetTeamMember(msg.Chat.ID, userID, team.ID, utils.GetMoscowTime()); err != nil {
+		b.logger.Errorf("Failed to assign user %d to team %d: %v", userID, team.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при записи в команду")
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("Assigned user %d to team %q in chat %d", userID, team.Name, msg.Chat.ID)
+	b.auditAdmin(msg, models.AuditTeamAssign, userID, target.Username, fmt.Sprintf("команда %d «%s»", team.ID, team.Name))
+	reply := b.newReply(msg, fmt.Sprintf("✅ %s теперь в команде «%s»", target.Username, team.Name))
+	b.post(reply)
+}
+
+func (b *Bot) handleTeamJoin(msg *tgbotapi.Message, args []string) {
+	name, ok := normalizeTeamName(args)
+	if !ok {
+		reply := b.newReply(msg, "❌ Использование: /team join <название>")
+		b.post(reply)
+		return
+	}
+
+	team, ok := b.findTeam(msg, name)
+	if !ok {
+		return
+	}
+
+	if err := b.db.SetTeamMember(msg.Chat.ID, msg.From.ID, team.ID, utils.GetMoscowTime()); err != nil {
+		b.logger.Errorf("Failed to add user %d to team %d: %v", msg.From.ID, team.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при вступлении в команду")
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("User %d joined team %q in chat %d", msg.From.ID, team.Name, msg.Chat.ID)
+	reply := b.newReply(msg, fmt.Sprintf("🛡 %s вступает в команду «%s»! Тренировки с этого момента идут в командный зачет 💪", getUserDisplayName(msg.From), team.Name))
+	b.post(reply)
+}
+
+func (b *Bot) handleTeamLeave(msg *tgbotapi.Message) {
+	removed, err := b.db.RemoveTeamMember(msg.Chat.ID, msg.From.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to remove user %d from team: %v", msg.From.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при выходе из команды")
+		b.post(reply)
+		return
+	}
+	if !removed {
+		reply := b.newReply(msg, "❌ Вы не состоите ни в одной команде")
+		b.post(reply)
+		return
+	}
+
+	reply := b.newReply(msg, fmt.Sprintf("👋 %s покидает команду", getUserDisplayName(msg.From)))
+	b.post(reply)
+}
+
+// findTeam ищет команду чата по названию и сообщает в чат, если ее нет
+func (b *Bot) findTeam(msg *tgbotapi.Message, name string) (*models.Team, bool) {
+	team, err := b.db.GetTeamByName(msg.Chat.ID, name)
+	if err == nil {
+		return team, true
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Команда «%s» не найдена. Список команд: /teams", name))
+		b.post(reply)
+		return nil, false
+	}
+
+	b.logger.Errorf("Failed to get team %q in chat %d: %v", name, msg.Chat.ID, err)
+	reply := b.newReply(msg, "❌ Ошибка при получении данных")
+	b.post(reply)
+	return nil, false
+}
+
+// sendTeamStandings показывает командный зачет текущей недели и команду автора
+func (b *Bot) sendTeamStandings(msg *tgbotapi.Message) {
+	now := utils.GetMoscowTime()
+	standings, err := b.db.GetTeamLeaderboard(msg.Chat.ID, utils.StartOfMoscowWeek(now), now)
+	if err != nil {
+		b.logger.Errorf("Failed to get team leaderboard for chat %d: %v", msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	if len(standings) == 0 {
+		reply := b.newReply(msg, "🛡 В чате пока нет команд. Администратор может создать: /team create <название>")
+		b.post(reply)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(formatTeamStandings("🛡 Командный зачет за неделю:", standings))
+
+	if msg.From != nil {
+		team, err := b.db.GetUserTeam(msg.Chat.ID, msg.From.ID)
+		switch {
+		case err == nil:
+			text.WriteString(fmt.Sprintf("\n👤 Ваша команда: «%s»", team.Name))
+		case errors.Is(err, sql.ErrNoRows):
+			text.WriteString("\n👤 Вы пока не в команде: /team join <название>")
+		default:
+			b.logger.Errorf("Failed to get team of user %d: %v", msg.From.ID, err)
+		}
+	}
+
+	reply := b.newReply(msg, text.String())
+	if _, err := b.api.Send(reply); err != nil {
+		b.logger.Errorf("Failed to send team standings: %v", err)
+	}
+}
+
+// formatTeamStandings форматирует командный зачет под заголовком
+func formatTeamStandings(title string, standings []*models.TeamStanding) string {
+	var text strings.Builder
+	text.WriteString(title + "\n\n")
+	for i, standing := range standings {
+		text.WriteString(fmt.Sprintf("%s %s - %d тренировок (участников: %d)\n", placeEmoji(i), standing.Name, standing.Trainings, standing.Members))
+	}
+	return text.String()
+}
+
+// previousTeamWeek возвращает границы прошлой московской недели [weekStart, weekEnd)
+func previousTeamWeek(now time.Time) (time.Time, time.Time) {
+	weekEnd := utils.StartOfMoscowWeek(now)
+	return weekEnd.AddDate(0, 0, -7), weekEnd
+}
+
+// postTeamWeeklyResults публикует итоги прошлой недели во всех чатах с командами.
+// Каждая неделя публикуется один раз: отметка ставится до отправки
+func (b *Bot) postTeamWeeklyResults(now time.Time) {
+	chatIDs, err := b.db.GetChatIDsWithTeams()
+	if err != nil {
+		b.logger.Errorf("Failed to get chats with teams: %v", err)
+		return
+	}
+
+	weekStart, weekEnd := previousTeamWeek(now)
+
+	for _, chatID := range chatIDs {
+		posted, err := b.db.MarkTeamWeekPosted(chatID, weekStart, now)
+		if err != nil {
+			b.logger.Errorf("Failed to mark team week %s for chat %d: %v", utils.GetMoscowDateFromTime(weekStart), chatID, err)
+			continue
+		}
+		if !posted {
+			continue
+		}
+
+		standings, err := b.db.GetTeamLeaderboard(chatID, weekStart, weekEnd)
+		if err != nil {
+			b.logger.Errorf("Failed to get team leaderboard for chat %d: %v", chatID, err)
+			continue
+		}
+		// Если за неделю никто из команд не тренировался, не шумим в чате
+		if len(standings) == 0 || standings[0].Trainings == 0 {
+			continue
+		}
+
+		title := fmt.Sprintf("🏁 Итоги командной недели %s — %s:",
+			utils.GetMoscowDateFromTime(weekStart), utils.GetMoscowDateFromTime(weekEnd.Add(-time.Second)))
+		text := formatTeamStandings(title, standings)
+		text += fmt.Sprintf("\n🎉 Победитель недели — команда «%s»! Новая неделя уже началась, вперед! 🦁", standings[0].Name)
+
+		reply := tgbotapi.NewMessage(chatID, text)
+		if _, err := b.api.Send(reply); err != nil {
+			b.logger.Errorf("Failed to send team weekly results to chat %d: %v", chatID, err)
+		} else {
+			b.logger.Infof("Posted team weekly results to chat %d", chatID)
+		}
+	}
+}
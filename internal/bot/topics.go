@@ -0,0 +1,337 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"leo-bot/internal/outbox"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// getUpdatesRetryDelay — пауза перед повторным запросом обновлений после ошибки
+const getUpdatesRetryDelay = 3 * time.Second
+
+// telegramAPI — клиент Bot API с поддержкой тем форума. Версия библиотеки не знает про message_thread_id,
+// поэтому сообщения в тему отправляются через MakeRequest. Исходящие запросы идут через outbox,
+// чтобы не упираться в лимиты Telegram
+type telegramAPI struct {
+	*tgbotapi.BotAPI
+
+	// outbox — очередь исходящих запросов, nil — запросы отправляются сразу
+	outbox *outbox.Outbox
+
+	// announceTopic возвращает тему для объявлений бота в чате, 0 — общая тема
+	announceTopic func(chatID int64) int
+}
+
+// topicMessage — ответ в ту тему форума, откуда пришло сообщение. ThreadID = 0 — общая тема
+type topicMessage struct {
+	tgbotapi.MessageConfig
+	ThreadID int
+}
+
+// incomingUpdate — обновление вместе с темой форума, в которой написано сообщение
+type incomingUpdate struct {
+	Update   tgbotapi.Update
+	ThreadID int
+}
+
+// topicFields — поля сообщения о темах форума, которых нет в tgbotapi.Message
+type topicFields struct {
+	MessageThreadID int  `json:"message_thread_id"`
+	IsTopicMessage  bool `json:"is_topic_message"`
+}
+
+// Send отправляет сообщение через очередь и ждет, пока оно будет доставлено. Нужен, когда важен результат:
+// отправленное сообщение или ошибка. Ответы, которые только показываются участнику, отправляет post
+func (a *telegramAPI) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if a.outbox == nil {
+		return a.deliver(c)
+	}
+
+	var message tgbotapi.Message
+	err := a.outbox.Do(chatIDOf(c), func() error {
+		var err error
+		message, err = a.deliver(c)
+		return err
+	})
+	return message, err
+}
+
+// post ставит сообщение в очередь и не ждет отправки — для ответов, результат которых не нужен.
+// Так обработчик не держит воркера диспетчера, пока чат упирается в лимит Telegram. Ошибка только пишется в лог
+func (b *Bot) post(c tgbotapi.Chattable) {
+	if b.api.outbox == nil {
+		if _, err := b.api.deliver(c); err != nil {
+			b.logger.Errorf("Failed to send message to chat %d: %v", chatIDOf(c), err)
+		}
+		return
+	}
+
+	done := b.api.outbox.Post(chatIDOf(c), func() error {
+		_, err := b.api.deliver(c)
+		return err
+	})
+	go func() {
+		if err := <-done; err != nil {
+			b.logger.Errorf("Failed to send message to chat %d: %v", chatIDOf(c), err)
+		}
+	}()
+}
+
+// Request выполняет запрос (бан, разбан, приглашение) через очередь
+func (a *telegramAPI) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	if a.outbox == nil {
+		return a.BotAPI.Request(c)
+	}
+
+	var resp *tgbotapi.APIResponse
+	err := a.outbox.Do(chatIDOf(c), func() error {
+		var err error
+		resp, err = a.BotAPI.Request(c)
+		return err
+	})
+	return resp, err
+}
+
+// chatIDOf возвращает чат запроса для початового лимита, 0 — запрос без чата или неизвестного вида.
+// У ответа на кнопку (CallbackConfig) чата нет: он идет в очередь без початового лимита
+func chatIDOf(c tgbotapi.Chattable) int64 {
+	switch m := c.(type) {
+	case topicMessage:
+		return m.ChatID
+	case tgbotapi.MessageConfig:
+		return m.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return m.ChatID
+	case tgbotapi.DeleteMessageConfig:
+		return m.ChatID
+	case tgbotapi.BanChatMemberConfig:
+		return m.ChatID
+	case tgbotapi.UnbanChatMemberConfig:
+		return m.ChatID
+	case tgbotapi.CreateChatInviteLinkConfig:
+		return m.ChatID
+	}
+	return 0
+}
+
+// deliver отправляет сообщение. Ответ уходит в тему исходного сообщения, а сообщение без темы
+// (предупреждения, удаления, итоги) — в тему объявлений чата, если она задана
+func (a *telegramAPI) deliver(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	switch m := c.(type) {
+	case topicMessage:
+		if m.ThreadID != 0 {
+			return a.sendToTopic(m.MessageConfig, m.ThreadID)
+		}
+		return a.BotAPI.Send(m.MessageConfig)
+	case tgbotapi.MessageConfig:
+		// Личные чаты имеют положительный ID, тем у них нет
+		if m.ChatID < 0 && a.announceTopic != nil {
+			if threadID := a.announceTopic(m.ChatID); threadID != 0 {
+				return a.sendToTopic(m, threadID)
+			}
+		}
+	}
+	return a.BotAPI.Send(c)
+}
+
+// sendToTopic отправляет текстовое сообщение в тему форума
+func (a *telegramAPI) sendToTopic(config tgbotapi.MessageConfig, threadID int) (tgbotapi.Message, error) {
+	params := make(tgbotapi.Params)
+	if err := params.AddFirstValid("chat_id", config.ChatID, config.ChannelUsername); err != nil {
+		return tgbotapi.Message{}, err
+	}
+	params.AddNonZero("message_thread_id", threadID)
+	params.AddNonEmpty("text", config.Text)
+	params.AddNonEmpty("parse_mode", config.ParseMode)
+	params.AddBool("disable_web_page_preview", config.DisableWebPagePreview)
+	params.AddNonZero("reply_to_message_id", config.ReplyToMessageID)
+	params.AddBool("disable_notification", config.DisableNotification)
+	params.AddBool("allow_sending_without_reply", config.AllowSendingWithoutReply)
+	if err := params.AddInterface("reply_markup", config.ReplyMarkup); err != nil {
+		return tgbotapi.Message{}, err
+	}
+	if err := params.AddInterface("entities", config.Entities); err != nil {
+		return tgbotapi.Message{}, err
+	}
+
+	resp, err := a.MakeRequest("sendMessage", params)
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+
+	var message tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &message); err != nil {
+		return tgbotapi.Message{}, fmt.Errorf("failed to parse sent message: %w", err)
+	}
+	return message, nil
+}
+
+// getUpdates запрашивает обновления и достает из каждого тему форума
+func (a *telegramAPI) getUpdates(config tgbotapi.UpdateConfig) ([]incomingUpdate, error) {
+	params := make(tgbotapi.Params)
+	params.AddNonZero("offset", config.Offset)
+	params.AddNonZero("limit", config.Limit)
+	params.AddNonZero("timeout", config.Timeout)
+	if err := params.AddInterface("allowed_updates", config.AllowedUpdates); err != nil {
+		return nil, err
+	}
+
+	resp, err := a.MakeRequest("getUpdates", params)
+	if err != nil {
+		return nil, err
+	}
+	return parseUpdates(resp.Result)
+}
+
+// parseUpdates разбирает ответ getUpdates. Тема берется только у сообщений форума:
+// в обычных супергруппах message_thread_id означает ветку ответов, а не тему
+func parseUpdates(result json.RawMessage) ([]incomingUpdate, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(result, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse updates: %w", err)
+	}
+
+	updates := make([]incomingUpdate, 0, len(raw))
+	for _, data := range raw {
+		in, err := parseUpdate(data)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, in)
+	}
+	return updates, nil
+}
+
+// parseUpdate разбирает одно обновление вместе с темой форума
+func parseUpdate(data json.RawMessage) (incomingUpdate, error) {
+	var in incomingUpdate
+	if err := json.Unmarshal(data, &in.Update); err != nil {
+		return in, fmt.Errorf("failed to parse update: %w", err)
+	}
+
+	var topic struct {
+		Message       *topicFields `json:"message"`
+		CallbackQuery *struct {
+			Message *topicFields `json:"message"`
+		} `json:"callback_query"`
+	}
+	if err := json.Unmarshal(data, &topic); err != nil {
+		return in, nil
+	}
+	if topic.CallbackQuery != nil {
+		// Кнопка нажата под сообщением бота — ответ уходит в тему этого сообщения
+		topic.Message = topic.CallbackQuery.Message
+	}
+	if topic.Message != nil && topic.Message.IsTopicMessage {
+		in.ThreadID = topic.Message.MessageThreadID
+	}
+	return in, nil
+}
+
+// pollUpdates получает обновления long polling'ом, пока не будет отменен контекст
+func (b *Bot) pollUpdates(ctx context.Context, config tgbotapi.UpdateConfig) <-chan incomingUpdate {
+	// Без буфера: следующий getUpdates подтверждает все полученные обновления, поэтому отдаем их
+	// только тогда, когда Start готов их принять
+	ch := make(chan incomingUpdate)
+
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			updates, err := b.api.getUpdates(config)
+			if err != nil {
+				b.logger.Errorf("Failed to get updates, retrying in %v: %v", getUpdatesRetryDelay, err)
+				select {
+				case <-time.After(getUpdatesRetryDelay):
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			for _, update := range updates {
+				if update.Update.UpdateID < config.Offset {
+					continue
+				}
+				config.Offset = update.Update.UpdateID + 1
+				select {
+				case ch <- update:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
+// handleIncoming запоминает тему сообщения на время его обработки и обрабатывает обновление
+func (b *Bot) handleIncoming(in incomingUpdate) {
+	msg := in.Update.Message
+	if in.Update.CallbackQuery != nil {
+		msg = in.Update.CallbackQuery.Message
+	}
+	if in.ThreadID != 0 && msg != nil {
+		b.messageThreads.Store(msg, in.ThreadID)
+		defer b.messageThreads.Delete(msg)
+	}
+	b.handleUpdate(in.Update)
+}
+
+// threadOf возвращает тему форума, в которой написано сообщение, 0 — общая тема или обычный чат
+func (b *Bot) threadOf(msg *tgbotapi.Message) int {
+	if threadID, ok := b.messageThreads.Load(msg); ok {
+		return threadID.(int)
+	}
+	return 0
+}
+
+// newReply создает ответ на сообщение в той же теме форума
+func (b *Bot) newReply(msg *tgbotapi.Message, text string) topicMessage {
+	return topicMessage{
+		MessageConfig: tgbotapi.NewMessage(msg.Chat.ID, text),
+		ThreadID:      b.threadOf(msg),
+	}
+}
+
+// announceTopic возвращает тему для объявлений бота в чате
+func (b *Bot) announceTopic(chatID int64) int {
+	settings, err := b.db.GetChatSettings(chatID)
+	if err != nil {
+		b.logger.Errorf("Failed to get announce topic of chat %d: %v", chatID, err)
+		return 0
+	}
+	return settings.AnnounceTopicID
+}
+
+// isOffTopicReport проверяет, что отчет отправлен не в тему для отчетов. Если чат просит подсказывать,
+// отвечает, куда отправить отчет
+func (b *Bot) isOffTopicReport(msg *tgbotapi.Message) bool {
+	settings, err := b.db.GetChatSettings(msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get report topic of chat %d: %v", msg.Chat.ID, err)
+		return false
+	}
+	if settings.ReportTopicID == 0 || b.threadOf(msg) == settings.ReportTopicID {
+		return false
+	}
+
+	b.logger.Infof("Ignoring report of user %d in chat %d: topic %d instead of %d", msg.From.ID, msg.Chat.ID, b.threadOf(msg), settings.ReportTopicID)
+	if settings.RedirectOffTopicReports {
+		reply := b.newReply(msg, fmt.Sprintf("📌 %s, отчеты принимаются только в теме для тренировок — этот не засчитан.\n\n🦁 Отправь #training_done туда, и Леопард все увидит!", getUserDisplayName(msg.From)))
+		reply.ReplyToMessageID = msg.MessageID
+		b.post(reply)
+	}
+	return true
+}
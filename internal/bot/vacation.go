@@ -0,0 +1,390 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/state"
+	"leo-bot/internal/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const vacationUsage = "🏖 Отпуск:\n" +
+	"#vacation <с YYYY-MM-DD> <по YYYY-MM-DD> или /vacation <с> <по> — запланировать отпуск\n" +
+	"/vacation — ваши отпуска и остаток дней\n" +
+	"/vacation cancel — отменить ближайший отпуск или выйти из текущего досрочно\n\n" +
+	"Например: #vacation 2026-11-01 2026-11-10"
+
+// vacationDatePattern находит даты отпуска в тексте сообщения
+var vacationDatePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// parseVacationDates находит в тексте две даты и возвращает интервал отпуска [startsAt, endsAt).
+// Оба дня входят в отпуск; если отпуск начинается сегодня, он начинается с момента now
+func parseVacationDates(text string, now time.Time) (startsAt, endsAt time.Time, err error) {
+	dates := vacationDatePattern.FindAllString(text, -1)
+	if len(dates) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("expected two dates, got %d", len(dates))
+	}
+
+	firstDay, err := utils.ParseMoscowDate(dates[0])
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start date: %s", dates[0])
+	}
+	lastDay, err := utils.ParseMoscowDate(dates[1])
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end date: %s", dates[1])
+	}
+
+	if lastDay.Before(firstDay) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end date %s is before start date %s", dates[1], dates[0])
+	}
+	if firstDay.Before(utils.StartOfMoscowDay(now)) {
+		return time.Time{}, time.Time{}, fmt.Errorf("start date is in the past: %s", dates[0])
+	}
+
+	startsAt = firstDay
+	if startsAt.Before(now) {
+		startsAt = now
+	}
+	return startsAt, lastDay.AddDate(0, 0, 1), nil
+}
+
+// formatVacation описывает отпуск одной строкой
+func formatVacation(v *models.Vacation, now time.Time) string {
+	status := "📅"
+	if !v.StartsAt.After(now) {
+		status = "🏖 идет,"
+	}
+	return fmt.Sprintf("%s %s — %s (%d дн.)", status,
+		utils.GetMoscowDateFromTime(v.StartsAt), utils.GetMoscowDateFromTime(v.EndsAt.Add(-time.Second)),
+		sickDaysCeil(v.EndsAt.Sub(v.StartsAt)))
+}
+
+// isOnVacation проверяет, идет ли у участника отпуск в момент now
+func (b *Bot) isOnVacation(userID, chatID int64, now time.Time) bool {
+	_, err := b.db.GetActiveVacation(userID, chatID, now)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			b.logger.Errorf("Failed to get active vacation for user %d in chat %d: %v", userID, chatID, err)
+		}
+		return false
+	}
+	return true
+}
+
+// handleVacationTag обрабатывает #vacation <с> <по>
+func (b *Bot) handleVacationTag(msg *tgbotapi.Message) {
+	b.planVacation(msg, messageText(msg))
+}
+
+// handleVacation обрабатывает команду /vacation
+func (b *Bot) handleVacation(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	switch {
+	case len(args) == 0:
+		b.showVacations(msg)
+	case strings.ToLower(args[0]) == "cancel":
+		b.cancelVacation(msg)
+	default:
+		b.planVacation(msg, msg.CommandArguments())
+	}
+}
+
+// planVacation проверяет лимиты чата и сохраняет отпуск
+func (b *Bot) planVacation(msg *tgbotapi.Message, text string) {
+	now := utils.GetMoscowTime()
+	startsAt, endsAt, err := parseVacationDates(text, now)
+	if err != nil {
+		b.logger.Infof("Invalid vacation request from user %d: %v", msg.From.ID, err)
+		reply := b.newReply(msg, "❌ Не удалось разобрать даты отпуска (даты не в прошлом, окончание не раньше начала)\n\n"+vacationUsage)
+		b.post(reply)
+		return
+	}
+
+	settings, err := b.db.GetChatSettings(msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get chat settings for chat %d: %v", msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	// Дни отпуска считаются так же, как больничные: неполный день — целый
+	days := sickDaysCeil(endsAt.Sub(startsAt))
+	if days > settings.MaxVacationDays {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Отпуск не может быть длиннее %d дн., а запрошено %d дн.", settings.MaxVacationDays, days))
+		b.post(reply)
+		return
+	}
+
+	overlaps, err := b.db.HasOverlappingVacation(msg.From.ID, msg.Chat.ID, startsAt, endsAt)
+	if err != nil {
+		b.logger.Errorf("Failed to check overlapping vacations: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+	if overlaps {
+		reply := b.newReply(msg, "❌ Этот отпуск пересекается с уже запланированным. Посмотреть свои отпуска: /vacation")
+		b.post(reply)
+		return
+	}
+
+	// Годовой лимит считаем по году начала отпуска
+	yearStart := utils.StartOfMoscowYear(startsAt)
+	usedDays, err := b.db.GetVacationDaysUsed(msg.From.ID, msg.Chat.ID, yearStart, yearStart.AddDate(1, 0, 0))
+	if err != nil {
+		b.logger.Errorf("Failed to get vacation days usage: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+	if usedDays+days > settings.VacationDaysPerYear {
+		reply := b.newReply(msg, fmt.Sprintf("❌ Не хватает дней отпуска на %d год: использовано %d из %d, а запрошено %d дн.",
+			startsAt.Year(), usedDays, settings.VacationDaysPerYear, days))
+		b.post(reply)
+		return
+	}
+
+	vacation := &models.Vacation{
+		UserID:   msg.From.ID,
+		ChatID:   msg.Chat.ID,
+		StartsAt: startsAt,
+		EndsAt:   endsAt,
+	}
+	if err := b.db.CreateVacation(vacation); err != nil {
+		b.logger.Errorf("Failed to create vacation: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при сохранении отпуска")
+		b.post(reply)
+		return
+	}
+
+	b.logger.Infof("User %d planned vacation %d in chat %d: %s - %s", msg.From.ID, vacation.ID, msg.Chat.ID, startsAt, endsAt)
+	reply := b.newReply(msg, fmt.Sprintf("🏖 Отпуск запланирован!\n\n%s\n\n⏸️ На время отпуска таймер остановится сам и продолжится после него с места остановки.\n\n📅 Дней отпуска на %d год осталось: %d из %d",
+		formatVacation(vacation, now), startsAt.Year(), settings.VacationDaysPerYear-usedDays-days, settings.VacationDaysPerYear))
+	b.post(reply)
+	// Отпуск с сегодняшнего дня начинается сразу, не дожидаясь планировщика
+	if !startsAt.After(now) {
+		b.startVacation(vacation)
+	}
+}
+
+// showVacations показывает текущие и будущие отпуска участника
+func (b *Bot) showVacations(msg *tgbotapi.Message) {
+	now := utils.GetMoscowTime()
+	vacations, err := b.db.GetVacationsEndingAfter(msg.From.ID, msg.Chat.ID, now)
+	if err != nil {
+		b.logger.Errorf("Failed to get vacations: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	settings, err := b.db.GetChatSettings(msg.Chat.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to get chat settings for chat %d: %v", msg.Chat.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	yearStart := utils.StartOfMoscowYear(now)
+	usedDays, err := b.db.GetVacationDaysUsed(msg.From.ID, msg.Chat.ID, yearStart, yearStart.AddDate(1, 0, 0))
+	if err != nil {
+		b.logger.Errorf("Failed to get vacation days usage: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+
+	var text strings.Builder
+	if len(vacations) == 0 {
+		text.WriteString("🏖 Запланированных отпусков нет\n")
+	} else {
+		text.WriteString("🏖 Ваши отпуска:\n")
+		for _, vacation := range vacations {
+			text.WriteString(formatVacation(vacation, now) + "\n")
+		}
+	}
+	text.WriteString(fmt.Sprintf("\n📅 Дней отпуска в этом году использовано: %d из %d (не длиннее %d дн. за раз)\n\n%s",
+		usedDays, settings.VacationDaysPerYear, settings.MaxVacationDays, vacationUsage))
+
+	reply := b.newReply(msg, text.String())
+	b.post(reply)
+}
+
+// cancelVacation отменяет ближайший отпуск, а идущий завершает досрочно
+func (b *Bot) cancelVacation(msg *tgbotapi.Message) {
+	now := utils.GetMoscowTime()
+	vacations, err := b.db.GetVacationsEndingAfter(msg.From.ID, msg.Chat.ID, now)
+	if err != nil {
+		b.logger.Errorf("Failed to get vacations: %v", err)
+		reply := b.newReply(msg, "❌ Ошибка при получении данных")
+		b.post(reply)
+		return
+	}
+	if len(vacations) == 0 {
+		reply := b.newReply(msg, "🏖 Запланированных отпусков нет")
+		b.post(reply)
+		return
+	}
+
+	vacation := vacations[0]
+	if vacation.StartsAt.After(now) {
+		if err := b.db.DeleteVacation(vacation.ID); err != nil {
+			b.logger.Errorf("Failed to delete vacation %d: %v", vacation.ID, err)
+			reply := b.newReply(msg, "❌ Ошибка при отмене отпуска")
+			b.post(reply)
+			return
+		}
+		b.logger.Infof("User %d cancelled vacation %d in chat %d", msg.From.ID, vacation.ID, msg.Chat.ID)
+		reply := b.newReply(msg, fmt.Sprintf("✅ Отпуск отменен: %s", formatVacation(vacation, now)))
+		b.post(reply)
+		return
+	}
+
+	// Досрочное возвращение: отпуск заканчивается сейчас, таймер продолжается сразу
+	if err := b.db.SetVacationEnd(vacation.ID, now); err != nil {
+		b.logger.Errorf("Failed to end vacation %d early: %v", vacation.ID, err)
+		reply := b.newReply(msg, "❌ Ошибка при отмене отпуска")
+		b.post(reply)
+		return
+	}
+	vacation.EndsAt = now
+	b.logger.Infof("User %d ended vacation %d in chat %d early", msg.From.ID, vacation.ID, msg.Chat.ID)
+	b.finishVacation(vacation)
+}
+
+// processVacations останавливает таймеры у начавшихся отпусков и возобновляет у закончившихся.
+// Состояние хранится в vacations, поэтому после перезапуска бот продолжает с того же места
+func (b *Bot) processVacations(ctx context.Context, now time.Time) {
+	finished, err := b.db.GetVacationsToFinish(now)
+	if err != nil {
+		b.logger.Errorf("Failed to get vacations to finish: %v", err)
+	} else {
+		for _, vacation := range finished {
+			vacation := vacation
+			b.submitMemberTask(ctx, vacation.ChatID, vacation.UserID, func() { b.finishVacation(vacation) })
+		}
+	}
+
+	started, err := b.db.GetVacationsToStart(now)
+	if err != nil {
+		b.logger.Errorf("Failed to get vacations to start: %v", err)
+		return
+	}
+	for _, vacation := range started {
+		vacation := vacation
+		b.submitMemberTask(ctx, vacation.ChatID, vacation.UserID, func() { b.startVacation(vacation) })
+	}
+}
+
+// startVacation останавливает таймер участника на время отпуска
+func (b *Bot) startVacation(vacation *models.Vacation) {
+	marked, err := b.db.MarkVacationStarted(vacation.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to mark vacation %d started: %v", vacation.ID, err)
+		return
+	}
+	if !marked {
+		return
+	}
+
+	messageLog, err := b.db.GetMessageLog(vacation.UserID, vacation.ChatID)
+	if err != nil {
+		b.logger.Errorf("Failed to get message log for vacation %d: %v", vacation.ID, err)
+		return
+	}
+	// Больничный или исключение из удаления и так держат таймер на паузе
+	if messageLog.State != state.Active {
+		b.logger.Infof("Vacation %d of user %d started while %s, state unchanged", vacation.ID, vacation.UserID, messageLog.State)
+		return
+	}
+	if err := b.setMemberState(vacation.UserID, vacation.ChatID, state.Vacation, state.ReasonVacation); err != nil {
+		return
+	}
+
+	b.cancelTimer(vacation.ChatID, vacation.UserID)
+	b.logger.Infof("Vacation %d of user %d started, timer paused", vacation.ID, vacation.UserID)
+
+	reply := tgbotapi.NewMessage(vacation.ChatID, fmt.Sprintf("🏖 %s, отпуск начался! Хорошего отдыха!\n\n⏸️ Таймер остановлен до %s и продолжится с места остановки.\n\n🦁 Но если потренируешься и в отпуске — #training_done никто не отменял!",
+		messageLog.Username, utils.GetMoscowDateFromTime(vacation.EndsAt.Add(-time.Second))))
+	if _, err := b.api.Send(reply); err != nil {
+		b.logger.Errorf("Failed to send vacation start message: %v", err)
+	}
+}
+
+// finishVacation возобновляет таймер после отпуска с учетом всех пауз
+func (b *Bot) finishVacation(vacation *models.Vacation) {
+	marked, err := b.db.MarkVacationFinished(vacation.ID)
+	if err != nil {
+		b.logger.Errorf("Failed to mark vacation %d finished: %v", vacation.ID, err)
+		return
+	}
+	if !marked {
+		return
+	}
+
+	messageLog, err := b.db.GetMessageLog(vacation.UserID, vacation.ChatID)
+	if err != nil {
+		b.logger.Errorf("Failed to get message log for vacation %d: %v", vacation.ID, err)
+		return
+	}
+	if !messageLog.State.InChat() {
+		return
+	}
+
+	header := fmt.Sprintf("🏖 %s, отпуск закончился! С возвращением!", messageLog.Username)
+
+	switch messageLog.State {
+	case state.Sick:
+		// На больничном таймер продолжит стоять до #healthy
+		reply := tgbotapi.NewMessage(vacation.ChatID, header+"\n\n🏥 Ты на больничном — таймер продолжится после #healthy.")
+		b.post(reply)
+		return
+	case state.Exempt:
+		reply := tgbotapi.NewMessage(vacation.ChatID, header)
+		b.post(reply)
+		return
+	}
+
+	// Следующий отпуск уже начался — таймер остановит он
+	now := utils.GetMoscowTime()
+	if b.isOnVacation(vacation.UserID, vacation.ChatID, now) {
+		return
+	}
+
+	if err := b.setMemberState(vacation.UserID, vacation.ChatID, state.Active, state.ReasonVacationEnd); err != nil {
+		return
+	}
+
+	remainingTime := b.remainingTimeWithPauses(messageLog)
+	b.logger.Infof("Vacation %d of user %d finished, remaining time: %v", vacation.ID, vacation.UserID, remainingTime)
+
+	if remainingTime <= 0 {
+		reply := tgbotapi.NewMessage(vacation.ChatID, header+"\n\n⏰ Но время таймера истекло еще до отпуска! 🚫\n\n🦁 Я питаюсь ленивыми леопардами и становлюсь жирнее!")
+		b.post(reply)
+		b.removeUser(vacation.UserID, vacation.ChatID, messageLog.Username)
+		return
+	}
+
+	// Сохраняем исходный старт таймера, чтобы после перезапуска отпуск тоже не засчитывался
+	if messageLog.TimerStartTime != nil {
+		b.restoreTimerWithDuration(vacation.UserID, vacation.ChatID, messageLog.Username, remainingTime, *messageLog.TimerStartTime)
+	} else {
+		b.startTimerWithDuration(vacation.UserID, vacation.ChatID, messageLog.Username, remainingTime)
+	}
+
+	reply := tgbotapi.NewMessage(vacation.ChatID, fmt.Sprintf("%s\n\n⏰ Таймер возобновлён с места остановки!\n\n⏳ До удаления осталось: %s\n\n🦁 Не дай мне стать жирным леопардом!",
+		header, b.formatDurationToDays(remainingTime)))
+	if _, err := b.api.Send(reply); err != nil {
+		b.logger.Errorf("Failed to send vacation finish message: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"leo-bot/internal/webhook"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// setWebhook регистрирует адрес webhook. Версия библиотеки не знает про secret_token,
+// поэтому запрос отправляется через MakeRequest
+func (a *telegramAPI) setWebhook(link, secret string, allowedUpdates []string) error {
+	params := make(tgbotapi.Params)
+	params.AddNonEmpty("url", link)
+	params.AddNonEmpty("secret_token", secret)
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return err
+	}
+	_, err := a.MakeRequest("setWebhook", params)
+	return err
+}
+
+// deleteWebhook снимает webhook, чтобы снова можно было получать обновления через getUpdates.
+// Накопившиеся обновления не сбрасываются
+func (a *telegramAPI) deleteWebhook() error {
+	_, err := a.MakeRequest("deleteWebhook", nil)
+	return err
+}
+
+// webhookSecret возвращает секрет из конфигурации или генерирует новый: webhook регистрируется
+// заново при каждом запуске, так что хранить его не нужно
+func webhookSecret(configured string) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// webhookUpdates регистрирует webhook и запускает HTTP-сервер, который передает обновления в тот же канал,
+// что и long polling. Сервер останавливается вместе с контекстом
+func (b *Bot) webhookUpdates(ctx context.Context, allowedUpdates []string) (<-chan incomingUpdate, error) {
+	link, err := url.Parse(b.config.WebhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	path := link.Path
+	if path == "" {
+		path = "/"
+	}
+
+	secret, err := webhookSecret(b.config.WebhookSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	// Если webhook не удастся зарегистрировать, сервер останавливается сразу, не дожидаясь ctx
+	ctx, cancel := context.WithCancel(ctx)
+	// Канал без буфера: Telegram получает ответ 200, только когда Start забрал обновление и поставит его
+	// в очередь обработчиков. При остановке обновление не теряется в буфере, а вернется с ошибкой и придет снова
+	ch := make(chan incomingUpdate)
+	handler := webhook.NewHandler(secret, func(data json.RawMessage) error {
+		in, err := parseUpdate(data)
+		if err != nil {
+			// Повтор не поможет: такое обновление не разобрать и в следующий раз
+			b.logger.Errorf("Skipping webhook update: %v", err)
+			return nil
+		}
+		select {
+		case ch <- in:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, b.logger)
+	server := webhook.NewServer(b.config.WebhookListen, path, handler, b.logger)
+
+	go func() {
+		defer cancel()
+		defer close(ch)
+		if err := server.Run(ctx); err != nil {
+			b.logger.Errorf("Webhook server error: %v", err)
+		}
+	}()
+
+	if err := b.api.setWebhook(link.String(), secret, allowedUpdates); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to set webhook: %w", err)
+	}
+	b.logger.Infof("Receiving updates via webhook %s", link.Redacted())
+	return ch, nil
+}
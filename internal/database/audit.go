@@ -0,0 +1,80 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"leo-bot/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// defaultAuditLimit — сколько записей журнала возвращается, если лимит не задан
+const defaultAuditLimit = 20
+
+// AddAuditEntry записывает действие в журнал аудита и заполняет ID и время записи
+func (d *Database) AddAuditEntry(entry *models.AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (chat_id, actor_id, actor_name, action, target_user_id, target_name, arguments, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+
+	return d.db.QueryRow(query, entry.ChatID, entry.ActorID, entry.ActorName, entry.Action,
+		entry.TargetUserID, entry.TargetName, entry.Arguments, entry.Reason).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// GetAuditEntries возвращает записи журнала аудита чата по фильтру, новые первыми
+func (d *Database) GetAuditEntries(filter models.AuditFilter) ([]*models.AuditEntry, error) {
+	conditions := []string{"chat_id = $1"}
+	args := []interface{}{filter.ChatID}
+
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.TargetUserID != 0 {
+		addCondition("target_user_id = $%d", filter.TargetUserID)
+	}
+	if filter.ActorName != "" {
+		addCondition("LOWER(actor_name) = LOWER($%d)", filter.ActorName)
+	}
+	if len(filter.Actions) > 0 {
+		addCondition("action = ANY($%d)", pq.Array(filter.Actions))
+	}
+	if !filter.Since.IsZero() {
+		addCondition("created_at >= $%d", filter.Since)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`
+		SELECT id, chat_id, actor_id, actor_name, action, target_user_id, target_name, arguments, reason, created_at
+		FROM audit_log
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d
+	`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		if err := rows.Scan(&e.ID, &e.ChatID, &e.ActorID, &e.ActorName, &e.Action, &e.TargetUserID,
+			&e.TargetName, &e.Arguments, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,182 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"leo-bot/internal/models"
+)
+
+const challengeColumns = `id, chat_id, title, tag, target, reward_cups, starts_at, ends_at, created_by, is_finished`
+
+// queryChallenges выполняет запрос, возвращающий колонки challengeColumns
+func (d *Database) queryChallenges(query string, args ...interface{}) ([]*models.Challenge, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var challenges []*models.Challenge
+	for rows.Next() {
+		var c models.Challenge
+		if err := rows.Scan(&c.ID, &c.ChatID, &c.Title, &c.Tag, &c.Target, &c.RewardCups,
+			&c.StartsAt, &c.EndsAt, &c.CreatedBy, &c.IsFinished); err != nil {
+			return nil, err
+		}
+		challenges = append(challenges, &c)
+	}
+
+	return challenges, rows.Err()
+}
+
+// CreateChallenge создает челлендж и заполняет его ID
+func (d *Database) CreateChallenge(c *models.Challenge) error {
+	query := `
+		INSERT INTO challenges (chat_id, title, tag, target, reward_cups, starts_at, ends_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+
+	return d.db.QueryRow(query, c.ChatID, c.Title, c.Tag, c.Target, c.RewardCups, c.StartsAt, c.EndsAt, c.CreatedBy).Scan(&c.ID)
+}
+
+// GetChallenge получает челлендж чата по ID. Если его нет, возвращает sql.ErrNoRows
+func (d *Database) GetChallenge(chatID, challengeID int64) (*models.Challenge, error) {
+	query := `SELECT ` + challengeColumns + ` FROM challenges WHERE chat_id = $1 AND id = $2`
+
+	var c models.Challenge
+	err := d.db.QueryRow(query, chatID, challengeID).Scan(&c.ID, &c.ChatID, &c.Title, &c.Tag, &c.Target, &c.RewardCups,
+		&c.StartsAt, &c.EndsAt, &c.CreatedBy, &c.IsFinished)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// GetActiveChallenges получает идущие челленджи чата
+func (d *Database) GetActiveChallenges(chatID int64, now time.Time) ([]*models.Challenge, error) {
+	query := `
+		SELECT ` + challengeColumns + `
+		FROM challenges
+		WHERE chat_id = $1 AND is_finished = FALSE AND starts_at <= $2 AND ends_at > $2
+		ORDER BY ends_at ASC, id ASC
+	`
+
+	return d.queryChallenges(query, chatID, now)
+}
+
+// GetUserPendingChallenges получает идущие челленджи, в которых участник еще не выполнил цель
+func (d *Database) GetUserPendingChallenges(chatID, userID int64, now time.Time) ([]*models.Challenge, error) {
+	query := `
+		SELECT c.id, c.chat_id, c.title, c.tag, c.target, c.reward_cups, c.starts_at, c.ends_at, c.created_by, c.is_finished
+		FROM challenges c
+		JOIN challenge_participants p ON p.challenge_id = c.id
+		WHERE c.chat_id = $1 AND p.user_id = $2 AND p.completed_at IS NULL
+			AND c.is_finished = FALSE AND c.starts_at <= $3 AND c.ends_at > $3
+		ORDER BY c.id ASC
+	`
+
+	return d.queryChallenges(query, chatID, userID, now)
+}
+
+// GetChallengesToFinish получает челленджи, срок которых истек, но итоги еще не подведены
+func (d *Database) GetChallengesToFinish(now time.Time) ([]*models.Challenge, error) {
+	query := `
+		SELECT ` + challengeColumns + `
+		FROM challenges
+		WHERE is_finished = FALSE AND ends_at <= $1
+		ORDER BY ends_at ASC, id ASC
+	`
+
+	return d.queryChallenges(query, now)
+}
+
+// JoinChallenge записывает участника в челлендж. Возвращает false, если он уже участвует
+func (d *Database) JoinChallenge(challengeID, userID int64, joinedAt time.Time) (bool, error) {
+	query := `
+		INSERT INTO challenge_participants (challenge_id, user_id, joined_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (challenge_id, user_id) DO NOTHING
+	`
+
+	result, err := d.db.Exec(query, challengeID, userID, joinedAt)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// GetChallengeProgress считает прогресс участников по дням с отчетами за срок челленджа.
+// День засчитывается, если последний отчет за него отправлен после старта: утренний отчет
+// и вечерний после создания челленджа хранятся одной строкой. Если у челленджа задан тег,
+// засчитываются только дни, в отчетах которых он был
+func (d *Database) GetChallengeProgress(c *models.Challenge) ([]*models.ChallengeProgress, error) {
+	query := `
+		SELECT p.user_id, m.username, COUNT(r.id) AS progress, p.completed_at
+		FROM challenge_participants p
+		JOIN message_log m ON m.user_id = p.user_id AND m.chat_id = $2
+		LEFT JOIN training_reports r ON r.chat_id = $2 AND r.user_id = p.user_id
+			AND r.last_reported_at >= $3 AND r.created_at < $4
+			AND ($5::text = '' OR $5::text = ANY(r.tags))
+		WHERE p.challenge_id = $1
+		GROUP BY p.user_id, m.username, p.completed_at
+		ORDER BY progress DESC, p.completed_at ASC NULLS LAST, p.user_id ASC
+	`
+
+	rows, err := d.db.Query(query, c.ID, c.ChatID, c.StartsAt, c.EndsAt, c.Tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var progress []*models.ChallengeProgress
+	for rows.Next() {
+		var entry models.ChallengeProgress
+		if err := rows.Scan(&entry.UserID, &entry.Username, &entry.Progress, &entry.CompletedAt); err != nil {
+			return nil, err
+		}
+		progress = append(progress, &entry)
+	}
+
+	return progress, rows.Err()
+}
+
+// CompleteChallenge отмечает выполнение цели и начисляет награду одной транзакцией.
+// Возвращает false, если участник уже получил награду за этот челлендж
+func (d *Database) CompleteChallenge(c *models.Challenge, userID int64, completedAt time.Time) (bool, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE challenge_participants SET completed_at = $3
+		WHERE challenge_id = $1 AND user_id = $2 AND completed_at IS NULL
+	`, c.ID, userID, completedAt)
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return false, nil
+	}
+
+	if err := applyBalanceChangeTx(tx, addCupsQuery, userID, c.ChatID, models.CurrencyCups, c.RewardCups, models.LedgerReasonChallenge); err != nil {
+		return false, fmt.Errorf("failed to grant challenge reward: %w", err)
+	}
+
+	return true, tx.Commit()
+}
+
+// FinishChallenge помечает челлендж завершенным. Возвращает false, если его уже завершили
+func (d *Database) FinishChallenge(challengeID int64) (bool, error) {
+	result, err := d.db.Exec(`UPDATE challenges SET is_finished = TRUE WHERE id = $1 AND is_finished = FALSE`, challengeID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
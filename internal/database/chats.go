@@ -0,0 +1,189 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"leo-bot/internal/models"
+)
+
+// SaveChat сохраняет чат и текущие права бота в нем. added_by обновляется, только если передан
+func (d *Database) SaveChat(chat *models.Chat) error {
+	query := `
+		INSERT INTO chats (chat_id, title, bot_status, can_ban, added_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (chat_id) DO UPDATE SET
+			title = EXCLUDED.title,
+			bot_status = EXCLUDED.bot_status,
+			can_ban = EXCLUDED.can_ban,
+			added_by = CASE WHEN EXCLUDED.added_by <> 0 THEN EXCLUDED.added_by ELSE chats.added_by END,
+			updated_at = NOW() AT TIME ZONE 'Europe/Moscow'
+		RETURNING added_by, added_at, updated_at
+	`
+
+	return d.db.QueryRow(query, chat.ChatID, chat.Title, chat.BotStatus, chat.CanBan, chat.AddedBy).
+		Scan(&chat.AddedBy, &chat.AddedAt, &chat.UpdatedAt)
+}
+
+// GetChat получает чат. Возвращает sql.ErrNoRows, если бот о чате еще не знает
+func (d *Database) GetChat(chatID int64) (*models.Chat, error) {
+	query := `
+		SELECT chat_id, title, bot_status, can_ban, added_by, added_at, updated_at
+		FROM chats
+		WHERE chat_id = $1
+	`
+
+	var chat models.Chat
+	err := d.db.QueryRow(query, chatID).Scan(&chat.ChatID, &chat.Title, &chat.BotStatus, &chat.CanBan,
+		&chat.AddedBy, &chat.AddedAt, &chat.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chat, nil
+}
+
+// PauseChat открывает паузу таймеров чата. Возвращает false, если чат уже на паузе
+func (d *Database) PauseChat(chatID int64, startedAt time.Time, reason string) (bool, error) {
+	query := `
+		INSERT INTO chat_pauses (chat_id, started_at, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (chat_id) WHERE ended_at IS NULL DO NOTHING
+	`
+
+	result, err := d.db.Exec(query, chatID, startedAt, reason)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// ResumeChat закрывает паузу таймеров чата. Возвращает false, если чат не был на паузе
+func (d *Database) ResumeChat(chatID int64, endedAt time.Time) (bool, error) {
+	query := `
+		UPDATE chat_pauses
+		SET ended_at = $2
+		WHERE chat_id = $1 AND ended_at IS NULL
+	`
+
+	result, err := d.db.Exec(query, chatID, endedAt)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// IsChatPaused проверяет, стоят ли сейчас таймеры чата
+func (d *Database) IsChatPaused(chatID int64) (bool, error) {
+	query := `SELECT 1 FROM chat_pauses WHERE chat_id = $1 AND ended_at IS NULL`
+
+	var exists int
+	err := d.db.QueryRow(query, chatID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetChatPausesEndingAfter получает паузы таймеров чата, которые закончились после since или еще идут
+func (d *Database) GetChatPausesEndingAfter(chatID int64, since time.Time) ([]*models.ChatPause, error) {
+	query := `
+		SELECT id, chat_id, started_at, ended_at, reason
+		FROM chat_pauses
+		WHERE chat_id = $1 AND (ended_at IS NULL OR ended_at > $2)
+		ORDER BY started_at
+	`
+
+	rows, err := d.db.Query(query, chatID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pauses []*models.ChatPause
+	for rows.Next() {
+		var p models.ChatPause
+		if err := rows.Scan(&p.ID, &p.ChatID, &p.StartedAt, &p.EndedAt, &p.Reason); err != nil {
+			return nil, err
+		}
+		pauses = append(pauses, &p)
+	}
+
+	return pauses, rows.Err()
+}
+
+// chatTables — таблицы, в которых хранятся данные чата. При миграции группы в супергруппу
+// все их строки переезжают на новый ID
+var chatTables = []string{
+	"message_log", "training_reports", "balance_ledger", "seasons", "hall_of_fame",
+	"teams", "team_members", "team_weekly_results", "challenges", "kudos",
+	"sick_leaves", "chat_settings", "vacations", "member_state_history",
+	"audit_log", "member_events", "chats", "chat_pauses", "hashtag_aliases",
+}
+
+// chatMigrationConflicts удаляет строки, которые бот успел создать под новым ID до сообщения о миграции
+// и которые иначе нарушили бы уникальные ключи. Данные старого чата при этом главнее: $1 — старый ID, $2 — новый
+var chatMigrationConflicts = []string{
+	`DELETE FROM message_log n WHERE n.chat_id = $2
+		AND EXISTS (SELECT 1 FROM message_log o WHERE o.chat_id = $1 AND o.user_id = n.user_id)`,
+	`DELETE FROM training_reports n WHERE n.chat_id = $2
+		AND EXISTS (SELECT 1 FROM training_reports o WHERE o.chat_id = $1 AND o.user_id = n.user_id AND o.report_date = n.report_date)`,
+	`DELETE FROM team_members n WHERE n.chat_id = $2
+		AND EXISTS (SELECT 1 FROM team_members o WHERE o.chat_id = $1 AND o.user_id = n.user_id)`,
+	`DELETE FROM teams n WHERE n.chat_id = $2
+		AND EXISTS (SELECT 1 FROM teams o WHERE o.chat_id = $1 AND LOWER(o.name) = LOWER(n.name))`,
+	`DELETE FROM team_weekly_results n WHERE n.chat_id = $2
+		AND EXISTS (SELECT 1 FROM team_weekly_results o WHERE o.chat_id = $1 AND o.week_start = n.week_start)`,
+	`DELETE FROM kudos n WHERE n.chat_id = $2
+		AND EXISTS (SELECT 1 FROM kudos o WHERE o.chat_id = $1 AND o.giver_id = n.giver_id AND o.report_message_id = n.report_message_id)`,
+	`DELETE FROM sick_leaves n WHERE n.chat_id = $2 AND n.ended_at IS NULL
+		AND EXISTS (SELECT 1 FROM sick_leaves o WHERE o.chat_id = $1 AND o.user_id = n.user_id AND o.ended_at IS NULL)`,
+	// Планировщик мог открыть в новом чате свой сезон — остается сезон старого чата
+	`DELETE FROM seasons n WHERE n.chat_id = $2 AND n.is_closed = FALSE
+		AND EXISTS (SELECT 1 FROM seasons o WHERE o.chat_id = $1 AND o.is_closed = FALSE)`,
+	`DELETE FROM chat_settings WHERE chat_id = $2 AND EXISTS (SELECT 1 FROM chat_settings WHERE chat_id = $1)`,
+	`DELETE FROM chats WHERE chat_id = $2 AND EXISTS (SELECT 1 FROM chats WHERE chat_id = $1)`,
+	`DELETE FROM chat_pauses n WHERE n.chat_id = $2 AND n.ended_at IS NULL
+		AND EXISTS (SELECT 1 FROM chat_pauses o WHERE o.chat_id = $1 AND o.ended_at IS NULL)`,
+	`DELETE FROM hashtag_aliases n WHERE n.chat_id = $2
+		AND EXISTS (SELECT 1 FROM hashtag_aliases o WHERE o.chat_id = $1 AND o.alias = n.alias)`,
+}
+
+// MigrateChat переносит все данные чата на новый ID одной транзакцией: Telegram меняет ID группы,
+// когда она становится супергруппой. Возвращает число перенесенных участников; 0 — переносить было нечего
+func (d *Database) MigrateChat(oldChatID, newChatID int64) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range chatMigrationConflicts {
+		if _, err := tx.Exec(query, oldChatID, newChatID); err != nil {
+			return 0, fmt.Errorf("failed to resolve migration conflicts: %w", err)
+		}
+	}
+
+	var members int64
+	for _, table := range chatTables {
+		result, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET chat_id = $2 WHERE chat_id = $1`, table), oldChatID, newChatID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to migrate %s: %w", table, err)
+		}
+		if table == "message_log" {
+			if members, err = result.RowsAffected(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return members, tx.Commit()
+}
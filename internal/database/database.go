@@ -2,12 +2,14 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"leo-bot/internal/logger"
 	"leo-bot/internal/models"
+	"leo-bot/internal/state"
 	"leo-bot/internal/utils"
 
 	_ "github.com/lib/pq"
@@ -91,92 +93,89 @@ func (d *Database) CreateTables() error {
 	return nil
 }
 
-// SaveMessageLog сохраняет информацию о сообщении
+// SaveMessageLog сохраняет информацию о сообщении. Калории, кубки и серии записываются только при создании
+// записи: дальше их меняют точечные запросы с записью в журнал, и сохранение прочитанной раньше копии их не затирает
 func (d *Database) SaveMessageLog(msg *models.MessageLog) error {
 	query := `
-		INSERT INTO message_log (user_id, username, chat_id, calories, streak_days, calorie_streak_days, cups_earned, last_training_date, last_message, has_training_done, has_sick_leave, has_healthy, is_deleted, is_exempt_from_deletion, timer_start_time, sick_leave_start_time, sick_leave_end_time, sick_time, rest_time_till_del, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+		INSERT INTO message_log (user_id, username, chat_id, calories, streak_days, calorie_streak_days, cups_earned, last_training_date, last_message, state, timer_start_time, sick_leave_start_time, sick_leave_end_time, sick_time, rest_time_till_del, last_spoke_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 		ON CONFLICT (user_id, chat_id) 
 		DO UPDATE SET 
 			username = EXCLUDED.username,
-			calories = EXCLUDED.calories,
-			streak_days = EXCLUDED.streak_days,
-			calorie_streak_days = EXCLUDED.calorie_streak_days,
-			cups_earned = EXCLUDED.cups_earned,
-			last_training_date = EXCLUDED.last_training_date,
 			last_message = EXCLUDED.last_message,
-			has_training_done = EXCLUDED.has_training_done,
-			has_sick_leave = EXCLUDED.has_sick_leave,
-			has_healthy = EXCLUDED.has_healthy,
-			is_deleted = EXCLUDED.is_deleted,
-			is_exempt_from_deletion = EXCLUDED.is_exempt_from_deletion,
 			timer_start_time = EXCLUDED.timer_start_time,
 			sick_leave_start_time = EXCLUDED.sick_leave_start_time,
 			sick_leave_end_time = EXCLUDED.sick_leave_end_time,
 			sick_time = EXCLUDED.sick_time,
 			rest_time_till_del = EXCLUDED.rest_time_till_del,
-			updated_at = $20
+			last_spoke_at = EXCLUDED.last_spoke_at,
+			updated_at = $17
 	`
 
+	// Состояние задается только при создании записи, дальше оно меняется через ChangeMemberState
+	memberState := msg.State
+	if memberState == "" {
+		memberState = state.Active
+	}
+
 	// Используем московское время
 	moscowTime := utils.FormatMoscowTime(utils.GetMoscowTime())
 
-	// Временное логирование для отладки
-	fmt.Printf("DEBUG: Saving to DB - UserID: %d, TimerStartTime: %v, SickLeaveStartTime: %v, RestTimeTillDel: %v\n",
-		msg.UserID, msg.TimerStartTime, msg.SickLeaveStartTime, msg.RestTimeTillDel)
-
-	result, err := d.db.Exec(query,
-		msg.UserID, msg.Username, msg.ChatID, msg.Calories, msg.StreakDays, msg.CalorieStreakDays, msg.CupsEarned, msg.LastTrainingDate, msg.LastMessage, msg.HasTrainingDone,
-		msg.HasSickLeave, msg.HasHealthy, msg.IsDeleted, msg.IsExemptFromDeletion, msg.TimerStartTime, msg.SickLeaveStartTime, msg.SickLeaveEndTime, msg.SickTime, msg.RestTimeTillDel, moscowTime)
-
-	if err != nil {
-		fmt.Printf("DEBUG: Save error: %v\n", err)
-		return err
-	}
+	_, err := d.db.Exec(query,
+		msg.UserID, msg.Username, msg.ChatID, msg.Calories, msg.StreakDays, msg.CalorieStreakDays, msg.CupsEarned, msg.LastTrainingDate, msg.LastMessage,
+		memberState, msg.TimerStartTime, msg.SickLeaveStartTime, msg.SickLeaveEndTime, msg.SickTime, msg.RestTimeTillDel, msg.LastSpokeAt, moscowTime)
+	return err
+}
 
-	// Проверяем, что именно произошло (INSERT или UPDATE)
-	rowsAffected, _ := result.RowsAffected()
-	fmt.Printf("DEBUG: Rows affected: %d\n", rowsAffected)
+// SetTimerStartTime записывает начало нового отсчета таймера участника
+func (d *Database) SetTimerStartTime(userID, chatID int64, timerStartTime string) error {
+	query := `
+		UPDATE message_log
+		SET timer_start_time = $3, updated_at = $4
+		WHERE user_id = $1 AND chat_id = $2
+	`
 
+	_, err := d.db.Exec(query, userID, chatID, timerStartTime, utils.FormatMoscowTime(utils.GetMoscowTime()))
 	return err
 }
 
 // GetMessageLog получает информацию о сообщении пользователя
 func (d *Database) GetMessageLog(userID, chatID int64) (*models.MessageLog, error) {
 	query := `
-		SELECT user_id, username, chat_id, calories, streak_days, calorie_streak_days, cups_earned, last_training_date, last_message, has_training_done, has_sick_leave, has_healthy, is_deleted, is_exempt_from_deletion,
-		       timer_start_time, sick_leave_start_time, sick_leave_end_time, sick_time, rest_time_till_del, created_at, updated_at
-		FROM message_log 
+		SELECT ` + messageLogColumns + `
+		FROM message_log
 		WHERE user_id = $1 AND chat_id = $2
 	`
 
+	return scanMessageLog(d.db.QueryRow(query, userID, chatID))
+}
+
+// messageLogColumns — колонки message_log в том порядке, в котором их читает scanMessageLog
+const messageLogColumns = `user_id, username, chat_id, calories, streak_days, calorie_streak_days, cups_earned, last_training_date, last_message,
+		state, timer_start_time, sick_leave_start_time, sick_leave_end_time, sick_time,
+		rest_time_till_del, last_spoke_at, created_at, updated_at`
+
+// rowScanner — общее у *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessageLog читает запись участника, выбранную колонками messageLogColumns
+func scanMessageLog(row rowScanner) (*models.MessageLog, error) {
 	var msg models.MessageLog
-	err := d.db.QueryRow(query, userID, chatID).Scan(
-		&msg.UserID, &msg.Username, &msg.ChatID, &msg.Calories, &msg.StreakDays, &msg.CalorieStreakDays, &msg.CupsEarned, &msg.LastTrainingDate, &msg.LastMessage, &msg.HasTrainingDone,
-		&msg.HasSickLeave, &msg.HasHealthy, &msg.IsDeleted, &msg.IsExemptFromDeletion, &msg.TimerStartTime, &msg.SickLeaveStartTime, &msg.SickLeaveEndTime, &msg.SickTime, &msg.RestTimeTillDel,
-		&msg.CreatedAt, &msg.UpdatedAt)
+	err := row.Scan(
+		&msg.UserID, &msg.Username, &msg.ChatID, &msg.Calories, &msg.StreakDays, &msg.CalorieStreakDays, &msg.CupsEarned, &msg.LastTrainingDate, &msg.LastMessage,
+		&msg.State, &msg.TimerStartTime, &msg.SickLeaveStartTime, &msg.SickLeaveEndTime, &msg.SickTime,
+		&msg.RestTimeTillDel, &msg.LastSpokeAt, &msg.CreatedAt, &msg.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
-
-	// Временное логирование для отладки
-	fmt.Printf("DEBUG: Retrieved from DB - UserID: %d, HasSickLeave: %t, TimerStartTime: %v, SickLeaveStartTime: %v, RestTimeTillDel: %v\n",
-		msg.UserID, msg.HasSickLeave, msg.TimerStartTime, msg.SickLeaveStartTime, msg.RestTimeTillDel)
-
 	return &msg, nil
 }
 
-// GetUsersByChatID получает всех пользователей в чате
-func (d *Database) GetUsersByChatID(chatID int64) ([]*models.MessageLog, error) {
-	query := `
-		SELECT user_id, username, chat_id, calories, streak_days, calorie_streak_days, cups_earned, last_training_date, last_message, has_training_done, has_sick_leave, has_healthy, is_deleted, is_exempt_from_deletion,
-		       timer_start_time, sick_leave_start_time, sick_leave_end_time, sick_time, rest_time_till_del, created_at, updated_at
-		FROM message_log 
-		WHERE chat_id = $1 AND is_deleted = FALSE
-		ORDER BY calories DESC, last_message DESC
-	`
-
-	rows, err := d.db.Query(query, chatID)
+// queryMessageLogs выполняет запрос по message_log, выбирающий колонки messageLogColumns
+func (d *Database) queryMessageLogs(query string, args ...interface{}) ([]*models.MessageLog, error) {
+	rows, err := d.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -184,69 +183,80 @@ func (d *Database) GetUsersByChatID(chatID int64) ([]*models.MessageLog, error)
 
 	var users []*models.MessageLog
 	for rows.Next() {
-		var msg models.MessageLog
-		err := rows.Scan(
-			&msg.UserID, &msg.Username, &msg.ChatID, &msg.Calories, &msg.StreakDays, &msg.CalorieStreakDays, &msg.CupsEarned, &msg.LastTrainingDate, &msg.LastMessage, &msg.HasTrainingDone,
-			&msg.HasSickLeave, &msg.HasHealthy, &msg.IsDeleted, &msg.IsExemptFromDeletion, &msg.TimerStartTime, &msg.SickLeaveStartTime, &msg.SickLeaveEndTime, &msg.SickTime, &msg.RestTimeTillDel,
-			&msg.CreatedAt, &msg.UpdatedAt)
+		msg, err := scanMessageLog(rows)
 		if err != nil {
 			return nil, err
 		}
-		users = append(users, &msg)
+		users = append(users, msg)
 	}
 
-	return users, nil
+	return users, rows.Err()
 }
 
-// GetUserIDByUsername получает user_id по username в конкретном чате
-// Поддерживает поиск по разным форматам: @username, username, "Имя Фамилия"
-func (d *Database) GetUserIDByUsername(username string, chatID int64) (int64, error) {
-	// Сначала пробуем точное совпадение
+// GetUsersByChatID получает всех пользователей в чате
+func (d *Database) GetUsersByChatID(chatID int64) ([]*models.MessageLog, error) {
 	query := `
-		SELECT user_id FROM message_log 
-		WHERE username = $1 AND chat_id = $2
+		SELECT ` + messageLogColumns + `
+		FROM message_log
+		WHERE chat_id = $1 AND state NOT IN ('removed', 'left')
+		ORDER BY calories DESC, last_message DESC
 	`
-	var userID int64
-	err := d.db.QueryRow(query, username, chatID).Scan(&userID)
-	if err == nil {
-		return userID, nil
-	}
 
-	// Если не найдено, пробуем поиск с @
-	if !strings.HasPrefix(username, "@") {
-		query = `
-			SELECT user_id FROM message_log 
-			WHERE username = $1 AND chat_id = $2
-		`
-		err = d.db.QueryRow(query, "@"+username, chatID).Scan(&userID)
-		if err == nil {
-			return userID, nil
-		}
+	return d.queryMessageLogs(query, chatID)
+}
+
+// FindUsersByName ищет участников чата по имени. Поддерживает разные форматы: @username, username, "Имя Фамилия".
+// Сначала ищется точное совпадение без учета регистра и @; если его нет, возвращаются частичные совпадения
+// и exact = false — такие кандидаты нужно показать администратору, а не выбирать за него
+func (d *Database) FindUsersByName(username string, chatID int64) (users []*models.ChatMember, exact bool, err error) {
+	name := strings.TrimPrefix(strings.TrimSpace(username), "@")
+	if name == "" {
+		return nil, false, nil
 	}
 
-	// Если не найдено, пробуем поиск без @
-	if strings.HasPrefix(username, "@") {
-		query = `
-			SELECT user_id FROM message_log 
-			WHERE username = $1 AND chat_id = $2
-		`
-		err = d.db.QueryRow(query, username[1:], chatID).Scan(&userID)
-		if err == nil {
-			return userID, nil
-		}
+	exactQuery := `
+		SELECT user_id, username, state FROM message_log
+		WHERE chat_id = $1 AND LOWER(LTRIM(username, '@')) = LOWER($2)
+		ORDER BY username, user_id
+	`
+	users, err = d.queryChatMembers(exactQuery, chatID, name)
+	if err != nil || len(users) > 0 {
+		return users, true, err
 	}
 
-	// Если все еще не найдено, пробуем поиск по частичному совпадению (для случаев типа "OggO Logos")
-	query = `
-		SELECT user_id FROM message_log 
-		WHERE username ILIKE $1 AND chat_id = $2
+	partialQuery := `
+		SELECT user_id, username, state FROM message_log
+		WHERE chat_id = $1 AND username ILIKE $2 ESCAPE '\'
+		ORDER BY username, user_id
+		LIMIT 10
 	`
-	err = d.db.QueryRow(query, "%"+username+"%", chatID).Scan(&userID)
-	if err == nil {
-		return userID, nil
+	users, err = d.queryChatMembers(partialQuery, chatID, "%"+escapeLikePattern(name)+"%")
+	return users, false, err
+}
+
+// queryChatMembers выполняет запрос, возвращающий колонки user_id, username и state
+func (d *Database) queryChatMembers(query string, args ...interface{}) ([]*models.ChatMember, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*models.ChatMember
+	for rows.Next() {
+		var m models.ChatMember
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Status); err != nil {
+			return nil, err
+		}
+		members = append(members, &m)
 	}
 
-	return 0, fmt.Errorf("user not found")
+	return members, rows.Err()
+}
+
+// escapeLikePattern экранирует спецсимволы LIKE, чтобы "_" и "%" в имени искались буквально
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
 }
 
 // SaveTrainingLog сохраняет отчет о тренировке
@@ -272,9 +282,9 @@ func (d *Database) GetDatabaseStats() (map[string]interface{}, error) {
 	query := `
 		SELECT 
 			COUNT(*) as total_users,
-			COUNT(CASE WHEN has_training_done = true THEN 1 END) as training_done,
-			COUNT(CASE WHEN has_sick_leave = true THEN 1 END) as sick_leave,
-			COUNT(CASE WHEN has_healthy = true THEN 1 END) as healthy
+			COUNT(CASE WHEN last_training_date = $1 THEN 1 END) as training_done,
+			COUNT(CASE WHEN state = 'sick' THEN 1 END) as sick_leave,
+			COUNT(CASE WHEN state <> 'sick' AND sick_leave_end_time IS NOT NULL THEN 1 END) as healthy
 		FROM message_log
 	`
 
@@ -285,7 +295,7 @@ func (d *Database) GetDatabaseStats() (map[string]interface{}, error) {
 		Healthy      int `db:"healthy"`
 	}
 
-	err := d.db.QueryRow(query).Scan(&stats.TotalUsers, &stats.TrainingDone, &stats.SickLeave, &stats.Healthy)
+	err := d.db.QueryRow(query, utils.GetMoscowDate()).Scan(&stats.TotalUsers, &stats.TrainingDone, &stats.SickLeave, &stats.Healthy)
 	if err != nil {
 		return nil, err
 	}
@@ -298,23 +308,15 @@ func (d *Database) GetDatabaseStats() (map[string]interface{}, error) {
 	}, nil
 }
 
-// AddCalories добавляет калории пользователю
-func (d *Database) AddCalories(userID, chatID int64, calories int) error {
-	query := `
-		UPDATE message_log 
-		SET calories = calories + $3, updated_at = $4
-		WHERE user_id = $1 AND chat_id = $2
-	`
-	// Используем московское время
-	moscowTime := utils.FormatMoscowTime(utils.GetMoscowTime())
-	_, err := d.db.Exec(query, userID, chatID, calories, moscowTime)
-	return err
+// AddCalories добавляет калории пользователю и записывает операцию в журнал
+func (d *Database) AddCalories(userID, chatID int64, calories int, reason string) error {
+	return d.applyBalanceChange(addCaloriesQuery, userID, chatID, models.CurrencyCalories, calories, reason)
 }
 
 // GetUserCalories получает калории пользователя
 func (d *Database) GetUserCalories(userID, chatID int64) (int, error) {
 	query := `
-		SELECT calories FROM message_log 
+		SELECT calories FROM message_log
 		WHERE user_id = $1 AND chat_id = $2
 	`
 	var calories int
@@ -390,110 +392,199 @@ func (d *Database) ResetCalorieStreak(userID, chatID int64) error {
 	return err
 }
 
-// AddCups добавляет кубки пользователю
-func (d *Database) AddCups(userID, chatID int64, cups int) error {
-	query := `
-		UPDATE message_log 
-		SET cups_earned = cups_earned + $3, updated_at = $4
-		WHERE user_id = $1 AND chat_id = $2
-	`
-	// Используем московское время
-	moscowTime := utils.FormatMoscowTime(utils.GetMoscowTime())
-	_, err := d.db.Exec(query, userID, chatID, cups, moscowTime)
-	return err
+// addCaloriesQuery начисляет калории: $3 — количество, $4 — время изменения
+const addCaloriesQuery = `
+	UPDATE message_log 
+	SET calories = calories + $3, updated_at = $4
+	WHERE user_id = $1 AND chat_id = $2
+`
+
+// addCupsQuery начисляет кубки: $3 — количество, $4 — время изменения
+const addCupsQuery = `
+	UPDATE message_log 
+	SET cups_earned = cups_earned + $3, updated_at = $4
+	WHERE user_id = $1 AND chat_id = $2
+`
+
+// AddCups добавляет кубки пользователю и записывает операцию в журнал
+func (d *Database) AddCups(userID, chatID int64, cups int, reason string) error {
+	return d.applyBalanceChange(addCupsQuery, userID, chatID, models.CurrencyCups, cups, reason)
 }
 
-// GetUserCups получает количество заработанных кубков пользователя
-func (d *Database) GetUserCups(userID, chatID int64) (int, error) {
-	query := `
-		SELECT COALESCE(cups_earned, 0) 
-		FROM message_log 
+// ResetBalances обнуляет калории и кубки участника, записывая списания в balance_ledger
+func (d *Database) ResetBalances(userID, chatID int64, reason string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var calories, cups int
+	err = tx.QueryRow(`
+		SELECT COALESCE(calories, 0), COALESCE(cups_earned, 0)
+		FROM message_log
 		WHERE user_id = $1 AND chat_id = $2
-	`
+		FOR UPDATE
+	`, userID, chatID).Scan(&calories, &cups)
+	if err != nil {
+		return err
+	}
 
-	var cups int
-	err := d.db.QueryRow(query, userID, chatID).Scan(&cups)
+	if calories != 0 {
+		if err := applyBalanceChangeTx(tx, addCaloriesQuery, userID, chatID, models.CurrencyCalories, -calories, reason); err != nil {
+			return err
+		}
+	}
+	if cups != 0 {
+		if err := applyBalanceChangeTx(tx, addCupsQuery, userID, chatID, models.CurrencyCups, -cups, reason); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// addStreakQuery меняет серию тренировок: $3 — изменение, $4 — время изменения.
+// Серия для калорий сдвигается на столько же, чтобы восстановленный день засчитывался и в ней
+const addStreakQuery = `
+	UPDATE message_log 
+	SET streak_days = streak_days + $3, calorie_streak_days = GREATEST(calorie_streak_days + $3, 0), updated_at = $4
+	WHERE user_id = $1 AND chat_id = $2
+`
+
+// ErrNegativeBalance — после изменения калории, кубки или серия стали бы отрицательными
+var ErrNegativeBalance = errors.New("balance would become negative")
+
+// balanceColumns — колонки message_log и запросы изменения для каждой валюты журнала
+var balanceColumns = map[string]struct {
+	column      string
+	updateQuery string
+}{
+	models.CurrencyCalories: {"calories", addCaloriesQuery},
+	models.CurrencyCups:     {"cups_earned", addCupsQuery},
+	models.CurrencyStreak:   {"streak_days", addStreakQuery},
+}
+
+// AdjustBalance вручную меняет калории, кубки или серию участника на delta и записывает операцию в журнал.
+// Возвращает новое значение. Если значение стало бы отрицательным, возвращает ErrNegativeBalance
+func (d *Database) AdjustBalance(userID, chatID int64, currency string, delta int, reason string) (int, error) {
+	balance, ok := balanceColumns[currency]
+	if !ok {
+		return 0, fmt.Errorf("unknown currency: %s", currency)
+	}
+
+	tx, err := d.db.Begin()
 	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current int
+	query := fmt.Sprintf(`SELECT COALESCE(%s, 0) FROM message_log WHERE user_id = $1 AND chat_id = $2 FOR UPDATE`, balance.column)
+	if err := tx.QueryRow(query, userID, chatID).Scan(&current); err != nil {
 		return 0, err
 	}
+	if current+delta < 0 {
+		return current, fmt.Errorf("%w: %d %+d", ErrNegativeBalance, current, delta)
+	}
 
-	return cups, nil
+	if err := applyBalanceChangeTx(tx, balance.updateQuery, userID, chatID, currency, delta, reason); err != nil {
+		return current, err
+	}
+
+	return current + delta, tx.Commit()
 }
 
-// MarkUserAsDeleted помечает пользователя как удаленного
-func (d *Database) MarkUserAsDeleted(userID, chatID int64) error {
-	query := `
-		UPDATE message_log 
-		SET is_deleted = TRUE, updated_at = $3
-		WHERE user_id = $1 AND chat_id = $2
-	`
+// SetStreak устанавливает серию тренировок и дату последней тренировки. Разница с прежней серией
+// записывается в журнал. Возвращает прежнюю серию
+func (d *Database) SetStreak(userID, chatID int64, streakDays int, lastTrainingDate string, reason string) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var previous int
+	err = tx.QueryRow(`SELECT COALESCE(streak_days, 0) FROM message_log WHERE user_id = $1 AND chat_id = $2 FOR UPDATE`,
+		userID, chatID).Scan(&previous)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := applyBalanceChangeTx(tx, addStreakQuery, userID, chatID, models.CurrencyStreak, streakDays-previous, reason); err != nil {
+		return previous, err
+	}
+
+	if _, err := tx.Exec(`UPDATE message_log SET last_training_date = $3 WHERE user_id = $1 AND chat_id = $2`,
+		userID, chatID, lastTrainingDate); err != nil {
+		return previous, err
+	}
+
+	return previous, tx.Commit()
+}
+
+// applyBalanceChange меняет баланс в message_log и пишет запись в balance_ledger одной транзакцией
+func (d *Database) applyBalanceChange(updateQuery string, userID, chatID int64, currency string, delta int, reason string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := applyBalanceChangeTx(tx, updateQuery, userID, chatID, currency, delta, reason); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// applyBalanceChangeTx меняет баланс и пишет журнал внутри уже открытой транзакции
+func applyBalanceChangeTx(tx *sql.Tx, updateQuery string, userID, chatID int64, currency string, delta int, reason string) error {
 	// Используем московское время
 	moscowTime := utils.FormatMoscowTime(utils.GetMoscowTime())
-	_, err := d.db.Exec(query, userID, chatID, moscowTime)
-	return err
+	if _, err := tx.Exec(updateQuery, userID, chatID, delta, moscowTime); err != nil {
+		return err
+	}
+
+	// Нулевые операции в журнал не пишем
+	if delta != 0 {
+		ledgerQuery := `
+			INSERT INTO balance_ledger (user_id, chat_id, currency, delta, reason, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`
+		if _, err := tx.Exec(ledgerQuery, userID, chatID, currency, delta, reason, moscowTime); err != nil {
+			return fmt.Errorf("failed to write ledger entry: %w", err)
+		}
+	}
+
+	return nil
 }
 
-// GetTopUsers получает топ пользователей по калориям
-func (d *Database) GetTopUsers(chatID int64, limit int) ([]*models.MessageLog, error) {
+// GetUserCups получает количество заработанных кубков пользователя
+func (d *Database) GetUserCups(userID, chatID int64) (int, error) {
 	query := `
-		SELECT user_id, username, chat_id, calories, streak_days, calorie_streak_days, cups_earned, last_training_date, last_message, has_training_done, has_sick_leave, has_healthy, is_deleted, is_exempt_from_deletion,
-		       timer_start_time, sick_leave_start_time, sick_leave_end_time, sick_time, rest_time_till_del, created_at, updated_at
-		FROM message_log 
-		WHERE chat_id = $1 AND calories > 0 AND is_deleted = FALSE
-		ORDER BY calories DESC, last_message DESC
-		LIMIT $2
+		SELECT COALESCE(cups_earned, 0) 
+		FROM message_log
+		WHERE user_id = $1 AND chat_id = $2
 	`
 
-	rows, err := d.db.Query(query, chatID, limit)
+	var cups int
+	err := d.db.QueryRow(query, userID, chatID).Scan(&cups)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []*models.MessageLog
-	for rows.Next() {
-		var msg models.MessageLog
-		err := rows.Scan(
-			&msg.UserID, &msg.Username, &msg.ChatID, &msg.Calories, &msg.StreakDays, &msg.CalorieStreakDays, &msg.CupsEarned, &msg.LastTrainingDate, &msg.LastMessage, &msg.HasTrainingDone,
-			&msg.HasSickLeave, &msg.HasHealthy, &msg.IsDeleted, &msg.IsExemptFromDeletion, &msg.TimerStartTime, &msg.SickLeaveStartTime, &msg.SickLeaveEndTime, &msg.SickTime, &msg.RestTimeTillDel,
-			&msg.CreatedAt, &msg.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		users = append(users, &msg)
+		return 0, err
 	}
 
-	return users, nil
+	return cups, nil
 }
 
 // GetAllUsersWithTimers получает всех пользователей с активными таймерами
 func (d *Database) GetAllUsersWithTimers() ([]*models.MessageLog, error) {
 	query := `
-		SELECT user_id, username, chat_id, calories, streak_days, calorie_streak_days, cups_earned, last_training_date, last_message, has_training_done, has_sick_leave, has_healthy, is_deleted, is_exempt_from_deletion,
-		       timer_start_time, sick_leave_start_time, sick_leave_end_time, sick_time, rest_time_till_del, created_at, updated_at
-		FROM message_log 
-		WHERE timer_start_time IS NOT NULL AND is_deleted = FALSE
+		SELECT ` + messageLogColumns + `
+		FROM message_log
+		WHERE timer_start_time IS NOT NULL AND state NOT IN ('removed', 'left')
 		ORDER BY timer_start_time ASC
 	`
 
-	rows, err := d.db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []*models.MessageLog
-	for rows.Next() {
-		var msg models.MessageLog
-		err := rows.Scan(
-			&msg.UserID, &msg.Username, &msg.ChatID, &msg.Calories, &msg.StreakDays, &msg.CalorieStreakDays, &msg.CupsEarned, &msg.LastTrainingDate, &msg.LastMessage, &msg.HasTrainingDone,
-			&msg.HasSickLeave, &msg.HasHealthy, &msg.IsDeleted, &msg.IsExemptFromDeletion, &msg.TimerStartTime, &msg.SickLeaveStartTime, &msg.SickLeaveEndTime, &msg.SickTime, &msg.RestTimeTillDel,
-			&msg.CreatedAt, &msg.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		users = append(users, &msg)
-	}
-
-	return users, nil
+	return d.queryMessageLogs(query)
 }
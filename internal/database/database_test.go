@@ -0,0 +1,345 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/state"
+	"leo-bot/internal/utils"
+
+	"github.com/lib/pq"
+)
+
+// openTestDatabase подключается к базе из TEST_DATABASE_URL и применяет миграции.
+// Без переменной тесты с базой пропускаются. Строки тестового чата удаляются до и после теста
+func openTestDatabase(t *testing.T, chatID int64) *Database {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	d, err := New(url)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	if err := d.CreateTables(); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+	if err := d.RunMigrations(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	cleanup := func() {
+		for _, table := range chatTables {
+			if _, err := d.db.Exec(`DELETE FROM `+table+` WHERE chat_id = $1`, chatID); err != nil {
+				t.Errorf("Failed to clean %s: %v", table, err)
+			}
+		}
+	}
+	cleanup()
+	t.Cleanup(func() {
+		cleanup()
+		d.Close()
+	})
+	return d
+}
+
+// addTestMember создает участника чата в состоянии active
+func addTestMember(t *testing.T, d *Database, chatID, userID int64, username string) {
+	t.Helper()
+	err := d.SaveMessageLog(&models.MessageLog{UserID: userID, ChatID: chatID, Username: username, LastMessage: "test"})
+	if err != nil {
+		t.Fatalf("Failed to save member %d: %v", userID, err)
+	}
+}
+
+func TestSaveTrainingReportKeepsOneReportPerDay(t *testing.T) {
+	const chatID = -990001
+	d := openTestDatabase(t, chatID)
+	addTestMember(t, d, chatID, 1, "runner")
+
+	reports := []*models.TrainingReport{
+		{UserID: 1, ChatID: chatID, ReportDate: "2026-10-14", StreakDays: 3, Tags: []string{"run"}},
+		{UserID: 1, ChatID: chatID, ReportDate: "2026-10-14", StreakDays: 3, Tags: []string{"yoga"}},
+		{UserID: 1, ChatID: chatID, ReportDate: "2026-10-14", StreakDays: 3},
+		{UserID: 1, ChatID: chatID, ReportDate: "2026-10-15", StreakDays: 4},
+	}
+	for _, report := range reports {
+		if err := d.SaveTrainingReport(report); err != nil {
+			t.Fatalf("Failed to save report: %v", err)
+		}
+	}
+
+	count, err := d.GetTrainingCount(1, chatID)
+	if err != nil {
+		t.Fatalf("Failed to count trainings: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 training days, got %d", count)
+	}
+
+	// Теги повторных отчетов сохраняются — челленджи с тегом их учитывают
+	var tags []string
+	err = d.db.QueryRow(`SELECT ARRAY(SELECT UNNEST(tags) ORDER BY 1) FROM training_reports WHERE user_id = 1 AND chat_id = $1 AND report_date = '2026-10-14'`, chatID).
+		Scan(pq.Array(&tags))
+	if err != nil {
+		t.Fatalf("Failed to read tags: %v", err)
+	}
+	if len(tags) != 2 || tags[0] != "run" || tags[1] != "yoga" {
+		t.Errorf("Expected merged tags [run yoga], got %v", tags)
+	}
+
+	top, err := d.GetLeaderboard(chatID, models.MetricTrainings, AllTime, time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatalf("Failed to get leaderboard: %v", err)
+	}
+	if len(top) != 1 || top[0].Value != 2 {
+		t.Errorf("Expected 2 trainings in the top, got %+v", top)
+	}
+}
+
+func TestLaterReportOfTheDayCountsAfterStart(t *testing.T) {
+	const chatID = -990005
+	d := openTestDatabase(t, chatID)
+	addTestMember(t, d, chatID, 1, "runner")
+
+	day, _ := utils.ParseMoscowDate("2026-10-14")
+	report := func(hour int, tags ...string) {
+		t.Helper()
+		err := d.SaveTrainingReport(&models.TrainingReport{UserID: 1, ChatID: chatID, ReportDate: "2026-10-14", StreakDays: 1,
+			Tags: tags, CreatedAt: day.Add(time.Duration(hour) * time.Hour)})
+		if err != nil {
+			t.Fatalf("Failed to save report: %v", err)
+		}
+	}
+
+	// Отчет в 08:00, челлендж и команда — в 12:00, отчет с тегом — в 18:00
+	report(8)
+	started := day.Add(12 * time.Hour)
+	challenge := &models.Challenge{ChatID: chatID, Title: "Пробежки", Tag: "run", Target: 3, StartsAt: started, EndsAt: day.AddDate(0, 0, 7)}
+	if err := d.CreateChallenge(challenge); err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	if _, err := d.JoinChallenge(challenge.ID, 1, started); err != nil {
+		t.Fatalf("Failed to join challenge: %v", err)
+	}
+	team := &models.Team{ChatID: chatID, Name: "Барсы", CreatedAt: started}
+	if err := d.CreateTeam(team); err != nil {
+		t.Fatalf("Failed to create team: %v", err)
+	}
+	if err := d.SetTeamMember(chatID, 1, team.ID, started); err != nil {
+		t.Fatalf("Failed to set team member: %v", err)
+	}
+	report(18, "run")
+
+	progress, err := d.GetChallengeProgress(challenge)
+	if err != nil {
+		t.Fatalf("Failed to get challenge progress: %v", err)
+	}
+	if len(progress) != 1 || progress[0].Progress != 1 {
+		t.Errorf("Expected the evening report to count for the challenge, got %+v", progress)
+	}
+
+	standings, err := d.GetTeamLeaderboard(chatID, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Failed to get team leaderboard: %v", err)
+	}
+	if len(standings) != 1 || standings[0].Trainings != 1 {
+		t.Errorf("Expected the evening report to count for the team, got %+v", standings)
+	}
+}
+
+// addTestReport записывает отчет с заданным временем отправки
+func addTestReport(t *testing.T, d *Database, chatID, userID int64, createdAt time.Time) {
+	t.Helper()
+	addTestStreakReport(t, d, chatID, userID, 1, createdAt)
+}
+
+// addTestStreakReport записывает отчет с серией на момент отправки
+func addTestStreakReport(t *testing.T, d *Database, chatID, userID int64, streakDays int, createdAt time.Time) {
+	t.Helper()
+	_, err := d.db.Exec(`INSERT INTO training_reports (user_id, chat_id, report_date, streak_days, created_at, last_reported_at) VALUES ($1, $2, $3, $4, $5, $5)`,
+		userID, chatID, createdAt.Format("2006-01-02"), streakDays, createdAt)
+	if err != nil {
+		t.Fatalf("Failed to add report of %d: %v", userID, err)
+	}
+}
+
+func TestGetTeamLeaderboard(t *testing.T) {
+	const chatID = -990002
+	d := openTestDatabase(t, chatID)
+
+	weekStart := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	weekEnd := weekStart.AddDate(0, 0, 7)
+
+	cats := &models.Team{ChatID: chatID, Name: "Барсы", CreatedAt: weekStart}
+	lynx := &models.Team{ChatID: chatID, Name: "Рыси", CreatedAt: weekStart}
+	for _, team := range []*models.Team{cats, lynx} {
+		if err := d.CreateTeam(team); err != nil {
+			t.Fatalf("Failed to create team: %v", err)
+		}
+	}
+
+	for userID, name := range map[int64]string{1: "one", 2: "two", 3: "three", 4: "four"} {
+		addTestMember(t, d, chatID, userID, name)
+	}
+
+	// 1 в Барсах всю неделю; 2 перешел в Барсы в среду; 3 в Рысях, но ушел из чата; 4 в Рысях
+	joins := []struct {
+		userID, teamID int64
+		joinedAt       time.Time
+	}{
+		{1, cats.ID, weekStart.AddDate(0, 0, -1)},
+		{2, cats.ID, weekStart.AddDate(0, 0, 2)},
+		{3, lynx.ID, weekStart.AddDate(0, 0, -1)},
+		{4, lynx.ID, weekStart.AddDate(0, 0, -1)},
+	}
+	for _, join := range joins {
+		if err := d.SetTeamMember(chatID, join.userID, join.teamID, join.joinedAt); err != nil {
+			t.Fatalf("Failed to set team member: %v", err)
+		}
+	}
+	if _, err := d.ChangeMemberState(3, chatID, state.Left, "test"); err != nil {
+		t.Fatalf("Failed to change member state: %v", err)
+	}
+
+	for day := 0; day < 7; day++ {
+		at := weekStart.AddDate(0, 0, day).Add(12 * time.Hour)
+		addTestReport(t, d, chatID, 1, at)
+		addTestReport(t, d, chatID, 2, at) // до среды не засчитываются Барсам
+		addTestReport(t, d, chatID, 3, at) // ушедший из чата не считается
+	}
+	addTestReport(t, d, chatID, 4, weekStart.Add(12*time.Hour))
+	// Отчет прошлой недели в зачет не входит
+	addTestReport(t, d, chatID, 4, weekStart.Add(-12*time.Hour))
+
+	standings, err := d.GetTeamLeaderboard(chatID, weekStart, weekEnd)
+	if err != nil {
+		t.Fatalf("Failed to get team leaderboard: %v", err)
+	}
+	if len(standings) != 2 {
+		t.Fatalf("Expected 2 teams, got %d", len(standings))
+	}
+
+	// Барсы: 7 отчетов первого и 5 второго (со среды по воскресенье)
+	if standings[0].Name != "Барсы" || standings[0].Members != 2 || standings[0].Trainings != 12 {
+		t.Errorf("Unexpected first place: %+v", standings[0])
+	}
+	if standings[1].Name != "Рыси" || standings[1].Members != 1 || standings[1].Trainings != 1 {
+		t.Errorf("Unexpected second place: %+v", standings[1])
+	}
+}
+
+func TestMarkTeamWeekPostedOnce(t *testing.T) {
+	const chatID = -990003
+	d := openTestDatabase(t, chatID)
+
+	weekStart := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	postedAt := weekStart.AddDate(0, 0, 7)
+
+	posted, err := d.MarkTeamWeekPosted(chatID, weekStart, postedAt)
+	if err != nil || !posted {
+		t.Fatalf("Expected first mark to succeed, got %t, %v", posted, err)
+	}
+
+	// Повторный запуск планировщика ту же неделю не публикует
+	posted, err = d.MarkTeamWeekPosted(chatID, weekStart, postedAt.Add(time.Minute))
+	if err != nil || posted {
+		t.Errorf("Expected second mark to be skipped, got %t, %v", posted, err)
+	}
+
+	// Следующая неделя публикуется как обычно
+	posted, err = d.MarkTeamWeekPosted(chatID, weekStart.AddDate(0, 0, 7), postedAt.AddDate(0, 0, 7))
+	if err != nil || !posted {
+		t.Errorf("Expected next week to be marked, got %t, %v", posted, err)
+	}
+}
+
+func TestStreakChangesShiftCalorieStreak(t *testing.T) {
+	const chatID = -990004
+	d := openTestDatabase(t, chatID)
+	addTestMember(t, d, chatID, 1, "runner")
+
+	expectStreaks := func(streak, calorieStreak int) {
+		t.Helper()
+		messageLog, err := d.GetMessageLog(1, chatID)
+		if err != nil {
+			t.Fatalf("Failed to get message log: %v", err)
+		}
+		if messageLog.StreakDays != streak || messageLog.CalorieStreakDays != calorieStreak {
+			t.Errorf("Expected streaks %d/%d, got %d/%d", streak, calorieStreak, messageLog.StreakDays, messageLog.CalorieStreakDays)
+		}
+	}
+
+	if _, err := d.AdjustBalance(1, chatID, models.CurrencyStreak, 5, models.LedgerReasonAdminAdjust); err != nil {
+		t.Fatalf("Failed to adjust streak: %v", err)
+	}
+	expectStreaks(5, 5)
+
+	// После обмена калорий серия для калорий начинается заново и дальше сдвигается на ту же разницу
+	if err := d.UpdateCalorieStreak(1, chatID, 1); err != nil {
+		t.Fatalf("Failed to update calorie streak: %v", err)
+	}
+	previous, err := d.SetStreak(1, chatID, 8, "2026-10-14", models.LedgerReasonSetStreak)
+	if err != nil || previous != 5 {
+		t.Fatalf("Expected previous streak 5, got %d, %v", previous, err)
+	}
+	expectStreaks(8, 4)
+
+	// Серия для калорий не уходит в минус
+	if _, err := d.AdjustBalance(1, chatID, models.CurrencyStreak, -6, models.LedgerReasonAdminAdjust); err != nil {
+		t.Fatalf("Failed to adjust streak: %v", err)
+	}
+	expectStreaks(2, 0)
+}
+
+func TestStreakLeaderboardPrefersEarlierStreak(t *testing.T) {
+	const chatID = -990006
+	d := openTestDatabase(t, chatID)
+	addTestMember(t, d, chatID, 1, "early")
+	addTestMember(t, d, chatID, 2, "late")
+
+	day := time.Date(2026, 10, 10, 12, 0, 0, 0, time.UTC)
+	// Первый набрал серию 2 раньше и продолжил отчитываться после перерыва, второй набрал 2 позже
+	addTestStreakReport(t, d, chatID, 1, 1, day)
+	addTestStreakReport(t, d, chatID, 1, 2, day.AddDate(0, 0, 1))
+	addTestStreakReport(t, d, chatID, 2, 1, day.AddDate(0, 0, 1))
+	addTestStreakReport(t, d, chatID, 2, 2, day.AddDate(0, 0, 2))
+	addTestStreakReport(t, d, chatID, 1, 1, day.AddDate(0, 0, 4))
+
+	top, err := d.GetLeaderboard(chatID, models.MetricStreak, AllTime, day.AddDate(0, 0, 7), 10)
+	if err != nil {
+		t.Fatalf("Failed to get leaderboard: %v", err)
+	}
+	if len(top) != 2 || top[0].UserID != 1 || top[0].Value != 2 || top[1].UserID != 2 || top[1].Value != 2 {
+		t.Errorf("Expected the earlier streak to win the tie, got %+v", top)
+	}
+}
+
+func TestMarkPrivateReminderSentOncePerTimer(t *testing.T) {
+	const chatID = -990007
+	d := openTestDatabase(t, chatID)
+	addTestMember(t, d, chatID, 1, "runner")
+
+	const timerStart = "2026-10-14T12:00:00+03:00"
+	sent, err := d.MarkPrivateReminderSent(1, chatID, timerStart)
+	if err != nil || !sent {
+		t.Fatalf("Expected first reminder to be marked, got %t, %v", sent, err)
+	}
+
+	// Таймер восстановлен после перезапуска — отсчет тот же, повторно не напоминаем
+	sent, err = d.MarkPrivateReminderSent(1, chatID, timerStart)
+	if err != nil || sent {
+		t.Errorf("Expected repeated reminder to be skipped, got %t, %v", sent, err)
+	}
+
+	// Новый отсчет после отчета — новое напоминание
+	sent, err = d.MarkPrivateReminderSent(1, chatID, "2026-10-15T09:00:00+03:00")
+	if err != nil || !sent {
+		t.Errorf("Expected reminder for a new timer to be marked, got %t, %v", sent, err)
+	}
+}
@@ -0,0 +1,45 @@
+package database
+
+// GetHashtagAliases возвращает псевдонимы служебных хештегов чата: псевдоним -> хештег
+func (d *Database) GetHashtagAliases(chatID int64) (map[string]string, error) {
+	rows, err := d.db.Query(`SELECT alias, tag FROM hashtag_aliases WHERE chat_id = $1`, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := make(map[string]string)
+	for rows.Next() {
+		var alias, tag string
+		if err := rows.Scan(&alias, &tag); err != nil {
+			return nil, err
+		}
+		aliases[alias] = tag
+	}
+	return aliases, rows.Err()
+}
+
+// SaveHashtagAlias добавляет псевдоним хештега или меняет хештег существующего
+func (d *Database) SaveHashtagAlias(chatID int64, alias, tag string, createdBy int64) error {
+	query := `
+		INSERT INTO hashtag_aliases (chat_id, alias, tag, created_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (chat_id, alias) DO UPDATE SET
+			tag = EXCLUDED.tag,
+			created_by = EXCLUDED.created_by,
+			created_at = (NOW() AT TIME ZONE 'Europe/Moscow')
+	`
+
+	_, err := d.db.Exec(query, chatID, alias, tag, createdBy)
+	return err
+}
+
+// DeleteHashtagAlias удаляет псевдоним хештега. Возвращает false, если такого псевдонима не было
+func (d *Database) DeleteHashtagAlias(chatID int64, alias string) (bool, error) {
+	result, err := d.db.Exec(`DELETE FROM hashtag_aliases WHERE chat_id = $1 AND alias = $2`, chatID, alias)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"leo-bot/internal/models"
+)
+
+var (
+	// ErrKudosLimit возвращается, если участник уже раздал все кудосы за день
+	ErrKudosLimit = errors.New("daily kudos limit reached")
+	// ErrKudosDuplicate возвращается при повторном кудосе за тот же отчет
+	ErrKudosDuplicate = errors.New("kudos already given for this report")
+)
+
+// GiveKudos сохраняет кудос и начисляет получателю кубки одной транзакцией.
+// Дневной лимит считается по кудосам дарителя начиная с dayStart
+func (d *Database) GiveKudos(kudos *models.Kudos, rewardCups, dailyLimit int, dayStart time.Time) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var givenToday int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM kudos
+		WHERE chat_id = $1 AND giver_id = $2 AND created_at >= $3
+	`, kudos.ChatID, kudos.GiverID, dayStart).Scan(&givenToday)
+	if err != nil {
+		return err
+	}
+	if givenToday >= dailyLimit {
+		return ErrKudosLimit
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO kudos (chat_id, giver_id, receiver_id, report_message_id, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (chat_id, giver_id, report_message_id) DO NOTHING
+	`, kudos.ChatID, kudos.GiverID, kudos.ReceiverID, kudos.ReportMessageID, kudos.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrKudosDuplicate
+	}
+
+	if err := applyBalanceChangeTx(tx, addCupsQuery, kudos.ReceiverID, kudos.ChatID, models.CurrencyCups, rewardCups, models.LedgerReasonKudos); err != nil {
+		return fmt.Errorf("failed to grant kudos reward: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetKudosStats получает количество полученных и отданных участником кудосов
+func (d *Database) GetKudosStats(userID, chatID int64) (*models.KudosStats, error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE receiver_id = $1),
+			COUNT(*) FILTER (WHERE giver_id = $1)
+		FROM kudos
+		WHERE chat_id = $2 AND (receiver_id = $1 OR giver_id = $1)
+	`
+
+	var stats models.KudosStats
+	if err := d.db.QueryRow(query, userID, chatID).Scan(&stats.Received, &stats.Given); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
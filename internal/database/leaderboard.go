@@ -0,0 +1,125 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/utils"
+
+	"github.com/lib/pq"
+)
+
+// SaveTrainingReport добавляет отчет в историю тренировок. За день у участника хранится один отчет:
+// повторный #training_done дополняет теги и время последнего отчета, чтобы топ, команды и челленджи
+// считали дни, а не сообщения. created_at остается временем первого отчета за день
+func (d *Database) SaveTrainingReport(report *models.TrainingReport) error {
+	query := `
+		INSERT INTO training_reports (user_id, chat_id, report_date, streak_days, tags, created_at, last_reported_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (user_id, chat_id, report_date) DO UPDATE SET
+			tags = ARRAY(SELECT DISTINCT UNNEST(training_reports.tags || EXCLUDED.tags)),
+			streak_days = GREATEST(training_reports.streak_days, EXCLUDED.streak_days),
+			last_reported_at = EXCLUDED.last_reported_at
+	`
+
+	// nil-срез pq превращает в NULL, а колонка tags обязательная
+	tags := report.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	// Используем московское время; CreatedAt задается, когда отчет записывается задним числом
+	reportedAt := report.CreatedAt
+	if reportedAt.IsZero() {
+		reportedAt = utils.GetMoscowTime()
+	}
+	moscowTime := utils.FormatMoscowTime(reportedAt)
+	_, err := d.db.Exec(query, report.UserID, report.ChatID, report.ReportDate, report.StreakDays, pq.Array(tags), moscowTime)
+	return err
+}
+
+// GetTrainingCount получает количество дней с отчетами участника в истории
+func (d *Database) GetTrainingCount(userID, chatID int64) (int, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM training_reports WHERE user_id = $1 AND chat_id = $2`, userID, chatID).Scan(&count)
+	return count, err
+}
+
+// AllTime — начало периода «за всё время». Только в таком топе учитываются начальные остатки
+// (opening_balance): миграция записала их в журнал в момент обновления, а не когда они были заработаны
+var AllTime = time.Unix(0, 0)
+
+// CountsOpeningBalance сообщает, попадут ли начальные остатки в топ за период с since.
+// Условие совпадает с фильтром по reason в leaderboardSources
+func CountsOpeningBalance(since time.Time) bool {
+	return !since.After(AllTime)
+}
+
+// leaderboardSources описывает, откуда берется значение для каждой метрики топа.
+// value — агрегат, reached_at — момент, когда он был набран: последний вклад в сумму или первый отчет
+// с лучшей серией (для разрешения ничьих)
+var leaderboardSources = map[models.LeaderboardMetric]string{
+	models.MetricTrainings: `
+		SELECT user_id, COUNT(*) AS value, MAX(created_at) AS reached_at
+		FROM training_reports
+		WHERE chat_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY user_id`,
+	models.MetricStreak: `
+		SELECT DISTINCT ON (user_id) user_id, streak_days AS value, created_at AS reached_at
+		FROM training_reports
+		WHERE chat_id = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY user_id, streak_days DESC, created_at ASC`,
+	models.MetricCalories: `
+		SELECT user_id, SUM(delta) AS value, MAX(created_at) AS reached_at
+		FROM balance_ledger
+		WHERE chat_id = $1 AND created_at >= $2 AND created_at < $3 AND currency = 'calories' AND delta > 0
+			AND (reason <> 'opening_balance' OR $2 <= TIMESTAMPTZ 'epoch')
+		GROUP BY user_id`,
+	models.MetricCups: `
+		SELECT user_id, SUM(delta) AS value, MAX(created_at) AS reached_at
+		FROM balance_ledger
+		WHERE chat_id = $1 AND created_at >= $2 AND created_at < $3 AND currency = 'cups' AND delta > 0
+			AND (reason <> 'opening_balance' OR $2 <= TIMESTAMPTZ 'epoch')
+		GROUP BY user_id`,
+	models.MetricKudos: `
+		SELECT receiver_id AS user_id, COUNT(*) AS value, MAX(created_at) AS reached_at
+		FROM kudos
+		WHERE chat_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY receiver_id`,
+}
+
+// GetLeaderboard строит топ участников чата по метрике за период [since, until).
+// При равенстве выше тот, кто набрал результат раньше, затем — меньший user_id
+func (d *Database) GetLeaderboard(chatID int64, metric models.LeaderboardMetric, since, until time.Time, limit int) ([]*models.LeaderboardEntry, error) {
+	source, ok := leaderboardSources[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown leaderboard metric: %s", metric)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT s.user_id, m.username, s.value
+		FROM (%s) s
+		JOIN message_log m ON m.user_id = s.user_id AND m.chat_id = $1
+		WHERE m.state NOT IN ('removed', 'left') AND s.value > 0
+		ORDER BY s.value DESC, s.reached_at ASC, s.user_id ASC
+		LIMIT $4
+	`, source)
+
+	rows, err := d.db.Query(query, chatID, since, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.LeaderboardEntry
+	for rows.Next() {
+		var entry models.LeaderboardEntry
+		if err := rows.Scan(&entry.UserID, &entry.Username, &entry.Value); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
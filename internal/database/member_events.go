@@ -0,0 +1,46 @@
+package database
+
+import (
+	"leo-bot/internal/models"
+)
+
+// RecordMemberEvent записывает вступление или выход участника
+func (d *Database) RecordMemberEvent(e *models.MemberEvent) error {
+	query := `
+		INSERT INTO member_events (chat_id, user_id, username, event, source, actor_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	return d.db.QueryRow(query, e.ChatID, e.UserID, e.Username, e.Event, e.Source, e.ActorID).Scan(&e.ID, &e.CreatedAt)
+}
+
+// GetChatRoster возвращает всех известных боту участников чата, включая вышедших и удаленных,
+// с временем последнего выхода из member_events
+func (d *Database) GetChatRoster(chatID int64) ([]*models.RosterEntry, error) {
+	query := `
+		SELECT m.user_id, m.username, m.state, m.last_spoke_at, m.created_at,
+		       (SELECT MAX(e.created_at) FROM member_events e
+		        WHERE e.chat_id = m.chat_id AND e.user_id = m.user_id AND e.event IN ('leave', 'kick'))
+		FROM message_log m
+		WHERE m.chat_id = $1
+		ORDER BY m.username, m.user_id
+	`
+
+	rows, err := d.db.Query(query, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roster []*models.RosterEntry
+	for rows.Next() {
+		var r models.RosterEntry
+		if err := rows.Scan(&r.UserID, &r.Username, &r.State, &r.LastSpokeAt, &r.FirstSeenAt, &r.LeftAt); err != nil {
+			return nil, err
+		}
+		roster = append(roster, &r)
+	}
+
+	return roster, rows.Err()
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"fmt"
+
+	"leo-bot/internal/state"
+	"leo-bot/internal/utils"
+)
+
+// ChangeMemberState переводит участника в состояние to и записывает переход в member_state_history.
+// Возвращает предыдущее состояние. Запрещенный переход возвращает state.ErrInvalidTransition,
+// отсутствие участника — sql.ErrNoRows. Переход в то же состояние ничего не меняет
+func (d *Database) ChangeMemberState(userID, chatID int64, to state.State, reason string) (state.State, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var from state.State
+	err = tx.QueryRow(`SELECT state FROM message_log WHERE user_id = $1 AND chat_id = $2 FOR UPDATE`, userID, chatID).Scan(&from)
+	if err != nil {
+		return "", err
+	}
+
+	if from == to {
+		return from, nil
+	}
+	if err := state.Transition(from, to); err != nil {
+		return from, err
+	}
+
+	// Используем московское время
+	now := utils.GetMoscowTime()
+	if _, err := tx.Exec(`UPDATE message_log SET state = $3, updated_at = $4 WHERE user_id = $1 AND chat_id = $2`,
+		userID, chatID, to, utils.FormatMoscowTime(now)); err != nil {
+		return from, err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO member_state_history (chat_id, user_id, from_state, to_state, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, chatID, userID, from, to, reason, now); err != nil {
+		return from, fmt.Errorf("failed to record state transition: %w", err)
+	}
+
+	return from, tx.Commit()
+}
@@ -100,6 +100,608 @@ var Migrations = []Migration{
 			DROP COLUMN is_exempt_from_deletion;
 		`,
 	},
+	{
+		Version:     5,
+		Description: "Add training_reports history and balance_ledger tables for leaderboards",
+		UpSQL: `
+			-- История отчетов о тренировках (по одной строке на каждый #training_done)
+			CREATE TABLE IF NOT EXISTS training_reports (
+				id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL,
+				chat_id BIGINT NOT NULL,
+				report_date DATE NOT NULL,
+				streak_days INTEGER NOT NULL DEFAULT 0,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_training_reports_chat_created
+			ON training_reports (chat_id, created_at);
+
+			-- Журнал начислений и списаний калорий и кубков
+			CREATE TABLE IF NOT EXISTS balance_ledger (
+				id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL,
+				chat_id BIGINT NOT NULL,
+				currency TEXT NOT NULL,
+				delta INTEGER NOT NULL,
+				reason TEXT NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+
+			-- Лидерборды считают только начисления, поэтому индекс частичный
+			CREATE INDEX IF NOT EXISTS idx_balance_ledger_earned
+			ON balance_ledger (chat_id, currency, created_at)
+			WHERE delta > 0;
+
+			-- Переносим текущие балансы как стартовые записи журнала
+			INSERT INTO balance_ledger (user_id, chat_id, currency, delta, reason)
+			SELECT user_id, chat_id, 'calories', calories, 'opening_balance'
+			FROM message_log WHERE calories <> 0;
+
+			INSERT INTO balance_ledger (user_id, chat_id, currency, delta, reason)
+			SELECT user_id, chat_id, 'cups', cups_earned, 'opening_balance'
+			FROM message_log WHERE COALESCE(cups_earned, 0) <> 0;
+		`,
+		DownSQL: `
+			DROP TABLE IF EXISTS balance_ledger;
+			DROP TABLE IF EXISTS training_reports;
+		`,
+	},
+	{
+		Version:     6,
+		Description: "Add seasons and hall_of_fame tables",
+		UpSQL: `
+			-- Сезоны: календарные кварталы или заданные администратором
+			CREATE TABLE IF NOT EXISTS seasons (
+				id BIGSERIAL PRIMARY KEY,
+				chat_id BIGINT NOT NULL,
+				name TEXT NOT NULL,
+				starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				is_closed BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_seasons_open
+			ON seasons (ends_at)
+			WHERE is_closed = FALSE;
+
+			-- Зал славы: призеры завершенных сезонов
+			CREATE TABLE IF NOT EXISTS hall_of_fame (
+				season_id BIGINT NOT NULL REFERENCES seasons (id) ON DELETE CASCADE,
+				chat_id BIGINT NOT NULL,
+				user_id BIGINT NOT NULL,
+				username TEXT DEFAULT '',
+				place INTEGER NOT NULL,
+				points INTEGER NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow'),
+				PRIMARY KEY (season_id, place)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_hall_of_fame_chat
+			ON hall_of_fame (chat_id);
+		`,
+		DownSQL: `
+			DROP TABLE IF EXISTS hall_of_fame;
+			DROP TABLE IF EXISTS seasons;
+		`,
+	},
+	{
+		Version:     7,
+		Description: "Add teams, team_members and team_weekly_results tables",
+		UpSQL: `
+			-- Команды внутри чата
+			CREATE TABLE IF NOT EXISTS teams (
+				id BIGSERIAL PRIMARY KEY,
+				chat_id BIGINT NOT NULL,
+				name TEXT NOT NULL,
+				created_by BIGINT NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_teams_chat_name
+			ON teams (chat_id, LOWER(name));
+
+			-- Участник может состоять только в одной команде чата
+			CREATE TABLE IF NOT EXISTS team_members (
+				chat_id BIGINT NOT NULL,
+				user_id BIGINT NOT NULL,
+				team_id BIGINT NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+				joined_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				PRIMARY KEY (chat_id, user_id)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_team_members_team
+			ON team_members (team_id);
+
+			-- Недели, итоги которых уже опубликованы
+			CREATE TABLE IF NOT EXISTS team_weekly_results (
+				chat_id BIGINT NOT NULL,
+				week_start DATE NOT NULL,
+				posted_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow'),
+				PRIMARY KEY (chat_id, week_start)
+			);
+		`,
+		DownSQL: `
+			DROP TABLE IF EXISTS team_weekly_results;
+			DROP TABLE IF EXISTS team_members;
+			DROP TABLE IF EXISTS teams;
+		`,
+	},
+	{
+		Version:     8,
+		Description: "Add report tags and challenges, challenge_participants tables",
+		UpSQL: `
+			-- Дополнительные хештеги отчета (#run, #yoga и т.п.) без служебных
+			ALTER TABLE training_reports
+			ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+			-- Групповые челленджи с ограниченным сроком
+			CREATE TABLE IF NOT EXISTS challenges (
+				id BIGSERIAL PRIMARY KEY,
+				chat_id BIGINT NOT NULL,
+				title TEXT NOT NULL,
+				tag TEXT NOT NULL DEFAULT '',
+				target INTEGER NOT NULL,
+				reward_cups INTEGER NOT NULL,
+				starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				created_by BIGINT NOT NULL,
+				is_finished BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_challenges_active
+			ON challenges (chat_id, ends_at) WHERE is_finished = FALSE;
+
+			CREATE TABLE IF NOT EXISTS challenge_participants (
+				challenge_id BIGINT NOT NULL REFERENCES challenges (id) ON DELETE CASCADE,
+				user_id BIGINT NOT NULL,
+				joined_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				completed_at TIMESTAMP WITH TIME ZONE,
+				PRIMARY KEY (challenge_id, user_id)
+			);
+		`,
+		DownSQL: `
+			DROP TABLE IF EXISTS challenge_participants;
+			DROP TABLE IF EXISTS challenges;
+			ALTER TABLE training_reports DROP COLUMN IF EXISTS tags;
+		`,
+	},
+	{
+		Version:     9,
+		Description: "Add kudos table",
+		UpSQL: `
+			-- Кудосы: ответ #kudos на отчет #training_done другого участника
+			CREATE TABLE IF NOT EXISTS kudos (
+				id BIGSERIAL PRIMARY KEY,
+				chat_id BIGINT NOT NULL,
+				giver_id BIGINT NOT NULL,
+				receiver_id BIGINT NOT NULL,
+				report_message_id INTEGER NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				UNIQUE (chat_id, giver_id, report_message_id)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_kudos_giver
+			ON kudos (chat_id, giver_id, created_at);
+
+			CREATE INDEX IF NOT EXISTS idx_kudos_receiver
+			ON kudos (chat_id, receiver_id, created_at);
+		`,
+		DownSQL: `
+			DROP TABLE IF EXISTS kudos;
+		`,
+	},
+	{
+		Version:     10,
+		Description: "Add sick_leaves history and chat_settings tables",
+		UpSQL: `
+			-- История больничных: одна строка на каждый эпизод
+			CREATE TABLE IF NOT EXISTS sick_leaves (
+				id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL,
+				chat_id BIGINT NOT NULL,
+				started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				ended_at TIMESTAMP WITH TIME ZONE,
+				duration_seconds BIGINT,
+				reason TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+
+			-- У участника может быть только один открытый больничный
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_sick_leaves_open
+			ON sick_leaves (chat_id, user_id) WHERE ended_at IS NULL;
+
+			CREATE INDEX IF NOT EXISTS idx_sick_leaves_user
+			ON sick_leaves (chat_id, user_id, started_at);
+
+			-- Переносим последний эпизод из message_log (более ранние уже перезаписаны).
+			-- sick_leave_end_time мог остаться от предыдущего эпизода, поэтому не даем ему быть раньше начала
+			INSERT INTO sick_leaves (user_id, chat_id, started_at, ended_at, duration_seconds)
+			SELECT user_id, chat_id, started_at, ended_at,
+				EXTRACT(EPOCH FROM ended_at - started_at)::BIGINT
+			FROM (
+				SELECT user_id, chat_id,
+					sick_leave_start_time::timestamptz AS started_at,
+					CASE
+						WHEN has_sick_leave AND NOT has_healthy THEN NULL
+						ELSE GREATEST(COALESCE(NULLIF(sick_leave_end_time, '')::timestamptz, sick_leave_start_time::timestamptz),
+							sick_leave_start_time::timestamptz)
+					END AS ended_at
+				FROM message_log
+				WHERE sick_leave_start_time IS NOT NULL AND sick_leave_start_time <> ''
+			) episodes;
+
+			-- Настройки чата; отсутствие строки означает значения по умолчанию
+			CREATE TABLE IF NOT EXISTS chat_settings (
+				chat_id BIGINT PRIMARY KEY,
+				sick_days_per_year INTEGER NOT NULL DEFAULT 30,
+				updated_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+		`,
+		DownSQL: `
+			DROP TABLE IF EXISTS chat_settings;
+			DROP TABLE IF EXISTS sick_leaves;
+		`,
+	},
+	{
+		Version:     11,
+		Description: "Add sick leave expiry settings and reminder tracking",
+		UpSQL: `
+			-- Максимальная длина больничного и интервал напоминаний
+			ALTER TABLE chat_settings
+			ADD COLUMN IF NOT EXISTS max_sick_leave_days INTEGER NOT NULL DEFAULT 14,
+			ADD COLUMN IF NOT EXISTS sick_reminder_interval_days INTEGER NOT NULL DEFAULT 3;
+
+			-- Когда участнику последний раз напоминали о незакрытом больничном
+			ALTER TABLE sick_leaves
+			ADD COLUMN IF NOT EXISTS last_reminded_at TIMESTAMP WITH TIME ZONE;
+		`,
+		DownSQL: `
+			ALTER TABLE sick_leaves DROP COLUMN IF EXISTS last_reminded_at;
+			ALTER TABLE chat_settings
+			DROP COLUMN IF EXISTS sick_reminder_interval_days,
+			DROP COLUMN IF EXISTS max_sick_leave_days;
+		`,
+	},
+	{
+		Version:     12,
+		Description: "Add vacations table and vacation limits to chat_settings",
+		UpSQL: `
+			-- Запланированные отпуска: таймер не идет в интервале [starts_at, ends_at)
+			CREATE TABLE IF NOT EXISTS vacations (
+				id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL,
+				chat_id BIGINT NOT NULL,
+				starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				is_started BOOLEAN DEFAULT FALSE,
+				is_finished BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_vacations_user
+			ON vacations (chat_id, user_id, starts_at);
+
+			CREATE INDEX IF NOT EXISTS idx_vacations_pending
+			ON vacations (starts_at, ends_at) WHERE is_finished = FALSE;
+
+			ALTER TABLE chat_settings
+			ADD COLUMN IF NOT EXISTS vacation_days_per_year INTEGER NOT NULL DEFAULT 30,
+			ADD COLUMN IF NOT EXISTS max_vacation_days INTEGER NOT NULL DEFAULT 21;
+		`,
+		DownSQL: `
+			ALTER TABLE chat_settings
+			DROP COLUMN IF EXISTS max_vacation_days,
+			DROP COLUMN IF EXISTS vacation_days_per_year;
+			DROP TABLE IF EXISTS vacations;
+		`,
+	},
+	{
+		Version:     13,
+		Description: "Replace member status flags with state column and add member_state_history",
+		UpSQL: `
+			-- Явное состояние участника вместо флагов is_deleted / is_exempt_from_deletion / has_sick_leave
+			ALTER TABLE message_log
+			ADD COLUMN IF NOT EXISTS state VARCHAR(16) NOT NULL DEFAULT 'active';
+
+			UPDATE message_log m SET state = CASE
+				WHEN m.is_deleted THEN 'removed'
+				WHEN m.is_exempt_from_deletion THEN 'exempt'
+				WHEN (m.has_sick_leave AND NOT m.has_healthy) OR EXISTS (
+					SELECT 1 FROM sick_leaves s
+					WHERE s.user_id = m.user_id AND s.chat_id = m.chat_id AND s.ended_at IS NULL
+				) THEN 'sick'
+				WHEN EXISTS (
+					SELECT 1 FROM vacations v
+					WHERE v.user_id = m.user_id AND v.chat_id = m.chat_id AND v.is_started AND NOT v.is_finished
+				) THEN 'vacation'
+				ELSE 'active'
+			END;
+
+			CREATE INDEX IF NOT EXISTS idx_message_log_state
+			ON message_log (chat_id, state);
+
+			-- История переходов между состояниями
+			CREATE TABLE IF NOT EXISTS member_state_history (
+				id BIGSERIAL PRIMARY KEY,
+				chat_id BIGINT NOT NULL,
+				user_id BIGINT NOT NULL,
+				from_state VARCHAR(16) NOT NULL,
+				to_state VARCHAR(16) NOT NULL,
+				reason TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_member_state_history_user
+			ON member_state_history (chat_id, user_id, created_at);
+
+			-- Выведенное из флагов состояние тоже попадает в историю
+			INSERT INTO member_state_history (chat_id, user_id, from_state, to_state, reason)
+			SELECT chat_id, user_id, 'active', state, 'migration'
+			FROM message_log
+			WHERE state <> 'active';
+
+			ALTER TABLE message_log
+			DROP COLUMN IF EXISTS is_deleted,
+			DROP COLUMN IF EXISTS is_exempt_from_deletion;
+		`,
+		DownSQL: `
+			ALTER TABLE message_log
+			ADD COLUMN IF NOT EXISTS is_deleted BOOLEAN DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS is_exempt_from_deletion BOOLEAN DEFAULT FALSE;
+
+			UPDATE message_log SET
+				is_deleted = state IN ('removed', 'left'),
+				is_exempt_from_deletion = state = 'exempt';
+
+			DROP TABLE IF EXISTS member_state_history;
+			DROP INDEX IF EXISTS idx_message_log_state;
+			ALTER TABLE message_log DROP COLUMN IF EXISTS state;
+		`,
+	},
+	{
+		Version:     14,
+		Description: "Add audit_log table",
+		UpSQL: `
+			-- Журнал действий администраторов и автоматических действий бота.
+			-- actor_id = 0 — действие выполнил сам бот (предупреждение, удаление, закрытие больничного),
+			-- target_user_id = 0 — у действия нет конкретного участника
+			CREATE TABLE IF NOT EXISTS audit_log (
+				id BIGSERIAL PRIMARY KEY,
+				chat_id BIGINT NOT NULL,
+				actor_id BIGINT NOT NULL DEFAULT 0,
+				actor_name VARCHAR(255) NOT NULL DEFAULT '',
+				action VARCHAR(64) NOT NULL,
+				target_user_id BIGINT NOT NULL DEFAULT 0,
+				target_name VARCHAR(255) NOT NULL DEFAULT '',
+				arguments TEXT NOT NULL DEFAULT '',
+				reason TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_audit_log_chat
+			ON audit_log (chat_id, created_at);
+
+			CREATE INDEX IF NOT EXISTS idx_audit_log_target
+			ON audit_log (chat_id, target_user_id, created_at);
+		`,
+		DownSQL: `
+			DROP TABLE IF EXISTS audit_log;
+		`,
+	},
+	{
+		Version:     15,
+		Description: "Add member_events table and message_log.last_spoke_at",
+		UpSQL: `
+			-- Когда участник последний раз писал в чат. Пусто — вступил, но молчит.
+			-- Старые записи создавались в основном из сообщений, поэтому считаем, что эти участники писали
+			ALTER TABLE message_log
+			ADD COLUMN IF NOT EXISTS last_spoke_at TIMESTAMP WITH TIME ZONE;
+
+			UPDATE message_log SET last_spoke_at = updated_at WHERE last_spoke_at IS NULL;
+
+			-- Вступления и выходы участников из служебных сообщений и обновлений chat_member
+			CREATE TABLE IF NOT EXISTS member_events (
+				id BIGSERIAL PRIMARY KEY,
+				chat_id BIGINT NOT NULL,
+				user_id BIGINT NOT NULL,
+				username VARCHAR(255) NOT NULL DEFAULT '',
+				event VARCHAR(16) NOT NULL,
+				source VARCHAR(16) NOT NULL,
+				actor_id BIGINT NOT NULL DEFAULT 0,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_member_events_chat
+			ON member_events (chat_id, created_at);
+		`,
+		DownSQL: `
+			DROP TABLE IF EXISTS member_events;
+			ALTER TABLE message_log DROP COLUMN IF EXISTS last_spoke_at;
+		`,
+	},
+	{
+		Version:     16,
+		Description: "Add chats and chat_pauses tables",
+		UpSQL: `
+			-- Чаты, в которые добавлен бот, и его текущие права в них
+			CREATE TABLE IF NOT EXISTS chats (
+				chat_id BIGINT PRIMARY KEY,
+				title VARCHAR(255) NOT NULL DEFAULT '',
+				bot_status VARCHAR(16) NOT NULL,
+				can_ban BOOLEAN NOT NULL DEFAULT FALSE,
+				added_by BIGINT NOT NULL DEFAULT 0,
+				added_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow'),
+				updated_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+
+			-- Периоды, когда таймеры всего чата стояли: бота удалили или лишили права банить
+			CREATE TABLE IF NOT EXISTS chat_pauses (
+				id BIGSERIAL PRIMARY KEY,
+				chat_id BIGINT NOT NULL,
+				started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				ended_at TIMESTAMP WITH TIME ZONE,
+				reason VARCHAR(32) NOT NULL DEFAULT ''
+			);
+
+			-- У чата может быть только одна открытая пауза
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_pauses_open
+			ON chat_pauses (chat_id) WHERE ended_at IS NULL;
+		`,
+		DownSQL: `
+			DROP TABLE IF EXISTS chat_pauses;
+			DROP TABLE IF EXISTS chats;
+		`,
+	},
+	{
+		Version:     17,
+		Description: "Add forum topic settings to chat_settings",
+		UpSQL: `
+			-- Темы форума: куда принимаются отчеты и куда бот пишет объявления. 0 — тема не задана
+			ALTER TABLE chat_settings
+			ADD COLUMN IF NOT EXISTS report_topic_id INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS announce_topic_id INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS redirect_off_topic_reports INTEGER NOT NULL DEFAULT 1;
+		`,
+		DownSQL: `
+			ALTER TABLE chat_settings
+			DROP COLUMN IF EXISTS report_topic_id,
+			DROP COLUMN IF EXISTS announce_topic_id,
+			DROP COLUMN IF EXISTS redirect_off_topic_reports;
+		`,
+	},
+	{
+		Version:     18,
+		Description: "Add hashtag_aliases table",
+		UpSQL: `
+			-- Псевдонимы служебных хештегов чата: #тренировка -> training_done.
+			-- alias хранится нормализованным: в нижнем регистре, без _ и -
+			CREATE TABLE IF NOT EXISTS hashtag_aliases (
+				chat_id BIGINT NOT NULL,
+				alias VARCHAR(64) NOT NULL,
+				tag VARCHAR(32) NOT NULL,
+				created_by BIGINT NOT NULL DEFAULT 0,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow'),
+				PRIMARY KEY (chat_id, alias)
+			);
+		`,
+		DownSQL: `
+			DROP TABLE IF EXISTS hashtag_aliases;
+		`,
+	},
+	{
+		Version:     19,
+		Description: "Add private_chats table",
+		UpSQL: `
+			-- Участники, которые запустили бота в личке и получают личные напоминания.
+			-- blocked — участник остановил бота, писать ему нельзя до нового /start
+			CREATE TABLE IF NOT EXISTS private_chats (
+				user_id BIGINT PRIMARY KEY,
+				blocked BOOLEAN NOT NULL DEFAULT FALSE,
+				started_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow'),
+				updated_at TIMESTAMP WITH TIME ZONE DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow')
+			);
+		`,
+		DownSQL: `
+			DROP TABLE IF EXISTS private_chats;
+		`,
+	},
+	{
+		Version:     20,
+		Description: "Keep one training report per member and day",
+		UpSQL: `
+			-- Повторные отчеты за день сливаем в первый: теги объединяются, серия берется наибольшая
+			WITH merged AS (
+				SELECT r.user_id, r.chat_id, r.report_date, MIN(r.id) AS keep_id, MAX(r.streak_days) AS streak_days,
+				       COALESCE(ARRAY_AGG(DISTINCT t.tag) FILTER (WHERE t.tag IS NOT NULL), '{}') AS tags
+				FROM training_reports r
+				LEFT JOIN LATERAL UNNEST(r.tags) AS t(tag) ON TRUE
+				GROUP BY r.user_id, r.chat_id, r.report_date
+				HAVING COUNT(DISTINCT r.id) > 1
+			)
+			UPDATE training_reports r
+			SET tags = m.tags, streak_days = m.streak_days
+			FROM merged m
+			WHERE r.id = m.keep_id;
+
+			DELETE FROM training_reports r
+			USING training_reports k
+			WHERE r.user_id = k.user_id AND r.chat_id = k.chat_id AND r.report_date = k.report_date AND r.id > k.id;
+
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_training_reports_day
+			ON training_reports (user_id, chat_id, report_date);
+		`,
+		DownSQL: `
+			DROP INDEX IF EXISTS idx_training_reports_day;
+		`,
+	},
+	{
+		Version:     21,
+		Description: "Drop has_training_done, has_sick_leave and has_healthy flags from message_log",
+		UpSQL: `
+			-- Больничный и выздоровление выводятся из state и отметок sick_leave_*_time
+			ALTER TABLE message_log
+			DROP COLUMN IF EXISTS has_training_done,
+			DROP COLUMN IF EXISTS has_sick_leave,
+			DROP COLUMN IF EXISTS has_healthy;
+		`,
+		DownSQL: `
+			ALTER TABLE message_log
+			ADD COLUMN IF NOT EXISTS has_training_done BOOLEAN DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS has_sick_leave BOOLEAN DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS has_healthy BOOLEAN DEFAULT FALSE;
+		`,
+	},
+	{
+		Version:     22,
+		Description: "Add last_reported_at to training_reports",
+		UpSQL: `
+			-- Время последнего отчета за день: created_at остается временем первого, а челленджи и команды
+			-- засчитывают день, если участник отчитался уже после старта или вступления
+			ALTER TABLE training_reports
+			ADD COLUMN IF NOT EXISTS last_reported_at TIMESTAMP WITH TIME ZONE;
+
+			UPDATE training_reports SET last_reported_at = created_at WHERE last_reported_at IS NULL;
+
+			ALTER TABLE training_reports
+			ALTER COLUMN last_reported_at SET DEFAULT (NOW() AT TIME ZONE 'Europe/Moscow');
+		`,
+		DownSQL: `
+			ALTER TABLE training_reports DROP COLUMN IF EXISTS last_reported_at;
+		`,
+	},
+	{
+		Version:     23,
+		Description: "Store redirect_off_topic_reports as boolean",
+		UpSQL: `
+			-- Подсказка об отчете не в той теме — флаг да/нет, как is_started и is_closed
+			ALTER TABLE chat_settings ALTER COLUMN redirect_off_topic_reports DROP DEFAULT;
+			ALTER TABLE chat_settings
+			ALTER COLUMN redirect_off_topic_reports TYPE BOOLEAN USING redirect_off_topic_reports <> 0;
+			ALTER TABLE chat_settings ALTER COLUMN redirect_off_topic_reports SET DEFAULT TRUE;
+		`,
+		DownSQL: `
+			ALTER TABLE chat_settings ALTER COLUMN redirect_off_topic_reports DROP DEFAULT;
+			ALTER TABLE chat_settings
+			ALTER COLUMN redirect_off_topic_reports TYPE INTEGER USING CASE WHEN redirect_off_topic_reports THEN 1 ELSE 0 END;
+			ALTER TABLE chat_settings ALTER COLUMN redirect_off_topic_reports SET DEFAULT 1;
+		`,
+	},
+	{
+		Version:     24,
+		Description: "Add private_reminder_timer_start to message_log",
+		UpSQL: `
+			-- Отсчет таймера (timer_start_time), за который участнику уже напомнили в личку:
+			-- после перезапуска бота восстановленный таймер не напоминает повторно
+			ALTER TABLE message_log
+			ADD COLUMN IF NOT EXISTS private_reminder_timer_start TEXT;
+		`,
+		DownSQL: `
+			ALTER TABLE message_log DROP COLUMN IF EXISTS private_reminder_timer_start;
+		`,
+	},
 }
 
 // MigrationRecord представляет запись о выполненной миграции
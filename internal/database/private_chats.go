@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"leo-bot/internal/models"
+)
+
+// EnablePrivateChat отмечает, что участник запустил бота в личке и ему можно писать
+func (d *Database) EnablePrivateChat(userID int64) error {
+	query := `
+		INSERT INTO private_chats (user_id, blocked)
+		VALUES ($1, FALSE)
+		ON CONFLICT (user_id) DO UPDATE SET
+			blocked = FALSE,
+			updated_at = (NOW() AT TIME ZONE 'Europe/Moscow')
+	`
+
+	_, err := d.db.Exec(query, userID)
+	return err
+}
+
+// DisablePrivateChat отмечает, что участник остановил бота и писать ему в личку больше нельзя
+func (d *Database) DisablePrivateChat(userID int64) error {
+	query := `
+		UPDATE private_chats
+		SET blocked = TRUE, updated_at = (NOW() AT TIME ZONE 'Europe/Moscow')
+		WHERE user_id = $1
+	`
+
+	_, err := d.db.Exec(query, userID)
+	return err
+}
+
+// IsPrivateChatEnabled сообщает, можно ли писать участнику в личку
+func (d *Database) IsPrivateChatEnabled(userID int64) (bool, error) {
+	var blocked bool
+	err := d.db.QueryRow(`SELECT blocked FROM private_chats WHERE user_id = $1`, userID).Scan(&blocked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !blocked, nil
+}
+
+// MarkPrivateReminderSent отмечает, что за отсчет таймера timerStartTime участнику напомнили в личку.
+// Возвращает false, если за этот отсчет напоминание уже было
+func (d *Database) MarkPrivateReminderSent(userID, chatID int64, timerStartTime string) (bool, error) {
+	query := `
+		UPDATE message_log
+		SET private_reminder_timer_start = $3
+		WHERE user_id = $1 AND chat_id = $2 AND private_reminder_timer_start IS DISTINCT FROM $3
+	`
+
+	result, err := d.db.Exec(query, userID, chatID, timerStartTime)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// GetUserGroups возвращает записи участника во всех группах, где он сейчас состоит
+func (d *Database) GetUserGroups(userID int64) ([]*models.MessageLog, error) {
+	query := `
+		SELECT ` + messageLogColumns + `
+		FROM message_log
+		WHERE user_id = $1 AND chat_id < 0 AND state NOT IN ('removed', 'left')
+		ORDER BY chat_id
+	`
+
+	return d.queryMessageLogs(query, userID)
+}
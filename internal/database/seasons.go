@@ -0,0 +1,174 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"leo-bot/internal/models"
+)
+
+// GetCurrentSeason получает незакрытый сезон чата, который идет в момент now.
+// Если сезона нет, возвращает sql.ErrNoRows
+func (d *Database) GetCurrentSeason(chatID int64, now time.Time) (*models.Season, error) {
+	query := `
+		SELECT id, chat_id, name, starts_at, ends_at, is_closed
+		FROM seasons
+		WHERE chat_id = $1 AND starts_at <= $2 AND ends_at > $2 AND is_closed = FALSE
+		ORDER BY starts_at DESC
+		LIMIT 1
+	`
+
+	var season models.Season
+	err := d.db.QueryRow(query, chatID, now).Scan(
+		&season.ID, &season.ChatID, &season.Name, &season.StartsAt, &season.EndsAt, &season.IsClosed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &season, nil
+}
+
+// GetLastSeasonEnd получает время окончания самого позднего сезона чата
+func (d *Database) GetLastSeasonEnd(chatID int64) (*time.Time, error) {
+	query := `SELECT MAX(ends_at) FROM seasons WHERE chat_id = $1`
+
+	var lastEnd sql.NullTime
+	if err := d.db.QueryRow(query, chatID).Scan(&lastEnd); err != nil {
+		return nil, err
+	}
+	if !lastEnd.Valid {
+		return nil, nil
+	}
+
+	return &lastEnd.Time, nil
+}
+
+// CreateSeason создает новый сезон и заполняет его ID
+func (d *Database) CreateSeason(season *models.Season) error {
+	query := `
+		INSERT INTO seasons (chat_id, name, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	return d.db.QueryRow(query, season.ChatID, season.Name, season.StartsAt, season.EndsAt).Scan(&season.ID)
+}
+
+// SetSeasonEnd переносит окончание сезона (например, при досрочном завершении)
+func (d *Database) SetSeasonEnd(seasonID int64, endsAt time.Time) error {
+	query := `UPDATE seasons SET ends_at = $2 WHERE id = $1`
+	_, err := d.db.Exec(query, seasonID, endsAt)
+	return err
+}
+
+// GetSeasonsToClose получает сезоны, которые уже закончились, но еще не подведены итоги
+func (d *Database) GetSeasonsToClose(now time.Time) ([]*models.Season, error) {
+	query := `
+		SELECT id, chat_id, name, starts_at, ends_at, is_closed
+		FROM seasons
+		WHERE is_closed = FALSE AND ends_at <= $1
+		ORDER BY ends_at ASC
+	`
+
+	rows, err := d.db.Query(query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seasons []*models.Season
+	for rows.Next() {
+		var season models.Season
+		if err := rows.Scan(&season.ID, &season.ChatID, &season.Name, &season.StartsAt, &season.EndsAt, &season.IsClosed); err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, &season)
+	}
+
+	return seasons, rows.Err()
+}
+
+// CloseSeason переносит призеров в зал славы и помечает сезон закрытым одной транзакцией
+func (d *Database) CloseSeason(season *models.Season, winners []*models.LeaderboardEntry) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Защищаемся от повторного закрытия одного и того же сезона
+	result, err := tx.Exec(`UPDATE seasons SET is_closed = TRUE WHERE id = $1 AND is_closed = FALSE`, season.ID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("season %d is already closed", season.ID)
+	}
+
+	insertQuery := `
+		INSERT INTO hall_of_fame (season_id, chat_id, user_id, username, place, points)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	for i, winner := range winners {
+		if _, err := tx.Exec(insertQuery, season.ID, season.ChatID, winner.UserID, winner.Username, i+1, winner.Value); err != nil {
+			return fmt.Errorf("failed to save hall of fame entry: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetHallOfFame получает призеров последних сезонов чата
+func (d *Database) GetHallOfFame(chatID int64, limit int) ([]*models.HallOfFameEntry, error) {
+	query := `
+		SELECT h.season_id, s.name, h.chat_id, h.user_id, h.username, h.place, h.points
+		FROM hall_of_fame h
+		JOIN seasons s ON s.id = h.season_id
+		WHERE h.chat_id = $1
+		ORDER BY s.ends_at DESC, h.place ASC
+		LIMIT $2
+	`
+
+	rows, err := d.db.Query(query, chatID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.HallOfFameEntry
+	for rows.Next() {
+		var entry models.HallOfFameEntry
+		if err := rows.Scan(&entry.SeasonID, &entry.SeasonName, &entry.ChatID, &entry.UserID, &entry.Username, &entry.Place, &entry.Points); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetTrackedChatIDs получает ID всех групповых чатов, в которых бот ведет участников
+func (d *Database) GetTrackedChatIDs() ([]int64, error) {
+	query := `
+		SELECT DISTINCT chat_id FROM message_log
+		WHERE chat_id < 0 AND state NOT IN ('removed', 'left')
+	`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chatIDs []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, err
+		}
+		chatIDs = append(chatIDs, chatID)
+	}
+
+	return chatIDs, rows.Err()
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"leo-bot/internal/models"
+	"leo-bot/internal/utils"
+)
+
+// GetChatSettings получает настройки чата. Если чат ничего не настраивал, возвращает значения по умолчанию
+func (d *Database) GetChatSettings(chatID int64) (*models.ChatSettings, error) {
+	query := `
+		SELECT chat_id, sick_days_per_year, max_sick_leave_days, sick_reminder_interval_days,
+			vacation_days_per_year, max_vacation_days, report_topic_id, announce_topic_id, redirect_off_topic_reports
+		FROM chat_settings
+		WHERE chat_id = $1
+	`
+
+	settings := &models.ChatSettings{
+		ChatID:                   chatID,
+		SickDaysPerYear:          models.DefaultSickDaysPerYear,
+		MaxSickLeaveDays:         models.DefaultMaxSickLeaveDays,
+		SickReminderIntervalDays: models.DefaultSickReminderIntervalDays,
+		VacationDaysPerYear:      models.DefaultVacationDaysPerYear,
+		MaxVacationDays:          models.DefaultMaxVacationDays,
+		RedirectOffTopicReports:  models.DefaultRedirectOffTopicReports,
+	}
+	err := d.db.QueryRow(query, chatID).Scan(
+		&settings.ChatID, &settings.SickDaysPerYear, &settings.MaxSickLeaveDays, &settings.SickReminderIntervalDays,
+		&settings.VacationDaysPerYear, &settings.MaxVacationDays, &settings.ReportTopicID, &settings.AnnounceTopicID,
+		&settings.RedirectOffTopicReports)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// SaveChatSettings сохраняет настройки чата
+func (d *Database) SaveChatSettings(settings *models.ChatSettings) error {
+	query := `
+		INSERT INTO chat_settings (chat_id, sick_days_per_year, max_sick_leave_days, sick_reminder_interval_days,
+			vacation_days_per_year, max_vacation_days, report_topic_id, announce_topic_id, redirect_off_topic_reports, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (chat_id) DO UPDATE SET
+			sick_days_per_year = EXCLUDED.sick_days_per_year,
+			max_sick_leave_days = EXCLUDED.max_sick_leave_days,
+			sick_reminder_interval_days = EXCLUDED.sick_reminder_interval_days,
+			vacation_days_per_year = EXCLUDED.vacation_days_per_year,
+			max_vacation_days = EXCLUDED.max_vacation_days,
+			report_topic_id = EXCLUDED.report_topic_id,
+			announce_topic_id = EXCLUDED.announce_topic_id,
+			redirect_off_topic_reports = EXCLUDED.redirect_off_topic_reports,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	// Используем московское время
+	moscowTime := utils.FormatMoscowTime(utils.GetMoscowTime())
+	_, err := d.db.Exec(query, settings.ChatID, settings.SickDaysPerYear, settings.MaxSickLeaveDays,
+		settings.SickReminderIntervalDays, settings.VacationDaysPerYear, settings.MaxVacationDays,
+		settings.ReportTopicID, settings.AnnounceTopicID, settings.RedirectOffTopicReports, moscowTime)
+	return err
+}
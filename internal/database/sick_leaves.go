@@ -0,0 +1,127 @@
+package database
+
+import (
+	"time"
+
+	"leo-bot/internal/models"
+)
+
+// StartSickLeave открывает новый эпизод больничного и заполняет его ID
+func (d *Database) StartSickLeave(leave *models.SickLeave) error {
+	query := `
+		INSERT INTO sick_leaves (user_id, chat_id, started_at, reason)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	return d.db.QueryRow(query, leave.UserID, leave.ChatID, leave.StartedAt, leave.Reason).Scan(&leave.ID)
+}
+
+// EndSickLeave закрывает открытый эпизод больничного участника.
+// Возвращает false, если открытого эпизода не было
+func (d *Database) EndSickLeave(userID, chatID int64, endedAt time.Time) (bool, error) {
+	query := `
+		UPDATE sick_leaves
+		SET ended_at = $3, duration_seconds = EXTRACT(EPOCH FROM $3 - started_at)::BIGINT
+		WHERE user_id = $1 AND chat_id = $2 AND ended_at IS NULL
+	`
+
+	result, err := d.db.Exec(query, userID, chatID, endedAt)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// GetSickLeaveUsage считает, сколько времени участник провел на больничном в интервале [since, now).
+// Открытый эпизод считается до now, эпизоды на границе интервала обрезаются
+func (d *Database) GetSickLeaveUsage(userID, chatID int64, since, now time.Time) (time.Duration, error) {
+	query := `
+		SELECT COALESCE(SUM(EXTRACT(EPOCH FROM
+			LEAST(COALESCE(ended_at, $4), $4) - GREATEST(started_at, $3)
+		)), 0)::BIGINT
+		FROM sick_leaves
+		WHERE user_id = $1 AND chat_id = $2
+			AND started_at < $4 AND COALESCE(ended_at, $4) > $3
+	`
+
+	var seconds int64
+	if err := d.db.QueryRow(query, userID, chatID, since, now).Scan(&seconds); err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// GetOpenSickLeaves получает все незакрытые больничные во всех чатах
+func (d *Database) GetOpenSickLeaves() ([]*models.SickLeave, error) {
+	query := `
+		SELECT id, user_id, chat_id, started_at, reason, last_reminded_at
+		FROM sick_leaves
+		WHERE ended_at IS NULL
+		ORDER BY started_at ASC
+	`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leaves []*models.SickLeave
+	for rows.Next() {
+		var leave models.SickLeave
+		if err := rows.Scan(&leave.ID, &leave.UserID, &leave.ChatID, &leave.StartedAt, &leave.Reason, &leave.LastRemindedAt); err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, &leave)
+	}
+
+	return leaves, rows.Err()
+}
+
+// MarkSickLeaveReminded запоминает время последнего напоминания о больничном
+func (d *Database) MarkSickLeaveReminded(sickLeaveID int64, remindedAt time.Time) error {
+	_, err := d.db.Exec(`UPDATE sick_leaves SET last_reminded_at = $2 WHERE id = $1`, sickLeaveID, remindedAt)
+	return err
+}
+
+// GetSickLeavesEndingAfter получает больничные участника, которые не закончились к моменту after (включая открытый)
+func (d *Database) GetSickLeavesEndingAfter(userID, chatID int64, after time.Time) ([]*models.SickLeave, error) {
+	query := `
+		SELECT id, user_id, chat_id, started_at, ended_at, reason
+		FROM sick_leaves
+		WHERE user_id = $1 AND chat_id = $2 AND (ended_at IS NULL OR ended_at > $3)
+		ORDER BY started_at ASC
+	`
+
+	rows, err := d.db.Query(query, userID, chatID, after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leaves []*models.SickLeave
+	for rows.Next() {
+		var leave models.SickLeave
+		if err := rows.Scan(&leave.ID, &leave.UserID, &leave.ChatID, &leave.StartedAt, &leave.EndedAt, &leave.Reason); err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, &leave)
+	}
+
+	return leaves, rows.Err()
+}
+
+// ClearSickLeaveMarks сбрасывает отметки больничного в message_log, когда начинается новый отсчет таймера
+func (d *Database) ClearSickLeaveMarks(userID, chatID int64) error {
+	query := `
+		UPDATE message_log
+		SET sick_leave_start_time = NULL, sick_leave_end_time = NULL
+		WHERE user_id = $1 AND chat_id = $2
+	`
+
+	_, err := d.db.Exec(query, userID, chatID)
+	return err
+}
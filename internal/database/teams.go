@@ -0,0 +1,178 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"leo-bot/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrTeamExists возвращается, если в чате уже есть команда с таким названием
+var ErrTeamExists = errors.New("team already exists")
+
+// CreateTeam создает команду в чате и заполняет ее ID
+func (d *Database) CreateTeam(team *models.Team) error {
+	query := `
+		INSERT INTO teams (chat_id, name, created_by, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	err := d.db.QueryRow(query, team.ChatID, team.Name, team.CreatedBy, team.CreatedAt).Scan(&team.ID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrTeamExists
+	}
+	return err
+}
+
+// DeleteTeam удаляет команду чата по названию (участники удаляются каскадно).
+// Возвращает false, если такой команды нет
+func (d *Database) DeleteTeam(chatID int64, name string) (bool, error) {
+	result, err := d.db.Exec(`DELETE FROM teams WHERE chat_id = $1 AND LOWER(name) = LOWER($2)`, chatID, name)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// GetTeamByName получает команду чата по названию без учета регистра.
+// Если команды нет, возвращает sql.ErrNoRows
+func (d *Database) GetTeamByName(chatID int64, name string) (*models.Team, error) {
+	query := `
+		SELECT id, chat_id, name, created_by, created_at
+		FROM teams
+		WHERE chat_id = $1 AND LOWER(name) = LOWER($2)
+	`
+
+	var team models.Team
+	err := d.db.QueryRow(query, chatID, name).Scan(&team.ID, &team.ChatID, &team.Name, &team.CreatedBy, &team.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+// GetUserTeam получает команду, в которой состоит участник.
+// Если участник не в команде, возвращает sql.ErrNoRows
+func (d *Database) GetUserTeam(chatID, userID int64) (*models.Team, error) {
+	query := `
+		SELECT t.id, t.chat_id, t.name, t.created_by, t.created_at
+		FROM team_members tm
+		JOIN teams t ON t.id = tm.team_id
+		WHERE tm.chat_id = $1 AND tm.user_id = $2
+	`
+
+	var team models.Team
+	err := d.db.QueryRow(query, chatID, userID).Scan(&team.ID, &team.ChatID, &team.Name, &team.CreatedBy, &team.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+// SetTeamMember записывает участника в команду, переводя его из прежней, если он там был
+func (d *Database) SetTeamMember(chatID, userID, teamID int64, joinedAt time.Time) error {
+	query := `
+		INSERT INTO team_members (chat_id, user_id, team_id, joined_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (chat_id, user_id) DO UPDATE SET
+			team_id = EXCLUDED.team_id,
+			joined_at = EXCLUDED.joined_at
+		WHERE team_members.team_id <> EXCLUDED.team_id
+	`
+
+	_, err := d.db.Exec(query, chatID, userID, teamID, joinedAt)
+	return err
+}
+
+// RemoveTeamMember исключает участника из команды. Возвращает false, если он ни в какой не состоял
+func (d *Database) RemoveTeamMember(chatID, userID int64) (bool, error) {
+	result, err := d.db.Exec(`DELETE FROM team_members WHERE chat_id = $1 AND user_id = $2`, chatID, userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// GetTeamLeaderboard строит командный зачет за период [since, until).
+// Команде засчитываются дни, в которые участник отчитался после вступления в нее (по последнему
+// отчету за день), поэтому переход в другую команду не переносит чужие тренировки. Ушедшие из чата
+// и удаленные участники не считаются ни в составе, ни в тренировках
+func (d *Database) GetTeamLeaderboard(chatID int64, since, until time.Time) ([]*models.TeamStanding, error) {
+	query := `
+		SELECT t.id, t.name, COUNT(DISTINCT tm.user_id) AS members, COUNT(r.id) AS trainings
+		FROM teams t
+		LEFT JOIN (
+			SELECT tm.team_id, tm.user_id, tm.joined_at
+			FROM team_members tm
+			JOIN message_log m ON m.user_id = tm.user_id AND m.chat_id = tm.chat_id
+			WHERE m.state NOT IN ('removed', 'left')
+		) tm ON tm.team_id = t.id
+		LEFT JOIN training_reports r ON r.chat_id = t.chat_id AND r.user_id = tm.user_id
+			AND r.last_reported_at >= tm.joined_at AND r.created_at >= $2 AND r.created_at < $3
+		WHERE t.chat_id = $1
+		GROUP BY t.id, t.name
+		ORDER BY trainings DESC, members ASC, t.name ASC
+	`
+
+	rows, err := d.db.Query(query, chatID, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var standings []*models.TeamStanding
+	for rows.Next() {
+		var standing models.TeamStanding
+		if err := rows.Scan(&standing.TeamID, &standing.Name, &standing.Members, &standing.Trainings); err != nil {
+			return nil, err
+		}
+		standings = append(standings, &standing)
+	}
+
+	return standings, rows.Err()
+}
+
+// GetChatIDsWithTeams получает ID чатов, в которых есть хотя бы одна команда
+func (d *Database) GetChatIDsWithTeams() ([]int64, error) {
+	rows, err := d.db.Query(`SELECT DISTINCT chat_id FROM teams`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chatIDs []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, err
+		}
+		chatIDs = append(chatIDs, chatID)
+	}
+
+	return chatIDs, rows.Err()
+}
+
+// MarkTeamWeekPosted отмечает, что итоги недели опубликованы.
+// Возвращает false, если итоги этой недели уже были отмечены раньше
+func (d *Database) MarkTeamWeekPosted(chatID int64, weekStart, postedAt time.Time) (bool, error) {
+	query := `
+		INSERT INTO team_weekly_results (chat_id, week_start, posted_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (chat_id, week_start) DO NOTHING
+	`
+
+	result, err := d.db.Exec(query, chatID, weekStart.Format("2006-01-02"), postedAt)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"time"
+
+	"leo-bot/internal/models"
+)
+
+const vacationColumns = `id, user_id, chat_id, starts_at, ends_at, is_started, is_finished`
+
+// queryVacations выполняет запрос, возвращающий колонки vacationColumns
+func (d *Database) queryVacations(query string, args ...interface{}) ([]*models.Vacation, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vacations []*models.Vacation
+	for rows.Next() {
+		var v models.Vacation
+		if err := rows.Scan(&v.ID, &v.UserID, &v.ChatID, &v.StartsAt, &v.EndsAt, &v.IsStarted, &v.IsFinished); err != nil {
+			return nil, err
+		}
+		vacations = append(vacations, &v)
+	}
+
+	return vacations, rows.Err()
+}
+
+// CreateVacation сохраняет запланированный отпуск и заполняет его ID
+func (d *Database) CreateVacation(v *models.Vacation) error {
+	query := `
+		INSERT INTO vacations (user_id, chat_id, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	return d.db.QueryRow(query, v.UserID, v.ChatID, v.StartsAt, v.EndsAt).Scan(&v.ID)
+}
+
+// HasOverlappingVacation проверяет, пересекается ли интервал [startsAt, endsAt) с другими отпусками участника
+func (d *Database) HasOverlappingVacation(userID, chatID int64, startsAt, endsAt time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM vacations
+			WHERE user_id = $1 AND chat_id = $2 AND starts_at < $4 AND ends_at > $3
+		)
+	`
+
+	var exists bool
+	err := d.db.QueryRow(query, userID, chatID, startsAt, endsAt).Scan(&exists)
+	return exists, err
+}
+
+// GetVacationDaysUsed считает дни отпусков участника, начинающихся в интервале [since, until)
+func (d *Database) GetVacationDaysUsed(userID, chatID int64, since, until time.Time) (int, error) {
+	query := `
+		SELECT COALESCE(SUM(CEIL(EXTRACT(EPOCH FROM ends_at - starts_at) / 86400)), 0)::INTEGER
+		FROM vacations
+		WHERE user_id = $1 AND chat_id = $2 AND starts_at >= $3 AND starts_at < $4
+	`
+
+	var days int
+	err := d.db.QueryRow(query, userID, chatID, since, until).Scan(&days)
+	return days, err
+}
+
+// GetVacationsEndingAfter получает отпуска участника, которые заканчиваются позже after:
+// при after = now это идущие и будущие отпуска, при after = старт таймера — паузы текущего таймера
+func (d *Database) GetVacationsEndingAfter(userID, chatID int64, after time.Time) ([]*models.Vacation, error) {
+	query := `
+		SELECT ` + vacationColumns + `
+		FROM vacations
+		WHERE user_id = $1 AND chat_id = $2 AND ends_at > $3
+		ORDER BY starts_at ASC
+	`
+
+	return d.queryVacations(query, userID, chatID, after)
+}
+
+// GetActiveVacation получает отпуск участника, идущий в момент now.
+// Возвращает sql.ErrNoRows, если участник не в отпуске
+func (d *Database) GetActiveVacation(userID, chatID int64, now time.Time) (*models.Vacation, error) {
+	query := `
+		SELECT ` + vacationColumns + `
+		FROM vacations
+		WHERE user_id = $1 AND chat_id = $2 AND starts_at <= $3 AND ends_at > $3
+		ORDER BY starts_at ASC
+		LIMIT 1
+	`
+
+	var v models.Vacation
+	err := d.db.QueryRow(query, userID, chatID, now).Scan(&v.ID, &v.UserID, &v.ChatID, &v.StartsAt, &v.EndsAt, &v.IsStarted, &v.IsFinished)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// GetVacationsToStart получает отпуска, которые уже начались, но бот еще не остановил таймер
+func (d *Database) GetVacationsToStart(now time.Time) ([]*models.Vacation, error) {
+	query := `
+		SELECT ` + vacationColumns + `
+		FROM vacations
+		WHERE is_started = FALSE AND starts_at <= $1 AND ends_at > $1
+		ORDER BY starts_at ASC
+	`
+
+	return d.queryVacations(query, now)
+}
+
+// GetVacationsToFinish получает закончившиеся отпуска, после которых таймер еще не возобновлен
+func (d *Database) GetVacationsToFinish(now time.Time) ([]*models.Vacation, error) {
+	query := `
+		SELECT ` + vacationColumns + `
+		FROM vacations
+		WHERE is_finished = FALSE AND ends_at <= $1
+		ORDER BY ends_at ASC
+	`
+
+	return d.queryVacations(query, now)
+}
+
+// MarkVacationStarted отмечает начало отпуска. Возвращает false, если его уже отметили
+func (d *Database) MarkVacationStarted(vacationID int64) (bool, error) {
+	result, err := d.db.Exec(`UPDATE vacations SET is_started = TRUE WHERE id = $1 AND is_started = FALSE`, vacationID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// MarkVacationFinished отмечает окончание отпуска. Возвращает false, если его уже отметили
+func (d *Database) MarkVacationFinished(vacationID int64) (bool, error) {
+	result, err := d.db.Exec(`
+		UPDATE vacations SET is_started = TRUE, is_finished = TRUE
+		WHERE id = $1 AND is_finished = FALSE
+	`, vacationID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// DeleteVacation удаляет еще не начавшийся отпуск
+func (d *Database) DeleteVacation(vacationID int64) error {
+	_, err := d.db.Exec(`DELETE FROM vacations WHERE id = $1 AND is_started = FALSE`, vacationID)
+	return err
+}
+
+// SetVacationEnd переносит окончание отпуска (например, при досрочном возвращении)
+func (d *Database) SetVacationEnd(vacationID int64, endsAt time.Time) error {
+	_, err := d.db.Exec(`UPDATE vacations SET ends_at = $2 WHERE id = $1`, vacationID, endsAt)
+	return err
+}
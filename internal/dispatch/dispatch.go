@@ -0,0 +1,157 @@
+// Package dispatch — ограниченный пул обработчиков обновлений. Задачи с одним ключом (чат и участник)
+// выполняются строго по очереди, разные ключи — параллельно не более чем в workers горутинах.
+// Когда ждущих задач становится слишком много, Submit блокируется, и бот перестает забирать новые обновления
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sync"
+
+	"leo-bot/internal/logger"
+)
+
+// ErrClosed — диспетчер остановлен и новые задачи не принимает
+var ErrClosed = errors.New("dispatcher is closed")
+
+// Key — задачи с одинаковым ключом не выполняются одновременно и идут в порядке поступления
+type Key struct {
+	ChatID int64
+	UserID int64
+}
+
+// keyQueue — задачи одного ключа. scheduled — ключ уже стоит в очереди воркеров или выполняется
+type keyQueue struct {
+	tasks     []func()
+	scheduled bool
+}
+
+// Dispatcher — пул воркеров с упорядочиванием по ключу
+type Dispatcher struct {
+	logger logger.Logger
+
+	// slots ограничивает число принятых, но еще не выполненных задач
+	slots chan struct{}
+	// ready — ключи, у которых есть задачи и которые сейчас никто не выполняет
+	ready chan Key
+
+	mu     sync.Mutex
+	queues map[Key]*keyQueue
+	closed bool
+
+	pending sync.WaitGroup
+	workers sync.WaitGroup
+}
+
+// New запускает workers воркеров. maxPending — сколько задач может ждать выполнения, прежде чем Submit заблокируется
+func New(workers, maxPending int, log logger.Logger) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxPending < workers {
+		maxPending = workers
+	}
+
+	d := &Dispatcher{
+		logger: log,
+		slots:  make(chan struct{}, maxPending),
+		// Ключей в очереди не больше, чем задач, поэтому запись в ready никогда не блокируется
+		ready:  make(chan Key, maxPending),
+		queues: make(map[Key]*keyQueue),
+	}
+	d.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// Submit ставит задачу в очередь ключа. Если очередь диспетчера заполнена, ждет свободного места
+// или отмены контекста
+func (d *Dispatcher) Submit(ctx context.Context, key Key, task func()) error {
+	select {
+	case d.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		<-d.slots
+		return ErrClosed
+	}
+
+	queue, ok := d.queues[key]
+	if !ok {
+		queue = &keyQueue{}
+		d.queues[key] = queue
+	}
+	queue.tasks = append(queue.tasks, task)
+	d.pending.Add(1)
+	if !queue.scheduled {
+		queue.scheduled = true
+		d.ready <- key
+	}
+	return nil
+}
+
+// Pending возвращает число принятых, но еще не выполненных задач
+func (d *Dispatcher) Pending() int {
+	return len(d.slots)
+}
+
+// Close перестает принимать задачи, дожидается выполнения уже принятых и останавливает воркеров
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		d.workers.Wait()
+		return
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	d.pending.Wait()
+	close(d.ready)
+	d.workers.Wait()
+}
+
+// work выполняет по одной задаче ключа и возвращает ключ в конец очереди, чтобы один активный участник
+// не занимал воркера надолго
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+
+	for key := range d.ready {
+		d.mu.Lock()
+		queue := d.queues[key]
+		task := queue.tasks[0]
+		queue.tasks = queue.tasks[1:]
+		d.mu.Unlock()
+
+		d.run(key, task)
+
+		d.mu.Lock()
+		if len(queue.tasks) == 0 {
+			delete(d.queues, key)
+		} else {
+			d.ready <- key
+		}
+		d.mu.Unlock()
+
+		<-d.slots
+		d.pending.Done()
+	}
+}
+
+// run выполняет задачу. Паника в обработчике одного обновления не должна останавливать бота
+func (d *Dispatcher) run(key Key, task func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.logger.Errorf("Dispatch: task for chat %d user %d panicked: %v\n%s", key.ChatID, key.UserID, r, debug.Stack())
+		}
+	}()
+	task()
+}
@@ -0,0 +1,165 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"leo-bot/internal/logger"
+)
+
+func newTestDispatcher(workers, maxPending int) *Dispatcher {
+	return New(workers, maxPending, logger.New("error"))
+}
+
+func TestDispatcherPreservesOrderPerKey(t *testing.T) {
+	d := newTestDispatcher(4, 100)
+
+	var mu sync.Mutex
+	order := make(map[Key][]int)
+	keys := []Key{{ChatID: -100, UserID: 1}, {ChatID: -100, UserID: 2}, {ChatID: -200, UserID: 1}}
+	for i := 0; i < 20; i++ {
+		for _, key := range keys {
+			key, i := key, i
+			err := d.Submit(context.Background(), key, func() {
+				// Задержка дает шанс следующей задаче того же ключа обогнать эту, если порядок не соблюдается
+				time.Sleep(time.Duration(20-i) * 100 * time.Microsecond)
+				mu.Lock()
+				order[key] = append(order[key], i)
+				mu.Unlock()
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+	}
+	d.Close()
+
+	for _, key := range keys {
+		if len(order[key]) != 20 {
+			t.Fatalf("Expected 20 tasks for %+v, got %d", key, len(order[key]))
+		}
+		for i, got := range order[key] {
+			if got != i {
+				t.Fatalf("Tasks of %+v reordered: %v", key, order[key])
+			}
+		}
+	}
+}
+
+func TestDispatcherSerialisesSameKey(t *testing.T) {
+	d := newTestDispatcher(8, 100)
+
+	var running, overlaps int32
+	key := Key{ChatID: -100, UserID: 1}
+	for i := 0; i < 30; i++ {
+		d.Submit(context.Background(), key, func() {
+			if atomic.AddInt32(&running, 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		})
+	}
+	d.Close()
+
+	if overlaps != 0 {
+		t.Errorf("Tasks of one key ran concurrently %d times", overlaps)
+	}
+}
+
+func TestDispatcherBoundsWorkers(t *testing.T) {
+	d := newTestDispatcher(3, 100)
+
+	var running, peak int32
+	for i := 0; i < 30; i++ {
+		d.Submit(context.Background(), Key{ChatID: -100, UserID: int64(i)}, func() {
+			now := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		})
+	}
+	d.Close()
+
+	if peak > 3 {
+		t.Errorf("Expected at most 3 concurrent tasks, got %d", peak)
+	}
+	if peak < 2 {
+		t.Errorf("Expected different keys to run in parallel, peak %d", peak)
+	}
+}
+
+func TestDispatcherBackpressure(t *testing.T) {
+	d := newTestDispatcher(1, 2)
+
+	release := make(chan struct{})
+	block := func() { <-release }
+	for i := 0; i < 2; i++ {
+		if err := d.Submit(context.Background(), Key{UserID: int64(i)}, block); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if pending := d.Pending(); pending != 2 {
+		t.Errorf("Expected 2 pending tasks, got %d", pending)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := d.Submit(ctx, Key{UserID: 3}, func() {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Submit to block while the queue is full, got %v", err)
+	}
+
+	close(release)
+	if err := d.Submit(context.Background(), Key{UserID: 3}, func() {}); err != nil {
+		t.Errorf("Expected Submit to succeed after tasks finished, got %v", err)
+	}
+	d.Close()
+}
+
+func TestDispatcherCloseDrains(t *testing.T) {
+	d := newTestDispatcher(2, 100)
+
+	var done int32
+	for i := 0; i < 10; i++ {
+		d.Submit(context.Background(), Key{ChatID: -100, UserID: int64(i % 3)}, func() {
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&done, 1)
+		})
+	}
+	d.Close()
+
+	if done != 10 {
+		t.Errorf("Expected all 10 tasks to finish before Close returns, got %d", done)
+	}
+	if err := d.Submit(context.Background(), Key{}, func() {}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+	if pending := d.Pending(); pending != 0 {
+		t.Errorf("Expected no pending tasks, got %d", pending)
+	}
+	// Повторный Close не блокируется и не паникует
+	d.Close()
+}
+
+func TestDispatcherRecoversPanics(t *testing.T) {
+	d := newTestDispatcher(1, 10)
+
+	var after int32
+	key := Key{ChatID: -100, UserID: 1}
+	d.Submit(context.Background(), key, func() { panic("handler bug") })
+	d.Submit(context.Background(), key, func() { atomic.AddInt32(&after, 1) })
+	d.Close()
+
+	if after != 1 {
+		t.Error("Expected the next task to run after a panic")
+	}
+}
@@ -0,0 +1,203 @@
+// Package hashtags — распознавание служебных хештегов бота. Хештеги берутся из сущностей Telegram,
+// а не поиском подстроки, поэтому #training_done_not не считается отчетом. Написание без разделителей
+// (#trainingdone, #training-done) и псевдонимы чата (#тренировка) приводятся к командам, а для опечаток
+// вроде #traning_done подбирается ближайшая команда по расстоянию Левенштейна
+package hashtags
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Служебные хештеги бота
+const (
+	TrainingDone = "training_done"
+	SickLeave    = "sick_leave"
+	Healthy      = "healthy"
+	Change       = "change"
+	Kudos        = "kudos"
+	Vacation     = "vacation"
+)
+
+// Commands — все служебные хештеги
+var Commands = []string{TrainingDone, SickLeave, Healthy, Change, Kudos, Vacation}
+
+// DefaultAliases — русские хештеги, которые понимает любой чат. Псевдонимы чата их дополняют и переопределяют
+var DefaultAliases = map[string]string{
+	"тренировка": TrainingDone,
+	"больничный": SickLeave,
+	"здоров":     Healthy,
+	"обмен":      Change,
+	"кудос":      Kudos,
+	"отпуск":     Vacation,
+}
+
+// IsCommand проверяет, что тег — служебный хештег бота
+func IsCommand(tag string) bool {
+	for _, command := range Commands {
+		if command == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize приводит хештег к виду для сравнения: без #, в нижнем регистре, без _ и -
+func Normalize(tag string) string {
+	tag = strings.TrimPrefix(strings.ToLower(tag), "#")
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' {
+			return -1
+		}
+		return r
+	}, tag)
+}
+
+// Extract возвращает хештеги сообщения по сущностям Telegram: в нижнем регистре, без # и без повторов.
+// Telegram обрывает хештег на дефисе, поэтому #training-done склеивается обратно в training-done
+func Extract(text string, entities []tgbotapi.MessageEntity) []string {
+	units := utf16.Encode([]rune(text))
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, entity := range entities {
+		if entity.Type != "hashtag" || entity.Offset < 0 || entity.Length <= 1 || entity.Offset+entity.Length > len(units) {
+			continue
+		}
+
+		end := entity.Offset + entity.Length
+		for end+1 < len(units) && units[end] == '-' && isTagChar(units[end+1]) {
+			end++
+			for end < len(units) && isTagChar(units[end]) {
+				end++
+			}
+		}
+
+		tag := strings.ToLower(string(utf16.Decode(units[entity.Offset+1 : end])))
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Parse разбирает слово команды вроде /challenge create … #Run как один хештег: в нижнем регистре и без #,
+// по тем же правилам, что и Extract, включая части через дефис (#training-done)
+func Parse(word string) (string, bool) {
+	units := utf16.Encode([]rune(word))
+	if len(units) < 2 || units[0] != '#' {
+		return "", false
+	}
+
+	for i := 1; i < len(units); i++ {
+		if isTagChar(units[i]) {
+			continue
+		}
+		// Дефис допустим только между частями хештега
+		if units[i] != '-' || i == 1 || i+1 == len(units) || !isTagChar(units[i+1]) {
+			return "", false
+		}
+	}
+	return strings.ToLower(string(utf16.Decode(units[1:]))), true
+}
+
+// isTagChar проверяет, может ли символ UTF-16 быть частью хештега
+func isTagChar(unit uint16) bool {
+	r := rune(unit)
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Resolver сопоставляет хештеги с командами с учетом псевдонимов чата
+type Resolver struct {
+	// names — нормализованное написание -> команда
+	names map[string]string
+}
+
+// NewResolver создает сопоставитель с командами, псевдонимами по умолчанию и псевдонимами чата
+func NewResolver(chatAliases map[string]string) *Resolver {
+	r := &Resolver{names: make(map[string]string)}
+	for _, command := range Commands {
+		r.names[Normalize(command)] = command
+	}
+	for alias, command := range DefaultAliases {
+		r.names[Normalize(alias)] = command
+	}
+	for alias, command := range chatAliases {
+		r.names[Normalize(alias)] = command
+	}
+	return r
+}
+
+// Resolve возвращает команду, которой соответствует хештег
+func (r *Resolver) Resolve(tag string) (string, bool) {
+	command, ok := r.names[Normalize(tag)]
+	return command, ok
+}
+
+// Suggest подбирает команду, на которую хештег похож, но не совпадает: #traning_done -> training_done.
+// Короткие хештеги не исправляются, чтобы #run или #yoga не превращались в команды
+func (r *Resolver) Suggest(tag string) (string, bool) {
+	norm := Normalize(tag)
+	if _, ok := r.names[norm]; ok {
+		return "", false
+	}
+	limit := maxDistance(len([]rune(norm)))
+	if limit == 0 {
+		return "", false
+	}
+
+	// Перебор в фиксированном порядке, чтобы при равных расстояниях подсказка не менялась
+	names := make([]string, 0, len(r.names))
+	for name := range r.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	best, bestDistance := "", limit+1
+	for _, name := range names {
+		if d := Distance(norm, name); d < bestDistance {
+			best, bestDistance = r.names[name], d
+		}
+	}
+	return best, best != ""
+}
+
+// maxDistance — сколько опечаток допускается в хештеге такой длины
+func maxDistance(length int) int {
+	switch {
+	case length < 4:
+		return 0
+	case length < 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Distance считает расстояние Левенштейна между строками по символам
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,186 @@
+package hashtags
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// hashtagEntities размечает хештеги так же, как Telegram: до первого символа, который не буква, цифра или _
+func hashtagEntities(text string) []tgbotapi.MessageEntity {
+	units := utf16.Encode([]rune(text))
+	var entities []tgbotapi.MessageEntity
+	for i := 0; i < len(units); i++ {
+		if units[i] != '#' {
+			continue
+		}
+		j := i + 1
+		for j < len(units) && isTagChar(units[j]) {
+			j++
+		}
+		if j > i+1 {
+			entities = append(entities, tgbotapi.MessageEntity{Type: "hashtag", Offset: i, Length: j - i})
+		}
+		i = j - 1
+	}
+	return entities
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"#training_done", []string{"training_done"}},
+		{"🏃 Пробежка 5 км #Training_Done #run #RUN", []string{"training_done", "run"}},
+		{"#training-done сегодня", []string{"training-done"}},
+		{"#тренировка и #йога", []string{"тренировка", "йога"}},
+		{"#training_done_not", []string{"training_done_not"}},
+		{"без тегов, но слово training_done", nil},
+		{"# и #- не теги", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := Extract(tt.text, hashtagEntities(tt.text)); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Extract(%q) = %v, expected %v", tt.text, got, tt.expected)
+			}
+		})
+	}
+
+	// Подстрока без сущности не считается хештегом — например, в коде или ссылке
+	if got := Extract("https://example.com/#training_done", nil); got != nil {
+		t.Errorf("Expected no hashtags without entities, got %v", got)
+	}
+
+	// Некорректные смещения не ломают разбор
+	bad := []tgbotapi.MessageEntity{{Type: "hashtag", Offset: 10, Length: 20}, {Type: "mention", Offset: 0, Length: 3}}
+	if got := Extract("#run", bad); got != nil {
+		t.Errorf("Expected invalid entities to be skipped, got %v", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		word     string
+		expected string
+		ok       bool
+	}{
+		{"#Run", "run", true},
+		{"#йога", "йога", true},
+		{"#training-done", "training-done", true},
+		{"#trail_run_10k", "trail_run_10k", true},
+		{"run", "", false},
+		{"#", "", false},
+		{"#run!", "", false},
+		{"#-run", "", false},
+		{"#run-", "", false},
+		{"#run--fast", "", false},
+		{"#run#yoga", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			got, ok := Parse(tt.word)
+			if got != tt.expected || ok != tt.ok {
+				t.Errorf("Parse(%q) = %q, %t, expected %q, %t", tt.word, got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := NewResolver(map[string]string{"трен": TrainingDone, "заболел": SickLeave})
+
+	tests := []struct {
+		tag      string
+		expected string
+		ok       bool
+	}{
+		{"training_done", TrainingDone, true},
+		{"trainingdone", TrainingDone, true},
+		{"training-done", TrainingDone, true},
+		{"TRAINING_DONE", TrainingDone, true},
+		{"тренировка", TrainingDone, true},
+		{"трен", TrainingDone, true},
+		{"заболел", SickLeave, true},
+		{"sick_leave", SickLeave, true},
+		{"training_done_not", "", false},
+		{"traning_done", "", false},
+		{"run", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, ok := r.Resolve(tt.tag)
+			if got != tt.expected || ok != tt.ok {
+				t.Errorf("Resolve(%q) = %q, %v, expected %q, %v", tt.tag, got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	r := NewResolver(nil)
+
+	tests := []struct {
+		tag      string
+		expected string
+		ok       bool
+	}{
+		{"traning_done", TrainingDone, true},
+		{"trainig_done", TrainingDone, true},
+		{"sick_leav", SickLeave, true},
+		{"helthy", Healthy, true},
+		{"тренеровка", TrainingDone, true},
+		{"kudoss", Kudos, true},
+		// Совпадения не исправляются
+		{"training_done", "", false},
+		// Слишком далеко от команд
+		{"training_done_not", "", false},
+		{"training", "", false},
+		// Короткие теги челленджей не превращаются в команды
+		{"run", "", false},
+		{"yoga", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, ok := r.Suggest(tt.tag)
+			if got != tt.expected || ok != tt.ok {
+				t.Errorf("Suggest(%q) = %q, %v, expected %q, %v", tt.tag, got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"trainingdone", "traningdone", 1},
+		{"тренировка", "тренеровка", 1},
+		{"healthy", "healthy", 0},
+	}
+
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Distance(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got := Normalize("#Training-Done_"); got != "trainingdone" {
+		t.Errorf("Expected trainingdone, got %q", got)
+	}
+	if !IsCommand(TrainingDone) || IsCommand("trainingdone") {
+		t.Error("IsCommand must match exact command names only")
+	}
+}
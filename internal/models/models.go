@@ -2,31 +2,33 @@ package models
 
 import (
 	"time"
+
+	"leo-bot/internal/state"
 )
 
-// MessageLog представляет запись о сообщении пользователя
+// MessageLog представляет запись о сообщении пользователя.
+// Состояние участника хранится в State; SickLeaveStartTime и SickLeaveEndTime лишь отмечают больничный
+// в текущем отсчете таймера, чтобы не засчитывать его в расчете оставшегося времени.
+// LastSpokeAt пуст у участников, которые вступили в чат, но еще ничего не писали
 type MessageLog struct {
-	UserID               int64     `json:"user_id" db:"user_id"`
-	ChatID               int64     `json:"chat_id" db:"chat_id"`
-	Username             string    `json:"username" db:"username"`
-	Calories             int       `json:"calories" db:"calories"`
-	StreakDays           int       `json:"streak_days" db:"streak_days"`
-	CalorieStreakDays    int       `json:"calorie_streak_days" db:"calorie_streak_days"`
-	CupsEarned           int       `json:"cups_earned" db:"cups_earned"`
-	LastTrainingDate     *string   `json:"last_training_date" db:"last_training_date"`
-	LastMessage          string    `json:"last_message" db:"last_message"`
-	HasTrainingDone      bool      `json:"has_training_done" db:"has_training_done"`
-	HasSickLeave         bool      `json:"has_sick_leave" db:"has_sick_leave"`
-	HasHealthy           bool      `json:"has_healthy" db:"has_healthy"`
-	IsDeleted            bool      `json:"is_deleted" db:"is_deleted"`
-	IsExemptFromDeletion bool      `json:"is_exempt_from_deletion" db:"is_exempt_from_deletion"`
-	TimerStartTime       *string   `json:"timer_start_time" db:"timer_start_time"`
-	SickLeaveStartTime   *string   `json:"sick_leave_start_time" db:"sick_leave_start_time"`
-	SickLeaveEndTime     *string   `json:"sick_leave_end_time" db:"sick_leave_end_time"`
-	SickTime             *string   `json:"sick_time" db:"sick_time"`
-	RestTimeTillDel      *string   `json:"rest_time_till_del" db:"rest_time_till_del"`
-	CreatedAt            time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt            time.Time `json:"updated_at" db:"updated_at"`
+	UserID             int64       `json:"user_id" db:"user_id"`
+	ChatID             int64       `json:"chat_id" db:"chat_id"`
+	Username           string      `json:"username" db:"username"`
+	Calories           int         `json:"calories" db:"calories"`
+	StreakDays         int         `json:"streak_days" db:"streak_days"`
+	CalorieStreakDays  int         `json:"calorie_streak_days" db:"calorie_streak_days"`
+	CupsEarned         int         `json:"cups_earned" db:"cups_earned"`
+	LastTrainingDate   *string     `json:"last_training_date" db:"last_training_date"`
+	LastMessage        string      `json:"last_message" db:"last_message"`
+	State              state.State `json:"state" db:"state"`
+	TimerStartTime     *string     `json:"timer_start_time" db:"timer_start_time"`
+	SickLeaveStartTime *string     `json:"sick_leave_start_time" db:"sick_leave_start_time"`
+	SickLeaveEndTime   *string     `json:"sick_leave_end_time" db:"sick_leave_end_time"`
+	SickTime           *string     `json:"sick_time" db:"sick_time"`
+	RestTimeTillDel    *string     `json:"rest_time_till_del" db:"rest_time_till_del"`
+	LastSpokeAt        *time.Time  `json:"last_spoke_at" db:"last_spoke_at"`
+	CreatedAt          time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time   `json:"updated_at" db:"updated_at"`
 }
 
 // TrainingLog представляет отчет о тренировке
@@ -54,3 +56,306 @@ type TimerInfo struct {
 	RemovalTask    chan bool
 	TimerStartTime string
 }
+
+// Валюты журнала начислений
+const (
+	CurrencyCalories = "calories"
+	CurrencyCups     = "cups"
+	// CurrencyStreak — ручные изменения серии тренировок, баланса у нее нет
+	CurrencyStreak = "streak"
+)
+
+// Причины начислений и списаний в журнале
+const (
+	LedgerReasonTraining        = "training"
+	LedgerReasonDoubleTraining  = "double_training"
+	LedgerReasonWeeklyStreak    = "weekly_streak"
+	LedgerReasonTwoWeekStreak   = "two_week_streak"
+	LedgerReasonThreeWeekStreak = "three_week_streak"
+	LedgerReasonMonthlyStreak   = "monthly_streak"
+	LedgerReasonQuarterlyStreak = "quarterly_streak"
+	LedgerReasonExchange        = "exchange"
+	LedgerReasonOpeningBalance  = "opening_balance"
+	LedgerReasonChallenge       = "challenge"
+	LedgerReasonKudos           = "kudos"
+	LedgerReasonPardonReset     = "pardon_reset"
+	LedgerReasonAdminAdjust     = "admin_adjust"
+	LedgerReasonSetStreak       = "set_streak"
+)
+
+// TrainingReport представляет одну запись истории отчетов о тренировках
+type TrainingReport struct {
+	ID         int64     `json:"id" db:"id"`
+	UserID     int64     `json:"user_id" db:"user_id"`
+	ChatID     int64     `json:"chat_id" db:"chat_id"`
+	ReportDate string    `json:"report_date" db:"report_date"`
+	StreakDays int       `json:"streak_days" db:"streak_days"`
+	Tags       []string  `json:"tags" db:"tags"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// LeaderboardMetric определяет, по какому показателю строится топ
+type LeaderboardMetric string
+
+const (
+	MetricTrainings LeaderboardMetric = "trainings"
+	MetricCalories  LeaderboardMetric = "calories"
+	MetricCups      LeaderboardMetric = "cups"
+	MetricStreak    LeaderboardMetric = "streak"
+	MetricKudos     LeaderboardMetric = "kudos"
+)
+
+// LeaderboardEntry представляет строку топа
+type LeaderboardEntry struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Value    int    `json:"value"`
+}
+
+// Season представляет соревновательный сезон чата
+type Season struct {
+	ID       int64     `json:"id" db:"id"`
+	ChatID   int64     `json:"chat_id" db:"chat_id"`
+	Name     string    `json:"name" db:"name"`
+	StartsAt time.Time `json:"starts_at" db:"starts_at"`
+	EndsAt   time.Time `json:"ends_at" db:"ends_at"`
+	IsClosed bool      `json:"is_closed" db:"is_closed"`
+}
+
+// HallOfFameEntry представляет призера завершенного сезона
+type HallOfFameEntry struct {
+	SeasonID   int64  `json:"season_id" db:"season_id"`
+	SeasonName string `json:"season_name" db:"season_name"`
+	ChatID     int64  `json:"chat_id" db:"chat_id"`
+	UserID     int64  `json:"user_id" db:"user_id"`
+	Username   string `json:"username" db:"username"`
+	Place      int    `json:"place" db:"place"`
+	Points     int    `json:"points" db:"points"`
+}
+
+// Team представляет команду внутри чата
+type Team struct {
+	ID        int64     `json:"id" db:"id"`
+	ChatID    int64     `json:"chat_id" db:"chat_id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedBy int64     `json:"created_by" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// TeamStanding представляет строку командного зачета
+type TeamStanding struct {
+	TeamID    int64  `json:"team_id"`
+	Name      string `json:"name"`
+	Members   int    `json:"members"`
+	Trainings int    `json:"trainings"`
+}
+
+// Challenge представляет групповой челлендж с ограниченным сроком
+type Challenge struct {
+	ID         int64     `json:"id" db:"id"`
+	ChatID     int64     `json:"chat_id" db:"chat_id"`
+	Title      string    `json:"title" db:"title"`
+	Tag        string    `json:"tag" db:"tag"` // пустой тег — засчитывается любая тренировка
+	Target     int       `json:"target" db:"target"`
+	RewardCups int       `json:"reward_cups" db:"reward_cups"`
+	StartsAt   time.Time `json:"starts_at" db:"starts_at"`
+	EndsAt     time.Time `json:"ends_at" db:"ends_at"`
+	CreatedBy  int64     `json:"created_by" db:"created_by"`
+	IsFinished bool      `json:"is_finished" db:"is_finished"`
+}
+
+// ChallengeProgress представляет прогресс участника челленджа
+type ChallengeProgress struct {
+	UserID      int64      `json:"user_id"`
+	Username    string     `json:"username"`
+	Progress    int        `json:"progress"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// Kudos представляет благодарность одного участника другому за отчет о тренировке
+type Kudos struct {
+	ID              int64     `json:"id" db:"id"`
+	ChatID          int64     `json:"chat_id" db:"chat_id"`
+	GiverID         int64     `json:"giver_id" db:"giver_id"`
+	ReceiverID      int64     `json:"receiver_id" db:"receiver_id"`
+	ReportMessageID int       `json:"report_message_id" db:"report_message_id"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// KudosStats представляет количество полученных и отданных кудосов участника
+type KudosStats struct {
+	Received int `json:"received"`
+	Given    int `json:"given"`
+}
+
+// SickLeave представляет один эпизод больничного
+type SickLeave struct {
+	ID              int64      `json:"id" db:"id"`
+	UserID          int64      `json:"user_id" db:"user_id"`
+	ChatID          int64      `json:"chat_id" db:"chat_id"`
+	StartedAt       time.Time  `json:"started_at" db:"started_at"`
+	EndedAt         *time.Time `json:"ended_at" db:"ended_at"`
+	DurationSeconds *int64     `json:"duration_seconds" db:"duration_seconds"`
+	Reason          string     `json:"reason" db:"reason"`
+	LastRemindedAt  *time.Time `json:"last_reminded_at" db:"last_reminded_at"`
+}
+
+// Значения настроек чата по умолчанию
+const (
+	DefaultSickDaysPerYear          = 30
+	DefaultMaxSickLeaveDays         = 14
+	DefaultSickReminderIntervalDays = 3
+	DefaultVacationDaysPerYear      = 30
+	DefaultMaxVacationDays          = 21
+	DefaultRedirectOffTopicReports  = true
+)
+
+// ChatSettings представляет настройки чата, которые меняют администраторы
+type ChatSettings struct {
+	ChatID                   int64 `json:"chat_id" db:"chat_id"`
+	SickDaysPerYear          int   `json:"sick_days_per_year" db:"sick_days_per_year"`
+	MaxSickLeaveDays         int   `json:"max_sick_leave_days" db:"max_sick_leave_days"`
+	SickReminderIntervalDays int   `json:"sick_reminder_interval_days" db:"sick_reminder_interval_days"`
+	VacationDaysPerYear      int   `json:"vacation_days_per_year" db:"vacation_days_per_year"`
+	MaxVacationDays          int   `json:"max_vacation_days" db:"max_vacation_days"`
+	ReportTopicID            int   `json:"report_topic_id" db:"report_topic_id"`                       // 0 — отчеты принимаются в любой теме
+	AnnounceTopicID          int   `json:"announce_topic_id" db:"announce_topic_id"`                   // 0 — объявления в общей теме
+	RedirectOffTopicReports  bool  `json:"redirect_off_topic_reports" db:"redirect_off_topic_reports"` // подсказывать, куда отправить отчет
+}
+
+// Vacation представляет запланированный отпуск участника
+type Vacation struct {
+	ID         int64     `json:"id" db:"id"`
+	UserID     int64     `json:"user_id" db:"user_id"`
+	ChatID     int64     `json:"chat_id" db:"chat_id"`
+	StartsAt   time.Time `json:"starts_at" db:"starts_at"`
+	EndsAt     time.Time `json:"ends_at" db:"ends_at"`
+	IsStarted  bool      `json:"is_started" db:"is_started"`
+	IsFinished bool      `json:"is_finished" db:"is_finished"`
+}
+
+// Действия, которые записываются в журнал аудита
+const (
+	AuditSetExempt        = "set_exempt"
+	AuditRemoveExempt     = "remove_exempt"
+	AuditStartTimer       = "start_timer"
+	AuditSendToChat       = "send_to_chat"
+	AuditPardon           = "pardon"
+	AuditSettings         = "settings"
+	AuditSeasonStart      = "season_start"
+	AuditSeasonEnd        = "season_end"
+	AuditTeamCreate       = "team_create"
+	AuditTeamDelete       = "team_delete"
+	AuditTeamAssign       = "team_assign"
+	AuditChallengeCreate  = "challenge_create"
+	AuditAdjust           = "adjust"
+	AuditSetStreak        = "set_streak"
+	AuditWarning          = "warning"
+	AuditRemoval          = "removal"
+	AuditRemovalFailed    = "removal_failed"
+	AuditSickLeaveExpired = "sick_leave_expired"
+	// AuditBotStatus — бота добавили в чат, удалили или изменили его права
+	AuditBotStatus = "bot_status"
+	// AuditChatMigrated — группа стала супергруппой, данные перенесены на новый ID
+	AuditChatMigrated = "chat_migrated"
+	// AuditHashtagAlias — добавлен или удален псевдоним служебного хештега
+	AuditHashtagAlias = "hashtag_alias"
+)
+
+// AuditActions — все действия журнала аудита, по ним фильтрует /audit
+var AuditActions = []string{
+	AuditSetExempt, AuditRemoveExempt, AuditStartTimer, AuditSendToChat, AuditPardon, AuditSettings,
+	AuditSeasonStart, AuditSeasonEnd, AuditTeamCreate, AuditTeamDelete, AuditTeamAssign, AuditChallengeCreate,
+	AuditAdjust, AuditSetStreak, AuditHashtagAlias,
+	AuditWarning, AuditRemoval, AuditRemovalFailed, AuditSickLeaveExpired, AuditBotStatus, AuditChatMigrated,
+}
+
+// AuditEntry представляет запись журнала аудита. ActorID = 0 — действие выполнил бот
+type AuditEntry struct {
+	ID           int64     `json:"id" db:"id"`
+	ChatID       int64     `json:"chat_id" db:"chat_id"`
+	ActorID      int64     `json:"actor_id" db:"actor_id"`
+	ActorName    string    `json:"actor_name" db:"actor_name"`
+	Action       string    `json:"action" db:"action"`
+	TargetUserID int64     `json:"target_user_id" db:"target_user_id"`
+	TargetName   string    `json:"target_name" db:"target_name"`
+	Arguments    string    `json:"arguments" db:"arguments"`
+	Reason       string    `json:"reason" db:"reason"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// AuditFilter задает выборку журнала аудита. Нулевые поля не фильтруют
+type AuditFilter struct {
+	ChatID       int64
+	TargetUserID int64
+	ActorName    string
+	Actions      []string
+	Since        time.Time
+	Limit        int
+}
+
+// События состава чата
+const (
+	MemberEventJoin  = "join"
+	MemberEventLeave = "leave"
+	MemberEventKick  = "kick"
+)
+
+// Источники событий состава: служебное сообщение в чате или обновление chat_member
+const (
+	MemberEventSourceMessage    = "message"
+	MemberEventSourceChatMember = "chat_member"
+)
+
+// MemberEvent представляет вступление или выход участника, о котором сообщил Telegram.
+// ActorID — кто выполнил действие (совпадает с UserID, если участник вступил или вышел сам)
+type MemberEvent struct {
+	ID        int64     `json:"id" db:"id"`
+	ChatID    int64     `json:"chat_id" db:"chat_id"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+	Username  string    `json:"username" db:"username"`
+	Event     string    `json:"event" db:"event"`
+	Source    string    `json:"source" db:"source"`
+	ActorID   int64     `json:"actor_id" db:"actor_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// RosterEntry представляет участника в отчете /roster
+type RosterEntry struct {
+	UserID      int64       `json:"user_id"`
+	Username    string      `json:"username"`
+	State       state.State `json:"state"`
+	LastSpokeAt *time.Time  `json:"last_spoke_at"`
+	FirstSeenAt time.Time   `json:"first_seen_at"`
+	LeftAt      *time.Time  `json:"left_at"` // последний выход или удаление по member_events
+}
+
+// Статусы бота в чате
+const (
+	// BotStatusActive — бот администратор с правом банить, таймеры идут
+	BotStatusActive = "active"
+	// BotStatusLimited — бот в чате, но удалять неактивных не может, таймеры стоят
+	BotStatusLimited = "limited"
+	// BotStatusRemoved — бота удалили из чата, таймеры стоят
+	BotStatusRemoved = "removed"
+)
+
+// Chat представляет чат, в который добавлен бот
+type Chat struct {
+	ChatID    int64     `json:"chat_id" db:"chat_id"`
+	Title     string    `json:"title" db:"title"`
+	BotStatus string    `json:"bot_status" db:"bot_status"`
+	CanBan    bool      `json:"can_ban" db:"can_ban"`
+	AddedBy   int64     `json:"added_by" db:"added_by"` // 0 — неизвестно
+	AddedAt   time.Time `json:"added_at" db:"added_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ChatPause представляет период, когда таймеры всего чата стояли
+type ChatPause struct {
+	ID        int64      `json:"id" db:"id"`
+	ChatID    int64      `json:"chat_id" db:"chat_id"`
+	StartedAt time.Time  `json:"started_at" db:"started_at"`
+	EndedAt   *time.Time `json:"ended_at" db:"ended_at"`
+	Reason    string     `json:"reason" db:"reason"` // статус бота, из-за которого таймеры остановлены
+}
@@ -0,0 +1,92 @@
+package outbox
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter — token bucket: burst запросов подряд, дальше rate запросов в секунду.
+// После 429 весь limiter стоит до blockedUntil
+type limiter struct {
+	mu           sync.Mutex
+	rate         float64
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// newLimiter создает limiter с полным запасом. rate <= 0 — без ограничений
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// reserve забирает токен, если он есть, и возвращает 0. Иначе возвращает, сколько ждать до следующей попытки
+func (l *limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.refill(now)
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// refill пополняет запас за время с прошлого обращения. Вызывается под mu
+func (l *limiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// wait ждет, пока можно будет отправить запрос, и забирает токен
+func (l *limiter) wait() {
+	for {
+		delay := l.reserve(time.Now())
+		if delay <= 0 {
+			return
+		}
+		time.Sleep(delay)
+	}
+}
+
+// block запрещает запросы до until, например по retry_after
+func (l *limiter) block(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// idle сообщает, что limiter вернулся в начальное состояние и его можно выбросить
+func (l *limiter) idle(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.blockedUntil) {
+		return false
+	}
+	if l.rate <= 0 {
+		return true
+	}
+	l.refill(now)
+	return l.tokens >= l.burst
+}
@@ -0,0 +1,267 @@
+// Package outbox — очередь исходящих запросов к Telegram. Запросы одного чата выполняются строго по порядку,
+// общий и початовый лимиты не дают упереться во flood control, ответ 429 с retry_after останавливает чат
+// на указанное время, а временные ошибки повторяются с экспоненциальной задержкой
+package outbox
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"leo-bot/internal/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ErrClosed — очередь закрыта и новые запросы не принимает
+var ErrClosed = errors.New("outbox is closed")
+
+// ErrQueueFull — в очереди чата слишком много неотправленных запросов
+var ErrQueueFull = errors.New("outbox chat queue is full")
+
+// Config задает лимиты и повторы очереди
+type Config struct {
+	// GlobalRate и GlobalBurst — запросов в секунду на весь бот и сколько можно отправить подряд
+	GlobalRate  float64
+	GlobalBurst int
+	// ChatRate и ChatBurst — то же для одного чата
+	ChatRate  float64
+	ChatBurst int
+	// MaxAttempts — сколько раз пробовать запрос, включая первый
+	MaxAttempts int
+	// BaseBackoff и MaxBackoff — задержка перед первым повтором и ее верхняя граница
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// MaxQueuedPerChat — сколько запросов может ждать отправки в одном чате
+	MaxQueuedPerChat int
+}
+
+// DefaultConfig возвращает лимиты Telegram: около 30 сообщений в секунду на бота и 20 в минуту на группу
+func DefaultConfig() Config {
+	return Config{
+		GlobalRate:       30,
+		GlobalBurst:      30,
+		ChatRate:         20.0 / 60.0,
+		ChatBurst:        20,
+		MaxAttempts:      5,
+		BaseBackoff:      time.Second,
+		MaxBackoff:       30 * time.Second,
+		MaxQueuedPerChat: 1000,
+	}
+}
+
+// Metrics — счетчики очереди с момента запуска
+type Metrics struct {
+	Sent        int64 // выполнено успешно
+	Failed      int64 // не выполнено после всех попыток или из-за постоянной ошибки
+	Retried     int64 // повторов после временных ошибок и 429
+	RateLimited int64 // ответов 429 от Telegram
+	Rejected    int64 // не принято: очередь закрыта или переполнена
+	Queued      int64 // ждут отправки сейчас
+}
+
+// job — запрос в очереди и канал для его результата
+type job struct {
+	call func() error
+	done chan error
+}
+
+// chatQueue — запросы одного чата. Пока running, их по порядку выполняет одна горутина
+type chatQueue struct {
+	jobs    []*job
+	limiter *limiter
+	running bool
+}
+
+// Outbox — очередь исходящих запросов
+type Outbox struct {
+	cfg    Config
+	logger logger.Logger
+	global *limiter
+
+	mu     sync.Mutex
+	chats  map[int64]*chatQueue
+	closed bool
+	wg     sync.WaitGroup
+
+	sent, failed, retried, rateLimited, rejected, queued int64
+}
+
+// New создает очередь с заданными лимитами
+func New(cfg Config, log logger.Logger) *Outbox {
+	return &Outbox{
+		cfg:    cfg,
+		logger: log,
+		global: newLimiter(cfg.GlobalRate, cfg.GlobalBurst),
+		chats:  make(map[int64]*chatQueue),
+	}
+}
+
+// Do ставит запрос в очередь чата и ждет, пока он будет выполнен или окончательно не удастся.
+// chatID = 0 — запрос без чата, на него действует только общий лимит
+func (o *Outbox) Do(chatID int64, call func() error) error {
+	return <-o.Post(chatID, call)
+}
+
+// Post ставит запрос в очередь чата и сразу возвращает канал, в который придет результат
+func (o *Outbox) Post(chatID int64, call func() error) <-chan error {
+	j := &job{call: call, done: make(chan error, 1)}
+
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		atomic.AddInt64(&o.rejected, 1)
+		j.done <- ErrClosed
+		return j.done
+	}
+	queue, ok := o.chats[chatID]
+	if !ok {
+		queue = &chatQueue{limiter: o.chatLimiter(chatID)}
+		o.chats[chatID] = queue
+	}
+	if o.cfg.MaxQueuedPerChat > 0 && len(queue.jobs) >= o.cfg.MaxQueuedPerChat {
+		o.mu.Unlock()
+		atomic.AddInt64(&o.rejected, 1)
+		j.done <- ErrQueueFull
+		return j.done
+	}
+	queue.jobs = append(queue.jobs, j)
+	atomic.AddInt64(&o.queued, 1)
+	if !queue.running {
+		queue.running = true
+		o.wg.Add(1)
+		go o.run(chatID, queue)
+	}
+	o.mu.Unlock()
+
+	return j.done
+}
+
+// chatLimiter создает лимит очереди чата. У запросов без чата (ответы на кнопки, меню команд)
+// початового лимита нет: limiter без скорости только останавливает очередь по retry_after
+func (o *Outbox) chatLimiter(chatID int64) *limiter {
+	if chatID == 0 {
+		return newLimiter(0, 1)
+	}
+	return newLimiter(o.cfg.ChatRate, o.cfg.ChatBurst)
+}
+
+// Close перестает принимать запросы и ждет, пока будут выполнены уже поставленные
+func (o *Outbox) Close() {
+	o.mu.Lock()
+	o.closed = true
+	o.mu.Unlock()
+
+	o.wg.Wait()
+}
+
+// Metrics возвращает текущие счетчики очереди
+func (o *Outbox) Metrics() Metrics {
+	return Metrics{
+		Sent:        atomic.LoadInt64(&o.sent),
+		Failed:      atomic.LoadInt64(&o.failed),
+		Retried:     atomic.LoadInt64(&o.retried),
+		RateLimited: atomic.LoadInt64(&o.rateLimited),
+		Rejected:    atomic.LoadInt64(&o.rejected),
+		Queued:      atomic.LoadInt64(&o.queued),
+	}
+}
+
+// run выполняет запросы чата по порядку, пока очередь не опустеет
+func (o *Outbox) run(chatID int64, queue *chatQueue) {
+	defer o.wg.Done()
+
+	for {
+		o.mu.Lock()
+		if len(queue.jobs) == 0 {
+			queue.running = false
+			// Пустую очередь убираем, чтобы не копить лимитеры всех чатов, куда бот когда-то писал
+			if queue.limiter.idle(time.Now()) {
+				delete(o.chats, chatID)
+			}
+			o.mu.Unlock()
+			return
+		}
+		j := queue.jobs[0]
+		queue.jobs = queue.jobs[1:]
+		o.mu.Unlock()
+
+		err := o.execute(chatID, queue.limiter, j.call)
+		atomic.AddInt64(&o.queued, -1)
+		if err != nil {
+			atomic.AddInt64(&o.failed, 1)
+			o.logger.Errorf("Outbox: request to chat %d failed: %v", chatID, err)
+		} else {
+			atomic.AddInt64(&o.sent, 1)
+		}
+		j.done <- err
+	}
+}
+
+// execute выполняет запрос с учетом лимитов и повторяет его после 429 и временных ошибок
+func (o *Outbox) execute(chatID int64, chatLimiter *limiter, call func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		chatLimiter.wait()
+		o.global.wait()
+
+		err = call()
+		if err == nil || attempt >= o.cfg.MaxAttempts {
+			return err
+		}
+
+		if retryAfter := RetryAfter(err); retryAfter > 0 {
+			atomic.AddInt64(&o.rateLimited, 1)
+			atomic.AddInt64(&o.retried, 1)
+			o.logger.Warnf("Outbox: chat %d hit flood control, retrying in %v", chatID, retryAfter)
+			// Лимит может быть как у чата, так и у всего бота — сам Telegram этого не сообщает
+			chatLimiter.block(time.Now().Add(retryAfter))
+			if chatID == 0 {
+				o.global.block(time.Now().Add(retryAfter))
+			}
+			continue
+		}
+
+		if !IsTemporary(err) {
+			return err
+		}
+
+		atomic.AddInt64(&o.retried, 1)
+		delay := o.backoff(attempt)
+		o.logger.Warnf("Outbox: request to chat %d failed (attempt %d), retrying in %v: %v", chatID, attempt, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// backoff возвращает задержку перед повтором: BaseBackoff, 2×BaseBackoff, 4×... но не больше MaxBackoff
+func (o *Outbox) backoff(attempt int) time.Duration {
+	delay := o.cfg.BaseBackoff
+	for i := 1; i < attempt && delay < o.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > o.cfg.MaxBackoff {
+		delay = o.cfg.MaxBackoff
+	}
+	return delay
+}
+
+// RetryAfter возвращает, сколько Telegram просит подождать после ответа 429, или 0
+func RetryAfter(err error) time.Duration {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second
+	}
+	return 0
+}
+
+// IsTemporary сообщает, имеет ли смысл повторить запрос: ошибки сети и 5xx Telegram временные,
+// а 400 и 403 (чат не найден, бота заблокировали) повтор не исправит
+func IsTemporary(err error) bool {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	return apiErr.Code >= http.StatusInternalServerError || apiErr.Code == http.StatusTooManyRequests
+}
@@ -0,0 +1,283 @@
+package outbox
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"leo-bot/internal/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeAPI записывает вызовы и по очереди возвращает заготовленные ошибки
+type fakeAPI struct {
+	mu     sync.Mutex
+	calls  []fakeCall
+	errors map[int64][]error
+}
+
+type fakeCall struct {
+	ChatID int64
+	Text   string
+	At     time.Time
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{errors: make(map[int64][]error)}
+}
+
+// fail заставляет следующие запросы в чат вернуть эти ошибки
+func (f *fakeAPI) fail(chatID int64, errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors[chatID] = append(f.errors[chatID], errs...)
+}
+
+// send возвращает запрос в чат, который фейк выполнит при вызове
+func (f *fakeAPI) send(chatID int64, text string) func() error {
+	return func() error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.calls = append(f.calls, fakeCall{ChatID: chatID, Text: text, At: time.Now()})
+		if errs := f.errors[chatID]; len(errs) > 0 {
+			f.errors[chatID] = errs[1:]
+			return errs[0]
+		}
+		return nil
+	}
+}
+
+func (f *fakeAPI) callsTo(chatID int64) []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []fakeCall
+	for _, call := range f.calls {
+		if call.ChatID == chatID {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// fastConfig — конфигурация без ощутимых задержек
+func fastConfig() Config {
+	return Config{
+		GlobalRate:       0,
+		GlobalBurst:      1,
+		ChatRate:         0,
+		ChatBurst:        1,
+		MaxAttempts:      3,
+		BaseBackoff:      time.Millisecond,
+		MaxBackoff:       5 * time.Millisecond,
+		MaxQueuedPerChat: 100,
+	}
+}
+
+func newTestOutbox(cfg Config) *Outbox {
+	return New(cfg, logger.New("error"))
+}
+
+func TestOutboxPreservesOrderPerChat(t *testing.T) {
+	api := newFakeAPI()
+	o := newTestOutbox(fastConfig())
+
+	texts := []string{"1", "2", "3", "4", "5", "6", "7", "8"}
+	var results []<-chan error
+	for _, text := range texts {
+		results = append(results, o.Post(-100, api.send(-100, text)))
+	}
+	// Временная ошибка на первом сообщении не должна пропустить вперед следующие
+	api.fail(-100, errors.New("connection reset"))
+
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	var delivered []string
+	for _, call := range api.callsTo(-100) {
+		if len(delivered) == 0 || delivered[len(delivered)-1] != call.Text {
+			delivered = append(delivered, call.Text)
+		}
+	}
+	if len(delivered) != len(texts) {
+		t.Fatalf("Expected %d messages, got %v", len(texts), delivered)
+	}
+	for i := range texts {
+		if delivered[i] != texts[i] {
+			t.Fatalf("Messages reordered: %v", delivered)
+		}
+	}
+}
+
+func TestOutboxHonoursRetryAfter(t *testing.T) {
+	api := newFakeAPI()
+	o := newTestOutbox(fastConfig())
+	api.fail(-100, &tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 1}})
+
+	if err := o.Do(-100, api.send(-100, "report")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	calls := api.callsTo(-100)
+	if len(calls) != 2 {
+		t.Fatalf("Expected a retry after 429, got %d calls", len(calls))
+	}
+	if waited := calls[1].At.Sub(calls[0].At); waited < time.Second {
+		t.Errorf("Expected to wait retry_after (1s), waited %v", waited)
+	}
+
+	metrics := o.Metrics()
+	if metrics.RateLimited != 1 || metrics.Retried != 1 || metrics.Sent != 1 || metrics.Queued != 0 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+}
+
+func TestOutboxRetriesTemporaryErrors(t *testing.T) {
+	api := newFakeAPI()
+	o := newTestOutbox(fastConfig())
+	api.fail(-100, errors.New("connection reset"), &tgbotapi.Error{Code: 502, Message: "Bad Gateway"})
+
+	if err := o.Do(-100, api.send(-100, "report")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls := len(api.callsTo(-100)); calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+	if metrics := o.Metrics(); metrics.Retried != 2 || metrics.Sent != 1 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+}
+
+func TestOutboxGivesUp(t *testing.T) {
+	api := newFakeAPI()
+	o := newTestOutbox(fastConfig())
+
+	// Постоянная ошибка не повторяется
+	forbidden := &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}
+	api.fail(42, forbidden)
+	if err := o.Do(42, api.send(42, "dm")); !errors.Is(err, forbidden) {
+		t.Fatalf("Expected forbidden error, got %v", err)
+	}
+	if calls := len(api.callsTo(42)); calls != 1 {
+		t.Errorf("Expected no retries for 403, got %d calls", calls)
+	}
+
+	// Временная ошибка повторяется не больше MaxAttempts раз
+	api.fail(-100, errors.New("timeout"), errors.New("timeout"), errors.New("timeout"), errors.New("timeout"))
+	if err := o.Do(-100, api.send(-100, "report")); err == nil {
+		t.Fatal("Expected error after all attempts")
+	}
+	if calls := len(api.callsTo(-100)); calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+
+	if metrics := o.Metrics(); metrics.Failed != 2 || metrics.Sent != 0 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+}
+
+func TestOutboxRateLimitsPerChat(t *testing.T) {
+	api := newFakeAPI()
+	cfg := fastConfig()
+	cfg.ChatRate = 20 // 50ms между сообщениями чата после первого
+	o := newTestOutbox(cfg)
+
+	start := time.Now()
+	var results []<-chan error
+	for i := 0; i < 5; i++ {
+		results = append(results, o.Post(-100, api.send(-100, "slow")))
+	}
+	// Другой чат не ждет очереди первого
+	if err := o.Do(-200, api.send(-200, "fast")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Other chat waited for a limited chat: %v", elapsed)
+	}
+
+	for _, result := range results {
+		<-result
+	}
+	calls := api.callsTo(-100)
+	if spread := calls[len(calls)-1].At.Sub(calls[0].At); spread < 190*time.Millisecond {
+		t.Errorf("Expected 5 messages to take at least 200ms at 20/s, took %v", spread)
+	}
+}
+
+func TestOutboxSkipsChatLimitWithoutChat(t *testing.T) {
+	api := newFakeAPI()
+	cfg := fastConfig()
+	cfg.ChatRate = 1 // секунда между сообщениями чата после первого
+	o := newTestOutbox(cfg)
+
+	// Ответы на кнопки и меню команд идут без чата: на них действует только общий лимит
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := o.Do(0, api.send(0, "callback")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Requests without chat waited for the chat limit: %v", elapsed)
+	}
+}
+
+func TestOutboxCloseDrainsQueue(t *testing.T) {
+	api := newFakeAPI()
+	cfg := fastConfig()
+	cfg.ChatRate = 100
+	o := newTestOutbox(cfg)
+
+	var results []<-chan error
+	for i := 0; i < 5; i++ {
+		results = append(results, o.Post(-100, api.send(-100, "queued")))
+	}
+	o.Close()
+
+	if calls := len(api.callsTo(-100)); calls != 5 {
+		t.Errorf("Expected queued messages to be sent before close, got %d", calls)
+	}
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+
+	if err := o.Do(-100, api.send(-100, "late")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after close, got %v", err)
+	}
+	if metrics := o.Metrics(); metrics.Rejected != 1 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+}
+
+func TestOutboxQueueFull(t *testing.T) {
+	api := newFakeAPI()
+	cfg := fastConfig()
+	cfg.ChatRate = 1
+	cfg.MaxQueuedPerChat = 2
+	o := newTestOutbox(cfg)
+
+	// Первый запрос сразу забирает воркер, следующие два ждут лимита и заполняют очередь
+	first := o.Post(-100, api.send(-100, "1"))
+	<-first
+	o.Post(-100, api.send(-100, "2"))
+	o.Post(-100, api.send(-100, "3"))
+	if err := <-o.Post(-100, api.send(-100, "4")); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	o := newTestOutbox(Config{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := o.backoff(i + 1); got != want {
+			t.Errorf("backoff(%d) = %v, expected %v", i+1, got, want)
+		}
+	}
+}
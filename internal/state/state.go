@@ -0,0 +1,121 @@
+// Package state описывает состояние участника чата и допустимые переходы между состояниями
+package state
+
+import (
+	"errors"
+	"fmt"
+)
+
+// State — состояние участника чата
+type State string
+
+const (
+	// Active — участник в чате, таймер идет
+	Active State = "active"
+	// Sick — участник на больничном, таймер приостановлен
+	Sick State = "sick"
+	// Vacation — участник в отпуске, таймер приостановлен
+	Vacation State = "vacation"
+	// Exempt — участник исключен из удаления, таймера нет
+	Exempt State = "exempt"
+	// Removed — участник удален ботом за неактивность
+	Removed State = "removed"
+	// Left — участника нет в чате, но он может вернуться: вышел сам или был помилован после удаления
+	Left State = "left"
+)
+
+// Причины переходов, которые записываются в историю
+const (
+	ReasonMigration    = "migration"
+	ReasonJoined       = "joined"
+	ReasonMessage      = "message"
+	ReasonTrainingDone = "training_done"
+	ReasonSickLeave    = "sick_leave"
+	ReasonHealthy      = "healthy"
+	ReasonSickExpired  = "sick_leave_expired"
+	ReasonVacation     = "vacation_started"
+	ReasonVacationEnd  = "vacation_finished"
+	ReasonSetExempt    = "set_exempt"
+	ReasonRemoveExempt = "remove_exempt"
+	ReasonTimerExpired = "timer_expired"
+	ReasonLeftChat     = "left_chat"
+	ReasonPardon       = "pardon"
+	ReasonKicked       = "kicked_by_admin"
+)
+
+// ErrInvalidTransition — переход между состояниями запрещен
+var ErrInvalidTransition = errors.New("invalid member state transition")
+
+// transitions — разрешенные переходы из каждого состояния
+var transitions = map[State][]State{
+	Active:   {Sick, Vacation, Exempt, Removed, Left},
+	Sick:     {Active, Vacation, Exempt, Removed, Left},
+	Vacation: {Active, Sick, Exempt, Removed, Left},
+	Exempt:   {Active, Removed, Left},
+	Removed:  {Active, Left},
+	Left:     {Active, Removed},
+}
+
+// titles — названия состояний для сообщений бота
+var titles = map[State]string{
+	Active:   "в строю",
+	Sick:     "на больничном",
+	Vacation: "в отпуске",
+	Exempt:   "исключен из удаления",
+	Removed:  "удален",
+	Left:     "вышел из чата",
+}
+
+// Parse разбирает состояние из строки, сохраненной в БД
+func Parse(s string) (State, error) {
+	state := State(s)
+	if !state.Valid() {
+		return "", fmt.Errorf("unknown member state: %q", s)
+	}
+	return state, nil
+}
+
+// Valid проверяет, что состояние известно
+func (s State) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// Title возвращает название состояния для сообщений бота
+func (s State) Title() string {
+	if title, ok := titles[s]; ok {
+		return title
+	}
+	return string(s)
+}
+
+// InChat сообщает, находится ли участник в чате
+func (s State) InChat() bool {
+	return s != Removed && s != Left
+}
+
+// TimerRuns сообщает, должен ли в этом состоянии идти таймер неактивности
+func (s State) TimerRuns() bool {
+	return s == Active
+}
+
+// CanTransition проверяет, разрешен ли переход from -> to. Переход в то же состояние разрешен всегда
+func CanTransition(from, to State) bool {
+	if from == to {
+		return from.Valid()
+	}
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition возвращает ErrInvalidTransition, если переход from -> to запрещен
+func Transition(from, to State) error {
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package state
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"active", "sick", "vacation", "exempt", "removed", "left"} {
+		if _, err := Parse(s); err != nil {
+			t.Errorf("Expected %q to be valid: %v", s, err)
+		}
+	}
+
+	if _, err := Parse("deleted"); err == nil {
+		t.Error("Expected error for unknown state")
+	}
+}
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		from, to State
+		allowed  bool
+	}{
+		{Active, Sick, true},
+		{Sick, Active, true},
+		{Sick, Vacation, true},
+		{Vacation, Active, true},
+		{Active, Removed, true},
+		{Removed, Active, true},
+		{Left, Active, true},
+		{Active, Active, true},
+		{Removed, Sick, false},
+		{Removed, Left, true},
+		{Removed, Vacation, false},
+		{Exempt, Sick, false},
+		{Exempt, Vacation, false},
+		{Left, Sick, false},
+	}
+
+	for _, tt := range tests {
+		err := Transition(tt.from, tt.to)
+		if tt.allowed && err != nil {
+			t.Errorf("Expected %s -> %s to be allowed, got %v", tt.from, tt.to, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("Expected %s -> %s to be rejected, got %v", tt.from, tt.to, err)
+		}
+	}
+
+	if CanTransition("deleted", "deleted") {
+		t.Error("Expected unknown state to be rejected")
+	}
+}
+
+func TestStateHelpers(t *testing.T) {
+	if !Active.TimerRuns() || Sick.TimerRuns() || Vacation.TimerRuns() || Exempt.TimerRuns() {
+		t.Error("Timer should run only for active members")
+	}
+	if Removed.InChat() || Left.InChat() || !Sick.InChat() {
+		t.Error("Only removed and left members are out of the chat")
+	}
+	if Sick.Title() != "на больничном" {
+		t.Errorf("Unexpected title: %s", Sick.Title())
+	}
+}
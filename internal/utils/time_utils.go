@@ -44,3 +44,45 @@ func GetMoscowDateFromTime(t time.Time) string {
 	return t.In(moscowLocation).Format("2006-01-02")
 }
 
+// FormatMoscowDateTime форматирует время в московском часовом поясе для сообщений бота: YYYY-MM-DD HH:MM
+func FormatMoscowDateTime(t time.Time) string {
+	return t.In(moscowLocation).Format("2006-01-02 15:04")
+}
+
+// StartOfMoscowDay возвращает начало суток (00:00 МСК) для указанного времени
+func StartOfMoscowDay(t time.Time) time.Time {
+	t = t.In(moscowLocation)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, moscowLocation)
+}
+
+// StartOfMoscowWeek возвращает начало недели (понедельник, 00:00 МСК) для указанного времени
+func StartOfMoscowWeek(t time.Time) time.Time {
+	t = t.In(moscowLocation)
+	// В Go неделя начинается с воскресенья, у нас — с понедельника
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, moscowLocation)
+}
+
+// StartOfMoscowMonth возвращает начало месяца (1-е число, 00:00 МСК) для указанного времени
+func StartOfMoscowMonth(t time.Time) time.Time {
+	t = t.In(moscowLocation)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, moscowLocation)
+}
+
+// StartOfMoscowQuarter возвращает начало календарного квартала (00:00 МСК) для указанного времени
+func StartOfMoscowQuarter(t time.Time) time.Time {
+	t = t.In(moscowLocation)
+	firstMonth := time.Month((int(t.Month())-1)/3*3 + 1)
+	return time.Date(t.Year(), firstMonth, 1, 0, 0, 0, 0, moscowLocation)
+}
+
+// StartOfMoscowYear возвращает начало календарного года (1 января, 00:00 МСК) для указанного времени
+func StartOfMoscowYear(t time.Time) time.Time {
+	t = t.In(moscowLocation)
+	return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, moscowLocation)
+}
+
+// ParseMoscowDate парсит дату в формате YYYY-MM-DD и возвращает полночь этой даты по Москве
+func ParseMoscowDate(dateStr string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", dateStr, moscowLocation)
+}
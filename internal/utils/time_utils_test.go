@@ -72,3 +72,81 @@ func TestGetMoscowDateFromTime(t *testing.T) {
 	}
 }
 
+func TestFormatMoscowDateTime(t *testing.T) {
+	utcTime := time.Date(2026, 10, 18, 21, 30, 0, 0, time.UTC)
+
+	// 21:30 UTC — это 00:30 следующего дня по Москве
+	if got := FormatMoscowDateTime(utcTime); got != "2026-10-19 00:30" {
+		t.Errorf("Expected 2026-10-19 00:30, got %s", got)
+	}
+}
+
+func TestStartOfMoscowWeek(t *testing.T) {
+	// Воскресенье 23:30 МСК относится к неделе, начавшейся в понедельник
+	sunday := time.Date(2026, 10, 18, 20, 30, 0, 0, time.UTC)
+	start := StartOfMoscowWeek(sunday)
+
+	if GetMoscowDateFromTime(start) != "2026-10-12" {
+		t.Errorf("Expected week start 2026-10-12, got %s", GetMoscowDateFromTime(start))
+	}
+	if start.Hour() != 0 || start.Minute() != 0 {
+		t.Errorf("Week should start at midnight, got %s", start.Format(time.RFC3339))
+	}
+
+	// Понедельник — сам себе начало недели
+	monday := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	if GetMoscowDateFromTime(StartOfMoscowWeek(monday)) != "2026-10-19" {
+		t.Errorf("Monday should start its own week, got %s", GetMoscowDateFromTime(StartOfMoscowWeek(monday)))
+	}
+}
+
+func TestStartOfMoscowMonth(t *testing.T) {
+	// 31 октября 22:00 UTC — это уже 1 ноября по Москве
+	lateNight := time.Date(2026, 10, 31, 22, 0, 0, 0, time.UTC)
+	start := StartOfMoscowMonth(lateNight)
+
+	if GetMoscowDateFromTime(start) != "2026-11-01" {
+		t.Errorf("Expected month start 2026-11-01, got %s", GetMoscowDateFromTime(start))
+	}
+}
+
+func TestStartOfMoscowQuarter(t *testing.T) {
+	start := StartOfMoscowQuarter(time.Date(2026, 11, 15, 12, 0, 0, 0, time.UTC))
+	if GetMoscowDateFromTime(start) != "2026-10-01" {
+		t.Errorf("Expected quarter start 2026-10-01, got %s", GetMoscowDateFromTime(start))
+	}
+
+	start = StartOfMoscowQuarter(time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC))
+	if GetMoscowDateFromTime(start) != "2026-01-01" {
+		t.Errorf("Expected quarter start 2026-01-01, got %s", GetMoscowDateFromTime(start))
+	}
+}
+
+func TestStartOfMoscowDayAndYear(t *testing.T) {
+	// 22:30 UTC 31 декабря — это уже 1 января по Москве
+	moment := time.Date(2026, 12, 31, 22, 30, 0, 0, time.UTC)
+
+	day := StartOfMoscowDay(moment)
+	if day.Format(time.RFC3339) != "2027-01-01T00:00:00+03:00" {
+		t.Errorf("Expected day start 2027-01-01T00:00:00+03:00, got %s", day.Format(time.RFC3339))
+	}
+
+	year := StartOfMoscowYear(moment)
+	if year.Format(time.RFC3339) != "2027-01-01T00:00:00+03:00" {
+		t.Errorf("Expected year start 2027-01-01T00:00:00+03:00, got %s", year.Format(time.RFC3339))
+	}
+}
+
+func TestParseMoscowDate(t *testing.T) {
+	date, err := ParseMoscowDate("2026-11-01")
+	if err != nil {
+		t.Fatalf("Failed to parse date: %v", err)
+	}
+	if date.Location().String() != "Europe/Moscow" || date.Hour() != 0 {
+		t.Errorf("Expected Moscow midnight, got %s", date.Format(time.RFC3339))
+	}
+
+	if _, err := ParseMoscowDate("01.11.2026"); err == nil {
+		t.Error("Expected error for wrong date format")
+	}
+}
@@ -0,0 +1,121 @@
+// Package webhook — прием обновлений Telegram по HTTP вместо long polling. Handler проверяет секретный
+// заголовок, который Telegram присылает с каждым запросом, и передает тело обновления дальше,
+// а Server останавливается, дождавшись уже принятых запросов
+package webhook
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"leo-bot/internal/logger"
+)
+
+// SecretHeader — заголовок с секретом, заданным в setWebhook
+const SecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// maxBodySize — обновления Telegram намного меньше, больше принимать незачем
+const maxBodySize = 1 << 20
+
+// shutdownTimeout — сколько ждать незавершенные запросы при остановке
+const shutdownTimeout = 10 * time.Second
+
+// Handler принимает обновления Telegram
+type Handler struct {
+	secret string
+	handle func(update json.RawMessage) error
+	logger logger.Logger
+}
+
+// NewHandler создает обработчик. handle получает тело одного обновления; если он вернул ошибку,
+// Telegram получит 503 и пришлет обновление повторно
+func NewHandler(secret string, handle func(update json.RawMessage) error, log logger.Logger) *Handler {
+	return &Handler{secret: secret, handle: handle, logger: log}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(SecretHeader)), []byte(h.secret)) != 1 {
+		h.logger.Warnf("Webhook: rejected request from %s with wrong secret token", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		h.logger.Errorf("Webhook: failed to read update: %v", err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var update struct {
+		UpdateID *int `json:"update_id"`
+	}
+	if err := json.Unmarshal(body, &update); err != nil || update.UpdateID == nil {
+		h.logger.Errorf("Webhook: invalid update: %v", err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.handle(body); err != nil {
+		h.logger.Errorf("Webhook: failed to handle update %d: %v", *update.UpdateID, err)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Server — HTTP-сервер для webhook
+type Server struct {
+	srv    *http.Server
+	logger logger.Logger
+}
+
+// NewServer создает сервер, который слушает addr и принимает обновления по path
+func NewServer(addr, path string, handler http.Handler, log logger.Logger) *Server {
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	return &Server{
+		srv: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		logger: log,
+	}
+}
+
+// Run принимает запросы, пока не будет отменен контекст, и затем дожидается уже начатых
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		s.logger.Infof("Webhook server listening on %s", s.srv.Addr)
+		errCh <- s.srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	s.logger.Info("Webhook server stopped")
+	return nil
+}
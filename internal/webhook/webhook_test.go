@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"leo-bot/internal/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// recordedUpdate — обновление в том виде, в каком его присылает Telegram: отчет в теме форума
+const recordedUpdate = `{
+	"update_id": 815274631,
+	"message": {
+		"message_id": 4821,
+		"message_thread_id": 17,
+		"is_topic_message": true,
+		"from": {"id": 123456789, "is_bot": false, "first_name": "Иван", "username": "ivan_runner", "language_code": "ru"},
+		"chat": {"id": -1001987654321, "title": "Стая Леопарда", "type": "supergroup", "is_forum": true},
+		"date": 1760791200,
+		"text": "#training_done пробежал 10 км",
+		"entities": [{"offset": 0, "length": 14, "type": "hashtag"}]
+	}
+}`
+
+func post(t *testing.T, h http.Handler, secret, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(SecretHeader, secret)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerDeliversUpdate(t *testing.T) {
+	var received []json.RawMessage
+	h := NewHandler("s3cr3t", func(update json.RawMessage) error {
+		received = append(received, update)
+		return nil
+	}, logger.New("error"))
+
+	rec := post(t, h, "s3cr3t", recordedUpdate)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 update, got %d", len(received))
+	}
+
+	var update tgbotapi.Update
+	if err := json.Unmarshal(received[0], &update); err != nil {
+		t.Fatalf("Failed to decode delivered update: %v", err)
+	}
+	if update.UpdateID != 815274631 || update.Message == nil {
+		t.Fatalf("Unexpected update: %+v", update)
+	}
+	if update.Message.Chat.ID != -1001987654321 || update.Message.From.ID != 123456789 {
+		t.Errorf("Unexpected message: chat %d, from %d", update.Message.Chat.ID, update.Message.From.ID)
+	}
+	if !strings.HasPrefix(update.Message.Text, "#training_done") {
+		t.Errorf("Unexpected text: %q", update.Message.Text)
+	}
+}
+
+func TestHandlerRejectsRequests(t *testing.T) {
+	handled := 0
+	h := NewHandler("s3cr3t", func(update json.RawMessage) error {
+		handled++
+		return nil
+	}, logger.New("error"))
+
+	tests := []struct {
+		name   string
+		secret string
+		body   string
+		code   int
+	}{
+		{"missing secret", "", recordedUpdate, http.StatusUnauthorized},
+		{"wrong secret", "guess", recordedUpdate, http.StatusUnauthorized},
+		{"invalid json", "s3cr3t", `{"update_id":`, http.StatusBadRequest},
+		{"not an update", "s3cr3t", `{"ok": true}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := post(t, h, tt.secret, tt.body); rec.Code != tt.code {
+				t.Errorf("Expected %d, got %d", tt.code, rec.Code)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/telegram", nil)
+	req.Header.Set(SecretHeader, "s3cr3t")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", rec.Code)
+	}
+
+	if handled != 0 {
+		t.Errorf("Rejected requests must not be handled, got %d", handled)
+	}
+}
+
+func TestHandlerAsksForRedelivery(t *testing.T) {
+	h := NewHandler("s3cr3t", func(update json.RawMessage) error {
+		return errors.New("bot is stopping")
+	}, logger.New("error"))
+
+	if rec := post(t, h, "s3cr3t", recordedUpdate); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 so that Telegram retries, got %d", rec.Code)
+	}
+}
+
+func TestServerStopsOnCancel(t *testing.T) {
+	h := NewHandler("s3cr3t", func(update json.RawMessage) error { return nil }, logger.New("error"))
+	s := NewServer("127.0.0.1:0", "/telegram", h, logger.New("error"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected graceful stop, got %v", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("Server did not stop")
+	}
+}